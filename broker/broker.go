@@ -0,0 +1,508 @@
+// Package broker provides a kite brokering events between kites: events
+// published to a named topic are kept by a Store and delivered to the
+// subscribers of the topic at least once, in order.
+//
+// The broker kite exports the methods:
+//
+//	broker.publish({topic, data})                 returns the offset of the event
+//	broker.subscribe({topic, group, from, onEvent})  returns the subscription ID
+//	broker.ack({topic, group, offset})            commits the offset of the group
+//	broker.unsubscribe({id})                      ends a subscription
+//
+// Subscribers belong to a consumer group. The broker stores the offset of
+// the last event acknowledged by each group, and delivers the events of a
+// topic to a new subscription of the group from the event following it, so
+// events are received again after a subscriber restarts or reconnects
+// unless they were acknowledged. Events not acknowledged within the ack
+// timeout are delivered again. Late joiners replay the events of a topic by
+// subscribing from an earlier offset.
+//
+// Publishers and subscribers find the broker registered to kontrol with
+// Find:
+//
+//	c, err := broker.Find(k)
+//	offset, err := broker.Publish(c, "builds", build)
+//
+//	s := &broker.Subscriber{Client: c, Topic: "builds", Group: "notifier", Handler: notify}
+//	err = s.Subscribe()
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// Name is the name the broker kite registers with.
+const Name = "broker"
+
+// Prefix is the prefix of the names of the broker methods.
+const Prefix = "broker."
+
+// Defaults of the Broker.
+const (
+	DefaultAckTimeout  = 30 * time.Second
+	DefaultMaxInFlight = 100
+)
+
+// Latest is the offset subscribing to the events published after the
+// subscription only.
+const Latest = -1
+
+// Event is an event published to a topic.
+type Event struct {
+	Topic  string          `json:"topic"`
+	Offset int64           `json:"offset"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Time   time.Time       `json:"time"`
+}
+
+// Unmarshal decodes the data of the event into v.
+func (e *Event) Unmarshal(v interface{}) error {
+	if len(e.Data) == 0 {
+		return errors.New("broker: event has no data")
+	}
+
+	return json.Unmarshal(e.Data, v)
+}
+
+// PublishArgs are the arguments of broker.publish.
+type PublishArgs struct {
+	Topic string          `json:"topic"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// SubscribeArgs are the arguments of broker.subscribe. OnEvent is called
+// with each *Event delivered to the subscription.
+//
+// If From is zero, events are delivered from the one following the offset
+// committed by the group, or from the first one of the topic if the group
+// has not committed any. If From is positive, events are delivered from
+// that offset, and if it is Latest, from the next event published.
+type SubscribeArgs struct {
+	Topic   string         `json:"topic"`
+	Group   string         `json:"group"`
+	From    int64          `json:"from,omitempty"`
+	OnEvent dnode.Function `json:"onEvent"`
+}
+
+// AckArgs are the arguments of broker.ack. Acknowledging an event
+// acknowledges the ones before it too.
+type AckArgs struct {
+	Topic  string `json:"topic"`
+	Group  string `json:"group"`
+	Offset int64  `json:"offset"`
+}
+
+// Broker keeps the events published to topics in a Store and delivers them
+// to subscriptions. Its fields must not be changed after HandleMethods is
+// called.
+type Broker struct {
+	// Store keeps the events and the offsets of the consumer groups.
+	Store Store
+
+	// AckTimeout is how long the broker waits for delivered events to be
+	// acknowledged before delivering them again. If zero,
+	// DefaultAckTimeout is used.
+	AckTimeout time.Duration
+
+	// MaxInFlight is the number of events delivered to a subscription and
+	// not acknowledged yet, above which delivery waits for
+	// acknowledgements. If zero, DefaultMaxInFlight is used.
+	MaxInFlight int
+
+	// Log logs the errors of the store. If nil, errors are not logged.
+	Log kite.Logger
+
+	mu      sync.Mutex // protects the subscriptions and serializes commits
+	seq     uint64
+	subs    map[string]*subscription // by topic and group
+	byID    map[string]*subscription
+	clients map[*kite.Client]map[string]*subscription // by subscriber and ID
+	closed  bool
+}
+
+// New returns a new broker keeping its events in store.
+func New(store Store) *Broker {
+	return &Broker{Store: store}
+}
+
+// NewKite returns a new broker kite of b.
+func NewKite(b *Broker) *kite.Kite {
+	k := kite.New(Name, "1.0.0")
+	if b.Log == nil {
+		b.Log = k.Log
+	}
+
+	b.HandleMethods(k)
+	return k
+}
+
+// HandleMethods adds the broker methods of b to k.
+func (b *Broker) HandleMethods(k *kite.Kite) {
+	k.HandleFunc(Prefix+"publish", func(r *kite.Request) (interface{}, error) {
+		var args PublishArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		return b.Publish(args.Topic, args.Data)
+	})
+
+	k.HandleFunc(Prefix+"subscribe", func(r *kite.Request) (interface{}, error) {
+		var args SubscribeArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		if !args.OnEvent.IsValid() {
+			return nil, errors.New("broker: no onEvent callback given")
+		}
+
+		return b.subscribe(&args, r.Client)
+	})
+
+	k.HandleFunc(Prefix+"ack", func(r *kite.Request) (interface{}, error) {
+		var args AckArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		return true, b.Ack(args.Topic, args.Group, args.Offset)
+	})
+
+	k.HandleFunc(Prefix+"unsubscribe", func(r *kite.Request) (interface{}, error) {
+		var args struct {
+			ID string `json:"id"`
+		}
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		b.Unsubscribe(args.ID)
+		return true, nil
+	})
+}
+
+// Publish adds an event to the topic and returns its offset.
+func (b *Broker) Publish(topic string, data json.RawMessage) (int64, error) {
+	if topic == "" {
+		return 0, errors.New("broker: no topic given")
+	}
+
+	e := &Event{
+		Topic: topic,
+		Data:  data,
+		Time:  time.Now().UTC(),
+	}
+
+	if err := b.Store.Append(e); err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	for _, s := range b.subs {
+		if s.topic == topic {
+			s.wakeup()
+		}
+	}
+	b.mu.Unlock()
+
+	return e.Offset, nil
+}
+
+// Ack commits the offset of the last event of the topic processed by the
+// group. Offsets lower than the committed one are not committed.
+func (b *Broker) Ack(topic, group string, offset int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	committed, err := b.Store.Offset(topic, group)
+	if err != nil {
+		return err
+	}
+
+	// Events replayed from before the committed offset are acknowledged to
+	// the subscription only.
+	if offset > committed {
+		latest, err := b.Store.Latest(topic)
+		if err != nil {
+			return err
+		}
+
+		if offset > latest {
+			return errors.New("broker: offset out of range")
+		}
+
+		if err := b.Store.Commit(topic, group, offset); err != nil {
+			return err
+		}
+	}
+
+	if s, ok := b.subs[topic+"\x00"+group]; ok {
+		s.ack(offset)
+	}
+
+	return nil
+}
+
+// Unsubscribe ends the subscription with the ID.
+func (b *Broker) Unsubscribe(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s, ok := b.byID[id]; ok {
+		b.remove(s)
+	}
+}
+
+// Close ends all subscriptions.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for _, s := range b.subs {
+		b.remove(s)
+	}
+}
+
+// subscribe starts delivering the events of a topic to a subscription of
+// the client, and returns its ID. A subscription of the same group to the
+// topic is ended, as only one subscription of a group receives the events
+// of a topic.
+func (b *Broker) subscribe(args *SubscribeArgs, client *kite.Client) (string, error) {
+	if args.Topic == "" || args.Group == "" {
+		return "", errors.New("broker: no topic or group given")
+	}
+
+	if args.From < Latest {
+		return "", errors.New("broker: from out of range")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return "", errors.New("broker: closed")
+	}
+
+	committed, err := b.Store.Offset(args.Topic, args.Group)
+	if err != nil {
+		return "", err
+	}
+
+	next := committed + 1
+
+	switch {
+	case args.From == Latest:
+		latest, err := b.Store.Latest(args.Topic)
+		if err != nil {
+			return "", err
+		}
+		next = latest + 1
+	case args.From > 0:
+		next = args.From
+	}
+
+	if b.subs == nil {
+		b.subs = make(map[string]*subscription)
+		b.byID = make(map[string]*subscription)
+		b.clients = make(map[*kite.Client]map[string]*subscription)
+	}
+
+	key := args.Topic + "\x00" + args.Group
+	if s, ok := b.subs[key]; ok {
+		b.remove(s)
+	}
+
+	b.seq++
+
+	s := &subscription{
+		b:       b,
+		id:      strconv.FormatUint(b.seq, 10),
+		client:  client,
+		key:     key,
+		topic:   args.Topic,
+		onEvent: args.OnEvent,
+		next:    next,
+		acked:   next - 1,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	b.subs[key] = s
+	b.byID[s.id] = s
+
+	// Subscriptions end with the connection of the subscriber. Its
+	// disconnect is hooked once, not for each of its subscriptions.
+	subs, ok := b.clients[client]
+	if !ok {
+		subs = make(map[string]*subscription)
+		b.clients[client] = subs
+		client.OnDisconnect(func() { b.unsubscribeClient(client) })
+	}
+	subs[s.id] = s
+
+	go s.run()
+
+	return s.id, nil
+}
+
+// unsubscribeClient ends the subscriptions of the disconnected client.
+func (b *Broker) unsubscribeClient(client *kite.Client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, s := range b.clients[client] {
+		b.remove(s)
+	}
+
+	delete(b.clients, client)
+}
+
+// remove ends the subscription. The caller holds b.mu.
+func (b *Broker) remove(s *subscription) {
+	if b.subs[s.key] == s {
+		delete(b.subs, s.key)
+	}
+
+	delete(b.byID, s.id)
+	delete(b.clients[s.client], s.id)
+	close(s.done)
+}
+
+func (b *Broker) ackTimeout() time.Duration {
+	if b.AckTimeout > 0 {
+		return b.AckTimeout
+	}
+
+	return DefaultAckTimeout
+}
+
+func (b *Broker) maxInFlight() int {
+	if b.MaxInFlight > 0 {
+		return b.MaxInFlight
+	}
+
+	return DefaultMaxInFlight
+}
+
+// subscription delivers the events of a topic to a subscriber.
+type subscription struct {
+	b       *Broker
+	id      string
+	client  *kite.Client // of the subscriber
+	key     string
+	topic   string
+	onEvent dnode.Function
+	wake    chan struct{}
+	done    chan struct{}
+
+	mu      sync.Mutex
+	next    int64     // offset of the next event to deliver
+	acked   int64     // offset of the last event acknowledged
+	lastAck time.Time // when the events in flight were last acknowledged
+}
+
+func (s *subscription) wakeup() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) ack(offset int64) {
+	s.mu.Lock()
+	if offset > s.acked {
+		s.acked = offset
+		s.lastAck = time.Now()
+	}
+
+	// Events acknowledged by an earlier subscription of the group are not
+	// delivered.
+	if s.next <= s.acked {
+		s.next = s.acked + 1
+	}
+	s.mu.Unlock()
+
+	s.wakeup()
+}
+
+func (s *subscription) run() {
+	timeout := s.b.ackTimeout()
+	max := s.b.maxInFlight()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		s.mu.Lock()
+		next := s.next
+		inFlight := int(next - 1 - s.acked)
+
+		if inFlight == 0 {
+			s.lastAck = time.Now()
+		}
+
+		wait := timeout - time.Since(s.lastAck)
+
+		// The events in flight were not acknowledged in time.
+		if inFlight > 0 && wait <= 0 {
+			s.next = s.acked + 1
+			s.lastAck = time.Now()
+			next, inFlight, wait = s.next, 0, timeout
+		}
+		s.mu.Unlock()
+
+		var timer <-chan time.Time
+		if inFlight > 0 {
+			timer = time.After(wait)
+		}
+
+		if inFlight < max {
+			events, err := s.b.Store.Read(s.topic, next, max-inFlight)
+			if err != nil {
+				if s.b.Log != nil {
+					s.b.Log.Error("broker: reading events of %q: %s", s.topic, err)
+				}
+
+				timer = time.After(time.Second)
+			}
+
+			for _, e := range events {
+				if err := s.onEvent.Call(e); err != nil {
+					s.b.Unsubscribe(s.id)
+					return
+				}
+			}
+
+			if len(events) != 0 {
+				s.mu.Lock()
+				// Delivery restarts if the events were acknowledged or
+				// timed out meanwhile.
+				if s.next == next {
+					s.next = events[len(events)-1].Offset + 1
+				}
+				s.mu.Unlock()
+
+				continue
+			}
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		case <-timer:
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package broker_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/broker"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/kitetest"
+)
+
+// recorder records the events handled by a subscriber.
+type recorder struct {
+	mu      sync.Mutex
+	offsets []int64
+	fail    map[int64]bool // offsets failing once
+}
+
+func (r *recorder) handle(e *broker.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var s string
+	if err := e.Unmarshal(&s); err != nil {
+		return err
+	}
+
+	if r.fail[e.Offset] {
+		delete(r.fail, e.Offset)
+		return errors.New("failed")
+	}
+
+	r.offsets = append(r.offsets, e.Offset)
+	return nil
+}
+
+func (r *recorder) wait(t *testing.T, n int) []int64 {
+	for i := 0; i < 500; i++ {
+		r.mu.Lock()
+		offsets := append([]int64(nil), r.offsets...)
+		r.mu.Unlock()
+
+		if len(offsets) >= n {
+			return offsets
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("got %v handled, want %d events", r.offsets, n)
+	return nil
+}
+
+func TestBroker(t *testing.T) {
+	store := broker.NewMemoryStore()
+
+	b := broker.New(store)
+	b.AckTimeout = 100 * time.Millisecond
+	defer b.Close()
+
+	k := broker.NewKite(b)
+	k.Config.DisableAuthentication = true
+
+	c, err := kitetest.Connect(kite.New("client", "0.0.1"), k)
+	if err != nil {
+		t.Fatalf("Connect()=%s", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := broker.Publish(c, "builds", "event"); err != nil {
+			t.Fatalf("Publish()=%s", err)
+		}
+	}
+
+	// The failed event is delivered again before the ones following it.
+	rec := &recorder{fail: map[int64]bool{2: true}}
+	s := &broker.Subscriber{
+		Client:  c,
+		Topic:   "builds",
+		Group:   "notifier",
+		Handler: rec.handle,
+		OnError: func(err error) { t.Errorf("subscriber: %s", err) },
+	}
+
+	if err := s.Subscribe(); err != nil {
+		t.Fatalf("Subscribe()=%s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := broker.Publish(c, "builds", "event"); err != nil {
+			t.Fatalf("Publish()=%s", err)
+		}
+	}
+
+	if got := rec.wait(t, 5); len(got) != 5 || got[0] != 1 || got[1] != 2 || got[4] != 5 {
+		t.Fatalf("got %v handled, want events 1 to 5 in order", got)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close()=%s", err)
+	}
+
+	// Acknowledgements are sent after the events are handled.
+	for i := 0; i < 100; i++ {
+		if offset, _ := store.Offset("builds", "notifier"); offset == 5 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if offset, err := store.Offset("builds", "notifier"); err != nil || offset != 5 {
+		t.Fatalf("got committed offset %d (%v), want 5", offset, err)
+	}
+
+	// A late joiner replays the events of the topic from an offset.
+	late := &recorder{}
+	s = &broker.Subscriber{
+		Client:  c,
+		Topic:   "builds",
+		Group:   "archiver",
+		From:    4,
+		Handler: late.handle,
+	}
+
+	if err := s.Subscribe(); err != nil {
+		t.Fatalf("Subscribe()=%s", err)
+	}
+	defer s.Close()
+
+	if got := late.wait(t, 2); len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Fatalf("got %v replayed, want events 4 and 5", got)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := broker.New(broker.NewMemoryStore())
+	defer b.Close()
+
+	k := broker.NewKite(b)
+	k.Config.DisableAuthentication = true
+
+	c, err := kitetest.Connect(kite.New("client", "0.0.1"), k)
+	if err != nil {
+		t.Fatalf("Connect()=%s", err)
+	}
+	defer c.Close()
+
+	subscribe := func() string {
+		res, err := c.Tell(broker.Prefix+"subscribe", &broker.SubscribeArgs{
+			Topic:   "builds",
+			Group:   "notifier",
+			OnEvent: dnode.Callback(func(*dnode.Partial) {}),
+		})
+		if err != nil {
+			t.Fatalf("subscribe: %s", err)
+		}
+		return res.MustString()
+	}
+
+	// Subscribing again and again does not hook the disconnect of the
+	// client again.
+	for i := 0; i < 10; i++ {
+		if _, err := c.Tell(broker.Prefix+"unsubscribe", map[string]string{"id": subscribe()}); err != nil {
+			t.Fatalf("unsubscribe: %s", err)
+		}
+	}
+
+	if clients, subs := b.Subscribers(); clients != 1 || subs != 0 {
+		t.Fatalf("got %d clients with %d subscriptions, want 1 with none", clients, subs)
+	}
+
+	subscribe()
+	c.Close()
+
+	// Subscriptions end with the connection of the subscriber.
+	for i := 0; i < 100; i++ {
+		if clients, _ := b.Subscribers(); clients == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	clients, subs := b.Subscribers()
+	t.Fatalf("got %d clients with %d subscriptions after disconnect, want none", clients, subs)
+}
@@ -0,0 +1,14 @@
+package broker
+
+// Subscribers returns the number of clients whose disconnect is hooked and
+// the number of their subscriptions, for test purposes.
+func (b *Broker) Subscribers() (clients, subscriptions int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, subs := range b.clients {
+		subscriptions += len(subs)
+	}
+
+	return len(b.clients), subscriptions
+}
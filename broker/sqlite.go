@@ -0,0 +1,157 @@
+package broker
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// SQLite is a Store keeping the events in a SQLite database, so they
+// survive restarts of the broker. The database is opened by the caller with
+// the SQLite driver of its choice, e.g.:
+//
+//	import _ "github.com/mattn/go-sqlite3"
+//
+//	db, err := sql.Open("sqlite3", "/var/lib/broker/events.db")
+//	store, err := broker.NewSQLite(db)
+type SQLite struct {
+	DB *sql.DB
+
+	mu sync.Mutex // serializes appends, SQLite has a single writer
+}
+
+var _ Store = (*SQLite)(nil)
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS broker_events (
+		topic TEXT NOT NULL,
+		event_offset INTEGER NOT NULL,
+		data TEXT,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (topic, event_offset)
+	)`,
+	`CREATE TABLE IF NOT EXISTS broker_offsets (
+		topic TEXT NOT NULL,
+		consumer_group TEXT NOT NULL,
+		event_offset INTEGER NOT NULL,
+		PRIMARY KEY (topic, consumer_group)
+	)`,
+}
+
+// NewSQLite returns a Store keeping the events in db, creating its tables
+// if they do not exist.
+func NewSQLite(db *sql.DB) (*SQLite, error) {
+	for _, stmt := range sqliteSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	return &SQLite{DB: db}, nil
+}
+
+// Append implements the Store interface.
+func (s *SQLite) Append(e *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var latest int64
+	err = tx.QueryRow(
+		`SELECT COALESCE(MAX(event_offset), 0) FROM broker_events WHERE topic = ?`,
+		e.Topic,
+	).Scan(&latest)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO broker_events (topic, event_offset, data, created_at) VALUES (?, ?, ?, ?)`,
+		e.Topic, latest+1, string(e.Data), e.Time.UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	e.Offset = latest + 1
+	return nil
+}
+
+// Read implements the Store interface.
+func (s *SQLite) Read(topic string, offset int64, max int) ([]*Event, error) {
+	rows, err := s.DB.Query(
+		`SELECT event_offset, data, created_at FROM broker_events
+		WHERE topic = ? AND event_offset >= ? ORDER BY event_offset LIMIT ?`,
+		topic, offset, max,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+
+	for rows.Next() {
+		var data sql.NullString
+		var created int64
+
+		e := &Event{Topic: topic}
+		if err := rows.Scan(&e.Offset, &data, &created); err != nil {
+			return nil, err
+		}
+
+		if data.Valid && data.String != "" {
+			e.Data = []byte(data.String)
+		}
+		e.Time = time.Unix(0, created).UTC()
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// Latest implements the Store interface.
+func (s *SQLite) Latest(topic string) (int64, error) {
+	var latest int64
+	err := s.DB.QueryRow(
+		`SELECT COALESCE(MAX(event_offset), 0) FROM broker_events WHERE topic = ?`,
+		topic,
+	).Scan(&latest)
+
+	return latest, err
+}
+
+// Offset implements the Store interface.
+func (s *SQLite) Offset(topic, group string) (int64, error) {
+	var offset int64
+	err := s.DB.QueryRow(
+		`SELECT event_offset FROM broker_offsets WHERE topic = ? AND consumer_group = ?`,
+		topic, group,
+	).Scan(&offset)
+
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return offset, err
+}
+
+// Commit implements the Store interface.
+func (s *SQLite) Commit(topic, group string, offset int64) error {
+	_, err := s.DB.Exec(
+		`INSERT OR REPLACE INTO broker_offsets (topic, consumer_group, event_offset) VALUES (?, ?, ?)`,
+		topic, group, offset,
+	)
+
+	return err
+}
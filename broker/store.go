@@ -0,0 +1,119 @@
+package broker
+
+import (
+	"sync"
+)
+
+// Store keeps the events of the topics and the offsets committed by the
+// consumer groups. Offsets of the events of a topic start at 1 and increase
+// by one with each event.
+type Store interface {
+	// Append adds the event to the end of its topic and sets its offset.
+	Append(e *Event) error
+
+	// Read returns at most max events of the topic, starting at offset.
+	Read(topic string, offset int64, max int) ([]*Event, error)
+
+	// Latest returns the offset of the last event of the topic, or 0 if
+	// it has none.
+	Latest(topic string) (int64, error)
+
+	// Offset returns the offset committed by the group for the topic, or
+	// 0 if the group committed none.
+	Offset(topic, group string) (int64, error)
+
+	// Commit stores the offset of the last event processed by the group.
+	Commit(topic, group string, offset int64) error
+}
+
+// MemoryStore is a Store keeping the events in memory, for tests and
+// brokers whose events do not need to survive a restart. Events are never
+// removed.
+type MemoryStore struct {
+	mu      sync.Mutex
+	events  map[string][]*Event
+	offsets map[string]map[string]int64
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		events:  make(map[string][]*Event),
+		offsets: make(map[string]map[string]int64),
+	}
+}
+
+// Append implements the Store interface.
+func (m *MemoryStore) Append(e *Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.events[e.Topic]
+	e.Offset = int64(len(events)) + 1
+
+	ev := *e
+	m.events[e.Topic] = append(events, &ev)
+
+	return nil
+}
+
+// Read implements the Store interface.
+func (m *MemoryStore) Read(topic string, offset int64, max int) ([]*Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.events[topic]
+	if offset < 1 {
+		offset = 1
+	}
+
+	if offset > int64(len(events)) {
+		return nil, nil
+	}
+
+	events = events[offset-1:]
+	if len(events) > max {
+		events = events[:max]
+	}
+
+	read := make([]*Event, len(events))
+	for i, e := range events {
+		ev := *e
+		read[i] = &ev
+	}
+
+	return read, nil
+}
+
+// Latest implements the Store interface.
+func (m *MemoryStore) Latest(topic string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return int64(len(m.events[topic])), nil
+}
+
+// Offset implements the Store interface.
+func (m *MemoryStore) Offset(topic, group string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.offsets[topic][group], nil
+}
+
+// Commit implements the Store interface.
+func (m *MemoryStore) Commit(topic, group string, offset int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	groups, ok := m.offsets[topic]
+	if !ok {
+		groups = make(map[string]int64)
+		m.offsets[topic] = groups
+	}
+
+	groups[group] = offset
+	return nil
+}
@@ -0,0 +1,155 @@
+package broker_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/broker"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := broker.NewMemoryStore()
+
+	// Events kept in memory do not survive a restart, the store is
+	// reopened as it is.
+	testStore(t, s, func() broker.Store { return s })
+}
+
+func TestSQLite(t *testing.T) {
+	driver := sqliteDriver()
+	if driver == "" {
+		t.Skip("no SQLite driver registered")
+	}
+
+	dir, err := ioutil.TempDir("", "broker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "events.db")
+
+	var db *sql.DB
+
+	open := func() broker.Store {
+		if db != nil {
+			db.Close()
+		}
+
+		if db, err = sql.Open(driver, file); err != nil {
+			t.Fatalf("Open()=%s", err)
+		}
+
+		s, err := broker.NewSQLite(db)
+		if err != nil {
+			t.Fatalf("NewSQLite()=%s", err)
+		}
+
+		return s
+	}
+	defer func() { db.Close() }()
+
+	testStore(t, open(), open)
+}
+
+// sqliteDriver returns the name of a registered SQLite driver, if the test
+// binary is built with one.
+func sqliteDriver() string {
+	for _, name := range sql.Drivers() {
+		if name == "sqlite3" || name == "sqlite" {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// testStore tests the behaviour of a Store the broker relies on. reopen
+// returns the store as after a restart of the broker.
+func testStore(t *testing.T, s broker.Store, reopen func() broker.Store) {
+	published := time.Unix(1500000000, 42).UTC()
+
+	for i := 0; i < 3; i++ {
+		e := &broker.Event{Topic: "t", Data: []byte(`"event"`), Time: published}
+		if err := s.Append(e); err != nil {
+			t.Fatalf("Append()=%s", err)
+		}
+
+		if e.Offset != int64(i+1) {
+			t.Fatalf("got offset %d, want %d", e.Offset, i+1)
+		}
+	}
+
+	// Topics have their own offsets.
+	e := &broker.Event{Topic: "other", Time: published}
+	if err := s.Append(e); err != nil || e.Offset != 1 {
+		t.Fatalf("Append()=%v, got offset %d, want 1 for another topic", err, e.Offset)
+	}
+
+	events, err := s.Read("t", 2, 10)
+	if err != nil || len(events) != 2 || events[0].Offset != 2 || events[1].Offset != 3 {
+		t.Fatalf("Read()=%+v, %v, want events 2 and 3", events, err)
+	}
+
+	if events, err := s.Read("t", 1, 2); err != nil || len(events) != 2 || events[1].Offset != 2 {
+		t.Fatalf("Read()=%+v, %v, want events 1 and 2", events, err)
+	}
+
+	if events, err := s.Read("t", 4, 10); err != nil || len(events) != 0 {
+		t.Fatalf("Read()=%+v, %v, want no events past the last one", events, err)
+	}
+
+	if latest, err := s.Latest("t"); err != nil || latest != 3 {
+		t.Fatalf("Latest()=%d, %v, want 3", latest, err)
+	}
+
+	if latest, err := s.Latest("none"); err != nil || latest != 0 {
+		t.Fatalf("Latest()=%d, %v, want 0 for a topic without events", latest, err)
+	}
+
+	for _, offset := range []int64{1, 2} {
+		if err := s.Commit("t", "g", offset); err != nil {
+			t.Fatalf("Commit()=%s", err)
+		}
+	}
+
+	if offset, err := s.Offset("t", "g"); err != nil || offset != 2 {
+		t.Fatalf("Offset()=%d, %v, want 2", offset, err)
+	}
+
+	if offset, err := s.Offset("t", "other"); err != nil || offset != 0 {
+		t.Fatalf("Offset()=%d, %v, want 0 for a new group", offset, err)
+	}
+
+	// Events and offsets are kept across restarts, and are replayed from
+	// an offset as they were published.
+	s = reopen()
+
+	if latest, err := s.Latest("t"); err != nil || latest != 3 {
+		t.Fatalf("Latest()=%d, %v, want 3 after reopening", latest, err)
+	}
+
+	if offset, err := s.Offset("t", "g"); err != nil || offset != 2 {
+		t.Fatalf("Offset()=%d, %v, want 2 after reopening", offset, err)
+	}
+
+	events, err = s.Read("t", 2, 10)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Read()=%+v, %v, want events 2 and 3 after reopening", events, err)
+	}
+
+	for i, e := range events {
+		if e.Topic != "t" || e.Offset != int64(i+2) || string(e.Data) != `"event"` || !e.Time.Equal(published) {
+			t.Fatalf("got %+v, want event %d as published", e, i+2)
+		}
+	}
+
+	e = &broker.Event{Topic: "t", Data: []byte(`"event"`), Time: published}
+	if err := s.Append(e); err != nil || e.Offset != 4 {
+		t.Fatalf("Append()=%v, got offset %d, want 4 after reopening", err, e.Offset)
+	}
+}
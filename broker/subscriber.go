@@ -0,0 +1,276 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+)
+
+// Find returns a client of a broker kite registered to the kontrol of k by
+// the same user in the same environment, connected to it.
+func Find(k *kite.Kite) (*kite.Client, error) {
+	clients, err := k.GetKites(&protocol.KontrolQuery{
+		Username:    k.Config.Username,
+		Environment: k.Config.Environment,
+		Name:        Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	kite.Close(clients[1:])
+
+	c := clients[0]
+	if err := c.Dial(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Publish publishes data encoded to JSON to the topic of the broker kite c
+// is connected to, and returns the offset of the event.
+func Publish(c *kite.Client, topic string, data interface{}) (int64, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := c.Tell(Prefix+"publish", &PublishArgs{Topic: topic, Data: raw})
+	if err != nil {
+		return 0, err
+	}
+
+	var offset int64
+	if err := res.Unmarshal(&offset); err != nil {
+		return 0, err
+	}
+
+	return offset, nil
+}
+
+// Subscriber receives the events of a topic from a broker kite and passes
+// them to its handler in order. It subscribes again when its client
+// reconnects, continuing from the last event acknowledged by its group.
+type Subscriber struct {
+	// Client is the client of the broker kite, see Find.
+	Client *kite.Client
+
+	// Topic is the topic the events are received from.
+	Topic string
+
+	// Group is the consumer group of the subscriber.
+	Group string
+
+	// From is the offset of the first event received, see SubscribeArgs.
+	// It applies to the first subscription only, later ones continue from
+	// the last event acknowledged.
+	From int64
+
+	// Handler processes an event. The event is acknowledged if it returns
+	// nil. Otherwise the event is not acknowledged, and it is received
+	// again once the ack timeout of the broker passes.
+	Handler func(*Event) error
+
+	// OnError, if not nil, is called with the errors of the calls to the
+	// broker, e.g. when it is not reachable.
+	OnError func(error)
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []*Event
+	id     string
+	stream *dnode.Stream // callback of the current subscription
+	closed bool
+	expect int64 // offset of the next event handled, or 0 for any
+}
+
+// Subscribe subscribes to the topic and starts passing the events to the
+// handler, until Close is called.
+func (s *Subscriber) Subscribe() error {
+	if s.Client == nil || s.Handler == nil {
+		return errors.New("broker: subscriber has no client or handler")
+	}
+
+	s.mu.Lock()
+	if s.cond != nil {
+		s.mu.Unlock()
+		return errors.New("broker: already subscribed")
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.mu.Unlock()
+
+	if err := s.subscribe(s.From); err != nil {
+		return err
+	}
+
+	s.Client.OnConnect(func() {
+		go func() {
+			if err := s.subscribe(0); err != nil {
+				s.error(err)
+			}
+		}()
+	})
+
+	go s.handle()
+
+	return nil
+}
+
+// Close ends the subscription. Events received but not handled yet are
+// dropped, they are received again by the next subscriber of the group.
+func (s *Subscriber) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.closed = true
+	id := s.id
+	s.events = nil
+	if s.cond != nil {
+		s.cond.Broadcast()
+	}
+	if s.stream != nil {
+		s.stream.Close()
+	}
+	s.mu.Unlock()
+
+	if id == "" {
+		return nil
+	}
+
+	_, err := s.Client.Tell(Prefix+"unsubscribe", map[string]string{"id": id})
+	return err
+}
+
+func (s *Subscriber) subscribe(from int64) error {
+	// The callback is called by the broker for as long as the
+	// subscription lasts, so it is a stream. The one of an earlier
+	// subscription is not called anymore.
+	stream := dnode.NewStream(s.receive)
+
+	s.mu.Lock()
+	closed := s.closed
+
+	// Events queued by an earlier subscription are dropped, the new one
+	// delivers them again from the offset committed by the group, which
+	// another subscriber of the group may have moved past them.
+	s.events = nil
+	s.expect = 0
+
+	if !closed {
+		if s.stream != nil {
+			s.stream.Close()
+		}
+		s.stream = stream
+	}
+	s.mu.Unlock()
+
+	if closed {
+		return nil
+	}
+
+	res, err := s.Client.Tell(Prefix+"subscribe", &SubscribeArgs{
+		Topic:   s.Topic,
+		Group:   s.Group,
+		From:    from,
+		OnEvent: stream.Function(),
+	})
+	if err != nil {
+		return err
+	}
+
+	var id string
+	if err := res.Unmarshal(&id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.id = id
+	s.mu.Unlock()
+
+	return nil
+}
+
+// receive queues an event for the handler. It is called by the read loop
+// of the client, so it must not block on calls to the broker.
+func (s *Subscriber) receive(p *dnode.Partial) {
+	var e Event
+	if err := p.One().Unmarshal(&e); err != nil {
+		s.error(fmt.Errorf("broker: invalid event: %s", err))
+		return
+	}
+
+	s.mu.Lock()
+	if !s.closed {
+		s.events = append(s.events, &e)
+		s.cond.Signal()
+	}
+	s.mu.Unlock()
+}
+
+func (s *Subscriber) handle() {
+	for {
+		s.mu.Lock()
+		for len(s.events) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+
+		e := s.events[0]
+		s.events = s.events[1:]
+		expect := s.expect
+		s.mu.Unlock()
+
+		switch {
+		case expect != 0 && e.Offset < expect:
+			// Handled already, the acknowledgement was lost.
+			s.ack(expect - 1)
+			continue
+		case expect != 0 && e.Offset > expect:
+			// An earlier event failed, it is received again first.
+			continue
+		}
+
+		if err := s.Handler(e); err != nil {
+			s.mu.Lock()
+			s.expect = e.Offset
+			s.mu.Unlock()
+			continue
+		}
+
+		s.mu.Lock()
+		s.expect = e.Offset + 1
+		s.mu.Unlock()
+
+		s.ack(e.Offset)
+	}
+}
+
+func (s *Subscriber) ack(offset int64) {
+	_, err := s.Client.Tell(Prefix+"ack", &AckArgs{
+		Topic:  s.Topic,
+		Group:  s.Group,
+		Offset: offset,
+	})
+	if err != nil {
+		s.error(fmt.Errorf("broker: ack of event %d of %q: %s", offset, s.Topic, err))
+	}
+}
+
+func (s *Subscriber) error(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
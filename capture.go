@@ -0,0 +1,136 @@
+package kite
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+// Directions of captured frames.
+const (
+	CaptureSend = "send"
+	CaptureRecv = "recv"
+)
+
+// CaptureFrame is a dnode frame sent or received by a kite, written to
+// captures as a JSON object per line.
+type CaptureFrame struct {
+	Time   time.Time `json:"time"`
+	Kite   string    `json:"kite"`             // ID of the capturing kite
+	Conn   string    `json:"conn"`             // ID of the session
+	Remote string    `json:"remote,omitempty"` // URL or address of the peer
+	Dir    string    `json:"dir"`              // CaptureSend or CaptureRecv
+	Data   string    `json:"data"`             // the frame, as sent on the wire
+}
+
+// Capture writes the dnode frames sent and received by kites and their
+// clients, for diagnosing interoperability problems with peers written in
+// other languages. Captures are pretty-printed by "kitectl capture".
+type Capture struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error // first error writing the capture
+}
+
+// NewCapture returns a capture writing the frames to w.
+func NewCapture(w io.Writer) *Capture {
+	return &Capture{enc: json.NewEncoder(w)}
+}
+
+// Write writes the frame. Writing stops after the first error, see Err.
+func (c *Capture) Write(f *CaptureFrame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err == nil {
+		c.err = c.enc.Encode(f)
+	}
+}
+
+// Err returns the first error writing the capture, if any.
+func (c *Capture) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// ReadCapture reads the frames of a capture.
+func ReadCapture(r io.Reader) ([]CaptureFrame, error) {
+	var frames []CaptureFrame
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var f CaptureFrame
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			return frames, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		frames = append(frames, f)
+	}
+
+	return frames, scanner.Err()
+}
+
+// openCapture opens the capture given by Config.WireCapture or the
+// KITE_WIRE_CAPTURE environment variable.
+func (k *Kite) openCapture() error {
+	path := k.Config.WireCapture
+	if path == "" {
+		path = os.Getenv("KITE_WIRE_CAPTURE")
+	}
+
+	switch path {
+	case "":
+		return nil
+	case "-":
+		k.Capture = NewCapture(os.Stderr)
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	k.Capture = NewCapture(f)
+	return nil
+}
+
+// capture captures the frame, if the client or its kite has a capture.
+func (c *Client) capture(dir string, session sockjs.Session, data string) {
+	capture := c.Capture
+	if capture == nil {
+		capture = c.LocalKite.Capture
+	}
+
+	if capture == nil {
+		return
+	}
+
+	remote := c.URL
+	if remote == "" {
+		remote = c.RemoteAddr()
+	}
+
+	capture.Write(&CaptureFrame{
+		Time:   c.LocalKite.Clock.Now(),
+		Kite:   c.LocalKite.Id,
+		Conn:   session.ID(),
+		Remote: remote,
+		Dir:    dir,
+		Data:   data,
+	})
+}
@@ -0,0 +1,85 @@
+package kite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func TestCapture(t *testing.T) {
+	var srvBuf, cliBuf lockedBuffer
+
+	k := New("capture", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+	k.Capture = NewCapture(&srvBuf)
+	k.HandleFunc("square", func(r *Request) (interface{}, error) {
+		n := r.Args.One().MustFloat64()
+		return n * n, nil
+	})
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("client", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	c.Capture = NewCapture(&cliBuf)
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Tell("square", 3); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	check := func(name string, buf *lockedBuffer, first string) {
+		frames, err := ReadCapture(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: ReadCapture()=%s", name, err)
+		}
+
+		if len(frames) < 2 {
+			t.Fatalf("%s: got %d frames, want a call and its response", name, len(frames))
+		}
+
+		if frames[0].Dir != first || frames[1].Dir == first {
+			t.Fatalf("%s: got directions %q and %q, want the call first", name, frames[0].Dir, frames[1].Dir)
+		}
+
+		var msg struct {
+			Method interface{} `json:"method"`
+		}
+		if err := json.Unmarshal([]byte(frames[0].Data), &msg); err != nil || msg.Method != "square" {
+			t.Fatalf("%s: got first frame %s, want the call of square", name, frames[0].Data)
+		}
+
+		for _, f := range frames {
+			if f.Conn == "" || f.Kite == "" || f.Time.IsZero() {
+				t.Fatalf("%s: got frame %+v without connection, kite or time", name, f)
+			}
+		}
+	}
+
+	check("client", &cliBuf, CaptureSend)
+	check("server", &srvBuf, CaptureRecv)
+}
@@ -0,0 +1,285 @@
+package kite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/igm/sockjs-go/sockjs"
+	"github.com/koding/kite/dnode"
+)
+
+// ChunkMethodName is the method of the frames carrying the chunks of a dnode
+// message larger than Config.ChunkSize. The chunks of a message are sent in
+// order and the message is handled once its last chunk is received.
+const ChunkMethodName = "kite.chunk"
+
+// Limits of the messages received in chunks by a client. Messages are
+// dropped when more of them are being received at once, or when their next
+// chunk is not received in time. The whole message is held in memory until
+// its last chunk is received, larger payloads are sent with a ChunkedReader
+// instead, which the limits do not apply to.
+const (
+	DefaultMaxChunkedSize = 64 << 20
+	maxChunkedMessages    = 16
+	chunkTimeout          = time.Minute
+)
+
+// chunkFrameOverhead is an upper bound of the size of a kite.chunk frame
+// besides its data and method.
+const chunkFrameOverhead = 256
+
+// Chunk is the single argument of a kite.chunk frame.
+type Chunk struct {
+	ID     string      `json:"id"`     // ID of the message, unique for the sender of the connection
+	Method interface{} `json:"method"` // method of the message, a name or a callback ID
+	Index  int         `json:"index"`  // index of the chunk, starting at zero
+	Count  int         `json:"count"`  // number of chunks of the message
+	Size   int         `json:"size"`   // size of the message in bytes
+	Data   []byte      `json:"data"`   // part of the message, base64 encoded
+}
+
+// ChunkProgress describes the progress of a message sent or received in
+// chunks.
+type ChunkProgress struct {
+	ID     string      // ID of the message, see Chunk
+	Method interface{} // method of the message, a name or a callback ID, nil for a ChunkedReader
+	Dir    string      // CaptureSend or CaptureRecv
+	Chunks int         // number of chunks transferred
+	Count  int         // number of chunks of the message
+	Bytes  int         // number of bytes transferred
+	Size   int         // size of the message in bytes
+}
+
+// Done reports whether the whole message was transferred.
+func (p *ChunkProgress) Done() bool {
+	return p.Chunks == p.Count
+}
+
+// chunkedMessage is a message being received in chunks.
+type chunkedMessage struct {
+	progress ChunkProgress
+	data     []byte
+	last     time.Time // when the last chunk was received
+}
+
+// OnChunkProgress adds a callback which is called after every chunk of a
+// message sent or received by the client. It is called from the loops
+// sending and reading the messages, so it must not block.
+func (c *Client) OnChunkProgress(handler func(*ChunkProgress)) {
+	c.m.Lock()
+	c.onChunkProgressHandlers = append(c.onChunkProgressHandlers, handler)
+	c.m.Unlock()
+}
+
+// OnChunkProgress registers a function to run after every chunk of a
+// message sent or received by the kite and its clients, see
+// Client.OnChunkProgress.
+func (k *Kite) OnChunkProgress(handler func(*Client, *ChunkProgress)) {
+	k.handlersMu.Lock()
+	k.onChunkProgressHandlers = append(k.onChunkProgressHandlers, handler)
+	k.handlersMu.Unlock()
+}
+
+func (c *Client) callOnChunkProgressHandlers(progress *ChunkProgress) {
+	p := *progress // handlers may keep it
+
+	c.m.RLock()
+	for _, handler := range c.onChunkProgressHandlers {
+		func() {
+			defer nopRecover()
+			handler(&p)
+		}()
+	}
+	c.m.RUnlock()
+
+	c.LocalKite.callOnChunkProgressHandlers(c, &p)
+}
+
+func (k *Kite) callOnChunkProgressHandlers(c *Client, p *ChunkProgress) {
+	k.handlersMu.RLock()
+	defer k.handlersMu.RUnlock()
+
+	for _, handler := range k.onChunkProgressHandlers {
+		func() {
+			defer nopRecover()
+			handler(c, p)
+		}()
+	}
+}
+
+// sendFrames sends the message over the session, in kite.chunk frames of
+// about Config.ChunkSize bytes if it is larger.
+func (c *Client) sendFrames(session sockjs.Session, msg *message) error {
+	frameSize := c.config().ChunkSize
+	if frameSize <= 0 || len(msg.p) <= frameSize {
+		return c.sendFrame(session, msg.p)
+	}
+
+	size := chunkDataSize(frameSize, msg.method)
+
+	p := &ChunkProgress{
+		ID:     c.nextChunkID(),
+		Method: msg.method,
+		Dir:    CaptureSend,
+		Count:  (len(msg.p) + size - 1) / size,
+		Size:   len(msg.p),
+	}
+
+	for p.Chunks < p.Count {
+		end := p.Bytes + size
+		if end > p.Size {
+			end = p.Size
+		}
+
+		args, err := json.Marshal([]interface{}{&Chunk{
+			ID:     p.ID,
+			Method: p.Method,
+			Index:  p.Chunks,
+			Count:  p.Count,
+			Size:   p.Size,
+			Data:   msg.p[p.Bytes:end],
+		}})
+		if err != nil {
+			return err
+		}
+
+		frame, err := json.Marshal(dnode.Message{
+			Method:    ChunkMethodName,
+			Arguments: &dnode.Partial{Raw: args},
+			Callbacks: map[string]dnode.Path{},
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := c.sendFrame(session, frame); err != nil {
+			return err
+		}
+
+		p.Chunks++
+		p.Bytes = end
+
+		c.callOnChunkProgressHandlers(p)
+	}
+
+	return nil
+}
+
+// nextChunkID returns the ID of the next message or ChunkedReader sent in
+// chunks.
+func (c *Client) nextChunkID() string {
+	return strconv.FormatUint(uint64(atomic.AddUint32(&c.chunkSeq, 1)), 10)
+}
+
+// chunkDataSize returns the number of bytes of data sent in each chunk of
+// the method, so its frames are about frameSize bytes.
+func chunkDataSize(frameSize int, method interface{}) int {
+	// The data of the chunks grows by a third when base64 encoded.
+	size := (frameSize - chunkFrameOverhead - len(fmt.Sprint(method))) / 4 * 3
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// sendFrame sends a single frame over the session.
+func (c *Client) sendFrame(session sockjs.Session, frame []byte) error {
+	if err := session.Send(string(frame)); err != nil {
+		return err
+	}
+
+	c.capture(CaptureSend, session, string(frame))
+	return nil
+}
+
+// addChunk adds the chunk carried by the arguments of a kite.chunk frame to
+// its message. It returns the message once all of its chunks are received,
+// nil otherwise. It is called by the read loop only.
+func (c *Client) addChunk(args *dnode.Partial) ([]byte, error) {
+	var chunk Chunk
+	if err := args.One().Unmarshal(&chunk); err != nil {
+		return nil, fmt.Errorf("invalid chunk: %s", err)
+	}
+
+	if chunk.ID == "" || chunk.Count <= 0 || chunk.Size < 0 {
+		return nil, errors.New("invalid chunk: missing id, count or size")
+	}
+
+	now := c.LocalKite.Clock.Now()
+
+	// Messages abandoned by the sender are dropped.
+	for id, m := range c.chunks {
+		if now.Sub(m.last) > chunkTimeout {
+			delete(c.chunks, id)
+		}
+	}
+
+	m, ok := c.chunks[chunk.ID]
+	if !ok {
+		if chunk.Index != 0 {
+			return nil, fmt.Errorf("chunk %d of unknown message %s", chunk.Index, chunk.ID)
+		}
+
+		max := c.config().MaxChunkedSize
+		if max <= 0 {
+			max = DefaultMaxChunkedSize
+		}
+
+		switch {
+		case chunk.Size > max:
+			return nil, fmt.Errorf("message %s of %d bytes exceeds the limit of %d bytes", chunk.ID, chunk.Size, max)
+		case chunk.Count > chunk.Size+1:
+			return nil, fmt.Errorf("message %s of %d bytes can not have %d chunks", chunk.ID, chunk.Size, chunk.Count)
+		case len(c.chunks) >= maxChunkedMessages:
+			return nil, fmt.Errorf("too many messages received in chunks at once, dropping message %s", chunk.ID)
+		}
+
+		m = &chunkedMessage{
+			progress: ChunkProgress{
+				ID:     chunk.ID,
+				Method: chunk.Method,
+				Dir:    CaptureRecv,
+				Count:  chunk.Count,
+				Size:   chunk.Size,
+			},
+		}
+		c.chunks[chunk.ID] = m
+	}
+
+	p := &m.progress
+
+	switch {
+	case chunk.Index != p.Chunks:
+		delete(c.chunks, chunk.ID)
+		return nil, fmt.Errorf("chunk %d of message %s received out of order, want %d", chunk.Index, chunk.ID, p.Chunks)
+	case chunk.Count != p.Count || chunk.Size != p.Size:
+		delete(c.chunks, chunk.ID)
+		return nil, fmt.Errorf("chunk %d of message %s changes its count or size", chunk.Index, chunk.ID)
+	case p.Bytes+len(chunk.Data) > p.Size:
+		delete(c.chunks, chunk.ID)
+		return nil, fmt.Errorf("chunks of message %s exceed its size of %d bytes", chunk.ID, p.Size)
+	}
+
+	m.data = append(m.data, chunk.Data...)
+	m.last = now
+	p.Chunks++
+	p.Bytes += len(chunk.Data)
+
+	c.callOnChunkProgressHandlers(p)
+
+	if !p.Done() {
+		return nil, nil
+	}
+
+	delete(c.chunks, chunk.ID)
+
+	if p.Bytes != p.Size {
+		return nil, fmt.Errorf("message %s has %d bytes, want %d", chunk.ID, p.Bytes, p.Size)
+	}
+
+	return m.data, nil
+}
@@ -0,0 +1,170 @@
+package kite
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/clock"
+	"github.com/koding/kite/dnode"
+)
+
+func TestChunkedMessages(t *testing.T) {
+	const chunkSize = 1024
+
+	payload := strings.Repeat("kite ", 20*chunkSize)
+
+	k := New("chunked", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+	k.Config.ChunkSize = chunkSize
+	k.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	})
+
+	var mu sync.Mutex
+	var received, sent int
+	k.OnChunkProgress(func(c *Client, p *ChunkProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if p.Done() && p.Bytes == p.Size {
+			switch p.Dir {
+			case CaptureRecv:
+				received++
+			case CaptureSend:
+				sent++
+			}
+		}
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	ck := New("client", "0.0.1")
+	ck.Config.ChunkSize = chunkSize
+
+	c := ck.NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+
+	var calls []*ChunkProgress
+	c.OnChunkProgress(func(p *ChunkProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if p.Dir == CaptureSend {
+			calls = append(calls, p)
+		}
+	})
+
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	result, err := c.Tell("echo", payload)
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if s := result.MustString(); s != payload {
+		t.Fatalf("got %d bytes, want %d", len(s), len(payload))
+	}
+
+	// The progress of the last chunks may be reported after the response.
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		done := received == 1 && sent == 1 && len(calls) != 0 && calls[len(calls)-1].Done()
+		mu.Unlock()
+
+		if done {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(calls) < len(payload)/chunkSize {
+		t.Fatalf("got %d chunks sent, want at least %d", len(calls), len(payload)/chunkSize)
+	}
+
+	for i, p := range calls {
+		if p.Method != "echo" || p.Chunks != i+1 || p.Count != len(calls) {
+			t.Fatalf("got progress %+v of chunk %d, want the chunks of echo in order", p, i)
+		}
+	}
+
+	if received != 1 || sent != 1 {
+		t.Fatalf("got %d messages received and %d sent in chunks by the kite, want 1 and 1", received, sent)
+	}
+}
+
+func TestChunkOutOfOrder(t *testing.T) {
+	c := New("client", "0.0.1").NewClient("")
+
+	chunk := func(index int, data string) *dnode.Partial {
+		return &dnode.Partial{Raw: []byte(fmt.Sprintf(
+			`[{"id":"1","method":"echo","index":%d,"count":3,"size":6,"data":%q}]`, index, data))}
+	}
+
+	if p, err := c.addChunk(chunk(0, "a2l0")); p != nil || err != nil {
+		t.Fatalf("addChunk()=%q, %v, want the message to be incomplete", p, err)
+	}
+
+	if _, err := c.addChunk(chunk(2, "ZQ==")); err == nil {
+		t.Fatal("expected error for a chunk received out of order")
+	}
+
+	if _, ok := c.chunks["1"]; ok {
+		t.Fatal("message received out of order was not dropped")
+	}
+}
+
+func TestChunkLimits(t *testing.T) {
+	mock := clock.NewMock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	k := New("client", "0.0.1")
+	k.Clock = mock
+	k.Config.MaxChunkedSize = 1024
+
+	c := k.NewClient("")
+
+	chunk := func(id string, count, size int) *dnode.Partial {
+		return &dnode.Partial{Raw: []byte(fmt.Sprintf(
+			`[{"id":%q,"method":"echo","index":0,"count":%d,"size":%d,"data":"a2l0"}]`, id, count, size))}
+	}
+
+	if _, err := c.addChunk(chunk("big", 2, 2048)); err == nil {
+		t.Fatal("expected error for a message larger than MaxChunkedSize")
+	}
+
+	if _, err := c.addChunk(chunk("many", 100, 10)); err == nil {
+		t.Fatal("expected error for a message with more chunks than bytes")
+	}
+
+	for i := 0; i < maxChunkedMessages; i++ {
+		if _, err := c.addChunk(chunk(fmt.Sprint(i), 2, 6)); err != nil {
+			t.Fatalf("addChunk()=%s", err)
+		}
+	}
+
+	if _, err := c.addChunk(chunk("extra", 2, 6)); err == nil {
+		t.Fatal("expected error for too many messages received at once")
+	}
+
+	// Incomplete messages are dropped once they time out.
+	mock.Add(chunkTimeout + time.Second)
+
+	if _, err := c.addChunk(chunk("extra", 2, 6)); err != nil {
+		t.Fatalf("addChunk()=%s", err)
+	}
+
+	if len(c.chunks) != 1 {
+		t.Fatalf("got %d messages being received, want 1", len(c.chunks))
+	}
+}
@@ -0,0 +1,380 @@
+package kite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/koding/kite/clock"
+	"github.com/koding/kite/dnode"
+)
+
+// defaultStreamChunkSize is the size of the frames of a ChunkedReader when
+// Config.ChunkSize is zero.
+const defaultStreamChunkSize = 256 << 10
+
+var errChunkedReaderClosed = errors.New("chunked reader is closed")
+
+// ChunkedReader is a method argument or result streaming the data of a
+// reader to the remote kite, so payloads of any size can be sent without
+// holding them in memory on either end. The receiving kite reads the data
+// with Client.ReadChunked, one chunk of about Config.ChunkSize bytes at a
+// time, and the sending kite reads the next chunk from the reader only once
+// it is asked for. Both ends report the chunks transferred to their
+// OnChunkProgress handlers.
+//
+// ChunkedReaders are created with Client.NewChunkedReader.
+type ChunkedReader struct {
+	ID    string `json:"id"`    // ID of the stream, unique for the sender of the connection
+	Count int    `json:"count"` // number of chunks of the stream
+	Size  int    `json:"size"`  // number of bytes of the stream
+
+	// Next asks for the next chunk. It is called with the callback
+	// receiving the chunks the first time, without arguments afterwards.
+	Next dnode.Function `json:"next"`
+
+	// Close stops the stream before all of its chunks are read.
+	Close dnode.Function `json:"close"`
+}
+
+// streamChunk is the argument of the callback receiving the chunks of a
+// ChunkedReader.
+type streamChunk struct {
+	Index int    `json:"index"`           // index of the chunk, starting at zero
+	Data  []byte `json:"data" dnode:"-"`  // data of the chunk, base64 encoded
+	Error string `json:"error,omitempty"` // reading the chunk failed
+}
+
+// NewChunkedReader returns a ChunkedReader streaming size bytes read from r
+// to the remote kite, when sent as an argument or the result of a method.
+// If r is an io.Closer, it is closed once the stream ends: when all of its
+// chunks are sent, reading r fails, the remote kite closes the stream or
+// disconnects, or it does not ask for the next chunk in time.
+func (c *Client) NewChunkedReader(r io.Reader, size int) *ChunkedReader {
+	frameSize := c.config().ChunkSize
+	if frameSize <= 0 {
+		frameSize = defaultStreamChunkSize
+	}
+
+	s := &chunkSender{
+		c:    c,
+		r:    r,
+		size: chunkDataSize(frameSize, nil),
+		progress: ChunkProgress{
+			ID:   c.nextChunkID(),
+			Dir:  CaptureSend,
+			Size: size,
+		},
+	}
+
+	s.progress.Count = (size + s.size - 1) / s.size
+	s.next = dnode.NewStream(func(p *dnode.Partial) { go s.sendNext(p) })
+	s.close = dnode.NewStream(func(*dnode.Partial) { s.finish() })
+
+	// The stream may end before the hooks ending it are set.
+	s.mu.Lock()
+	s.removeHandler = c.onDisconnect(s.finish)
+	s.timer = c.LocalKite.Clock.AfterFunc(chunkTimeout, s.finish)
+	s.mu.Unlock()
+
+	// There is nothing to ask for, the streams are not even sent.
+	if size == 0 {
+		s.finish()
+	}
+
+	return &ChunkedReader{
+		ID:    s.progress.ID,
+		Count: s.progress.Count,
+		Size:  size,
+		Next:  s.next.Function(),
+		Close: s.close.Function(),
+	}
+}
+
+// chunkSender sends the chunks of a ChunkedReader as they are asked for.
+type chunkSender struct {
+	c    *Client
+	r    io.Reader
+	size int // of the data of the chunks
+
+	next, close *dnode.Stream
+
+	mu            sync.Mutex
+	removeHandler func()
+	timer         clock.Timer // ends the stream when no chunk is asked for
+	progress      ChunkProgress
+	onChunk       dnode.Function
+	buf           []byte
+	done          bool
+}
+
+// sendNext sends the next chunk to the callback given by the arguments of
+// the first call of Next.
+func (s *chunkSender) sendNext(p *dnode.Partial) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return
+	}
+
+	if args, err := p.Slice(); err == nil && len(args) != 0 {
+		args[0].Unmarshal(&s.onChunk)
+	}
+
+	if !s.onChunk.IsValid() || s.progress.Done() {
+		s.finishLocked()
+		return
+	}
+
+	s.timer.Reset(chunkTimeout)
+
+	n := s.progress.Size - s.progress.Bytes
+	if n > s.size {
+		n = s.size
+	}
+
+	if s.buf == nil {
+		s.buf = make([]byte, s.size)
+	}
+
+	chunk := &streamChunk{Index: s.progress.Chunks, Data: s.buf[:n]}
+
+	if _, err := io.ReadFull(s.r, chunk.Data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("stream ended after %d of %d bytes", s.progress.Bytes, s.progress.Size)
+		}
+
+		s.onChunk.Call(&streamChunk{Index: chunk.Index, Error: err.Error()})
+		s.finishLocked()
+		return
+	}
+
+	// The chunk is encoded by Call, so the buffer can be reused afterwards.
+	if err := s.onChunk.Call(chunk); err != nil {
+		s.finishLocked()
+		return
+	}
+
+	s.progress.Chunks++
+	s.progress.Bytes += n
+
+	s.c.callOnChunkProgressHandlers(&s.progress)
+
+	if s.progress.Done() {
+		s.finishLocked()
+	}
+}
+
+func (s *chunkSender) finish() {
+	s.mu.Lock()
+	s.finishLocked()
+	s.mu.Unlock()
+}
+
+func (s *chunkSender) finishLocked() {
+	if s.done {
+		return
+	}
+
+	s.done = true
+	s.buf = nil
+	s.timer.Stop()
+	s.removeHandler()
+	s.next.Close()
+	s.close.Close()
+
+	if closer, ok := s.r.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// ReadChunked returns a reader of the data streamed by the ChunkedReader,
+// received as an argument or the result of a method called over c. Each
+// Read, once the data of the previous chunk is consumed, asks the remote
+// kite for the next chunk and waits for it. Closing the reader before the
+// end of the data stops the stream.
+//
+// Method handlers reading the data must not block the read loop of the
+// client, which is the default, see Client.Concurrent.
+func (c *Client) ReadChunked(cr *ChunkedReader) io.ReadCloser {
+	r := &chunkReceiver{
+		c:      c,
+		cr:     cr,
+		chunks: make(chan *streamChunk, 1),
+		stop:   make(chan struct{}),
+		progress: ChunkProgress{
+			ID:    cr.ID,
+			Dir:   CaptureRecv,
+			Count: cr.Count,
+			Size:  cr.Size,
+		},
+	}
+
+	if cr.Size < 0 || cr.Count < 0 || cr.Count > cr.Size || (cr.Size > 0 && (cr.Count == 0 || !cr.Next.IsValid())) {
+		r.err = errors.New("invalid chunked reader")
+		return r
+	}
+
+	r.onChunk = dnode.NewStream(func(p *dnode.Partial) {
+		var chunk streamChunk
+		if err := p.One().Unmarshal(&chunk); err != nil {
+			chunk.Error = fmt.Sprintf("invalid chunk: %s", err)
+		}
+
+		select {
+		case r.chunks <- &chunk:
+		case <-r.stop:
+		}
+	})
+
+	r.mu.Lock()
+	r.removeHandler = c.onDisconnect(func() { r.stopped(errors.New("kite disconnected")) })
+	r.mu.Unlock()
+
+	return r
+}
+
+// chunkReceiver reads the chunks of a ChunkedReader.
+type chunkReceiver struct {
+	c  *Client
+	cr *ChunkedReader
+
+	onChunk *dnode.Stream
+	chunks  chan *streamChunk
+
+	mu            sync.Mutex
+	removeHandler func()
+
+	progress ChunkProgress
+	started  bool
+	buf      []byte
+	err      error
+
+	once    sync.Once
+	stop    chan struct{} // closed once the stream ends or is stopped
+	stopErr error         // error of Read once stop is closed
+}
+
+func (r *chunkReceiver) Read(p []byte) (int, error) {
+	// Data left of the last chunk is read unless the stream was stopped.
+	select {
+	case <-r.stop:
+		if r.stopErr != io.EOF {
+			return 0, r.stopErr
+		}
+	default:
+	}
+
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		r.err = r.receive()
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// receive asks for the next chunk and waits for it.
+func (r *chunkReceiver) receive() error {
+	if r.progress.Bytes == r.progress.Size {
+		r.stopped(io.EOF)
+		return io.EOF
+	}
+
+	select {
+	case <-r.stop:
+		return r.stopErr
+	default:
+	}
+
+	var err error
+	if r.started {
+		err = r.cr.Next.Call()
+	} else {
+		err = r.cr.Next.Call(r.onChunk.Function())
+		r.started = true
+	}
+
+	if err != nil {
+		r.stopped(err)
+		return err
+	}
+
+	timer := r.c.LocalKite.Clock.NewTimer(chunkTimeout)
+	defer timer.Stop()
+
+	var chunk *streamChunk
+
+	select {
+	case chunk = <-r.chunks:
+	case <-r.stop:
+		return r.stopErr
+	case <-timer.C():
+		err := fmt.Errorf("chunk %d of stream %s not received in time", r.progress.Chunks, r.progress.ID)
+		r.stopped(err)
+		return err
+	}
+
+	p := &r.progress
+
+	switch {
+	case chunk.Error != "":
+		err = fmt.Errorf("stream %s: %s", p.ID, chunk.Error)
+	case chunk.Index != p.Chunks:
+		err = fmt.Errorf("chunk %d of stream %s received out of order, want %d", chunk.Index, p.ID, p.Chunks)
+	case chunk.Index >= p.Count:
+		err = fmt.Errorf("chunk %d of stream %s exceeds its %d chunks", chunk.Index, p.ID, p.Count)
+	case len(chunk.Data) == 0 || p.Bytes+len(chunk.Data) > p.Size:
+		err = fmt.Errorf("chunk %d of stream %s has %d bytes, with %d of %d bytes received", chunk.Index, p.ID, len(chunk.Data), p.Bytes, p.Size)
+	}
+
+	if err != nil {
+		r.stopped(err)
+		return err
+	}
+
+	r.buf = chunk.Data
+	p.Chunks++
+	p.Bytes += len(chunk.Data)
+
+	r.c.callOnChunkProgressHandlers(p)
+
+	return nil
+}
+
+// Close stops the stream if not all of its data is read, unblocking a Read
+// waiting for a chunk.
+func (r *chunkReceiver) Close() error {
+	r.stopped(errChunkedReaderClosed)
+	return nil
+}
+
+// stopped ends the stream with err, the error of Read from then on. Unless
+// all of the data was read, the remote kite is told to stop the stream.
+func (r *chunkReceiver) stopped(err error) {
+	r.once.Do(func() {
+		r.stopErr = err
+		close(r.stop)
+
+		if r.onChunk == nil {
+			return
+		}
+
+		r.mu.Lock()
+		remove := r.removeHandler
+		r.mu.Unlock()
+
+		r.onChunk.Close()
+		remove()
+
+		if err != io.EOF && r.cr.Close.IsValid() {
+			r.cr.Close.Call()
+		}
+	})
+}
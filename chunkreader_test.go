@@ -0,0 +1,207 @@
+package kite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChunkedReader(t *testing.T) {
+	const chunkSize = 4096
+
+	// Larger than MaxChunkedSize, which does not limit streams.
+	payload := make([]byte, 1<<20+17)
+	rand.Read(payload)
+	sum := sha256.Sum256(payload)
+
+	k := New("chunked", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+	k.Config.ChunkSize = chunkSize
+	k.Config.MaxChunkedSize = 64 * 1024
+	k.HandleFunc("upload", func(r *Request) (interface{}, error) {
+		var cr ChunkedReader
+		if err := r.Args.One().Unmarshal(&cr); err != nil {
+			return nil, err
+		}
+
+		rc := r.Client.ReadChunked(&cr)
+		defer rc.Close()
+
+		h := sha256.New()
+		if _, err := io.Copy(h, rc); err != nil {
+			return nil, err
+		}
+
+		return fmt.Sprintf("%x", h.Sum(nil)), nil
+	})
+	k.HandleFunc("download", func(r *Request) (interface{}, error) {
+		return r.Client.NewChunkedReader(bytes.NewReader(payload), len(payload)), nil
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	ck := New("client", "0.0.1")
+	ck.Config.ChunkSize = chunkSize
+
+	c := ck.NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+
+	var mu sync.Mutex
+	progress := make(map[string]*ChunkProgress)
+	c.OnChunkProgress(func(p *ChunkProgress) {
+		mu.Lock()
+		progress[p.Dir] = p
+		mu.Unlock()
+	})
+
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	result, err := c.Tell("upload", c.NewChunkedReader(bytes.NewReader(payload), len(payload)))
+	if err != nil {
+		t.Fatalf("Tell(upload)=%s", err)
+	}
+
+	if got, want := result.MustString(), fmt.Sprintf("%x", sum); got != want {
+		t.Fatalf("got uploaded sum %s, want %s", got, want)
+	}
+
+	result, err = c.Tell("download")
+	if err != nil {
+		t.Fatalf("Tell(download)=%s", err)
+	}
+
+	var cr ChunkedReader
+	if err := result.Unmarshal(&cr); err != nil {
+		t.Fatal(err)
+	}
+
+	rc := c.ReadChunked(&cr)
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("ReadAll()=%s", err)
+	}
+
+	if sha256.Sum256(data) != sum {
+		t.Fatalf("got %d bytes downloaded, want the %d bytes of the payload", len(data), len(payload))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, dir := range []string{CaptureSend, CaptureRecv} {
+		p := progress[dir]
+		if p == nil || !p.Done() || p.Bytes != len(payload) || p.Count < len(payload)/chunkSize {
+			t.Errorf("got %s progress %+v, want all of the chunks of the payload", dir, p)
+		}
+	}
+}
+
+// closeReader records whether it was closed.
+type closeReader struct {
+	io.Reader
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (r *closeReader) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *closeReader) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+func TestChunkedReaderClose(t *testing.T) {
+	payload := bytes.Repeat([]byte("kite"), 64*1024)
+	src := &closeReader{Reader: bytes.NewReader(payload)}
+
+	k := New("chunked", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+	k.Config.ChunkSize = 1024
+	k.HandleFunc("download", func(r *Request) (interface{}, error) {
+		return r.Client.NewChunkedReader(src, len(payload)), nil
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("client", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	result, err := c.Tell("download")
+	if err != nil {
+		t.Fatalf("Tell(download)=%s", err)
+	}
+
+	var cr ChunkedReader
+	if err := result.Unmarshal(&cr); err != nil {
+		t.Fatal(err)
+	}
+
+	rc := c.ReadChunked(&cr)
+
+	p := make([]byte, 100)
+	if _, err := io.ReadFull(rc, p); err != nil {
+		t.Fatalf("ReadFull()=%s", err)
+	}
+
+	if err := rc.Close(); err != nil {
+		t.Fatalf("Close()=%s", err)
+	}
+
+	if _, err := rc.Read(p); err != errChunkedReaderClosed {
+		t.Fatalf("Read()=%v, want %v", err, errChunkedReaderClosed)
+	}
+
+	// The kite stops the stream and closes its reader.
+	for i := 0; i < 100 && !src.isClosed(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !src.isClosed() {
+		t.Fatal("reader of the stream closed early was not closed")
+	}
+}
+
+func TestChunkedReaderInvalid(t *testing.T) {
+	c := New("client", "0.0.1").NewClient("")
+
+	for _, cr := range []*ChunkedReader{
+		{Size: -1},
+		{Size: 10, Count: 11},
+		{Size: 10, Count: 1}, // no Next function
+	} {
+		if _, err := c.ReadChunked(cr).Read(make([]byte, 1)); err == nil || err == io.EOF {
+			t.Errorf("Read()=%v, want an error for %+v", err, cr)
+		}
+	}
+
+	// An empty stream ends right away.
+	if n, err := c.ReadChunked(&ChunkedReader{}).Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read()=%d, %v, want EOF", n, err)
+	}
+}
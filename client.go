@@ -7,11 +7,11 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/koding/kite/clock"
 	"github.com/koding/kite/config"
 	"github.com/koding/kite/dnode"
 	"github.com/koding/kite/protocol"
@@ -61,6 +61,19 @@ type Client struct {
 	// If Config is nil, LocalKite.Config is used instead.
 	Config *config.Config
 
+	// DialSession, if not nil, opens the sessions to the remote kite
+	// instead of the transport given by Config.Transport, e.g. the
+	// in-memory sessions of the kitetest package. It is called with the URL
+	// and the config of the client each time the client dials.
+	//
+	// Sessions opened by DialSession are trusted like the ones of the
+	// builtin transports, as the client has initiated them.
+	DialSession func(url string, cfg *config.Config) (sockjs.Session, error)
+
+	// Capture, if not nil, captures the frames of the client instead of
+	// LocalKite.Capture.
+	Capture *Capture
+
 	// Concurrent specified whether we should process incoming messages concurrently.
 	//
 	// Defaults to true.
@@ -114,6 +127,10 @@ type Client struct {
 	// is closed but was not dialed
 	closeRenewer chan struct{}
 
+	// renewer renews the token of the client, if it authenticates with
+	// a token. Protected by authMu.
+	renewer *TokenRenewer
+
 	// interrupt is used to signalise readloop that
 	// session was interrupted.
 	interrupt chan error
@@ -141,16 +158,31 @@ type Client struct {
 	// dnode scrubber for saving callbacks sent to remote.
 	scrubber *dnode.Scrubber
 
+	// callbackTimeout is Config.CallbackTimeout of the kite when the
+	// client was created, the timeout of its response callbacks.
+	callbackTimeout time.Duration
+
+	// chunkSeq is the ID of the last message or ChunkedReader sent in
+	// chunks, incremented atomically. Wrapping around is harmless, as the
+	// IDs only tell apart the messages being sent.
+	chunkSeq uint32
+
+	// chunks are the messages being received in chunks, by ID. Used by
+	// the read loop only.
+	chunks map[string]*chunkedMessage
+
 	// Time to wait before redial connection.
 	redialBackOff backoff.BackOff
 
 	// on connect/disconnect handlers are invoked after every
 	// connect/disconnect.
 	onConnectHandlers     []func()
-	onDisconnectHandlers  []func()
+	onDisconnectHandlers  []*func()
 	onTokenExpireHandlers []func()
 	onTokenRenewHandlers  []func(string)
 
+	onChunkProgressHandlers []func(*ChunkProgress)
+
 	testHookSetSession func(sockjs.Session)
 
 	// For protecting access over OnConnect and OnDisconnect handlers.
@@ -159,10 +191,40 @@ type Client struct {
 	firstRequestHandlersNotified sync.Once
 }
 
+// dialedSession wraps the sessions opened by Client.DialSession or passed
+// through Kite.SessionHook, marking them as initiated by the client.
+type dialedSession struct {
+	sockjs.Session
+}
+
+// RemoteAddr gives the remote address of the wrapped session, if it has
+// one.
+func (s *dialedSession) RemoteAddr() string {
+	if s, ok := s.Session.(interface {
+		RemoteAddr() string
+	}); ok {
+		return s.RemoteAddr()
+	}
+
+	return ""
+}
+
+// isDialed reports whether the session was opened by the client side of the
+// connection, which is trusted.
+func isDialed(session sockjs.Session) bool {
+	switch session.(type) {
+	case *sockjsclient.WebsocketSession, *sockjsclient.XHRSession, *dialedSession:
+		return true
+	default:
+		return false
+	}
+}
+
 // message carries an encoded payload sent over connected session.
 type message struct {
-	p    []byte
-	errC chan<- error
+	p      []byte
+	method interface{} // of the dnode message, for chunk progress
+	errC   chan<- error
 }
 
 // callOptions is the type of first argument in the dnode message.
@@ -189,6 +251,13 @@ type Auth struct {
 	// Type can be "kiteKey", "token" or "sessionID" for now.
 	Type string `json:"type"`
 	Key  string `json:"key"`
+
+	// RefreshToken, if set for the "token" type, is used to get a new
+	// token from Kontrol when Key expires, see Kite.GetRefreshToken. It
+	// is replaced with the refresh token given along with the new token,
+	// as refresh tokens are used once. It is never sent to the remote
+	// kite.
+	RefreshToken string `json:"-"`
 }
 
 // response is the type of the return value of Tell() and Go() methods.
@@ -208,6 +277,7 @@ func (k *Kite) NewClient(remoteURL string) *Client {
 		closeChan:          make(chan struct{}),
 		redialBackOff:      forever,
 		scrubber:           dnode.NewScrubber(),
+		chunks:             make(map[string]*chunkedMessage),
 		testHookSetSession: nopSetSession,
 		Concurrent:         true,
 		send:               make(chan *message),
@@ -216,6 +286,9 @@ func (k *Kite) NewClient(remoteURL string) *Client {
 		cancel:             func() {},
 	}
 
+	c.callbackTimeout = k.Config.CallbackTimeout
+	c.scrubber.Clock = k.Clock
+
 	c.OnConnect(c.setContext)
 	c.OnDisconnect(c.closeContext)
 
@@ -304,18 +377,25 @@ func (c *Client) authCopy() *Auth {
 }
 
 func (c *Client) dial(timeout time.Duration) (err error) {
+	c.setupTokenRenewer()
+
 	transport := c.config().Transport
 
 	c.LocalKite.Log.Debug("Client transport is set to '%s'", transport)
 
 	var session sockjs.Session
 
-	switch transport {
-	case config.WebSocket:
+	switch {
+	case c.DialSession != nil:
+		session, err = c.DialSession(c.URL, c.config())
+		if err == nil {
+			session = &dialedSession{Session: session}
+		}
+	case transport == config.WebSocket:
 		session, err = sockjsclient.DialWebsocket(c.URL, c.config())
-	case config.XHRPolling:
+	case transport == config.XHRPolling:
 		session, err = sockjsclient.DialXHR(c.URL, c.config())
-	case config.Auto:
+	case transport == config.Auto:
 		session, err = sockjsclient.DialWebsocket(c.URL, c.config())
 		if err == websocket.ErrBadHandshake {
 			// In cases when kite server is behind a proxy that do
@@ -330,7 +410,7 @@ func (c *Client) dial(timeout time.Duration) (err error) {
 		return err
 	}
 
-	c.setSession(session)
+	c.setSession(c.LocalKite.hookSession(session))
 	c.wg.Add(1)
 	go c.sendHub()
 
@@ -361,7 +441,7 @@ func (c *Client) dialForever(connectNotifyChan chan bool) {
 		return nil
 	}
 
-	backoff.Retry(dial, c.redialBackOff) // this will retry dial forever
+	retry(dial, c.redialBackOff, c.LocalKite.Clock) // this will retry dial forever
 
 	if connectNotifyChan != nil {
 		close(connectNotifyChan)
@@ -376,12 +456,14 @@ func (c *Client) RemoteAddr() string {
 		return ""
 	}
 
-	websocketsession, ok := session.(*sockjsclient.WebsocketSession)
+	s, ok := session.(interface {
+		RemoteAddr() string
+	})
 	if !ok {
 		return ""
 	}
 
-	return websocketsession.RemoteAddr()
+	return s.RemoteAddr()
 }
 
 // run consumes incoming dnode messages. Reconnects if necessary.
@@ -423,6 +505,9 @@ func (c *Client) reconnect() bool {
 
 // readLoop reads a message from websocket and processes it.
 func (c *Client) readLoop() error {
+	// Chunks of messages received over a previous session are dropped.
+	c.chunks = make(map[string]*chunkedMessage)
+
 	for {
 		p, err := c.receiveData()
 
@@ -472,6 +557,9 @@ func (c *Client) receiveData() ([]byte, error) {
 
 	go func() {
 		msg, err := session.Recv()
+		if err == nil {
+			c.capture(CaptureRecv, session, msg)
+		}
 		done <- recv{[]byte(msg), err}
 	}()
 
@@ -492,6 +580,13 @@ func (c *Client) processMessage(data []byte) (msg *dnode.Message, fn interface{}
 		}
 	}()
 
+	// Malformed input must not crash the read loop of the connection.
+	defer func() {
+		if r := recover(); r != nil {
+			msg, fn, err = nil, nil, fmt.Errorf("malformed message: %v", r)
+		}
+	}()
+
 	msg = &dnode.Message{}
 
 	if err = json.Unmarshal(data, &msg); err != nil {
@@ -505,6 +600,16 @@ func (c *Client) processMessage(data []byte) (msg *dnode.Message, fn interface{}
 		return e
 	}
 
+	// Reassemble messages sent in chunks and process them once complete.
+	if method, ok := msg.Method.(string); ok && method == ChunkMethodName {
+		p, err := c.addChunk(msg.Arguments)
+		if err != nil || p == nil {
+			return nil, nil, err
+		}
+
+		return c.processMessage(p)
+	}
+
 	// Replace function placeholders with real functions.
 	if err := dnode.ParseCallbacks(msg, sender); err != nil {
 		return nil, nil, err
@@ -582,8 +687,7 @@ func (c *Client) sendHub() {
 				continue
 			}
 
-			err := session.Send(string(msg.p))
-			if err != nil {
+			if err := c.sendFrames(session, msg); err != nil {
 				if msg.errC != nil {
 					msg.errC <- err
 				}
@@ -617,9 +721,30 @@ func (c *Client) OnConnect(handler func()) {
 // OnDisconnect adds a callback which is called when client disconnects
 // from a remote kite.
 func (c *Client) OnDisconnect(handler func()) {
+	c.onDisconnect(handler)
+}
+
+// onDisconnect is like OnDisconnect, but returns a function removing the
+// handler, for handlers of resources which may be released before the
+// client disconnects.
+func (c *Client) onDisconnect(handler func()) (remove func()) {
+	h := &handler
+
 	c.m.Lock()
-	c.onDisconnectHandlers = append(c.onDisconnectHandlers, handler)
+	c.onDisconnectHandlers = append(c.onDisconnectHandlers, h)
 	c.m.Unlock()
+
+	return func() {
+		c.m.Lock()
+		defer c.m.Unlock()
+
+		for i, other := range c.onDisconnectHandlers {
+			if other == h {
+				c.onDisconnectHandlers = append(c.onDisconnectHandlers[:i:i], c.onDisconnectHandlers[i+1:]...)
+				return
+			}
+		}
+	}
 }
 
 // OnTokenExpire adds a callback which is called when client receives
@@ -651,15 +776,17 @@ func (c *Client) callOnConnectHandlers() {
 	}
 }
 
-// callOnDisconnectHandlers runs the registered disconnect handlers.
+// callOnDisconnectHandlers runs the registered disconnect handlers. They
+// are called without holding the lock, so they may remove themselves.
 func (c *Client) callOnDisconnectHandlers() {
 	c.m.RLock()
-	defer c.m.RUnlock()
+	handlers := c.onDisconnectHandlers
+	c.m.RUnlock()
 
-	for _, handler := range c.onDisconnectHandlers {
+	for _, handler := range handlers {
 		func() {
 			defer nopRecover()
-			handler()
+			(*handler)()
 		}()
 	}
 }
@@ -724,8 +851,18 @@ func (c *Client) SendWebRTCRequest(req *protocol.WebRTCSignalMessage) error {
 // TellWithTimeout does the same thing with Tell() method except it takes an
 // extra argument that is the timeout for waiting reply from the remote Kite.
 // If timeout is given 0, the behavior is same as Tell().
+//
+// If the call fails because the token of the client is expired, the token
+// is renewed and the call is made once more with the new token.
 func (c *Client) TellWithTimeout(method string, timeout time.Duration, args ...interface{}) (result *dnode.Partial, err error) {
+	key := c.authKey()
+
 	response := <-c.GoWithTimeout(method, timeout, args...)
+
+	if isTokenExpired(response.Err) && c.renewExpiredToken(key) {
+		response = <-c.GoWithTimeout(method, timeout, args...)
+	}
+
 	return response.Result, response.Err
 }
 
@@ -778,7 +915,7 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 	// select statement
 	var afterTimeout <-chan time.Time
 	if timeout > 0 {
-		afterTimeout = time.After(timeout)
+		afterTimeout = c.LocalKite.Clock.After(timeout)
 	}
 
 	// Waits until the response has came or the connection has disconnected.
@@ -788,10 +925,8 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 
 		select {
 		case resp := <-doneChan:
-			if e, ok := resp.Err.(*Error); ok {
-				if e.Type == "authenticationError" && strings.Contains(e.Message, "token is expired") {
-					c.callOnTokenExpireHandlers()
-				}
+			if isTokenExpired(resp.Err) {
+				c.callOnTokenExpireHandlers()
 			}
 
 			responseChan <- resp
@@ -836,8 +971,19 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 // marshalAndSend takes a method and arguments, scrubs the arguments to create
 // a dnode message, marshals the message to JSON and sends it over the wire.
 func (c *Client) marshalAndSend(method interface{}, arguments []interface{}) (callbacks map[string]dnode.Path, errC <-chan error, err error) {
+	// Do not encode empty arguments as "null", make it "[]".
+	if arguments == nil {
+		arguments = make([]interface{}, 0)
+	}
+
+	// replace the values implementing dnode.Marshaler with their own.
+	resolved, err := dnode.Resolve(arguments)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// scrub trough the arguments and save any callbacks.
-	callbacks = c.scrubber.Scrub(arguments)
+	callbacks = c.scrubber.Scrub(resolved)
 
 	defer func() {
 		if err != nil {
@@ -845,12 +991,7 @@ func (c *Client) marshalAndSend(method interface{}, arguments []interface{}) (ca
 		}
 	}()
 
-	// Do not encode empty arguments as "null", make it "[]".
-	if arguments == nil {
-		arguments = make([]interface{}, 0)
-	}
-
-	rawArgs, err := json.Marshal(arguments)
+	rawArgs, err := json.Marshal(resolved)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -877,8 +1018,9 @@ func (c *Client) marshalAndSend(method interface{}, arguments []interface{}) (ca
 		errC := make(chan error, 1)
 
 		c.send <- &message{
-			p:    p,
-			errC: errC,
+			p:      p,
+			method: method,
+			errC:   errC,
 		}
 
 		return callbacks, errC, nil
@@ -946,8 +1088,21 @@ func sendCallbackID(callbacks map[string]dnode.Path, ch chan<- uint64) {
 // makeResponseCallback prepares and returns a callback function sent to the server.
 // The caller of the Tell() is blocked until the server calls this callback function.
 // Sets theResponse and notifies the caller by sending to done channel.
+//
+// If the server does not call the callback within Config.CallbackTimeout,
+// the caller gets a timeout error.
 func (c *Client) makeResponseCallback(doneChan chan *response, removeCallback <-chan uint64, method string, args []interface{}) dnode.Function {
-	return dnode.Callback(func(arguments *dnode.Partial) {
+	expired := func(err error) {
+		doneChan <- &response{
+			nil,
+			&Error{
+				Type:    "timeout",
+				Message: fmt.Sprintf("No response to %q method: %s", method, err),
+			},
+		}
+	}
+
+	return dnode.CallbackWithTimeout(func(arguments *dnode.Partial) {
 		// Single argument of response callback.
 		var resp struct {
 			Result *dnode.Partial `json:"result"`
@@ -996,7 +1151,7 @@ func (c *Client) makeResponseCallback(doneChan chan *response, removeCallback <-
 			}
 			return
 		}
-	})
+	}, c.callbackTimeout, expired)
 }
 
 // onError is called when an error happened in a method handler.
@@ -1049,3 +1204,22 @@ func (lb *lockedBackoff) Reset() {
 
 	lb.b.Reset()
 }
+
+// retry is backoff.Retry waiting for the backoffs on the clock.
+func retry(op backoff.Operation, b backoff.BackOff, clk clock.Clock) error {
+	b.Reset()
+
+	for {
+		err := op()
+		if err == nil {
+			return nil
+		}
+
+		next := b.NextBackOff()
+		if next == backoff.Stop {
+			return err
+		}
+
+		clk.Sleep(next)
+	}
+}
@@ -0,0 +1,149 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/koding/kite/clock"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestMockTimer(t *testing.T) {
+	m := clock.NewMock(epoch)
+
+	timer := m.NewTimer(time.Minute)
+	after := m.After(2 * time.Minute)
+
+	m.Add(59 * time.Second)
+
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	m.Add(time.Second)
+
+	select {
+	case now := <-timer.C():
+		if want := epoch.Add(time.Minute); !now.Equal(want) {
+			t.Fatalf("got %s, want %s", now, want)
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+
+	if timer.Stop() {
+		t.Fatal("Stop() of a fired timer returned true")
+	}
+
+	m.Add(time.Hour)
+
+	select {
+	case now := <-after:
+		if want := epoch.Add(2 * time.Minute); !now.Equal(want) {
+			t.Fatalf("got %s, want %s", now, want)
+		}
+	default:
+		t.Fatal("After() did not fire")
+	}
+
+	if want := epoch.Add(time.Hour + time.Minute); !m.Now().Equal(want) {
+		t.Fatalf("got %s, want %s", m.Now(), want)
+	}
+}
+
+func TestMockStopReset(t *testing.T) {
+	m := clock.NewMock(epoch)
+
+	timer := m.NewTimer(time.Second)
+	if !timer.Stop() {
+		t.Fatal("Stop() of a pending timer returned false")
+	}
+
+	m.Add(time.Minute)
+
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	timer.Reset(time.Second)
+	m.Add(time.Second)
+
+	select {
+	case <-timer.C():
+	default:
+		t.Fatal("reset timer did not fire")
+	}
+}
+
+func TestMockTicker(t *testing.T) {
+	m := clock.NewMock(epoch)
+	ticker := m.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for i := 1; i <= 3; i++ {
+		m.Add(time.Second)
+
+		select {
+		case now := <-ticker.C():
+			if want := epoch.Add(time.Duration(i) * time.Second); !now.Equal(want) {
+				t.Fatalf("got tick %s, want %s", now, want)
+			}
+		default:
+			t.Fatalf("ticker did not tick %d times", i)
+		}
+	}
+
+	ticker.Stop()
+	m.Add(time.Minute)
+
+	select {
+	case <-ticker.C():
+		t.Fatal("stopped ticker ticked")
+	default:
+	}
+}
+
+func TestMockAfterFuncSleep(t *testing.T) {
+	m := clock.NewMock(epoch)
+
+	called := make(chan struct{})
+	m.AfterFunc(time.Minute, func() { close(called) })
+
+	slept := make(chan struct{})
+	go func() {
+		m.Sleep(time.Hour)
+		close(slept)
+	}()
+
+	m.BlockUntil(2)
+	m.Add(time.Minute)
+
+	select {
+	case <-called:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AfterFunc() function was not called")
+	}
+
+	select {
+	case <-slept:
+		t.Fatal("Sleep() returned early")
+	default:
+	}
+
+	m.Add(time.Hour)
+
+	select {
+	case <-slept:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sleep() did not return")
+	}
+
+	if n := m.Waiters(); n != 0 {
+		t.Fatalf("got %d waiters, want 0", n)
+	}
+}
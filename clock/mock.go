@@ -0,0 +1,222 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Mock is a Clock whose time only changes when it is set or advanced. Its
+// timers, tickers and sleepers are woken up once the time passes their
+// deadline.
+type Mock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*mockTimer
+	changed chan struct{} // closed and replaced when waiters change
+}
+
+var _ Clock = (*Mock)(nil)
+
+// NewMock returns a mock clock set to now.
+func NewMock(now time.Time) *Mock {
+	return &Mock{
+		now:     now,
+		changed: make(chan struct{}),
+	}
+}
+
+// Now implements the Clock interface.
+func (m *Mock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.now
+}
+
+// Since implements the Clock interface.
+func (m *Mock) Since(t time.Time) time.Duration {
+	return m.Now().Sub(t)
+}
+
+// Sleep implements the Clock interface. It returns once the clock is
+// advanced by d.
+func (m *Mock) Sleep(d time.Duration) {
+	<-m.After(d)
+}
+
+// After implements the Clock interface.
+func (m *Mock) After(d time.Duration) <-chan time.Time {
+	return m.NewTimer(d).C()
+}
+
+// AfterFunc implements the Clock interface. As time.AfterFunc, f is called
+// in a goroutine of its own.
+func (m *Mock) AfterFunc(d time.Duration, f func()) Timer {
+	t := &mockTimer{mock: m, fn: f}
+	m.schedule(t, d)
+	return t
+}
+
+// NewTimer implements the Clock interface.
+func (m *Mock) NewTimer(d time.Duration) Timer {
+	t := &mockTimer{mock: m, c: make(chan time.Time, 1)}
+	m.schedule(t, d)
+	return t
+}
+
+// NewTicker implements the Clock interface.
+func (m *Mock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	t := &mockTimer{mock: m, c: make(chan time.Time, 1), period: d}
+	m.schedule(t, d)
+	return mockTicker{t}
+}
+
+// Add advances the clock by d, firing the timers and tickers due in order
+// of their deadlines.
+func (m *Mock) Add(d time.Duration) {
+	m.Set(m.Now().Add(d))
+}
+
+// Set sets the clock to t, firing the timers and tickers due in order of
+// their deadlines. The clock does not go back in time for them.
+func (m *Mock) Set(t time.Time) {
+	for {
+		m.mu.Lock()
+
+		if len(m.waiters) == 0 || m.waiters[0].when.After(t) {
+			if t.After(m.now) {
+				m.now = t
+			}
+			m.mu.Unlock()
+			return
+		}
+
+		w := m.waiters[0]
+		if w.when.After(m.now) {
+			m.now = w.when
+		}
+
+		if w.period > 0 {
+			w.when = w.when.Add(w.period)
+			m.sortLocked()
+		} else {
+			m.removeLocked(w)
+		}
+
+		now := m.now
+		m.mu.Unlock()
+
+		w.fire(now)
+	}
+}
+
+// Waiters returns the number of timers, tickers and sleepers waiting for
+// the clock to advance.
+func (m *Mock) Waiters() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.waiters)
+}
+
+// BlockUntil blocks until at least n timers, tickers and sleepers wait for
+// the clock to advance. Tests call it before advancing the clock to make
+// sure the code they test is waiting.
+func (m *Mock) BlockUntil(n int) {
+	for {
+		m.mu.Lock()
+		if len(m.waiters) >= n {
+			m.mu.Unlock()
+			return
+		}
+		changed := m.changed
+		m.mu.Unlock()
+
+		<-changed
+	}
+}
+
+func (m *Mock) schedule(t *mockTimer, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.when = m.now.Add(d)
+	m.waiters = append(m.waiters, t)
+	m.sortLocked()
+	m.notifyLocked()
+}
+
+// unschedule removes t and reports whether it was waiting.
+func (m *Mock) unschedule(t *mockTimer) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.removeLocked(t)
+}
+
+func (m *Mock) removeLocked(t *mockTimer) bool {
+	for i, w := range m.waiters {
+		if w == t {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			m.notifyLocked()
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Mock) sortLocked() {
+	sort.SliceStable(m.waiters, func(i, j int) bool {
+		return m.waiters[i].when.Before(m.waiters[j].when)
+	})
+}
+
+func (m *Mock) notifyLocked() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// mockTimer is a timer or, with a period, a ticker of a Mock.
+type mockTimer struct {
+	mock   *Mock
+	c      chan time.Time
+	fn     func()
+	period time.Duration
+	when   time.Time // guarded by mock.mu
+}
+
+func (t *mockTimer) C() <-chan time.Time { return t.c }
+
+func (t *mockTimer) Stop() bool {
+	return t.mock.unschedule(t)
+}
+
+func (t *mockTimer) Reset(d time.Duration) bool {
+	active := t.mock.unschedule(t)
+	t.mock.schedule(t, d)
+	return active
+}
+
+// mockTicker is the Ticker of a mockTimer with a period.
+type mockTicker struct{ *mockTimer }
+
+func (t mockTicker) Stop() { t.mockTimer.Stop() }
+
+func (t *mockTimer) fire(now time.Time) {
+	if t.fn != nil {
+		go t.fn()
+		return
+	}
+
+	// As with the timers of the time package, a tick is dropped if the
+	// previous one was not received yet.
+	select {
+	case t.c <- now:
+	default:
+	}
+}
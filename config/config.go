@@ -1,4 +1,10 @@
 // Package config contains a Config struct for kites.
+//
+// Get builds a Config from the defaults, overlaid by the kite.key of the
+// user, overlaid by the KITE_* environment variables, so every setting
+// given by the environment takes precedence over the kite.key, which takes
+// precedence over the defaults. See ReadEnvironmentVariables for the list
+// of variables.
 package config
 
 import (
@@ -9,6 +15,7 @@ import (
 	"net/http/cookiejar"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/koding/kite/kitekey"
@@ -33,11 +40,43 @@ type Config struct {
 	KiteKey               string    // The kite.key value to use for "kiteKey" authentication.
 	DisableAuthentication bool      // Do not require authentication for requests.
 	DisableConcurrency    bool      // Do not process messages concurrently.
+	StrictArguments       bool      // Decode arguments of methods strictly, see kite.Method.Strict.
 	Transport             Transport // SockJS transport to use.
 
 	IP   string // IP of the kite server.
 	Port int    // Port number of the kite server.
 
+	// TLSCertFile and TLSKeyFile are the PEM encoded certificate and key
+	// the kite server is served with. The server serves plain HTTP if
+	// they are empty and no tls.Config is set on the kite.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// LogLevel is the level of the kite logger, one of DEBUG, INFO,
+	// WARNING, ERROR or FATAL. If empty, the level is read from the
+	// KITE_LOG_LEVEL environment variable when the kite is created.
+	LogLevel string
+
+	// AllowedUsers, if not empty, are the only users whose authenticated
+	// requests are served. Requests of other users fail authentication.
+	AllowedUsers []string
+
+	// RateLimit is the number of requests per second served for every
+	// method which is not throttled with Method.Throttle. Zero means no
+	// limit.
+	RateLimit float64
+
+	// RateLimitBurst is the number of requests served at once before
+	// RateLimit applies. If zero, RateLimit rounded up is used.
+	RateLimitBurst int64
+
+	// SigningAlgorithms restricts the algorithms the kite keys and tokens
+	// accepted by the kite may be signed with, by issuer. Unless listed,
+	// any algorithm fitting the key of the issuer is accepted, so limiting
+	// an issuer to the algorithm of its key keeps tokens signed with
+	// another one from being accepted should the issuer's key change.
+	SigningAlgorithms kitekey.Algorithms
+
 	// VerifyFunc is used to verify the public key of the signed token.
 	//
 	// If the pub key is not to be trusted, the function must return
@@ -111,8 +150,55 @@ type Config struct {
 	KontrolKey  string
 	KontrolUser string
 
+	// KontrolTLS and ProxyTLS, if set, pin the CAs or public keys of the
+	// certificates accepted from Kontrol and from the proxy kites the kite
+	// registers to, so a CA trusted by the system cannot impersonate them.
+	KontrolTLS *TLSPin
+	ProxyTLS   *TLSPin
+
 	// UseWebRTC is the flag for Kite's to communicate over WebRTC if possible.
 	UseWebRTC bool
+
+	// WireCapture, if not empty, is the file every dnode frame sent and
+	// received by the kite and its clients is appended to, "-" for
+	// stderr, see kite.Capture. If empty, the KITE_WIRE_CAPTURE environment
+	// variable is used when the kite is created.
+	WireCapture string
+
+	// CallbackTimeout, if not zero, is how long the clients of the kite
+	// wait for the response of a call before its callback is removed and
+	// the call fails with a timeout error, so response callbacks abandoned
+	// by the remote kite do not pile up on long-lived connections. It
+	// applies to the clients created once it is set. Other callbacks, like
+	// the ones streaming output, are kept until they are removed, see
+	// dnode.Stream and dnode.CallbackWithTimeout.
+	CallbackTimeout time.Duration
+
+	// ChunkSize, if not zero, is the size in bytes above which dnode
+	// messages are sent in kite.chunk frames of about ChunkSize bytes, so
+	// large arguments and results do not need to fit a single frame. Only
+	// kites which know the kite.chunk method reassemble chunked messages,
+	// older kites and peers written in other languages fail to handle
+	// them, so it must be set only when every peer supports it.
+	//
+	// Chunking bounds the size of the frames, not the memory used: the
+	// whole message is still held by both ends. Stream large payloads with
+	// a kite.ChunkedReader instead, which is read in chunks of about
+	// ChunkSize bytes, or 256 KiB if zero.
+	ChunkSize int
+
+	// MaxChunkedSize, if not zero, is the size in bytes of the largest
+	// message received in chunks. Larger messages are dropped. If zero,
+	// 64 MiB is used. It does not limit kite.ChunkedReader streams.
+	MaxChunkedSize int
+
+	// source, if not nil, is the path and the arguments Load built the
+	// Config from, see Reload.
+	source *loadSource
+
+	// set are the names of the variables of the settings given by a
+	// config file, the environment or a flag, see IsSet.
+	set map[string]bool
 }
 
 // DefaultConfig contains the default settings.
@@ -185,59 +271,277 @@ func MustGet() *Config {
 	return c
 }
 
+// ReadEnvironmentVariables overrides the fields of c with the values of the
+// KITE_* environment variables which are set and not empty:
+//
+//	KITE_USERNAME                 Username
+//	KITE_ENVIRONMENT              Environment
+//	KITE_REGION                   Region
+//	KITE_ID                       Id
+//	KITE_KEY                      KiteKey
+//	KITE_DISABLE_AUTHENTICATION   DisableAuthentication
+//	KITE_DISABLE_CONCURRENCY      DisableConcurrency
+//	KITE_STRICT_ARGUMENTS         StrictArguments
+//	KITE_TRANSPORT                Transport, WebSocket or XHRPolling
+//	KITE_IP                       IP
+//	KITE_PORT                     Port
+//	KITE_TLS_CERT_FILE            TLSCertFile
+//	KITE_TLS_KEY_FILE             TLSKeyFile
+//	KITE_LOG_LEVEL                LogLevel
+//	KITE_ALLOWED_USERS            AllowedUsers, comma separated
+//	KITE_RATE_LIMIT               RateLimit
+//	KITE_RATE_LIMIT_BURST         RateLimitBurst
+//	KITE_SIGNING_ALGORITHMS       SigningAlgorithms, see below
+//	KITE_VERIFY_TTL               VerifyTTL
+//	KITE_TIMEOUT                  Timeout and Client.Timeout
+//	KITE_HANDSHAKE_TIMEOUT        Websocket.HandshakeTimeout
+//	KITE_HEARTBEAT_DELAY          SockJS.HeartbeatDelay
+//	KITE_DISCONNECT_DELAY         SockJS.DisconnectDelay
+//	KITE_KONTROL_URL              KontrolURL
+//	KITE_KONTROL_KEY              KontrolKey
+//	KITE_KONTROL_USER             KontrolUser
+//	KITE_KONTROL_CA_FILE          KontrolTLS.RootCAs, a PEM file
+//	KITE_KONTROL_PINS             KontrolTLS.PublicKeys, comma separated
+//	KITE_PROXY_CA_FILE            ProxyTLS.RootCAs, a PEM file
+//	KITE_PROXY_PINS               ProxyTLS.PublicKeys, comma separated
+//	KITE_USE_WEBRTC               UseWebRTC
+//	KITE_WIRE_CAPTURE             WireCapture
+//	KITE_CALLBACK_TIMEOUT         CallbackTimeout
+//	KITE_CHUNK_SIZE               ChunkSize
+//	KITE_MAX_CHUNKED_SIZE         MaxChunkedSize
+//
+// Booleans are parsed with strconv.ParseBool and durations with
+// time.ParseDuration. An invalid value is an error naming the variable.
+//
+// KITE_SIGNING_ALGORITHMS is a comma separated list of algorithms, each
+// optionally prefixed with an issuer and a colon, e.g.
+// "kontrol:ES256,RS256" accepts only ES256 from the issuer kontrol and
+// only RS256 from every other issuer.
+//
+// The pins of KITE_KONTROL_PINS and KITE_PROXY_PINS are base64 encoded
+// SHA-256 hashes of public keys, see TLSPin.
 func (c *Config) ReadEnvironmentVariables() error {
-	var err error
+	for _, v := range EnvironmentVariables {
+		value := os.Getenv(v.Name)
+		if value == "" {
+			continue
+		}
 
-	if username := os.Getenv("KITE_USERNAME"); username != "" {
-		c.Username = username
+		if err := v.Set(c, value); err != nil {
+			return fmt.Errorf("invalid %s value %q: %s", v.Name, value, err)
+		}
+		c.markSet(v.Name)
 	}
 
-	if environment := os.Getenv("KITE_ENVIRONMENT"); environment != "" {
-		c.Environment = environment
-	}
+	return nil
+}
 
-	if region := os.Getenv("KITE_REGION"); region != "" {
-		c.Region = region
-	}
+// EnvironmentVariable describes an environment variable read by
+// ReadEnvironmentVariables.
+type EnvironmentVariable struct {
+	Name string                      // Name of the variable.
+	Set  func(*Config, string) error // Set sets the field from a value.
+}
 
-	if ip := os.Getenv("KITE_IP"); ip != "" {
-		c.IP = ip
-	}
+// EnvironmentVariables are the environment variables read by
+// ReadEnvironmentVariables, in the order they are applied.
+var EnvironmentVariables = []EnvironmentVariable{
+	{"KITE_USERNAME", stringVar(func(c *Config) *string { return &c.Username })},
+	{"KITE_ENVIRONMENT", stringVar(func(c *Config) *string { return &c.Environment })},
+	{"KITE_REGION", stringVar(func(c *Config) *string { return &c.Region })},
+	{"KITE_ID", stringVar(func(c *Config) *string { return &c.Id })},
+	{"KITE_KEY", stringVar(func(c *Config) *string { return &c.KiteKey })},
+	{"KITE_DISABLE_AUTHENTICATION", boolVar(func(c *Config) *bool { return &c.DisableAuthentication })},
+	{"KITE_DISABLE_CONCURRENCY", boolVar(func(c *Config) *bool { return &c.DisableConcurrency })},
+	{"KITE_STRICT_ARGUMENTS", boolVar(func(c *Config) *bool { return &c.StrictArguments })},
+	{"KITE_TRANSPORT", func(c *Config, v string) error {
+		transport, ok := Transports[v]
+		if !ok {
+			return fmt.Errorf("transport '%s' doesn't exists", v)
+		}
 
-	if port := os.Getenv("KITE_PORT"); port != "" {
-		c.Port, err = strconv.Atoi(port)
+		c.Transport = transport
+		return nil
+	}},
+	{"KITE_IP", stringVar(func(c *Config) *string { return &c.IP })},
+	{"KITE_PORT", func(c *Config, v string) error {
+		port, err := strconv.Atoi(v)
 		if err != nil {
 			return err
 		}
-	}
 
-	if kontrolURL := os.Getenv("KITE_KONTROL_URL"); kontrolURL != "" {
-		c.KontrolURL = kontrolURL
-	}
+		c.Port = port
+		return nil
+	}},
+	{"KITE_TLS_CERT_FILE", stringVar(func(c *Config) *string { return &c.TLSCertFile })},
+	{"KITE_TLS_KEY_FILE", stringVar(func(c *Config) *string { return &c.TLSKeyFile })},
+	{"KITE_LOG_LEVEL", func(c *Config, v string) error {
+		switch level := strings.ToUpper(v); level {
+		case "DEBUG", "INFO", "WARNING", "ERROR", "FATAL":
+			c.LogLevel = level
+			return nil
+		default:
+			return errors.New("unknown log level")
+		}
+	}},
+	{"KITE_ALLOWED_USERS", func(c *Config, v string) error {
+		c.AllowedUsers = nil
+		for _, user := range strings.Split(v, ",") {
+			if user = strings.TrimSpace(user); user != "" {
+				c.AllowedUsers = append(c.AllowedUsers, user)
+			}
+		}
+		return nil
+	}},
+	{"KITE_RATE_LIMIT", func(c *Config, v string) error {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		if rate < 0 {
+			return errors.New("must not be negative")
+		}
 
-	if transportName := os.Getenv("KITE_TRANSPORT"); transportName != "" {
-		transport, ok := Transports[transportName]
-		if !ok {
-			return fmt.Errorf("transport '%s' doesn't exists", transportName)
+		c.RateLimit = rate
+		return nil
+	}},
+	{"KITE_RATE_LIMIT_BURST", func(c *Config, v string) error {
+		burst, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		if burst < 0 {
+			return errors.New("must not be negative")
 		}
 
-		c.Transport = transport
+		c.RateLimitBurst = burst
+		return nil
+	}},
+	{"KITE_SIGNING_ALGORITHMS", func(c *Config, v string) error {
+		algs := make(kitekey.Algorithms)
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+
+			var issuer string
+			if i := strings.LastIndex(item, ":"); i != -1 {
+				issuer, item = item[:i], item[i+1:]
+			}
+
+			alg, err := kitekey.ParseAlgorithm(item)
+			if err != nil {
+				return err
+			}
+
+			algs[issuer] = append(algs[issuer], alg)
+		}
+
+		c.SigningAlgorithms = nil
+		if len(algs) != 0 {
+			c.SigningAlgorithms = algs
+		}
+		return nil
+	}},
+	{"KITE_VERIFY_TTL", durationVar(func(c *Config) *time.Duration { return &c.VerifyTTL })},
+	{"KITE_TIMEOUT", func(c *Config, v string) error {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+
+		c.Timeout = timeout
+		if c.Client != nil {
+			c.Client.Timeout = timeout
+		}
+		return nil
+	}},
+	{"KITE_HANDSHAKE_TIMEOUT", func(c *Config, v string) error {
+		if c.Websocket == nil {
+			return errors.New("no websocket dialer configured")
+		}
+		return durationVar(func(c *Config) *time.Duration { return &c.Websocket.HandshakeTimeout })(c, v)
+	}},
+	{"KITE_HEARTBEAT_DELAY", sockJSDurationVar(func(o *sockjs.Options) *time.Duration { return &o.HeartbeatDelay })},
+	{"KITE_DISCONNECT_DELAY", sockJSDurationVar(func(o *sockjs.Options) *time.Duration { return &o.DisconnectDelay })},
+	{"KITE_KONTROL_URL", stringVar(func(c *Config) *string { return &c.KontrolURL })},
+	{"KITE_KONTROL_KEY", stringVar(func(c *Config) *string { return &c.KontrolKey })},
+	{"KITE_KONTROL_USER", stringVar(func(c *Config) *string { return &c.KontrolUser })},
+	{"KITE_KONTROL_CA_FILE", caFileVar(func(c *Config) **TLSPin { return &c.KontrolTLS })},
+	{"KITE_KONTROL_PINS", pinsVar(func(c *Config) **TLSPin { return &c.KontrolTLS })},
+	{"KITE_PROXY_CA_FILE", caFileVar(func(c *Config) **TLSPin { return &c.ProxyTLS })},
+	{"KITE_PROXY_PINS", pinsVar(func(c *Config) **TLSPin { return &c.ProxyTLS })},
+	{"KITE_USE_WEBRTC", boolVar(func(c *Config) *bool { return &c.UseWebRTC })},
+	{"KITE_WIRE_CAPTURE", stringVar(func(c *Config) *string { return &c.WireCapture })},
+	{"KITE_CALLBACK_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.CallbackTimeout })},
+	{"KITE_CHUNK_SIZE", sizeVar(func(c *Config) *int { return &c.ChunkSize })},
+	{"KITE_MAX_CHUNKED_SIZE", sizeVar(func(c *Config) *int { return &c.MaxChunkedSize })},
+}
+
+func stringVar(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
 	}
+}
+
+func sizeVar(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		if size < 0 {
+			return errors.New("must not be negative")
+		}
 
-	if ttl, err := time.ParseDuration(os.Getenv("KITE_VERIFY_TTL")); err == nil {
-		c.VerifyTTL = ttl
+		*field(c) = size
+		return nil
 	}
+}
 
-	if timeout, err := time.ParseDuration(os.Getenv("KITE_TIMEOUT")); err == nil {
-		c.Timeout = timeout
-		c.Client.Timeout = timeout
+func boolVar(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+
+		*field(c) = b
+		return nil
 	}
+}
+
+func durationVar(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
 
-	if timeout, err := time.ParseDuration(os.Getenv("KITE_HANDSHAKE_TIMEOUT")); err == nil {
-		c.Websocket.HandshakeTimeout = timeout
+		*field(c) = d
+		return nil
 	}
+}
 
-	return nil
+// sockJSDurationVar sets a duration of the SockJS options. The options are
+// shared with DefaultConfig, so they are copied before being changed.
+func sockJSDurationVar(field func(*sockjs.Options) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+
+		var opts sockjs.Options
+		if c.SockJS != nil {
+			opts = *c.SockJS
+		}
+
+		*field(&opts) = d
+		c.SockJS = &opts
+		return nil
+	}
 }
 
 // ReadKiteKey parsed the user's kite key and returns a new Config.
@@ -287,5 +591,20 @@ func (c *Config) Copy() *Config {
 		copy.Websocket = &ws
 	}
 
+	if c.AllowedUsers != nil {
+		copy.AllowedUsers = append([]string(nil), c.AllowedUsers...)
+	}
+
+	if c.set != nil {
+		copy.set = make(map[string]bool, len(c.set))
+		for name := range c.set {
+			copy.set[name] = true
+		}
+	}
+
+	copy.SigningAlgorithms = c.SigningAlgorithms.Copy()
+	copy.KontrolTLS = c.KontrolTLS.Copy()
+	copy.ProxyTLS = c.ProxyTLS.Copy()
+
 	return &copy
 }
@@ -2,10 +2,14 @@ package config_test
 
 import (
 	"net/http"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/koding/kite/config"
+	"github.com/koding/kite/kitekey"
 
 	"github.com/igm/sockjs-go/sockjs"
 )
@@ -30,3 +34,62 @@ func TestConfigCopy(t *testing.T) {
 		}
 	}
 }
+
+func TestReadEnvironmentVariables(t *testing.T) {
+	env := map[string]string{
+		"KITE_USERNAME":               "john",
+		"KITE_PORT":                   "4567",
+		"KITE_TRANSPORT":              "XHRPolling",
+		"KITE_DISABLE_AUTHENTICATION": "true",
+		"KITE_TLS_CERT_FILE":          "/etc/kite/cert.pem",
+		"KITE_LOG_LEVEL":              "debug",
+		"KITE_SIGNING_ALGORITHMS":     "kontrol:es256, kontrol:EdDSA,RS256",
+		"KITE_TIMEOUT":                "5s",
+		"KITE_HEARTBEAT_DELAY":        "3s",
+		"KITE_KONTROL_URL":            "https://koding.com/kontrol/kite",
+		"KITE_CHUNK_SIZE":             "65536",
+		"KITE_MAX_CHUNKED_SIZE":       "1048576",
+	}
+
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	c := config.New()
+	if err := c.ReadEnvironmentVariables(); err != nil {
+		t.Fatalf("ReadEnvironmentVariables()=%s", err)
+	}
+
+	want := config.New()
+	want.Username = "john"
+	want.Port = 4567
+	want.Transport = config.XHRPolling
+	want.DisableAuthentication = true
+	want.TLSCertFile = "/etc/kite/cert.pem"
+	want.LogLevel = "DEBUG"
+	want.SigningAlgorithms = kitekey.Algorithms{"kontrol": {"ES256", "EdDSA"}, "": {"RS256"}}
+	want.Timeout = 5 * time.Second
+	want.Client.Timeout = 5 * time.Second
+	sockJS := *want.SockJS
+	sockJS.HeartbeatDelay = 3 * time.Second
+	want.SockJS = &sockJS
+	want.KontrolURL = "https://koding.com/kontrol/kite"
+	want.ChunkSize = 65536
+	want.MaxChunkedSize = 1048576
+
+	if !reflect.DeepEqual(c, want) {
+		t.Fatalf("got %#v, want %#v", c, want)
+	}
+
+	if config.DefaultConfig.SockJS.HeartbeatDelay == 3*time.Second {
+		t.Fatal("DefaultConfig was modified")
+	}
+
+	os.Setenv("KITE_TIMEOUT", "5")
+
+	err := config.New().ReadEnvironmentVariables()
+	if err == nil || !strings.Contains(err.Error(), "KITE_TIMEOUT") {
+		t.Fatalf("got %v, want error naming KITE_TIMEOUT", err)
+	}
+}
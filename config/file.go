@@ -0,0 +1,283 @@
+package config
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Key returns the name of the setting in config files, the name of the
+// variable in lower case without the KITE_ prefix, e.g. kontrol_url for
+// KITE_KONTROL_URL.
+func (v EnvironmentVariable) Key() string {
+	return strings.ToLower(strings.TrimPrefix(v.Name, "KITE_"))
+}
+
+// Flag returns the name of the command line flag of the setting, the key
+// with dashes instead of underscores, e.g. kontrol-url for KITE_KONTROL_URL.
+func (v EnvironmentVariable) Flag() string {
+	return strings.Replace(v.Key(), "_", "-", -1)
+}
+
+// KeyError is an error about the value of a setting.
+type KeyError struct {
+	Key string // Key of the setting, as in config files.
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Key, e.Err)
+}
+
+// Load builds a Config from the following layers, every one of which takes
+// precedence over the previous ones:
+//
+//   - the defaults
+//   - the kite.key of the user, if it exists
+//   - the config file at path, unless path is empty
+//   - the KITE_* environment variables
+//   - the command line flags in args
+//
+// The resulting Config is validated, so errors refer to the setting
+// responsible for them instead of surfacing when the kite is run.
+func Load(path string, args []string) (*Config, error) {
+	c := New()
+	c.source = &loadSource{path: path, args: append([]string(nil), args...)}
+
+	if err := c.ReadKiteKey(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if path != "" {
+		if err := c.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.ReadEnvironmentVariables(); err != nil {
+		return nil, err
+	}
+
+	fs := flag.NewFlagSet("kite", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	c.AddFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// loadSource is what Load built a Config from.
+type loadSource struct {
+	path string
+	args []string
+}
+
+// Reload builds the Config again with Load, from the config file and the
+// arguments c was built from, so changes made to the file or the
+// environment since are read. It fails if c was not built by Load.
+func (c *Config) Reload() (*Config, error) {
+	if c.source == nil {
+		return nil, errors.New("config: not built by Load, nothing to reload it from")
+	}
+
+	return Load(c.source.path, c.source.args)
+}
+
+// IsSet reports whether the setting of the environment variable with the
+// given name, e.g. KITE_RATE_LIMIT, was given by a config file, the
+// environment or a flag when c was read, even if to its zero value.
+func (c *Config) IsSet(name string) bool {
+	return c.set[name]
+}
+
+func (c *Config) markSet(name string) {
+	if c.set == nil {
+		c.set = make(map[string]bool)
+	}
+	c.set[name] = true
+}
+
+// ReadFile overrides the fields of c with the settings of a config file. The
+// format of the file is given by its extension, .toml, .yaml, .yml or .json.
+// The settings are named by the keys of EnvironmentVariables and take the
+// same values as the variables; durations are given as strings like "10s"
+// and settings with several values, like allowed_users, may be given as
+// lists. Unknown settings are an error.
+func (c *Config) ReadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	settings := make(map[string]interface{})
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		err = toml.Unmarshal(data, &settings)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &settings)
+	case ".json":
+		err = json.Unmarshal(data, &settings)
+	default:
+		return fmt.Errorf("%s: unknown config file format %q", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v, ok := lookupKey(key)
+		if !ok {
+			return fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+
+		value, err := scalarString(settings[key])
+		if err == nil {
+			err = v.Set(c, value)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, &KeyError{Key: key, Err: err})
+		}
+		c.markSet(v.Name)
+	}
+
+	return nil
+}
+
+// AddFlags defines a flag for every setting on fs, named after
+// EnvironmentVariable.Flag. Flags which are set override the fields of c
+// when fs is parsed.
+func (c *Config) AddFlags(fs *flag.FlagSet) {
+	for _, v := range EnvironmentVariables {
+		fs.Var(&configFlag{c: c, v: v}, v.Flag(), "sets "+v.Name)
+	}
+}
+
+// configFlag is a flag.Value setting a field of a Config.
+type configFlag struct {
+	c     *Config
+	v     EnvironmentVariable
+	value string
+}
+
+func (f *configFlag) String() string {
+	return f.value
+}
+
+func (f *configFlag) Set(value string) error {
+	if err := f.v.Set(f.c, value); err != nil {
+		return err
+	}
+	f.c.markSet(f.v.Name)
+
+	f.value = value
+	return nil
+}
+
+// Validate checks the settings of c which would otherwise only fail once the
+// kite is run or connects to Kontrol. The returned error is a *KeyError.
+func (c *Config) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return &KeyError{Key: "port", Err: fmt.Errorf("%d is out of range", c.Port)}
+	}
+
+	if c.Timeout <= 0 {
+		return &KeyError{Key: "timeout", Err: fmt.Errorf("%s is not positive", c.Timeout)}
+	}
+
+	if c.SockJS != nil && c.SockJS.HeartbeatDelay >= c.Timeout {
+		return &KeyError{Key: "timeout", Err: fmt.Errorf("%s must be greater than heartbeat_delay %s",
+			c.Timeout, c.SockJS.HeartbeatDelay)}
+	}
+
+	if c.KontrolURL != "" {
+		u, err := url.Parse(c.KontrolURL)
+		if err == nil && (u.Scheme == "" || u.Host == "") {
+			err = fmt.Errorf("%q is not an absolute URL", c.KontrolURL)
+		}
+		if err != nil {
+			return &KeyError{Key: "kontrol_url", Err: err}
+		}
+	}
+
+	switch {
+	case c.TLSCertFile == "" && c.TLSKeyFile == "":
+	case c.TLSCertFile == "":
+		return &KeyError{Key: "tls_cert_file", Err: fmt.Errorf("must be set together with tls_key_file")}
+	case c.TLSKeyFile == "":
+		return &KeyError{Key: "tls_key_file", Err: fmt.Errorf("must be set together with tls_cert_file")}
+	default:
+		if _, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile); err != nil {
+			return &KeyError{Key: "tls_cert_file", Err: err}
+		}
+	}
+
+	return nil
+}
+
+func lookupKey(key string) (EnvironmentVariable, bool) {
+	for _, v := range EnvironmentVariables {
+		if v.Key() == key {
+			return v, true
+		}
+	}
+	return EnvironmentVariable{}, false
+}
+
+// scalarString formats a value decoded from a config file like the value
+// of an environment variable. Lists are joined with commas.
+func scalarString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			if _, ok := item.([]interface{}); ok {
+				return "", fmt.Errorf("%v is not a list of strings, numbers or booleans", v)
+			}
+
+			s, err := scalarString(item)
+			if err != nil {
+				return "", err
+			}
+			values[i] = s
+		}
+		return strings.Join(values, ","), nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("%v is not a string, number or boolean", v)
+	}
+}
@@ -0,0 +1,185 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func writeConfigFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kiteconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("KITE_HOME", dir)
+	defer os.Unsetenv("KITE_HOME")
+
+	files := map[string]string{
+		"kite.toml": `
+username = "john"
+port = 4000
+region = "eu"
+timeout = "20s"
+disable_authentication = true
+allowed_users = ["john", "jane"]
+`,
+		"kite.yaml": `
+username: john
+port: 4000
+region: eu
+timeout: 20s
+disable_authentication: true
+allowed_users: [john, jane]
+`,
+		"kite.json": `{
+	"username": "john",
+	"port": 4000,
+	"region": "eu",
+	"timeout": "20s",
+	"disable_authentication": true,
+	"allowed_users": ["john", "jane"]
+}`,
+	}
+
+	os.Setenv("KITE_REGION", "us")
+	defer os.Unsetenv("KITE_REGION")
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfigFile(t, dir, name, content)
+
+			c, err := config.Load(path, []string{"-port", "5000"})
+			if err != nil {
+				t.Fatalf("Load()=%s", err)
+			}
+
+			if c.Username != "john" {
+				t.Errorf("got username %q, want %q", c.Username, "john")
+			}
+
+			if c.Port != 5000 {
+				t.Errorf("got port %d, want flag value 5000", c.Port)
+			}
+
+			if c.Region != "us" {
+				t.Errorf("got region %q, want environment value %q", c.Region, "us")
+			}
+
+			if c.Timeout != 20*time.Second {
+				t.Errorf("got timeout %s, want 20s", c.Timeout)
+			}
+
+			if !c.DisableAuthentication {
+				t.Error("want authentication disabled")
+			}
+
+			if !reflect.DeepEqual(c.AllowedUsers, []string{"john", "jane"}) {
+				t.Errorf("got allowed users %v, want [john jane]", c.AllowedUsers)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kiteconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("KITE_HOME", dir)
+	defer os.Unsetenv("KITE_HOME")
+
+	cases := []struct {
+		name    string
+		content string
+		args    []string
+		want    string
+	}{
+		{"unknown.toml", `prot = 4000`, nil, `unknown setting "prot"`},
+		{"port.toml", `port = "abc"`, nil, "invalid port"},
+		{"range.yaml", `port: 70000`, nil, "invalid port"},
+		{"timeout.yaml", `timeout: 10`, nil, "invalid timeout"},
+		{"heartbeat.yaml", `timeout: 5s`, nil, "invalid timeout"},
+		{"kontrol.json", `{"kontrol_url": "koding.com"}`, nil, "invalid kontrol_url"},
+		{"tls.toml", `tls_cert_file = "cert.pem"`, nil, "invalid tls_key_file"},
+		{"nested.yaml", "username:\n  first: john", nil, "invalid username"},
+		{"flag.toml", ``, []string{"-transport", "Carrier"}, "-transport"},
+		{"kite.ini", ``, nil, "unknown config file format"},
+	}
+
+	for _, cas := range cases {
+		t.Run(cas.name, func(t *testing.T) {
+			path := writeConfigFile(t, dir, cas.name, cas.content)
+
+			_, err := config.Load(path, cas.args)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !strings.Contains(err.Error(), cas.want) {
+				t.Fatalf("got %q, want it to contain %q", err, cas.want)
+			}
+		})
+	}
+}
+
+func TestLoadReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kiteconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("KITE_HOME", dir)
+	defer os.Unsetenv("KITE_HOME")
+
+	path := writeConfigFile(t, dir, "kite.toml", `rate_limit = 0`)
+
+	c, err := config.Load(path, []string{"-log-level=debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{
+		"KITE_RATE_LIMIT":    true,
+		"KITE_LOG_LEVEL":     true,
+		"KITE_ALLOWED_USERS": false,
+	} {
+		if got := c.IsSet(name); got != want {
+			t.Errorf("IsSet(%q)=%t, want %t", name, got, want)
+		}
+	}
+
+	writeConfigFile(t, dir, "kite.toml", `allowed_users = ["john"]`)
+
+	c, err = c.Copy().Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(c.AllowedUsers, []string{"john"}) || c.LogLevel != "DEBUG" || !c.IsSet("KITE_ALLOWED_USERS") {
+		t.Fatalf("got allowed users %v and log level %q, want the changed file read with the flags",
+			c.AllowedUsers, c.LogLevel)
+	}
+
+	if _, err := config.New().Reload(); err == nil {
+		t.Fatal("expected Reload() to fail for a Config not built by Load")
+	}
+}
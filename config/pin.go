@@ -0,0 +1,209 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// pinPrefix is the prefix of public key pins, which name the hash function
+// like the pins of HTTP Public Key Pinning (RFC 7469) do.
+const pinPrefix = "sha256/"
+
+// TLSPin restricts the certificates accepted from a TLS server beyond the
+// verification against the trust store of the system.
+type TLSPin struct {
+	// RootCAs, if not nil, are the only CAs whose certificates are trusted
+	// instead of the ones of the system.
+	RootCAs *x509.CertPool
+
+	// PublicKeys, if not empty, are the pins of the public keys of which
+	// at least one must be in the verified certificate chain of the server,
+	// either the key of the server itself or of a CA. Pins are the base64
+	// encoded SHA-256 hashes of the DER encoded SubjectPublicKeyInfo, with
+	// the "sha256/" prefix, as returned by PublicKeyPin.
+	PublicKeys []string
+}
+
+// PublicKeyPin returns the pin of the public key of the certificate, as
+// used in TLSPin.PublicKeys.
+func PublicKeyPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ParsePin returns the pin in the form of PublicKeyPin. The "sha256/"
+// prefix is optional.
+func ParsePin(pin string) (string, error) {
+	hash := strings.TrimPrefix(strings.TrimSpace(pin), pinPrefix)
+
+	p, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil || len(p) != sha256.Size {
+		return "", fmt.Errorf("%q is not a base64 encoded SHA-256 hash", pin)
+	}
+
+	return pinPrefix + hash, nil
+}
+
+// Copy returns a copy of p. The RootCAs pool is shared.
+func (p *TLSPin) Copy() *TLSPin {
+	if p == nil {
+		return nil
+	}
+
+	copy := *p
+	copy.PublicKeys = append([]string(nil), p.PublicKeys...)
+	return &copy
+}
+
+// TLSConfig returns a copy of base, which may be nil, verifying servers
+// against the pins.
+func (p *TLSPin) TLSConfig(base *tls.Config) *tls.Config {
+	cfg := &tls.Config{}
+	if base != nil {
+		cfg = base.Clone()
+	}
+
+	if p.RootCAs != nil {
+		cfg.RootCAs = p.RootCAs
+	}
+
+	if len(p.PublicKeys) != 0 {
+		verify := cfg.VerifyPeerCertificate
+		cfg.VerifyPeerCertificate = func(raw [][]byte, chains [][]*x509.Certificate) error {
+			if err := p.verify(chains); err != nil {
+				return err
+			}
+			if verify != nil {
+				return verify(raw, chains)
+			}
+			return nil
+		}
+
+		// VerifyPeerCertificate is not called for resumed sessions, which
+		// would skip the pins, so sessions are never resumed.
+		cfg.ClientSessionCache = nil
+		cfg.SessionTicketsDisabled = true
+	}
+
+	return cfg
+}
+
+func (p *TLSPin) verify(chains [][]*x509.Certificate) error {
+	for _, chain := range chains {
+		for _, cert := range chain {
+			pin := PublicKeyPin(cert)
+			for _, want := range p.PublicKeys {
+				if pin == want {
+					return nil
+				}
+			}
+		}
+	}
+
+	if len(chains) == 0 {
+		return errors.New("certificate of the server is not verified, cannot check pinned public keys")
+	}
+
+	return fmt.Errorf("no pinned public key in the certificate chain of %s", chains[0][0].Subject)
+}
+
+// Pinned returns a copy of c whose XHR, Client and Websocket clients verify
+// servers against the pin. It is used for the connections to Kontrol and to
+// proxy kites, see KontrolTLS and ProxyTLS. If pin is nil, c is returned.
+//
+// The clients must use the default transport or an *http.Transport, any
+// other http.RoundTripper cannot be pinned.
+func (c *Config) Pinned(pin *TLSPin) (*Config, error) {
+	if pin == nil {
+		return c, nil
+	}
+
+	copy := c.Copy()
+
+	for _, client := range []*http.Client{copy.XHR, copy.Client} {
+		if client == nil {
+			continue
+		}
+
+		var t *http.Transport
+
+		switch rt := client.Transport.(type) {
+		case nil:
+			t = http.DefaultTransport.(*http.Transport).Clone()
+		case *http.Transport:
+			t = rt.Clone()
+		default:
+			return nil, fmt.Errorf("cannot pin certificates of the %T HTTP transport", rt)
+		}
+
+		t.TLSClientConfig = pin.TLSConfig(t.TLSClientConfig)
+		client.Transport = t
+	}
+
+	if copy.Websocket != nil {
+		copy.Websocket.TLSClientConfig = pin.TLSConfig(copy.Websocket.TLSClientConfig)
+	}
+
+	return copy, nil
+}
+
+// caFileVar returns the setter of variables naming a file of PEM encoded
+// CA certificates, which become the RootCAs of the pin.
+func caFileVar(field func(*Config) **TLSPin) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		pem, err := ioutil.ReadFile(v)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no PEM encoded certificates found")
+		}
+
+		pin := (*field(c)).Copy()
+		if pin == nil {
+			pin = &TLSPin{}
+		}
+
+		pin.RootCAs = pool
+		*field(c) = pin
+		return nil
+	}
+}
+
+// pinsVar returns the setter of variables holding comma separated public
+// key pins.
+func pinsVar(field func(*Config) **TLSPin) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		var pins []string
+		for _, item := range strings.Split(v, ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+
+			pin, err := ParsePin(item)
+			if err != nil {
+				return err
+			}
+
+			pins = append(pins, pin)
+		}
+
+		pin := (*field(c)).Copy()
+		if pin == nil {
+			pin = &TLSPin{}
+		}
+
+		pin.PublicKeys = pins
+		*field(c) = pin
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+package config_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+func TestPinned(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	}))
+	defer srv.Close()
+
+	cert := srv.Certificate()
+	other := sha256.Sum256([]byte("other key"))
+	otherPin := "sha256/" + base64.StdEncoding.EncodeToString(other[:])
+
+	dir, err := ioutil.TempDir("", "kite-pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		env  map[string]string
+		err  string
+	}{{
+		name: "system trust store",
+		err:  "certificate",
+	}, {
+		name: "ca file",
+		env:  map[string]string{"KITE_KONTROL_CA_FILE": caFile},
+	}, {
+		name: "matching pin",
+		env: map[string]string{
+			"KITE_KONTROL_CA_FILE": caFile,
+			"KITE_KONTROL_PINS":    otherPin + "," + strings.TrimPrefix(config.PublicKeyPin(cert), "sha256/"),
+		},
+	}, {
+		name: "other pin",
+		env: map[string]string{
+			"KITE_KONTROL_CA_FILE": caFile,
+			"KITE_KONTROL_PINS":    otherPin,
+		},
+		err: "no pinned public key",
+	}}
+
+	for _, cas := range cases {
+		t.Run(cas.name, func(t *testing.T) {
+			for k, v := range cas.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+
+			c := config.New()
+			if err := c.ReadEnvironmentVariables(); err != nil {
+				t.Fatal(err)
+			}
+
+			pinned, err := c.Pinned(c.KontrolTLS)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := pinned.Client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			switch {
+			case cas.err == "" && err != nil:
+				t.Fatalf("got %s, want no error", err)
+			case cas.err != "" && (err == nil || !strings.Contains(err.Error(), cas.err)):
+				t.Fatalf("got %v, want error containing %q", err, cas.err)
+			}
+		})
+	}
+
+	if c := config.New(); c.Client.Transport != nil {
+		t.Fatalf("pinning changed the default transport")
+	}
+}
+
+func TestParsePin(t *testing.T) {
+	if _, err := config.ParsePin("sha256/bm90IGEgaGFzaA=="); err == nil {
+		t.Fatal("want error for a pin which is not a SHA-256 hash")
+	}
+
+	os.Setenv("KITE_PROXY_PINS", "invalid")
+	defer os.Unsetenv("KITE_PROXY_PINS")
+
+	if err := config.New().ReadEnvironmentVariables(); err == nil || !strings.Contains(err.Error(), "KITE_PROXY_PINS") {
+		t.Fatalf("got %v, want error naming KITE_PROXY_PINS", err)
+	}
+}
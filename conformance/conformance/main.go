@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/conformance"
+)
+
+var (
+	flagIP        = flag.String("ip", "0.0.0.0", "Listening IP")
+	flagPort      = flag.Int("port", 4567, "Server port to bind")
+	flagCheck     = flag.String("check", "", "Kite URL of a conformance kite to run the conformance cases against, instead of serving one")
+	flagTransport = flag.String("transport", "WebSocket", "Transport the cases are run over: WebSocket or XHRPolling")
+	flagUsername  = flag.String("username", "conformance", "Username the cases authenticate as")
+)
+
+func main() {
+	flag.Parse()
+
+	if *flagCheck == "" {
+		k := conformance.New()
+		k.Config.IP = *flagIP
+		k.Config.Port = *flagPort
+		k.Run()
+		return
+	}
+
+	transport, ok := config.Transports[*flagTransport]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown transport %q\n", *flagTransport)
+		os.Exit(2)
+	}
+
+	local := kite.New("conformance-driver", "1.0.0")
+	local.Config.Transport = transport
+
+	d := &conformance.Driver{
+		Local:    local,
+		URL:      *flagCheck,
+		Username: *flagUsername,
+	}
+
+	failed := 0
+	for _, res := range d.Run() {
+		if res.Err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %s\n", res.Name, res.Err)
+		} else {
+			fmt.Printf("ok    %s\n", res.Name)
+		}
+	}
+
+	if failed != 0 {
+		fmt.Printf("%d cases failed\n", failed)
+		os.Exit(1)
+	}
+}
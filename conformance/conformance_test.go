@@ -0,0 +1,39 @@
+package conformance_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	k := conformance.New()
+	k.Config.Port = 0
+	go k.Run()
+	<-k.ServerReadyNotify()
+	defer k.Close()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port())
+
+	for _, transport := range []config.Transport{config.WebSocket, config.XHRPolling} {
+		t.Run(transport.String(), func(t *testing.T) {
+			local := kite.New("driver", "1.0.0")
+			local.Config.Transport = transport
+			defer local.Close()
+
+			d := &conformance.Driver{
+				Local: local,
+				URL:   url,
+			}
+
+			for _, res := range d.Run() {
+				if res.Err != nil {
+					t.Errorf("%s: %s", res.Name, res.Err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package conformance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/kitetest"
+)
+
+// Driver runs the conformance cases against a conformance kite, each case
+// over a connection of its own.
+type Driver struct {
+	// Local is the kite creating the clients. Its config gives the
+	// transport, see config.Config.Transport. If nil, a new kite is used.
+	Local *kite.Kite
+
+	// URL is the kite URL of the conformance kite.
+	URL string
+
+	// Username the clients authenticate as, with the fake credentials of
+	// the kitetest package. Defaults to "conformance".
+	Username string
+
+	// Timeout of the calls, 10s by default.
+	Timeout time.Duration
+}
+
+// Result is the result of a conformance case.
+type Result struct {
+	Name string
+	Err  error // nil if the case passed
+}
+
+type testCase struct {
+	name string
+	run  func(d *Driver, c *kite.Client) error
+}
+
+var cases = []testCase{
+	{"handshake", testHandshake},
+	{"echo", testEcho},
+	{"large payload", testLargePayload},
+	{"add", testAdd},
+	{"authentication required", testAuthRequired},
+	{"unknown authentication type", testUnknownAuth},
+	{"authentication", testAuth},
+	{"error", testError},
+	{"generic error", testGenericError},
+	{"argument error", testArgumentError},
+	{"callback", testCallback},
+	{"stream", testStream},
+	{"nested callback", testNested},
+	{"concurrent calls", testConcurrent},
+	{"timeout", testTimeout},
+	{"unknown method", testUnknownMethod},
+}
+
+// Run runs all cases and returns their results, in order.
+func (d *Driver) Run() []Result {
+	results := make([]Result, 0, len(cases))
+
+	for _, tc := range cases {
+		results = append(results, Result{
+			Name: tc.name,
+			Err:  d.runCase(tc),
+		})
+	}
+
+	return results
+}
+
+func (d *Driver) runCase(tc testCase) error {
+	local := d.Local
+	if local == nil {
+		local = kite.New("conformance-driver", "1.0.0")
+		defer local.Close()
+	}
+
+	c := local.NewClient(d.URL)
+	c.Auth = kitetest.Auth(d.username())
+
+	if err := c.DialTimeout(d.timeout()); err != nil {
+		return fmt.Errorf("dial: %s", err)
+	}
+	defer c.Close()
+
+	return tc.run(d, c)
+}
+
+func (d *Driver) username() string {
+	if d.Username != "" {
+		return d.Username
+	}
+	return "conformance"
+}
+
+func (d *Driver) timeout() time.Duration {
+	if d.Timeout != 0 {
+		return d.Timeout
+	}
+	return 10 * time.Second
+}
+
+func (d *Driver) tell(c *kite.Client, method string, args ...interface{}) (*dnode.Partial, error) {
+	return c.TellWithTimeout(Prefix+method, d.timeout(), args...)
+}
+
+// expect calls the method and compares its result with want, after both are
+// normalized by a JSON round trip.
+func (d *Driver) expect(c *kite.Client, want interface{}, method string, args ...interface{}) error {
+	res, err := d.tell(c, method, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %s", method, err)
+	}
+
+	// A null result is given as a nil partial.
+	var got interface{}
+	if res != nil {
+		if err := res.Unmarshal(&got); err != nil {
+			return fmt.Errorf("%s: %s", method, err)
+		}
+	}
+
+	if want, err = normalize(want); err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("%s: got %#v, want %#v", method, got, want)
+	}
+
+	return nil
+}
+
+// expectError calls the method and checks it fails with an error of the
+// type.
+func (d *Driver) expectError(c *kite.Client, typ, method string, args ...interface{}) (*kite.Error, error) {
+	_, err := d.tell(c, method, args...)
+	if err == nil {
+		return nil, fmt.Errorf("%s: got no error, want %s", method, typ)
+	}
+
+	kerr, ok := err.(*kite.Error)
+	if !ok || kerr.Type != typ {
+		return nil, fmt.Errorf("%s: got error %q, want %s", method, err, typ)
+	}
+
+	return kerr, nil
+}
+
+func normalize(v interface{}) (interface{}, error) {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var n interface{}
+	err = json.Unmarshal(p, &n)
+	return n, err
+}
+
+func testHandshake(d *Driver, c *kite.Client) error {
+	c.Auth = nil
+	return d.expect(c, "ok", "anonymous")
+}
+
+func testEcho(d *Driver, c *kite.Client) error {
+	values := []interface{}{
+		"hello",
+		"unicode ✓ 世界, escapes \" \\ \n \u0000 and  ",
+		"",
+		42,
+		-1.5e-10,
+		true,
+		false,
+		nil,
+		[]interface{}{},
+		[]interface{}{1, "a", nil, []interface{}{true}},
+		map[string]interface{}{},
+		map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{1, 2}}, "": "empty key"},
+	}
+
+	for _, v := range values {
+		if err := d.expect(c, v, "echo", v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func testLargePayload(d *Driver, c *kite.Client) error {
+	const n = 1 << 20
+
+	if err := d.expect(c, strings.Repeat("y", n), "echo", strings.Repeat("y", n)); err != nil {
+		return err
+	}
+
+	return d.expect(c, strings.Repeat("x", n), "size", n)
+}
+
+func testAdd(d *Driver, c *kite.Client) error {
+	if err := d.expect(c, 6.5, "add", 1, 2, 3.5); err != nil {
+		return err
+	}
+
+	return d.expect(c, 0, "add")
+}
+
+func testAuthRequired(d *Driver, c *kite.Client) error {
+	c.Auth = nil
+	_, err := d.expectError(c, "authenticationError", "whoami")
+	return err
+}
+
+func testUnknownAuth(d *Driver, c *kite.Client) error {
+	c.Auth = &kite.Auth{Type: "conformance-unknown", Key: "key"}
+	_, err := d.expectError(c, "authenticationError", "whoami")
+	return err
+}
+
+func testAuth(d *Driver, c *kite.Client) error {
+	return d.expect(c, d.username(), "whoami")
+}
+
+func testError(d *Driver, c *kite.Client) error {
+	args := map[string]string{
+		"type":    "conformanceError",
+		"message": "expected failure",
+		"code":    "E42",
+	}
+
+	kerr, err := d.expectError(c, "conformanceError", "fail", args)
+	if err != nil {
+		return err
+	}
+
+	if kerr.Message != args["message"] || kerr.CodeVal != args["code"] {
+		return fmt.Errorf("fail: got %+v, want message %q and code %q", kerr, args["message"], args["code"])
+	}
+
+	return nil
+}
+
+func testGenericError(d *Driver, c *kite.Client) error {
+	kerr, err := d.expectError(c, "genericError", "failGeneric", "boom")
+	if err != nil {
+		return err
+	}
+
+	if kerr.Message != "boom" {
+		return fmt.Errorf("failGeneric: got message %q, want %q", kerr.Message, "boom")
+	}
+
+	return nil
+}
+
+func testArgumentError(d *Driver, c *kite.Client) error {
+	_, err := d.expectError(c, "argumentError", "add", "not a number")
+	return err
+}
+
+func testCallback(d *Driver, c *kite.Client) error {
+	got := make(chan interface{}, 1)
+	fn := dnode.Callback(func(args *dnode.Partial) {
+		var v interface{}
+		args.One().Unmarshal(&v)
+		got <- v
+	})
+
+	if err := d.expect(c, nil, "callback", "value", fn); err != nil {
+		return err
+	}
+
+	// The callback must be called before the response is sent.
+	select {
+	case v := <-got:
+		if v != "value" {
+			return fmt.Errorf("callback: got %#v, want %q", v, "value")
+		}
+		return nil
+	default:
+		return errors.New("callback: response received before the callback was called")
+	}
+}
+
+func testStream(d *Driver, c *kite.Client) error {
+	const n = 100
+
+	var mu sync.Mutex
+	var got []float64
+
+	fn := dnode.Callback(func(args *dnode.Partial) {
+		mu.Lock()
+		got = append(got, args.One().MustFloat64())
+		mu.Unlock()
+	})
+
+	if err := d.expect(c, n, "stream", n, fn); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(got) != n {
+		return fmt.Errorf("stream: got %d calls of the callback, want %d", len(got), n)
+	}
+
+	for i, v := range got {
+		if v != float64(i) {
+			return fmt.Errorf("stream: got %v as value %d, want the values in order", v, i)
+		}
+	}
+
+	return nil
+}
+
+func testNested(d *Driver, c *kite.Client) error {
+	fn := dnode.Callback(func(args *dnode.Partial) {
+		args.One().MustFunction().Call("pong")
+	})
+
+	return d.expect(c, "pong", "nested", fn)
+}
+
+func testConcurrent(d *Driver, c *kite.Client) error {
+	const n = 50
+
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			errs <- d.expect(c, 2*i, "add", i, i)
+		}(i)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func testTimeout(d *Driver, c *kite.Client) error {
+	_, err := c.TellWithTimeout(Prefix+"sleep", 100*time.Millisecond, 1000)
+	if kerr, ok := err.(*kite.Error); !ok || kerr.Type != "timeout" {
+		return fmt.Errorf("sleep: got %v, want timeout", err)
+	}
+
+	// The connection must survive the late response.
+	time.Sleep(time.Second)
+
+	return d.expect(c, "after timeout", "echo", "after timeout")
+}
+
+func testUnknownMethod(d *Driver, c *kite.Client) error {
+	if _, err := c.TellWithTimeout(Prefix+"unknown", time.Second); err == nil {
+		return errors.New("unknown: got a result, want an error or no response")
+	}
+
+	// The connection must survive calls of unknown methods.
+	return d.expect(c, "ok", "anonymous")
+}
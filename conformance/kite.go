@@ -0,0 +1,200 @@
+// Package conformance provides a kite exporting a standard set of methods
+// and a driver exercising them, for verifying that implementations of the
+// kite protocol in other languages are compatible with this one.
+//
+// An alternative client is verified by running its own tests against the
+// reference kite, started with:
+//
+//	conformance -port 4567
+//
+// An alternative server implementing the methods below is verified by the
+// driver of this package, with:
+//
+//	conformance -check http://127.0.0.1:4567/kite
+//
+// The methods of the conformance kite, all of them taking their arguments
+// as the "withArgs" array of a kite call, are:
+//
+//	conformance.echo(value)             returns value
+//	conformance.add(numbers...)         returns the sum of the numbers
+//	conformance.whoami()                returns the authenticated username
+//	conformance.anonymous()             returns "ok", with no authentication
+//	conformance.fail({type, message, code})
+//	                                    fails with an error of the type,
+//	                                    message and code
+//	conformance.failGeneric(message)    fails with a "genericError"
+//	conformance.callback(value, fn)     calls fn(value), then returns null
+//	conformance.stream(n, fn)           calls fn(0) ... fn(n-1) in order,
+//	                                    then returns n
+//	conformance.nested(fn)              calls fn(reply), where reply is a
+//	                                    function of the server, and returns
+//	                                    the value fn passes to reply
+//	conformance.sleep(ms)               returns ms after sleeping for ms
+//	                                    milliseconds
+//	conformance.size(n)                 returns a string of n "x" bytes
+//
+// Clients authenticate with the fake credentials of the kitetest package,
+// {"type": "kitetest", "key": "<username>"}, besides the kite keys and
+// tokens of a kontrol configured for the kite.
+package conformance
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/kitetest"
+)
+
+// Prefix is the prefix of the names of the conformance methods.
+const Prefix = "conformance."
+
+// nestedTimeout is how long conformance.nested waits for its reply function
+// to be called.
+const nestedTimeout = 10 * time.Second
+
+// maxSize limits the strings returned by conformance.size.
+const maxSize = 64 << 20
+
+// New returns a new conformance kite.
+func New() *kite.Kite {
+	k := kite.New("conformance", "1.0.0")
+	HandleMethods(k)
+	return k
+}
+
+// HandleMethods adds the conformance methods and the fake authentication of
+// the kitetest package to k.
+func HandleMethods(k *kite.Kite) {
+	kitetest.FakeAuth(k)
+
+	k.HandleFunc(Prefix+"echo", echo)
+	k.HandleFunc(Prefix+"add", add)
+	k.HandleFunc(Prefix+"whoami", whoami)
+	k.HandleFunc(Prefix+"anonymous", anonymous).DisableAuthentication()
+	k.HandleFunc(Prefix+"fail", fail)
+	k.HandleFunc(Prefix+"failGeneric", failGeneric)
+	k.HandleFunc(Prefix+"callback", callback)
+	k.HandleFunc(Prefix+"stream", stream)
+	k.HandleFunc(Prefix+"nested", nested)
+	k.HandleFunc(Prefix+"sleep", sleep)
+	k.HandleFunc(Prefix+"size", size)
+}
+
+func echo(r *kite.Request) (interface{}, error) {
+	// A null argument is given as a nil partial.
+	arg := r.Args.One()
+	if arg == nil {
+		return nil, nil
+	}
+
+	var v interface{}
+	arg.MustUnmarshal(&v)
+	return v, nil
+}
+
+func add(r *kite.Request) (interface{}, error) {
+	var sum float64
+	if r.Args == nil {
+		return sum, nil
+	}
+
+	for _, arg := range r.Args.MustSlice() {
+		sum += arg.MustFloat64()
+	}
+	return sum, nil
+}
+
+func whoami(r *kite.Request) (interface{}, error) {
+	return r.Username, nil
+}
+
+func anonymous(r *kite.Request) (interface{}, error) {
+	return "ok", nil
+}
+
+func fail(r *kite.Request) (interface{}, error) {
+	var args struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	}
+	r.Args.One().MustUnmarshal(&args)
+
+	return nil, &kite.Error{
+		Type:    args.Type,
+		Message: args.Message,
+		CodeVal: args.Code,
+	}
+}
+
+func failGeneric(r *kite.Request) (interface{}, error) {
+	return nil, errors.New(r.Args.One().MustString())
+}
+
+func callback(r *kite.Request) (interface{}, error) {
+	args := r.Args.MustSliceOfLength(2)
+
+	var v interface{}
+	if args[0] != nil {
+		args[0].MustUnmarshal(&v)
+	}
+
+	return nil, args[1].MustFunction().Call(v)
+}
+
+func stream(r *kite.Request) (interface{}, error) {
+	args := r.Args.MustSliceOfLength(2)
+	n := int(args[0].MustFloat64())
+	fn := args[1].MustFunction()
+
+	for i := 0; i < n; i++ {
+		if err := fn.Call(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+func nested(r *kite.Request) (interface{}, error) {
+	fn := r.Args.One().MustFunction()
+
+	replies := make(chan interface{}, 1)
+	reply := dnode.Callback(func(args *dnode.Partial) {
+		var v interface{}
+		args.One().Unmarshal(&v)
+
+		select {
+		case replies <- v:
+		default:
+		}
+	})
+
+	if err := fn.Call(reply); err != nil {
+		return nil, err
+	}
+
+	select {
+	case v := <-replies:
+		return v, nil
+	case <-time.After(nestedTimeout):
+		return nil, errors.New("reply function was not called")
+	}
+}
+
+func sleep(r *kite.Request) (interface{}, error) {
+	ms := r.Args.One().MustFloat64()
+	time.Sleep(time.Duration(ms * float64(time.Millisecond)))
+	return ms, nil
+}
+
+func size(r *kite.Request) (interface{}, error) {
+	n := int(r.Args.One().MustFloat64())
+	if n < 0 || n > maxSize {
+		return nil, errors.New("size out of range")
+	}
+	return strings.Repeat("x", n), nil
+}
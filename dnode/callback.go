@@ -3,6 +3,8 @@ package dnode
 import (
 	"errors"
 	"strconv"
+	"sync"
+	"time"
 )
 
 // Function is the type for sending and receiving functions in dnode messages.
@@ -29,10 +31,12 @@ func (f Function) IsValid() bool {
 }
 
 func (f Function) MarshalJSON() ([]byte, error) {
-	if _, ok := f.Caller.(callback); !ok {
+	switch f.Caller.(type) {
+	case callback, *timedCallback, *Stream:
+		return []byte(`"[Function]"`), nil
+	default:
 		return []byte(`null`), nil
 	}
-	return []byte(`"[Function]"`), nil
 }
 
 func (*Function) UnmarshalJSON(data []byte) error {
@@ -53,6 +57,87 @@ func (f callback) Call(args ...interface{}) error {
 	panic("you cannot call your own callback method")
 }
 
+// CallbackWithTimeout is like Callback, but the callback is removed once the
+// remote side has not called it for timeout, instead of Scrubber.Timeout. A
+// timeout of zero or less keeps the callback until it is removed. If expired
+// is not nil, it is called with a *CallbackTimeoutError when the callback is
+// removed because of its timeout.
+func CallbackWithTimeout(f func(*Partial), timeout time.Duration, expired func(error)) Function {
+	return Function{
+		Caller: &timedCallback{fn: f, timeout: timeout, expired: expired},
+	}
+}
+
+type timedCallback struct {
+	fn      func(*Partial)
+	timeout time.Duration
+	expired func(error)
+}
+
+func (f *timedCallback) Call(args ...interface{}) error {
+	panic("you cannot call your own callback method")
+}
+
+// Stream is a callback the remote side calls for as long as a stream lasts,
+// e.g. with the data of a forwarded connection. It has no timeout, instead
+// it is removed from the scrubbers it was sent with by Close once the
+// stream ends.
+type Stream struct {
+	fn func(*Partial)
+
+	mu     sync.Mutex
+	sent   map[*Scrubber][]uint64
+	closed bool
+}
+
+// NewStream returns a Stream calling f.
+func NewStream(f func(*Partial)) *Stream {
+	return &Stream{fn: f}
+}
+
+// Function returns the Function sending the stream callback.
+func (s *Stream) Function() Function {
+	return Function{Caller: s}
+}
+
+func (s *Stream) Call(args ...interface{}) error {
+	panic("you cannot call your own callback method")
+}
+
+// Close removes the callback from the scrubbers it was sent with, so it is
+// not called anymore. It is not registered if it is sent again.
+func (s *Stream) Close() {
+	s.mu.Lock()
+	sent := s.sent
+	s.sent = nil
+	s.closed = true
+	s.mu.Unlock()
+
+	for scrubber, ids := range sent {
+		for _, id := range ids {
+			scrubber.RemoveCallback(id)
+		}
+	}
+}
+
+// registered records the ID the callback was registered with by the
+// scrubber. It returns false if the stream is closed.
+func (s *Stream) registered(scrubber *Scrubber, id uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	if s.sent == nil {
+		s.sent = make(map[*Scrubber][]uint64)
+	}
+	s.sent[scrubber] = append(s.sent[scrubber], id)
+
+	return true
+}
+
 // functionReceived is a type implementing caller interface.
 // It is used to set the Function when a callback function is received.
 type functionReceived func(...interface{}) error
@@ -76,6 +161,10 @@ type Path []interface{}
 // parseCallbacks parses the message's "callbacks" field and prepares
 // callback functions in "arguments" field.
 func ParseCallbacks(msg *Message, sender func(id uint64, args []interface{}) error) error {
+	if msg.Arguments == nil && len(msg.Callbacks) != 0 {
+		return errors.New("callbacks given without arguments")
+	}
+
 	// Parse callbacks field and create callback functions.
 	for methodID, path := range msg.Callbacks {
 		id, err := strconv.ParseUint(methodID, 10, 64)
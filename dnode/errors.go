@@ -2,6 +2,7 @@ package dnode
 
 import (
 	"fmt"
+	"time"
 )
 
 // MethodNotFoundError is returned when there is no registered handler for
@@ -26,6 +27,17 @@ func (e CallbackNotFoundError) Error() string {
 	return fmt.Sprintf("Callback ID not found: %d", e.ID)
 }
 
+// CallbackTimeoutError is given to the expired function of a callback which
+// was removed because the remote side did not call it within its timeout.
+type CallbackTimeoutError struct {
+	ID      uint64
+	Timeout time.Duration
+}
+
+func (e *CallbackTimeoutError) Error() string {
+	return fmt.Sprintf("Callback ID %d was not called in %s", e.ID, e.Timeout)
+}
+
 // ArgumentError is returned when received message contains invalid arguments.
 type ArgumentError struct {
 	s string
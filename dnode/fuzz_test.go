@@ -0,0 +1,149 @@
+// +build go1.18
+
+package dnode
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// fuzzArgs is a struct the arguments of fuzzed messages are unmarshaled
+// into, with callbacks at every level.
+type fuzzArgs struct {
+	Name     string
+	Callback Function
+	Options  *struct {
+		Callbacks []Function
+		Nested    map[string]interface{}
+	}
+	Args  *Partial
+	Items []*Partial
+	Any   interface{}
+	Map   map[string]Function
+	hide  Function
+}
+
+// unmarshalAll unmarshals the partial into values of all kinds setCallback
+// walks, going into the nested partials. It must not panic.
+func unmarshalAll(p *Partial, depth int) {
+	if p == nil || depth > 4 {
+		return
+	}
+
+	var (
+		s   fuzzArgs
+		a   []fuzzArgs
+		i   interface{}
+		m   map[string]interface{}
+		mp  map[string]*Partial
+		sp  []*Partial
+		fn  Function
+		arr [2]Function
+	)
+
+	for _, v := range []interface{}{&s, &a, &i, &m, &mp, &sp, &fn, &arr} {
+		p.Unmarshal(v)
+	}
+
+	for _, q := range sp {
+		unmarshalAll(q, depth+1)
+	}
+
+	for _, q := range mp {
+		unmarshalAll(q, depth+1)
+	}
+
+	unmarshalAll(s.Args, depth+1)
+
+	for _, q := range s.Items {
+		unmarshalAll(q, depth+1)
+	}
+}
+
+func FuzzMessage(f *testing.F) {
+	seeds := []string{
+		`{"method":"square","arguments":[{"kite":{},"withArgs":[4],"responseCallback":"[Function]"}],"callbacks":{"0":["0","responseCallback"]}}`,
+		`{"method":0,"arguments":[null,{"result":16}],"callbacks":{}}`,
+		`{"method":"m","arguments":[{"callback":"[Function]","options":{"callbacks":["[Function]"]}}],"callbacks":{"1":[0,"callback"],"2":[0,"options","callbacks",0]}}`,
+		`{"method":"m","callbacks":{"1":[0]}}`,
+		`{"method":"m","arguments":null,"callbacks":{"1":[0]}}`,
+		`{"method":"m","arguments":[1],"callbacks":{"1":[7]}}`,
+		`{"method":"m","arguments":[1],"callbacks":{"1":[-1]}}`,
+		`{"method":"m","arguments":[{}],"callbacks":{"1":[0,""]}}`,
+		`{"method":"m","arguments":[{}],"callbacks":{"1":[0,true,null,{}]}}`,
+		`{"method":"m","arguments":[{"map":{"a":1}}],"callbacks":{"1":[0,"map",1]}}`,
+		`{"method":"m","arguments":[{"hide":1}],"callbacks":{"1":[0,"hide"]}}`,
+		`{"method":"m","arguments":[{"a":1}],"callbacks":{"x":[0]}}`,
+		`{"method":"m","arguments":[{"a":1}],"callbacks":{"1":"not a path"}}`,
+		`{"method":"m","arguments":[`,
+		`{"method":-1.5e300,"arguments":[[[[[]]]]]}`,
+		`[]`,
+		``,
+		strings.Repeat(`[`, 10000) + strings.Repeat(`]`, 10000),
+		`{"method":"m","arguments":[` + strings.Repeat(`"[Function]",`, 1000) + `0],"callbacks":{"1":[999],"2":[1000],"3":[1001]}}`,
+	}
+
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return
+		}
+
+		sender := func(uint64, []interface{}) error { return nil }
+
+		if err := ParseCallbacks(&msg, sender); err != nil {
+			return
+		}
+
+		unmarshalAll(msg.Arguments, 0)
+	})
+}
+
+func FuzzCallbackPath(f *testing.F) {
+	seeds := []struct {
+		args, path string
+	}{
+		{`[{"callback":"[Function]"}]`, `[0,"callback"]`},
+		{`[{"callback":"[Function]"}]`, `["0","callback"]`},
+		{`[1,2,3]`, `[3]`},
+		{`[1,2,3]`, `[1.5]`},
+		{`[1,2,3]`, `["x"]`},
+		{`[{"options":{"nested":{"a":null}}}]`, `[0,"options","nested","a"]`},
+		{`[{"options":{"nested":null}}]`, `[0,"options","nested","a"]`},
+		{`[{"map":{"a":"[Function]"}}]`, `[0,"map","a"]`},
+		{`[{"map":{}}]`, `[0,"map",0]`},
+		{`[{"args":[1,{"b":"[Function]"}]}]`, `[0,"args",1,"b"]`},
+		{`[{"items":[{"b":"[Function]"}]}]`, `[0,"items",0,"b"]`},
+		{`{"callback":"[Function]"}`, `["callback"]`},
+		{`[{}]`, `[0]`},
+		{`[{}]`, `[]`},
+		{`[{}]`, `[0,"name",0]`},
+		{`[{}]`, `[0,"hide"]`},
+		{`null`, `[0,null]`},
+	}
+
+	for _, seed := range seeds {
+		f.Add(seed.args, seed.path)
+	}
+
+	f.Fuzz(func(t *testing.T, args, path string) {
+		var p Path
+		if err := json.Unmarshal([]byte(path), &p); err != nil {
+			return
+		}
+
+		noop := functionReceived(func(...interface{}) error { return nil })
+
+		partial := &Partial{
+			Raw:           []byte(args),
+			CallbackSpecs: []CallbackSpec{{Path: p, Function: Function{noop}}},
+		}
+
+		unmarshalAll(partial, 0)
+	})
+}
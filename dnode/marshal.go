@@ -0,0 +1,311 @@
+package dnode
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Marshaler is the interface implemented by types controlling how they are
+// sent in dnode messages, e.g. to redact secrets, to encode values in a
+// format of their own or to send types holding funcs. The value returned by
+// MarshalDnode is sent in place of the receiver. It is scrubbed, so it may
+// contain Functions which are sent as callbacks, and encoded to JSON.
+//
+// Structs, maps and slices containing a Marshaler are sent as JSON objects
+// and arrays of their fields and elements, so the methods of such structs
+// are not sent as callbacks.
+type Marshaler interface {
+	MarshalDnode() (interface{}, error)
+}
+
+// MarshalerError is returned by Resolve when MarshalDnode fails.
+type MarshalerError struct {
+	Type reflect.Type
+	Err  error
+}
+
+func (e *MarshalerError) Error() string {
+	return fmt.Sprintf("dnode: error calling MarshalDnode for type %s: %s", e.Type, e.Err)
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// Resolve returns obj with the Marshalers it contains replaced by the
+// values they return. It is called on the arguments of a message before
+// they are scrubbed and encoded, so MarshalDnode is called once per value.
+// If obj contains no Marshaler, it is returned as is.
+func Resolve(obj interface{}) (interface{}, error) {
+	v, changed, err := resolve(reflect.ValueOf(obj), true)
+	if err != nil || !changed {
+		return obj, err
+	}
+
+	return v, nil
+}
+
+// resolve returns the value of rv with the Marshalers it contains replaced,
+// and whether it contains any. If marshal is false, rv itself is not
+// marshaled, so a MarshalDnode returning its receiver does not recurse.
+func resolve(rv reflect.Value, marshal bool) (interface{}, bool, error) {
+	if !rv.IsValid() {
+		return nil, false, nil
+	}
+
+	if m, ok := marshaler(rv); ok && marshal {
+		v, err := m.MarshalDnode()
+		if err != nil {
+			return nil, false, &MarshalerError{Type: rv.Type(), Err: err}
+		}
+
+		mv := reflect.ValueOf(v)
+		resolved, changed, err := resolve(mv, !mv.IsValid() || mv.Type() != rv.Type())
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !changed {
+			resolved = v
+		}
+
+		return resolved, true, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if rv.IsNil() {
+			return nil, false, nil
+		}
+
+		return resolve(rv.Elem(), true)
+	case reflect.Array, reflect.Slice:
+		if !mayMarshal(rv.Type().Elem()) {
+			return nil, false, nil
+		}
+
+		var out []interface{}
+
+		for i, n := 0, rv.Len(); i < n; i++ {
+			v, changed, err := resolve(rv.Index(i), true)
+			if err != nil {
+				return nil, false, err
+			}
+
+			if changed && out == nil {
+				out = make([]interface{}, n)
+				for j := 0; j < i; j++ {
+					out[j] = rv.Index(j).Interface()
+				}
+			}
+
+			if out == nil {
+				continue
+			}
+
+			if !changed {
+				v = rv.Index(i).Interface()
+			}
+
+			out[i] = v
+		}
+
+		return out, out != nil, nil
+	case reflect.Map:
+		if !mayMarshal(rv.Type().Elem()) {
+			return nil, false, nil
+		}
+
+		var out map[string]interface{}
+		keys := rv.MapKeys()
+
+		for i, key := range keys {
+			v, changed, err := resolve(rv.MapIndex(key), true)
+			if err != nil {
+				return nil, false, err
+			}
+
+			if changed && out == nil {
+				out = make(map[string]interface{}, len(keys))
+				for _, prev := range keys[:i] {
+					out[mapKey(prev)] = rv.MapIndex(prev).Interface()
+				}
+			}
+
+			if out == nil {
+				continue
+			}
+
+			if !changed {
+				v = rv.MapIndex(key).Interface()
+			}
+
+			out[mapKey(key)] = v
+		}
+
+		return out, out != nil, nil
+	case reflect.Struct:
+		// Structs encoding themselves to JSON are sent as they are.
+		if rv.Type() == dnodeFunctionType || rv.Type().Implements(jsonMarshalerType) {
+			return nil, false, nil
+		}
+
+		out := make(map[string]interface{})
+
+		changed, err := resolveFields(rv, out)
+		if err != nil || !changed {
+			return nil, false, err
+		}
+
+		return out, true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// resolveFields adds the fields of the struct rv to out, named like the json
+// package does, and reports whether any of them contains a Marshaler.
+func resolveFields(rv reflect.Value, out map[string]interface{}) (bool, error) {
+	anyChanged := false
+
+	for i := 0; i < rv.NumField(); i++ {
+		sf := rv.Type().Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported.
+			continue
+		}
+
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx != -1 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		fv := rv.Field(i)
+
+		// Fields of embedded structs are promoted, as in JSON.
+		if sf.Anonymous && name == "" {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+
+			if fv.Kind() == reflect.Struct {
+				promoted := make(map[string]interface{})
+
+				changed, err := resolveFields(fv, promoted)
+				if err != nil {
+					return false, err
+				}
+
+				// Fields of the outer struct take precedence.
+				for name, v := range promoted {
+					if _, ok := out[name]; !ok {
+						out[name] = v
+					}
+				}
+
+				anyChanged = anyChanged || changed
+				continue
+			}
+		}
+
+		if sf.PkgPath != "" || !fv.CanInterface() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmptyValue(fv) {
+			continue
+		}
+
+		v, changed, err := resolve(fv, true)
+		if err != nil {
+			return false, err
+		}
+
+		if !changed {
+			v = fv.Interface()
+		}
+
+		out[name] = v
+		anyChanged = anyChanged || changed
+	}
+
+	return anyChanged, nil
+}
+
+// marshaler returns the Marshaler implemented by rv or by its address.
+func marshaler(rv reflect.Value) (Marshaler, bool) {
+	if !rv.CanInterface() {
+		return nil, false
+	}
+
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil, false
+	}
+
+	if rv.Type().Implements(marshalerType) {
+		return rv.Interface().(Marshaler), true
+	}
+
+	if rv.CanAddr() && reflect.PtrTo(rv.Type()).Implements(marshalerType) {
+		return rv.Addr().Interface().(Marshaler), true
+	}
+
+	return nil, false
+}
+
+// mayMarshal reports whether values of type t may contain a Marshaler, so
+// the elements of e.g. large byte slices are not walked.
+func mayMarshal(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType)
+	default:
+		return true
+	}
+}
+
+// mapKey formats the key of a map like the json package does for the
+// string and integer keys.
+func mapKey(key reflect.Value) string {
+	if key.Kind() == reflect.String {
+		return key.String()
+	}
+
+	return fmt.Sprint(key.Interface())
+}
+
+// isEmptyValue reports whether the field is omitted by the omitempty
+// option of the json package.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
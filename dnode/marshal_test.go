@@ -0,0 +1,98 @@
+package dnode
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type secret string
+
+func (secret) MarshalDnode() (interface{}, error) {
+	return "***", nil
+}
+
+type handler struct {
+	fn func(*Partial)
+}
+
+func (h *handler) MarshalDnode() (interface{}, error) {
+	return map[string]interface{}{"call": Callback(h.fn)}, nil
+}
+
+type self struct {
+	A int `json:"a"`
+}
+
+func (s self) MarshalDnode() (interface{}, error) {
+	return s, nil
+}
+
+type failing struct{}
+
+func (failing) MarshalDnode() (interface{}, error) {
+	return nil, errors.New("cannot marshal")
+}
+
+func TestResolve(t *testing.T) {
+	type login struct {
+		User     string   `json:"user"`
+		Password secret   `json:"password"`
+		Token    *secret  `json:"token,omitempty"`
+		Handler  *handler `json:"handler"`
+		Done     Function `json:"done"`
+	}
+
+	args := []interface{}{
+		login{
+			User:     "kite",
+			Password: "hunter2",
+			Handler:  &handler{fn: func(*Partial) {}},
+			Done:     Callback(func(*Partial) {}),
+		},
+		self{A: 1},
+		[]byte("data"),
+	}
+
+	resolved, err := Resolve(args)
+	if err != nil {
+		t.Fatalf("Resolve()=%s", err)
+	}
+
+	raw, err := json.Marshal(resolved)
+	if err != nil {
+		t.Fatalf("Marshal()=%s", err)
+	}
+
+	want := `[{"done":"[Function]","handler":{"call":"[Function]"},"password":"***","user":"kite"},{"a":1},"ZGF0YQ=="]`
+	if string(raw) != want {
+		t.Fatalf("got %s, want %s", raw, want)
+	}
+
+	callbacks := NewScrubber().Scrub(resolved)
+	wantCallbacks := map[string]Path{
+		"0": {0, "done"},
+		"1": {0, "handler", "call"},
+	}
+
+	// The order of the callbacks follows the order of the map keys.
+	if len(callbacks) != 2 {
+		t.Fatalf("got callbacks %v, want %v", callbacks, wantCallbacks)
+	}
+
+	for _, path := range callbacks {
+		if !reflect.DeepEqual(path, wantCallbacks["0"]) && !reflect.DeepEqual(path, wantCallbacks["1"]) {
+			t.Fatalf("got callbacks %v, want %v", callbacks, wantCallbacks)
+		}
+	}
+
+	plain := []interface{}{"foo", map[string]int{"a": 1}}
+	if v, err := Resolve(plain); err != nil || !reflect.DeepEqual(v, plain) {
+		t.Fatalf("got %v, %v, want arguments without Marshalers as they are", v, err)
+	}
+
+	if _, err := Resolve([]interface{}{failing{}}); err == nil {
+		t.Fatal("expected error of MarshalDnode")
+	}
+}
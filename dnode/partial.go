@@ -1,16 +1,24 @@
 package dnode
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 // Partial is the type of "arguments" field in dnode.Message.
 type Partial struct {
 	Raw           []byte
 	CallbackSpecs []CallbackSpec
+
+	// Strict makes Unmarshal reject objects with fields unknown to the
+	// struct they are decoded into and values of the wrong type with an
+	// *ArgumentError, instead of decoding what fits. The partials given by
+	// Slice, Map and their variants inherit it.
+	Strict bool
 }
 
 // MarshalJSON returns the raw bytes of the Partial.
@@ -36,7 +44,14 @@ func (p *Partial) Unmarshal(v interface{}) error {
 		return fmt.Errorf("Cannot unmarshal nil argument")
 	}
 
-	if err := json.Unmarshal(p.Raw, &v); err != nil {
+	if p.Strict {
+		dec := json.NewDecoder(bytes.NewReader(p.Raw))
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(&v); err != nil {
+			return strictError(err)
+		}
+	} else if err := json.Unmarshal(p.Raw, &v); err != nil {
 		return fmt.Errorf("%s. Data: %s", err.Error(), string(p.Raw))
 	}
 
@@ -56,6 +71,26 @@ func (p *Partial) MustUnmarshal(v interface{}) {
 	checkError(err)
 }
 
+// strictError describes an error of a strict Unmarshal.
+func strictError(err error) error {
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		if e.Field != "" {
+			return &ArgumentError{fmt.Sprintf("invalid argument %q: got %s, want %s", e.Field, e.Value, e.Type)}
+		}
+		return &ArgumentError{fmt.Sprintf("invalid argument: got %s, want %s", e.Value, e.Type)}
+	case *json.SyntaxError:
+		return &ArgumentError{fmt.Sprintf("malformed arguments: %s", e)}
+	}
+
+	// The error of an unknown field is not typed.
+	if field := strings.TrimPrefix(err.Error(), "json: unknown field "); field != err.Error() {
+		return &ArgumentError{fmt.Sprintf("unknown argument %s", field)}
+	}
+
+	return &ArgumentError{err.Error()}
+}
+
 //-------------------------------------------
 // Helper methods for unmarshaling JSON types
 //-------------------------------------------
@@ -63,12 +98,17 @@ func (p *Partial) MustUnmarshal(v interface{}) {
 // Slice is a helper method to unmarshal a JSON Array.
 func (p *Partial) Slice() (a []*Partial, err error) {
 	err = p.Unmarshal(&a)
+	for _, elem := range a {
+		if elem != nil {
+			elem.Strict = p.Strict
+		}
+	}
 	return
 }
 
 // SliceOfLength is a helper method to unmarshal a JSON Array with specified length.
 func (p *Partial) SliceOfLength(length int) (a []*Partial, err error) {
-	err = p.Unmarshal(&a)
+	a, err = p.Slice()
 	if err != nil {
 		return
 	}
@@ -83,6 +123,11 @@ func (p *Partial) SliceOfLength(length int) (a []*Partial, err error) {
 // Map is a helper method to unmarshal to a JSON Object.
 func (p *Partial) Map() (m map[string]*Partial, err error) {
 	err = p.Unmarshal(&m)
+	for _, elem := range m {
+		if elem != nil {
+			elem.Strict = p.Strict
+		}
+	}
 	return
 }
 
@@ -19,3 +19,45 @@ func TestUnmarshalArguments(t *testing.T) {
 		return
 	}
 }
+
+func TestUnmarshalStrict(t *testing.T) {
+	type args struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	tests := []struct {
+		raw string
+		lax bool   // whether the lax Unmarshal succeeds
+		err string // of the strict Unmarshal
+	}{
+		{`[{"name": "kite", "count": 1}]`, true, ""},
+		{`[{"name": "kite", "cuont": 1}]`, true, `unknown argument "cuont"`},
+		{`[{"name": "kite", "count": "1"}]`, false, `invalid argument "count": got string, want int`},
+	}
+
+	for _, test := range tests {
+		arguments := &Partial{Raw: []byte(test.raw)}
+
+		var lax args
+		if err := arguments.One().Unmarshal(&lax); (err == nil) != test.lax {
+			t.Errorf("%s: got lax Unmarshal()=%v", test.raw, err)
+		}
+
+		arguments.Strict = true
+
+		var strict args
+		err := arguments.One().Unmarshal(&strict)
+
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: Unmarshal()=%s", test.raw, err)
+			}
+			continue
+		}
+
+		if _, ok := err.(*ArgumentError); !ok || err.Error() != test.err {
+			t.Errorf("%s: got %v (%T), want *ArgumentError %q", test.raw, err, err, test.err)
+		}
+	}
+}
@@ -56,7 +56,7 @@ func (s *Scrubber) collect(rv reflect.Value, path Path, callbacks map[string]Pat
 		// register callback functions wrapper.
 		if rv.Type() == dnodeFunctionType {
 			if cb := rv.Interface().(Function); cb.Caller != nil {
-				s.register(cb.Caller.(callback), path, callbacks)
+				s.register(cb.Caller, path, callbacks)
 			}
 			return
 		}
@@ -113,16 +113,30 @@ func (s *Scrubber) methods(rv reflect.Value, path Path, callbacks map[string]Pat
 
 			name := rv.Type().Method(i).Name
 			name = strings.ToLower(name[0:1]) + name[1:]
-			s.register(cb, append(path, name), callbacks)
+			s.register(callback(cb), append(path, name), callbacks)
 		}
 	}
 }
 
 // register is called when a function/method is found in arguments array. It
 // assigns an unique ID to the passed callback and stores it internally.
-func (s *Scrubber) register(cb func(*Partial), path Path, callbacks map[string]Path) {
+func (s *Scrubber) register(c caller, path Path, callbacks map[string]Path) {
+	cb := &sentCallback{}
+
+	switch c := c.(type) {
+	case callback:
+		cb.fn, cb.timeout = c, s.Timeout
+	case *timedCallback:
+		cb.fn, cb.timeout, cb.expired = c.fn, c.timeout, c.expired
+	case *Stream:
+		cb.fn = c.fn
+	default:
+		// functions received from the remote side are not sent back.
+		return
+	}
+
 	// do not register nil callbacks.
-	if cb == nil {
+	if cb.fn == nil {
 		return
 	}
 	// subtract one to start counting from zero. This is not absolutely
@@ -130,11 +144,20 @@ func (s *Scrubber) register(cb func(*Partial), path Path, callbacks map[string]P
 	next := atomic.AddUint64(&s.seq, 1) - 1
 	seq := strconv.FormatUint(next, 10)
 
-	// save in scubber callbacks.
+	// save in scubber callbacks, removing them once they time out.
 	s.Lock()
+	if cb.timeout > 0 {
+		cb.called = s.clock().Now()
+		cb.timer = s.clock().AfterFunc(cb.timeout, func() { s.expire(next, cb) })
+	}
 	s.callbacks[next] = cb
 	s.Unlock()
 
+	if stream, ok := c.(*Stream); ok && !stream.registered(s, next) {
+		s.RemoveCallback(next)
+		return
+	}
+
 	// Add to callback map to be sent to remote. Make a copy of path because it
 	// is reused in caller.
 	pathCopy := make(Path, len(path))
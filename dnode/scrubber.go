@@ -1,21 +1,44 @@
 package dnode
 
-import "sync"
+import (
+	"sync"
+	"time"
+
+	"github.com/koding/kite/clock"
+)
 
 type Scrubber struct {
 	// Next callback number.
 	// Incremented atomically by register().
 	seq uint64
 
+	// Timeout, if positive, is how long the callbacks sent without a
+	// timeout of their own wait to be called by the remote side, see
+	// CallbackWithTimeout. A callback which is not called for Timeout is
+	// removed. If zero, callbacks are kept until they are removed.
+	Timeout time.Duration
+
+	// Clock runs the timeouts of the callbacks. If nil, clock.Real is used.
+	Clock clock.Clock
+
 	// Reference to sent callbacks are saved in this map.
 	sync.Mutex // protects
-	callbacks  map[uint64]func(*Partial)
+	callbacks  map[uint64]*sentCallback
+}
+
+// sentCallback is a callback sent to the remote side.
+type sentCallback struct {
+	fn      func(*Partial)
+	timeout time.Duration // zero without a timeout
+	expired func(error)   // called when the callback times out, may be nil
+	called  time.Time     // when the callback was sent or last called
+	timer   clock.Timer
 }
 
 // New returns a pointer to a new Scrubber.
 func NewScrubber() *Scrubber {
 	return &Scrubber{
-		callbacks: make(map[uint64]func(*Partial)),
+		callbacks: make(map[uint64]*sentCallback),
 	}
 }
 
@@ -23,13 +46,59 @@ func NewScrubber() *Scrubber {
 // Can be used to remove unused callbacks to free memory.
 func (s *Scrubber) RemoveCallback(id uint64) {
 	s.Lock()
+	if cb, ok := s.callbacks[id]; ok && cb.timer != nil {
+		cb.timer.Stop()
+	}
 	delete(s.callbacks, id)
 	s.Unlock()
 }
 
+// GetCallback returns the callback with id, or nil if there is none. It is
+// called when the remote side calls the callback, which restarts its
+// timeout.
 func (s *Scrubber) GetCallback(id uint64) func(*Partial) {
 	s.Lock()
-	fn := s.callbacks[id]
+	defer s.Unlock()
+
+	cb, ok := s.callbacks[id]
+	if !ok {
+		return nil
+	}
+
+	if cb.timer != nil {
+		cb.called = s.clock().Now()
+	}
+
+	return cb.fn
+}
+
+// expire removes the callback with id once it was not called for its
+// timeout, or waits for the rest of the timeout if it was called since.
+func (s *Scrubber) expire(id uint64, cb *sentCallback) {
+	s.Lock()
+
+	if s.callbacks[id] != cb {
+		s.Unlock()
+		return
+	}
+
+	if idle := s.clock().Since(cb.called); idle < cb.timeout {
+		cb.timer.Reset(cb.timeout - idle)
+		s.Unlock()
+		return
+	}
+
+	delete(s.callbacks, id)
 	s.Unlock()
-	return fn
+
+	if cb.expired != nil {
+		cb.expired(&CallbackTimeoutError{ID: id, Timeout: cb.timeout})
+	}
+}
+
+func (s *Scrubber) clock() clock.Clock {
+	if s.Clock != nil {
+		return s.Clock
+	}
+	return clock.Real
 }
@@ -1,6 +1,11 @@
 package dnode
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/koding/kite/clock"
+)
 
 func TestScrubUnscrub(t *testing.T) {
 	scrubber := NewScrubber()
@@ -48,3 +53,110 @@ func TestScrubUnscrub(t *testing.T) {
 		t.Error("callback is not called")
 	}
 }
+
+func TestCallbackTimeout(t *testing.T) {
+	mock := clock.NewMock(time.Now())
+
+	scrubber := NewScrubber()
+	scrubber.Timeout = time.Minute
+	scrubber.Clock = mock
+
+	expired := make(chan error, 1)
+
+	scrubber.Scrub([]interface{}{
+		Callback(func(*Partial) {}),
+		CallbackWithTimeout(func(*Partial) {}, time.Hour, func(err error) { expired <- err }),
+		CallbackWithTimeout(func(*Partial) {}, 0, nil),
+		Callback(func(*Partial) {}),
+	})
+
+	has := func(id uint64) bool {
+		scrubber.Lock()
+		defer scrubber.Unlock()
+		_, ok := scrubber.callbacks[id]
+		return ok
+	}
+
+	waitRemoved := func(id uint64) {
+		for i := 0; has(id); i++ {
+			if i == 100 {
+				t.Fatalf("callback %d was not removed", id)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	scrubber.RemoveCallback(3)
+	if n := mock.Waiters(); n != 2 {
+		t.Fatalf("got %d timers, want 2 after removing a callback", n)
+	}
+
+	// Calling the callback restarts its timeout.
+	mock.Add(30 * time.Second)
+	if scrubber.GetCallback(0) == nil {
+		t.Fatal("callback 0 was removed before its timeout")
+	}
+
+	mock.Add(45 * time.Second)
+	mock.BlockUntil(2)
+
+	if !has(0) {
+		t.Fatal("callback 0 was removed although it was called")
+	}
+
+	mock.Add(time.Minute)
+	waitRemoved(0)
+
+	mock.Add(time.Hour)
+	waitRemoved(1)
+
+	select {
+	case err := <-expired:
+		if e, ok := err.(*CallbackTimeoutError); !ok || e.ID != 1 || e.Timeout != time.Hour {
+			t.Fatalf("got %v, want timeout of callback 1", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expired function was not called")
+	}
+
+	if !has(2) {
+		t.Fatal("callback without a timeout was removed")
+	}
+}
+
+func TestStream(t *testing.T) {
+	mock := clock.NewMock(time.Now())
+
+	scrubber := NewScrubber()
+	scrubber.Timeout = time.Minute
+	scrubber.Clock = mock
+
+	stream := NewStream(func(*Partial) {})
+
+	for i := 0; i < 2; i++ {
+		if callbacks := scrubber.Scrub([]interface{}{stream.Function()}); len(callbacks) != 1 {
+			t.Fatalf("got callbacks %v, want the stream", callbacks)
+		}
+	}
+
+	// Streams do not time out.
+	mock.Add(time.Hour)
+
+	if scrubber.GetCallback(0) == nil || scrubber.GetCallback(1) == nil {
+		t.Fatal("stream was removed before it was closed")
+	}
+
+	stream.Close()
+
+	if scrubber.GetCallback(0) != nil || scrubber.GetCallback(1) != nil {
+		t.Fatal("stream was not removed when closed")
+	}
+
+	if callbacks := scrubber.Scrub([]interface{}{stream.Function()}); len(callbacks) != 0 {
+		t.Fatalf("got callbacks %v, want none for a closed stream", callbacks)
+	}
+
+	if n := len(scrubber.callbacks); n != 0 {
+		t.Fatalf("got %d callbacks, want none", n)
+	}
+}
@@ -48,8 +48,15 @@ func setCallback(value reflect.Value, path Path, cb functionReceived) error {
 				}
 			case float64:
 				index = int(v)
+				if float64(index) != v {
+					return fmt.Errorf("integer expected in callback path, got '%v'.", path[i])
+				}
 			default:
-				panic(fmt.Errorf("unknown type: %#v", path[i]))
+				return fmt.Errorf("Invalid path: %#v", path[i])
+			}
+
+			if index < 0 || index >= value.Len() {
+				return fmt.Errorf("callback path index out of range: %v", path)
 			}
 
 			value = value.Index(index)
@@ -58,16 +65,30 @@ func setCallback(value reflect.Value, path Path, cb functionReceived) error {
 			if i == len(path) {
 				return fmt.Errorf("callback path too short: %v", path)
 			}
+
+			key := reflect.ValueOf(path[i])
+			if !key.IsValid() || !key.Type().AssignableTo(value.Type().Key()) {
+				return fmt.Errorf("Invalid path: %#v", path[i])
+			}
+
+			if value.IsNil() {
+				// callback path does not exist, skip
+				return nil
+			}
+
 			if i == len(path)-1 && value.Type().Elem().Kind() == reflect.Interface {
-				value.SetMapIndex(reflect.ValueOf(path[i]), reflect.ValueOf(cb))
+				value.SetMapIndex(key, reflect.ValueOf(cb))
 				return nil
 			}
-			value = value.MapIndex(reflect.ValueOf(path[i]))
+			value = value.MapIndex(key)
 			i++
 		case reflect.Ptr:
 			value = value.Elem()
 		case reflect.Interface:
 			if i == len(path) {
+				if !value.CanSet() {
+					return fmt.Errorf("cannot set callback at path: %v", path)
+				}
 				value.Set(reflect.ValueOf(cb))
 				return nil
 			}
@@ -75,23 +96,37 @@ func setCallback(value reflect.Value, path Path, cb functionReceived) error {
 		case reflect.Struct:
 			if value.Type() == reflect.TypeOf(Function{}) {
 				caller := value.FieldByName("Caller")
+				if !caller.CanSet() {
+					return fmt.Errorf("cannot set callback at path: %v", path)
+				}
 				caller.Set(reflect.ValueOf(cb))
 				return nil
 			}
 
+			if !value.CanAddr() {
+				return fmt.Errorf("cannot set callback at path: %v", path)
+			}
+
 			if innerPartial, ok := value.Addr().Interface().(*Partial); ok {
 				spec := CallbackSpec{path[i:], Function{cb}}
 				innerPartial.CallbackSpecs = append(innerPartial.CallbackSpecs, spec)
 				return nil
 			}
 
+			if i == len(path) {
+				return fmt.Errorf("callback path too short: %v", path)
+			}
+
 			// Path component may be a string or an integer.
 			name, ok := path[i].(string)
-			if !ok {
+			if !ok || name == "" {
 				return fmt.Errorf("Invalid path: %#v", path[i])
 			}
 
 			value = value.FieldByName(strings.ToUpper(name[0:1]) + name[1:])
+			if value.IsValid() && !value.CanInterface() {
+				return fmt.Errorf("Invalid path: %#v", path[i])
+			}
 			i++
 		case reflect.Func:
 			// plain func is not supported, use Function type
@@ -100,7 +135,7 @@ func setCallback(value reflect.Value, path Path, cb functionReceived) error {
 			// callback path does not exist, skip
 			return nil
 		default:
-			return fmt.Errorf("Unhandled value of kind '%v' in callback path: %s", value.Kind(), value.Interface())
+			return fmt.Errorf("Unhandled value of kind '%v' in callback path: %v", value.Kind(), path)
 		}
 	}
 }
@@ -0,0 +1,159 @@
+package kite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/koding/kite/dnode"
+)
+
+// ExecMethodName is the method which runs a command on the kite's host, see
+// HandleExec and Client.Exec.
+const ExecMethodName = "kite.exec"
+
+// ExecArgs are the arguments of the kite.exec method.
+type ExecArgs struct {
+	// Cmd is the command to run followed by its arguments.
+	Cmd []string `json:"cmd"`
+
+	// Dir is the working directory of the command, the kite's one if empty.
+	Dir string `json:"dir,omitempty"`
+
+	// Env is appended to the environment of the kite for the command.
+	Env []string `json:"env,omitempty"`
+
+	// Stdout and Stderr, if valid, are called with every chunk of output
+	// the command writes.
+	Stdout dnode.Function `json:"stdout"`
+	Stderr dnode.Function `json:"stderr"`
+}
+
+// ExecResult is the result of the kite.exec method.
+type ExecResult struct {
+	// ExitCode is the exit status of the command, or 128 plus the signal
+	// number if it was killed by a signal.
+	ExitCode int `json:"exitCode"`
+}
+
+// HandleExec registers the kite.exec method, which lets remote kites run
+// commands on this kite's host. The method returns once the command exits;
+// its output is streamed to the callbacks while it runs and it is killed if
+// the caller disconnects.
+//
+// The allow function is called with the request and the command before it
+// is run and rejects it by returning an error. If allow is nil, only the
+// user the kite itself runs as is allowed to run commands, and only with
+// authenticated requests: the username asserted by kites calling methods
+// with authentication disabled is not trusted.
+func (k *Kite) HandleExec(allow func(r *Request, cmd []string) error) *Method {
+	if allow == nil {
+		allow = func(r *Request, _ []string) error {
+			return k.allowOwner(r, "run commands")
+		}
+	}
+
+	return k.HandleFunc(ExecMethodName, func(r *Request) (interface{}, error) {
+		var args ExecArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %s", err)
+		}
+
+		if len(args.Cmd) == 0 {
+			return nil, errors.New("no command given")
+		}
+
+		if err := allow(r, args.Cmd); err != nil {
+			return nil, err
+		}
+
+		cmd := exec.CommandContext(r.Context, args.Cmd[0], args.Cmd[1:]...)
+		cmd.Dir = args.Dir
+		if len(args.Env) != 0 {
+			cmd.Env = append(os.Environ(), args.Env...)
+		}
+
+		// The command waits for the output to be copied before returning, so
+		// all of it is sent before the result.
+		if args.Stdout.IsValid() {
+			cmd.Stdout = callbackWriter(args.Stdout)
+		}
+		if args.Stderr.IsValid() {
+			cmd.Stderr = callbackWriter(args.Stderr)
+		}
+
+		k.Log.Info("Running command %q for %s", args.Cmd, r.Username)
+
+		err := cmd.Run()
+		if err == nil {
+			return ExecResult{}, nil
+		}
+
+		if e, ok := err.(*exec.ExitError); ok {
+			if ws, ok := e.Sys().(syscall.WaitStatus); ok {
+				if ws.Signaled() {
+					return ExecResult{ExitCode: 128 + int(ws.Signal())}, nil
+				}
+				return ExecResult{ExitCode: ws.ExitStatus()}, nil
+			}
+		}
+
+		return nil, err
+	})
+}
+
+// callbackWriter is an io.Writer sending what is written to a remote
+// callback.
+type callbackWriter dnode.Function
+
+func (w callbackWriter) Write(p []byte) (int, error) {
+	// The caller may reuse p after Write returns.
+	chunk := make([]byte, len(p))
+	copy(chunk, p)
+
+	if err := dnode.Function(w).Call(chunk); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Exec runs the command given by args on the remote kite, which must have
+// registered the kite.exec method with HandleExec, and returns its exit code.
+// The output of the command is copied to stdout and stderr while it runs,
+// either of which may be nil to discard it; the callbacks of args are
+// ignored.
+func (c *Client) Exec(args ExecArgs, stdout, stderr io.Writer) (int, error) {
+	args.Stdout = writerCallback(stdout)
+	args.Stderr = writerCallback(stderr)
+
+	result, err := c.Tell(ExecMethodName, args)
+	if err != nil {
+		return 0, err
+	}
+
+	var res ExecResult
+	if err := result.Unmarshal(&res); err != nil {
+		return 0, err
+	}
+
+	return res.ExitCode, nil
+}
+
+// writerCallback returns a callback copying the received chunks to w, or an
+// invalid one if w is nil.
+func writerCallback(w io.Writer) dnode.Function {
+	if w == nil {
+		return dnode.Function{}
+	}
+
+	return dnode.Callback(func(p *dnode.Partial) {
+		var data []byte
+		if err := p.One().Unmarshal(&data); err == nil {
+			w.Write(data)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package kite
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	k := New("exec", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 3739
+	k.HandleExec(func(*Request, []string) error { return nil })
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient("http://127.0.0.1:3739/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var stdout, stderr bytes.Buffer
+
+	code, err := c.Exec(ExecArgs{
+		Cmd: []string{"sh", "-c", "echo out; echo err >&2; echo $EXEC_TEST; exit 3"},
+		Env: []string{"EXEC_TEST=env"},
+	}, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("Exec()=%s", err)
+	}
+
+	if code != 3 {
+		t.Errorf("got exit code %d, want 3", code)
+	}
+
+	if got, want := stdout.String(), "out\nenv\n"; got != want {
+		t.Errorf("got stdout %q, want %q", got, want)
+	}
+
+	if got, want := stderr.String(), "err\n"; got != want {
+		t.Errorf("got stderr %q, want %q", got, want)
+	}
+
+	if _, err := c.Exec(ExecArgs{}, nil, nil); err == nil {
+		t.Error("expected an error for an empty command")
+	}
+}
+
+func TestExecRejectsAssertedOwner(t *testing.T) {
+	k := New("exec", "0.0.1")
+	k.Config.Username = "owner"
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+	k.HandleExec(nil)
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	// Without authentication the username is only claimed by the caller.
+	ck := New("exp", "0.0.1")
+	ck.Config.Username = "owner"
+
+	c := ck.NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err := c.Exec(ExecArgs{Cmd: []string{"true"}}, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "only authenticated users") {
+		t.Fatalf("Exec()=%v, want the unauthenticated request rejected", err)
+	}
+}
@@ -0,0 +1,393 @@
+// Package fault injects faults into kite sessions, for chaos testing
+// applications built on kite without external network tooling.
+//
+// An Injector wraps the sessions of a kite with the SessionHook of the kite,
+// which applies to the sessions the kite serves and the ones its clients
+// dial:
+//
+//	inj := fault.New(fault.Faults{
+//		Latency:         50 * time.Millisecond,
+//		Jitter:          20 * time.Millisecond,
+//		DropRate:        0.01,
+//		TokenExpiryRate: 0.05,
+//	})
+//	k.SessionHook = inj.Wrap
+//
+// The faults can be changed at any time with Set, and apply to the frames
+// sent and received after the change.
+package fault
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/igm/sockjs-go/sockjs"
+	"github.com/koding/kite"
+)
+
+// Faults are the faults injected into sessions. Rates are probabilities
+// between 0 and 1, applied to each frame.
+type Faults struct {
+	// Latency is added before each frame is sent, increased by a random
+	// duration up to Jitter. As frames are sent in order, the latency
+	// also limits the rate frames are sent at.
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// DropRate is the rate of frames dropped, both sent and received.
+	DropRate float64
+
+	// CorruptRate is the rate of sent frames corrupted, by truncating them
+	// or replacing one of their bytes.
+	CorruptRate float64
+
+	// DisconnectRate is the rate of frames, sent or received, on which the
+	// session is closed.
+	DisconnectRate float64
+
+	// DisconnectAfter, if not zero, closes the sessions wrapped after the
+	// duration.
+	DisconnectAfter time.Duration
+
+	// TokenExpiryRate is the rate of received calls authenticated with a
+	// token that are answered with a token-is-expired error, without being
+	// passed to the kite, as if their token expired.
+	TokenExpiryRate float64
+}
+
+// Stats count the faults injected.
+type Stats struct {
+	Delayed       int
+	Dropped       int
+	Corrupted     int
+	Disconnected  int
+	TokensExpired int
+}
+
+// Injector injects faults into the sessions it wraps.
+type Injector struct {
+	mu       sync.Mutex
+	faults   Faults
+	rand     *rand.Rand
+	stats    Stats
+	sessions map[*Session]struct{}
+}
+
+// New returns an injector of the faults.
+func New(f Faults) *Injector {
+	return &Injector{
+		faults:   f,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		sessions: make(map[*Session]struct{}),
+	}
+}
+
+// Set replaces the injected faults.
+func (i *Injector) Set(f Faults) {
+	i.mu.Lock()
+	i.faults = f
+	i.mu.Unlock()
+}
+
+// Faults returns the injected faults.
+func (i *Injector) Faults() Faults {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.faults
+}
+
+// Seed seeds the random source of the injector, for reproducible faults.
+func (i *Injector) Seed(seed int64) {
+	i.mu.Lock()
+	i.rand.Seed(seed)
+	i.mu.Unlock()
+}
+
+// Stats returns the faults injected so far.
+func (i *Injector) Stats() Stats {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.stats
+}
+
+// Wrap returns a session injecting faults into session. Its signature is
+// the one of Kite.SessionHook.
+func (i *Injector) Wrap(session sockjs.Session) sockjs.Session {
+	s := &Session{
+		Session: session,
+		inj:     i,
+		closed:  make(chan struct{}),
+	}
+
+	i.mu.Lock()
+	i.sessions[s] = struct{}{}
+	after := i.faults.DisconnectAfter
+	i.mu.Unlock()
+
+	if after > 0 {
+		time.AfterFunc(after, s.disconnect)
+	}
+
+	return s
+}
+
+// DisconnectAll closes all open sessions wrapped by the injector.
+func (i *Injector) DisconnectAll() {
+	i.mu.Lock()
+	sessions := make([]*Session, 0, len(i.sessions))
+	for s := range i.sessions {
+		sessions = append(sessions, s)
+	}
+	i.mu.Unlock()
+
+	for _, s := range sessions {
+		s.disconnect()
+	}
+}
+
+// roll reports whether an event of the rate happens, and counts it with
+// count if it does.
+func (i *Injector) roll(rate func(*Faults) float64, count func(*Stats)) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	r := rate(&i.faults)
+	if r <= 0 || i.rand.Float64() >= r {
+		return false
+	}
+
+	if count != nil {
+		count(&i.stats)
+	}
+	return true
+}
+
+func (i *Injector) delay() time.Duration {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	d := i.faults.Latency
+	if i.faults.Jitter > 0 {
+		d += time.Duration(i.rand.Int63n(int64(i.faults.Jitter)))
+	}
+
+	if d > 0 {
+		i.stats.Delayed++
+	}
+	return d
+}
+
+func (i *Injector) corrupt(msg string) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if len(msg) < 2 {
+		return "{"
+	}
+
+	n := i.rand.Intn(len(msg))
+	if i.rand.Intn(2) == 0 {
+		return msg[:n]
+	}
+
+	p := []byte(msg)
+	p[n] = byte(' ' + i.rand.Intn('~'-' '+1))
+	return string(p)
+}
+
+func (i *Injector) remove(s *Session) {
+	i.mu.Lock()
+	delete(i.sessions, s)
+	i.mu.Unlock()
+}
+
+func dropRate(f *Faults) float64        { return f.DropRate }
+func corruptRate(f *Faults) float64     { return f.CorruptRate }
+func disconnectRate(f *Faults) float64  { return f.DisconnectRate }
+func tokenExpiryRate(f *Faults) float64 { return f.TokenExpiryRate }
+
+func countDropped(s *Stats)      { s.Dropped++ }
+func countCorrupted(s *Stats)    { s.Corrupted++ }
+func countTokenExpired(s *Stats) { s.TokensExpired++ }
+
+// Session is a sockjs.Session injecting the faults of an Injector into
+// another one.
+type Session struct {
+	sockjs.Session
+
+	inj    *Injector
+	closed chan struct{}
+	once   sync.Once
+}
+
+var _ sockjs.Session = (*Session)(nil)
+
+// Recv implements the sockjs.Session interface.
+func (s *Session) Recv() (string, error) {
+	for {
+		msg, err := s.Session.Recv()
+		if err != nil {
+			s.done()
+			return msg, err
+		}
+
+		if s.inj.roll(disconnectRate, nil) {
+			s.disconnect()
+			return "", sockjs.ErrSessionNotOpen
+		}
+
+		if s.inj.roll(dropRate, countDropped) {
+			continue
+		}
+
+		if resp, ok := expiredTokenResponse(msg); ok && s.inj.roll(tokenExpiryRate, countTokenExpired) {
+			if err := s.Session.Send(resp); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		return msg, nil
+	}
+}
+
+// Send implements the sockjs.Session interface.
+func (s *Session) Send(msg string) error {
+	if s.inj.roll(disconnectRate, nil) {
+		s.disconnect()
+		return sockjs.ErrSessionNotOpen
+	}
+
+	if d := s.inj.delay(); d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-s.closed:
+			t.Stop()
+			return sockjs.ErrSessionNotOpen
+		}
+	}
+
+	if s.inj.roll(dropRate, countDropped) {
+		return nil
+	}
+
+	if s.inj.roll(corruptRate, countCorrupted) {
+		msg = s.inj.corrupt(msg)
+	}
+
+	return s.Session.Send(msg)
+}
+
+// Close implements the sockjs.Session interface.
+func (s *Session) Close(status uint32, reason string) error {
+	s.done()
+	return s.Session.Close(status, reason)
+}
+
+// RemoteAddr gives the remote address of the wrapped session, if it has
+// one.
+func (s *Session) RemoteAddr() string {
+	if r, ok := s.Session.(interface {
+		RemoteAddr() string
+	}); ok {
+		return r.RemoteAddr()
+	}
+
+	return ""
+}
+
+// disconnect closes the session as a fault, unless it is closed already.
+func (s *Session) disconnect() {
+	first := false
+	s.once.Do(func() {
+		first = true
+		s.finish()
+	})
+
+	if !first {
+		return
+	}
+
+	s.inj.mu.Lock()
+	s.inj.stats.Disconnected++
+	s.inj.mu.Unlock()
+
+	s.Session.Close(3000, "Fault injected")
+}
+
+func (s *Session) done() {
+	s.once.Do(s.finish)
+}
+
+func (s *Session) finish() {
+	close(s.closed)
+	s.inj.remove(s)
+}
+
+// expiredTokenResponse returns the response of a kite to msg if msg is a call
+// authenticated with an expired token. It returns false if msg is not a call
+// authenticated with a token.
+func expiredTokenResponse(msg string) (string, bool) {
+	var call struct {
+		Method    interface{}              `json:"method"`
+		Arguments []json.RawMessage        `json:"arguments"`
+		Callbacks map[string][]interface{} `json:"callbacks"`
+	}
+
+	if err := json.Unmarshal([]byte(msg), &call); err != nil || len(call.Arguments) == 0 {
+		return "", false
+	}
+
+	if _, ok := call.Method.(string); !ok {
+		return "", false
+	}
+
+	var options struct {
+		Auth *kite.Auth `json:"authentication"`
+	}
+
+	if err := json.Unmarshal(call.Arguments[0], &options); err != nil || options.Auth == nil || options.Auth.Type != "token" {
+		return "", false
+	}
+
+	for id, path := range call.Callbacks {
+		if len(path) != 2 || path[1] != "responseCallback" {
+			continue
+		}
+
+		if i, ok := path[0].(float64); (!ok || i != 0) && path[0] != "0" {
+			continue
+		}
+
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return "", false
+		}
+
+		p, err := json.Marshal(map[string]interface{}{
+			"method": n,
+			"arguments": []interface{}{
+				kite.Response{
+					Error: &kite.Error{
+						Type:    "authenticationError",
+						Message: "token is expired",
+					},
+				},
+			},
+			"callbacks": map[string]interface{}{},
+		})
+		if err != nil {
+			return "", false
+		}
+
+		return string(p), true
+	}
+
+	return "", false
+}
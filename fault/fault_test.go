@@ -0,0 +1,148 @@
+package fault_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/fault"
+	"github.com/koding/kite/kitetest"
+)
+
+func newServer(inj *fault.Injector) *kite.Kite {
+	k := kite.New("server", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.SessionHook = inj.Wrap
+	k.HandleFunc("square", func(r *kite.Request) (interface{}, error) {
+		n := r.Args.One().MustFloat64()
+		return n * n, nil
+	})
+	return k
+}
+
+func connect(t *testing.T, srv *kite.Kite) *kite.Client {
+	c, err := kitetest.Connect(kite.New("client", "0.0.1"), srv)
+	if err != nil {
+		t.Fatalf("Connect()=%s", err)
+	}
+	return c
+}
+
+func TestLatency(t *testing.T) {
+	inj := fault.New(fault.Faults{Latency: 100 * time.Millisecond})
+
+	c := connect(t, newServer(inj))
+	defer c.Close()
+
+	start := time.Now()
+	if _, err := c.Tell("square", 2); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Fatalf("got a response after %s, want it delayed by 100ms", d)
+	}
+
+	if stats := inj.Stats(); stats.Delayed == 0 {
+		t.Fatalf("got %+v, want delayed frames", stats)
+	}
+}
+
+func TestDropAndCorrupt(t *testing.T) {
+	cases := map[string]fault.Faults{
+		"drop":    {DropRate: 1},
+		"corrupt": {CorruptRate: 1},
+	}
+
+	for name, faults := range cases {
+		t.Run(name, func(t *testing.T) {
+			inj := fault.New(faults)
+
+			c := connect(t, newServer(inj))
+			defer c.Close()
+
+			if _, err := c.TellWithTimeout("square", 200*time.Millisecond, 2); err == nil {
+				t.Fatal("Tell() succeeded, want it to fail")
+			}
+
+			// The faults stop once they are unset.
+			inj.Set(fault.Faults{})
+
+			res, err := c.Tell("square", 3)
+			if err != nil {
+				t.Fatalf("Tell()=%s", err)
+			}
+
+			if n := res.MustFloat64(); n != 9 {
+				t.Fatalf("got %v, want 9", n)
+			}
+		})
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	inj := fault.New(fault.Faults{})
+
+	disconnected := make(chan struct{}, 1)
+	srv := newServer(inj)
+	srv.OnDisconnect(func(*kite.Client) { disconnected <- struct{}{} })
+
+	c := connect(t, srv)
+	defer c.Close()
+
+	if _, err := c.Tell("square", 2); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	inj.DisconnectAll()
+
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the disconnect")
+	}
+
+	if stats := inj.Stats(); stats.Disconnected != 1 {
+		t.Fatalf("got %+v, want a disconnect", stats)
+	}
+}
+
+func TestDisconnectAfter(t *testing.T) {
+	inj := fault.New(fault.Faults{DisconnectAfter: 100 * time.Millisecond})
+
+	disconnected := make(chan struct{}, 1)
+	srv := newServer(inj)
+	srv.OnDisconnect(func(*kite.Client) { disconnected <- struct{}{} })
+
+	c := connect(t, srv)
+	defer c.Close()
+
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the disconnect")
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	inj := fault.New(fault.Faults{TokenExpiryRate: 1})
+
+	c := connect(t, newServer(inj))
+	defer c.Close()
+
+	// Calls authenticated otherwise are passed through.
+	if _, err := c.Tell("square", 2); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	c.Auth = &kite.Auth{Type: "token", Key: "token"}
+
+	_, err := c.Tell("square", 2)
+	if e, ok := err.(*kite.Error); !ok || e.Type != "authenticationError" || e.Message != "token is expired" {
+		t.Fatalf("got %v, want a token is expired error", err)
+	}
+
+	if stats := inj.Stats(); stats.TokensExpired != 1 {
+		t.Fatalf("got %+v, want an expired token", stats)
+	}
+}
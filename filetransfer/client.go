@@ -0,0 +1,257 @@
+package filetransfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/koding/kite"
+)
+
+// Progress describes how much of a file has been transferred.
+type Progress struct {
+	Path   string // remote path of the file
+	Upload bool   // whether the file is uploaded or downloaded
+	Bytes  int64  // bytes transferred so far, including resumed ones
+	Size   int64  // size of the file
+}
+
+// Done reports whether the whole file has been transferred.
+func (p *Progress) Done() bool {
+	return p.Bytes == p.Size
+}
+
+// Client transfers files to and from a kite serving them with a Server.
+type Client struct {
+	// Kite is the client of the kite serving the files.
+	Kite *kite.Client
+
+	// ChunkSize is the number of bytes sent in each call. If zero,
+	// DefaultChunkSize is used.
+	ChunkSize int
+
+	// Timeout is the timeout of each call. If zero, calls do not time out.
+	Timeout time.Duration
+
+	// Progress, if not nil, is called after each chunk is transferred.
+	Progress func(*Progress)
+}
+
+// Stat returns the FileInfo of the remote file p. Its checksum is computed
+// by the remote kite only if checksum is true.
+func (c *Client) Stat(p string, checksum bool) (*FileInfo, error) {
+	var info FileInfo
+	if err := c.call("stat", &info, &StatArgs{Path: p, Checksum: checksum}); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// Upload copies the local file to the remote path. An upload of the file
+// interrupted earlier is resumed. If the resumed file turns out not to match
+// the local one, it is uploaded again from the start.
+func (c *Client) Upload(ctx context.Context, local, remote string) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	sum, err := Checksum(local)
+	if err != nil {
+		return err
+	}
+
+	info, err := c.Stat(remote, false)
+	if err != nil {
+		return err
+	}
+
+	offset := info.Partial
+	if offset > fi.Size() {
+		offset = 0
+	}
+
+	commit := &CommitArgs{
+		Path:   remote,
+		Size:   fi.Size(),
+		SHA256: sum,
+		Mode:   fi.Mode().Perm(),
+	}
+
+	err = c.upload(ctx, f, commit, offset)
+	if offset != 0 && isChecksumMismatch(err) {
+		err = c.upload(ctx, f, commit, 0)
+	}
+
+	return err
+}
+
+func (c *Client) upload(ctx context.Context, f *os.File, commit *CommitArgs, offset int64) error {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	buf := make([]byte, c.chunkSize())
+
+	// Empty files are written once, so the partial file is created.
+	for first := true; first || offset < commit.Size; first = false {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := io.ReadFull(f, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if n == 0 && !first {
+			return fmt.Errorf("%s: file shrank to %d bytes while uploading", f.Name(), offset)
+		}
+
+		var written int64
+		args := &WriteArgs{Path: commit.Path, Offset: offset, Data: buf[:n]}
+		if err := c.call("write", &written, args); err != nil {
+			return err
+		}
+
+		offset = written
+		c.progress(commit.Path, true, offset, commit.Size)
+	}
+
+	return c.call("commit", nil, commit)
+}
+
+// Download copies the remote file to the local path. A download of the
+// file interrupted earlier is resumed from the partial file
+// local+PartialSuffix. If the resumed file turns out not to match the remote
+// one, it is downloaded again from the start.
+func (c *Client) Download(ctx context.Context, remote, local string) error {
+	info, err := c.Stat(remote, true)
+	if err != nil {
+		return err
+	}
+
+	if !info.Exists {
+		return fmt.Errorf("%s: file does not exist", remote)
+	}
+
+	var offset int64
+	if fi, err := os.Stat(local + PartialSuffix); err == nil && fi.Size() <= info.Size {
+		offset = fi.Size()
+	}
+
+	err = c.download(ctx, info, local, offset)
+	if offset != 0 && isChecksumMismatch(err) {
+		err = c.download(ctx, info, local, 0)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(local+PartialSuffix, info.Mode.Perm()); err != nil {
+		return err
+	}
+
+	return os.Rename(local+PartialSuffix, local)
+}
+
+func (c *Client) download(ctx context.Context, info *FileInfo, local string, offset int64) error {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if offset == 0 {
+		flag |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(local+PartialSuffix, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for offset < info.Size {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var res ReadResult
+		args := &ReadArgs{Path: info.Path, Offset: offset, Length: c.chunkSize()}
+		if err := c.call("read", &res, args); err != nil {
+			return err
+		}
+
+		if len(res.Data) == 0 {
+			return fmt.Errorf("%s: file shrank to %d bytes while downloading", info.Path, offset)
+		}
+
+		if _, err := f.Write(res.Data); err != nil {
+			return err
+		}
+
+		offset += int64(len(res.Data))
+		c.progress(info.Path, false, offset, info.Size)
+
+		if res.EOF {
+			break
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return verify(local+PartialSuffix, info.Size, info.SHA256)
+}
+
+func (c *Client) call(method string, result interface{}, args interface{}) error {
+	if c.Kite == nil {
+		return errors.New("filetransfer: no kite client")
+	}
+
+	res, err := c.Kite.TellWithTimeout(Prefix+method, c.Timeout, args)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return res.Unmarshal(result)
+}
+
+func (c *Client) chunkSize() int {
+	if c.ChunkSize > 0 {
+		return c.ChunkSize
+	}
+
+	return DefaultChunkSize
+}
+
+func (c *Client) progress(path string, upload bool, bytes, size int64) {
+	if c.Progress != nil {
+		c.Progress(&Progress{
+			Path:   path,
+			Upload: upload,
+			Bytes:  bytes,
+			Size:   size,
+		})
+	}
+}
+
+func isChecksumMismatch(err error) bool {
+	e, ok := err.(*kite.Error)
+	return ok && e.Type == ChecksumMismatch
+}
@@ -0,0 +1,370 @@
+// Package filetransfer provides methods for copying files to and from a
+// kite, and the client helpers calling them. Files are sent in chunks,
+// interrupted transfers are resumed from the offset they stopped at and
+// the files are verified with their SHA-256 checksum.
+//
+// A kite serving the files of a directory exports the methods:
+//
+//	filetransfer.stat({path, checksum})        returns the FileInfo of path
+//	filetransfer.read({path, offset, length})  returns {data, eof}
+//	filetransfer.write({path, offset, data})   returns the bytes written so far
+//	filetransfer.commit({path, size, sha256})  moves the uploaded file in place
+//
+// Writes are allowed only by the Allow function of the Server.
+//
+// Uploads are written to the partial file path+PartialSuffix, which
+// filetransfer.commit renames to path once its size and checksum match.
+// Downloads are written to a local partial file the same way.
+package filetransfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+)
+
+// Prefix is the prefix of the names of the file transfer methods.
+const Prefix = "filetransfer."
+
+// PartialSuffix is appended to the names of files being transferred.
+const PartialSuffix = ".part"
+
+// ChecksumMismatch is the type of the kite.Error returned when a file does
+// not match the checksum it was sent with.
+const ChecksumMismatch = "checksumMismatch"
+
+// DefaultChunkSize is the number of bytes sent in each call by default.
+const DefaultChunkSize = 256 * 1024
+
+// maxChunkSize limits the bytes read or written by a single call.
+const maxChunkSize = 16 << 20
+
+// FileInfo describes a file served by a kite.
+type FileInfo struct {
+	Path    string      `json:"path"`
+	Exists  bool        `json:"exists"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	SHA256  string      `json:"sha256,omitempty"`
+
+	// Partial is the number of bytes of an interrupted upload of the file.
+	Partial int64 `json:"partial"`
+}
+
+// StatArgs are the arguments of filetransfer.stat. The checksum of the file
+// is computed only if Checksum is true.
+type StatArgs struct {
+	Path     string `json:"path"`
+	Checksum bool   `json:"checksum"`
+}
+
+// ReadArgs are the arguments of filetransfer.read.
+type ReadArgs struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+}
+
+// ReadResult is the result of filetransfer.read. EOF is true when the chunk
+// ends at the end of the file.
+type ReadResult struct {
+	Data []byte `json:"data"`
+	EOF  bool   `json:"eof"`
+}
+
+// WriteArgs are the arguments of filetransfer.write. Offset must be the
+// number of bytes written so far, or 0 to start the upload over.
+type WriteArgs struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Data   []byte `json:"data"`
+}
+
+// CommitArgs are the arguments of filetransfer.commit.
+type CommitArgs struct {
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	SHA256 string      `json:"sha256"`
+	Mode   os.FileMode `json:"mode,omitempty"`
+}
+
+// Server serves the files of a directory with the file transfer methods.
+type Server struct {
+	// Root is the directory the files are served from. Paths given to the
+	// methods are relative to it and can not refer to files outside of it.
+	Root string
+
+	// ReadOnly disables filetransfer.write and filetransfer.commit.
+	ReadOnly bool
+
+	// Allow, if not nil, is called with the path of each request, relative
+	// to Root, and whether the request writes to it. The request fails if
+	// it returns an error. If nil, the files are read-only, as any user
+	// allowed to call the kite could create and overwrite them otherwise:
+	// writes must be allowed explicitly.
+	Allow func(r *kite.Request, path string, write bool) error
+
+	mu sync.Mutex // serializes writes
+}
+
+// HandleMethods adds the file transfer methods serving the files of s.Root
+// to k.
+func (s *Server) HandleMethods(k *kite.Kite) {
+	k.HandleFunc(Prefix+"stat", s.stat)
+	k.HandleFunc(Prefix+"read", s.read)
+	k.HandleFunc(Prefix+"write", s.write)
+	k.HandleFunc(Prefix+"commit", s.commit)
+}
+
+// path returns the local path of the file name, relative to s.Root.
+func (s *Server) path(r *kite.Request, name string, write bool) (string, error) {
+	if s.Root == "" {
+		return "", errors.New("no root directory")
+	}
+
+	if write && (s.ReadOnly || s.Allow == nil) {
+		return "", errors.New("files are read-only")
+	}
+
+	// Cleaning the rooted path drops any ".." leaving the root.
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if name == "" {
+		return "", errors.New("no path given")
+	}
+
+	if strings.HasSuffix(name, PartialSuffix) {
+		return "", fmt.Errorf("path %q is reserved for partial files", name)
+	}
+
+	if s.Allow != nil {
+		if err := s.Allow(r, name, write); err != nil {
+			return "", err
+		}
+	}
+
+	return filepath.Join(s.Root, filepath.FromSlash(name)), nil
+}
+
+func (s *Server) stat(r *kite.Request) (interface{}, error) {
+	var args StatArgs
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	p, err := s.path(r, args.Path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &FileInfo{Path: args.Path}
+
+	if fi, err := os.Stat(p + PartialSuffix); err == nil {
+		info.Partial = fi.Size()
+	}
+
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return info, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		return nil, fmt.Errorf("%q is a directory", args.Path)
+	}
+
+	info.Exists = true
+	info.Size = fi.Size()
+	info.Mode = fi.Mode()
+	info.ModTime = fi.ModTime()
+
+	if args.Checksum {
+		if info.SHA256, err = Checksum(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+func (s *Server) read(r *kite.Request) (interface{}, error) {
+	var args ReadArgs
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	p, err := s.path(r, args.Path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Offset < 0 || args.Length <= 0 || args.Length > maxChunkSize {
+		return nil, errors.New("offset or length out of range")
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Offset > fi.Size() {
+		return nil, fmt.Errorf("offset %d is past the end of %q", args.Offset, args.Path)
+	}
+
+	data := make([]byte, args.Length)
+
+	n, err := f.ReadAt(data, args.Offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &ReadResult{
+		Data: data[:n],
+		EOF:  args.Offset+int64(n) >= fi.Size(),
+	}, nil
+}
+
+func (s *Server) write(r *kite.Request) (interface{}, error) {
+	var args WriteArgs
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	p, err := s.path(r, args.Path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args.Data) > maxChunkSize {
+		return nil, errors.New("chunk too large")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flag := os.O_WRONLY | os.O_APPEND
+	if args.Offset == 0 {
+		flag |= os.O_CREATE | os.O_TRUNC
+
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(p+PartialSuffix, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Chunks are appended in order, a chunk sent again after a lost
+	// response is rejected instead of being written twice.
+	if fi.Size() != args.Offset {
+		return nil, fmt.Errorf("offset %d does not match the %d bytes written", args.Offset, fi.Size())
+	}
+
+	if _, err := f.Write(args.Data); err != nil {
+		return nil, err
+	}
+
+	return args.Offset + int64(len(args.Data)), nil
+}
+
+func (s *Server) commit(r *kite.Request) (interface{}, error) {
+	var args CommitArgs
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	p, err := s.path(r, args.Path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := verify(p+PartialSuffix, args.Size, args.SHA256); err != nil {
+		return nil, err
+	}
+
+	if args.Mode != 0 {
+		if err := os.Chmod(p+PartialSuffix, args.Mode.Perm()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.Rename(p+PartialSuffix, p); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+// verify checks the size and the checksum of the partial file p. If the
+// checksum does not match, the file is removed, so the transfer starts over.
+func verify(p string, size int64, sum string) error {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+
+	if fi.Size() != size {
+		return fmt.Errorf("got %d bytes, want %d", fi.Size(), size)
+	}
+
+	got, err := Checksum(p)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(got, sum) {
+		os.Remove(p)
+
+		return &kite.Error{
+			Type:    ChecksumMismatch,
+			Message: fmt.Sprintf("got checksum %s, want %s", got, sum),
+		}
+	}
+
+	return nil
+}
+
+// Checksum returns the hex encoded SHA-256 checksum of the file p.
+func Checksum(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
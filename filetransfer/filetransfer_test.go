@@ -0,0 +1,222 @@
+package filetransfer_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/filetransfer"
+	"github.com/koding/kite/kitetest"
+)
+
+func newClient(t *testing.T, srv *filetransfer.Server) *filetransfer.Client {
+	k := kite.New("files", "0.0.1")
+	k.Config.DisableAuthentication = true
+	srv.HandleMethods(k)
+
+	c, err := kitetest.Connect(kite.New("client", "0.0.1"), k)
+	if err != nil {
+		t.Fatalf("Connect()=%s", err)
+	}
+
+	return &filetransfer.Client{Kite: c, ChunkSize: 1024}
+}
+
+// allowAll allows every request, including writes.
+func allowAll(*kite.Request, string, bool) error { return nil }
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "filetransfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func writeFile(t *testing.T, p string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(p, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func randomData(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+func TestUploadDownload(t *testing.T) {
+	root, cleanRoot := tempDir(t)
+	defer cleanRoot()
+
+	local, cleanLocal := tempDir(t)
+	defer cleanLocal()
+
+	c := newClient(t, &filetransfer.Server{Root: root, Allow: allowAll})
+	defer c.Kite.Close()
+
+	var progress []*filetransfer.Progress
+	c.Progress = func(p *filetransfer.Progress) { progress = append(progress, p) }
+
+	data := randomData(10*1024 + 100)
+	writeFile(t, filepath.Join(local, "src"), data)
+
+	if err := c.Upload(context.Background(), filepath.Join(local, "src"), "dir/file"); err != nil {
+		t.Fatalf("Upload()=%s", err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(root, "dir", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes uploaded, want %d", len(got), len(data))
+	}
+
+	fi, err := os.Stat(filepath.Join(root, "dir", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("got uploaded file mode %v, want 0600", fi.Mode())
+	}
+
+	if len(progress) != 11 || !progress[len(progress)-1].Done() || !progress[0].Upload {
+		t.Fatalf("got %d upload progress calls, want 11 ending with the whole file", len(progress))
+	}
+
+	progress = nil
+
+	if err := c.Download(context.Background(), "dir/file", filepath.Join(local, "dst")); err != nil {
+		t.Fatalf("Download()=%s", err)
+	}
+
+	got, err = ioutil.ReadFile(filepath.Join(local, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes downloaded, want %d", len(got), len(data))
+	}
+
+	if len(progress) != 11 || !progress[len(progress)-1].Done() || progress[0].Upload {
+		t.Fatalf("got %d download progress calls, want 11 ending with the whole file", len(progress))
+	}
+}
+
+func TestResume(t *testing.T) {
+	root, cleanRoot := tempDir(t)
+	defer cleanRoot()
+
+	local, cleanLocal := tempDir(t)
+	defer cleanLocal()
+
+	c := newClient(t, &filetransfer.Server{Root: root, Allow: allowAll})
+	defer c.Kite.Close()
+
+	data := randomData(4096)
+	writeFile(t, filepath.Join(local, "src"), data)
+	writeFile(t, filepath.Join(root, "up"+filetransfer.PartialSuffix), data[:3000])
+
+	info, err := c.Stat("up", false)
+	if err != nil {
+		t.Fatalf("Stat()=%s", err)
+	}
+
+	if info.Exists || info.Partial != 3000 {
+		t.Fatalf("got %+v, want a partial upload of 3000 bytes", info)
+	}
+
+	var written int64
+	c.Progress = func(p *filetransfer.Progress) {
+		if written == 0 {
+			written = p.Bytes
+		}
+	}
+
+	if err := c.Upload(context.Background(), filepath.Join(local, "src"), "up"); err != nil {
+		t.Fatalf("Upload()=%s", err)
+	}
+
+	if written != 4024 {
+		t.Fatalf("got %d bytes after the first chunk, want the upload resumed from 3000", written)
+	}
+
+	// A partial file not matching the remote one is downloaded again.
+	writeFile(t, filepath.Join(root, "down"), data)
+	writeFile(t, filepath.Join(local, "down"+filetransfer.PartialSuffix), randomData(2000))
+
+	if err := c.Download(context.Background(), "down", filepath.Join(local, "down")); err != nil {
+		t.Fatalf("Download()=%s", err)
+	}
+
+	for _, p := range []string{filepath.Join(root, "up"), filepath.Join(local, "down")} {
+		got, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: got %d bytes, want the %d bytes sent", p, len(got), len(data))
+		}
+	}
+}
+
+func TestServerPaths(t *testing.T) {
+	root, cleanRoot := tempDir(t)
+	defer cleanRoot()
+
+	writeFile(t, filepath.Join(root, "ro"), []byte("kite"))
+
+	c := newClient(t, &filetransfer.Server{Root: filepath.Join(root, "files"), ReadOnly: true})
+	defer c.Kite.Close()
+
+	writeFile(t, filepath.Join(root, "files", "file"), []byte("kite"))
+
+	if info, err := c.Stat("../../file", true); err != nil || !info.Exists || info.Size != 4 {
+		t.Fatalf("Stat()=%+v, %v, want the file inside the root", info, err)
+	}
+
+	if info, err := c.Stat("../ro", false); err != nil || info.Exists {
+		t.Fatalf("Stat()=%+v, %v, want no file outside of the root", info, err)
+	}
+
+	if _, err := c.Stat("file"+filetransfer.PartialSuffix, false); err == nil {
+		t.Fatal("expected error for a partial file")
+	}
+
+	if err := c.Upload(context.Background(), filepath.Join(root, "ro"), "new"); err == nil {
+		t.Fatal("expected error uploading to a read-only server")
+	}
+}
+
+func TestServerWritesNeedAllow(t *testing.T) {
+	root, cleanRoot := tempDir(t)
+	defer cleanRoot()
+
+	writeFile(t, filepath.Join(root, "local"), []byte("kite"))
+
+	c := newClient(t, &filetransfer.Server{Root: filepath.Join(root, "files")})
+	defer c.Kite.Close()
+
+	if err := c.Upload(context.Background(), filepath.Join(root, "local"), "new"); err == nil {
+		t.Fatal("expected error uploading to a server without an Allow function")
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "files", "new")); !os.IsNotExist(err) {
+		t.Fatalf("Stat()=%v, want the upload not written", err)
+	}
+}
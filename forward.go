@@ -0,0 +1,349 @@
+package kite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+// ForwardMethodName is the method which forwards a TCP connection over the
+// kite connection, see HandleForward and Client.DialForward.
+const ForwardMethodName = "kite.forward"
+
+// forwardBufSize is the maximum size of a chunk of data sent to the remote
+// end of a forwarded connection.
+const forwardBufSize = 32 * 1024
+
+var errForwardDeadline = errors.New("deadlines are not supported by forwarded connections")
+
+// ForwardArgs are the arguments of the kite.forward method.
+type ForwardArgs struct {
+	// Addr is the TCP address the kite dials, in host:port form.
+	Addr string `json:"addr"`
+
+	// OnData is called with every chunk of data read from the connection.
+	OnData dnode.Function `json:"onData"`
+
+	// OnClose is called once the connection is closed, with the error
+	// message if it was closed because of an error.
+	OnClose dnode.Function `json:"onClose"`
+}
+
+// HandleForward registers the kite.forward method, which lets remote kites
+// open TCP connections from this kite. The allow function is called with the
+// requested address before dialing and rejects the connection by returning
+// an error. If allow is nil, only the user the kite itself runs as, with
+// authenticated requests, may forward connections, and only to loopback
+// addresses, so only services running next to the kite can be reached.
+func (k *Kite) HandleForward(allow func(r *Request, addr string) error) *Method {
+	if allow == nil {
+		allow = func(r *Request, addr string) error {
+			if err := k.allowOwner(r, "forward connections"); err != nil {
+				return err
+			}
+			return allowLoopback(r, addr)
+		}
+	}
+
+	return k.HandleFunc(ForwardMethodName, func(r *Request) (interface{}, error) {
+		var args ForwardArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %s", err)
+		}
+
+		if !args.OnData.IsValid() || !args.OnClose.IsValid() {
+			return nil, errors.New("onData and onClose callbacks are required")
+		}
+
+		if err := allow(r, args.Addr); err != nil {
+			return nil, err
+		}
+
+		conn, err := net.DialTimeout("tcp", args.Addr, 10*time.Second)
+		if err != nil {
+			return nil, err
+		}
+
+		write := dnode.NewStream(func(p *dnode.Partial) {
+			var data []byte
+			if err := p.One().Unmarshal(&data); err != nil {
+				k.Log.Warning("forward: invalid data from %s: %s", r.Client.Kite, err)
+				conn.Close()
+				return
+			}
+
+			if _, err := conn.Write(data); err != nil {
+				conn.Close()
+			}
+		})
+
+		close := dnode.NewStream(func(*dnode.Partial) { conn.Close() })
+
+		removeHandler := r.Client.onDisconnect(func() { conn.Close() })
+
+		go func() {
+			// Nothing refers to the connection once it is closed.
+			defer func() {
+				removeHandler()
+				write.Close()
+				close.Close()
+			}()
+
+			buf := make([]byte, forwardBufSize)
+			for {
+				n, err := conn.Read(buf)
+				if n > 0 {
+					chunk := make([]byte, n)
+					copy(chunk, buf[:n])
+					if e := args.OnData.Call(chunk); e != nil {
+						err = e
+					}
+				}
+
+				if err != nil {
+					conn.Close()
+
+					msg := ""
+					if err != io.EOF && !isClosedConnError(err) {
+						msg = err.Error()
+					}
+					args.OnClose.Call(msg)
+					return
+				}
+			}
+		}()
+
+		return map[string]dnode.Function{
+			"write": write.Function(),
+			"close": close.Function(),
+		}, nil
+	})
+}
+
+// allowLoopback allows forwarding only to addresses on the local host.
+func allowLoopback(_ *Request, addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("forwarding to %q is not allowed", addr)
+}
+
+func isClosedConnError(err error) bool {
+	if e, ok := err.(*net.OpError); ok {
+		err = e.Err
+	}
+	// The error is not exported by the net package.
+	return err != nil && err.Error() == "use of closed network connection"
+}
+
+// DialForward asks the remote kite to dial the TCP address and returns a
+// connection which forwards data to it over the kite connection. The remote
+// kite must have registered the kite.forward method with HandleForward.
+// The returned connection does not support deadlines, and keeps data in
+// order only while the client runs callbacks sequentially, which is the
+// default.
+func (c *Client) DialForward(addr string) (net.Conn, error) {
+	fc := &forwardConn{
+		addr: addr,
+		data: make(chan []byte, 64),
+		eof:  make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	onData := dnode.NewStream(func(p *dnode.Partial) {
+		var data []byte
+		if err := p.One().Unmarshal(&data); err != nil {
+			fc.closeRemote(err.Error())
+			return
+		}
+
+		select {
+		case fc.data <- data:
+		case <-fc.done:
+		}
+	})
+
+	onClose := dnode.NewStream(func(p *dnode.Partial) {
+		var msg string
+		if args, err := p.Slice(); err == nil && len(args) > 0 {
+			args[0].Unmarshal(&msg)
+		}
+		fc.closeRemote(msg)
+	})
+
+	fc.streams = []*dnode.Stream{onData, onClose}
+	fc.removeHandler = c.onDisconnect(func() { fc.closeRemote("kite disconnected") })
+
+	result, err := c.Tell(ForwardMethodName, ForwardArgs{
+		Addr:    addr,
+		OnData:  onData.Function(),
+		OnClose: onClose.Function(),
+	})
+	if err != nil {
+		fc.release()
+		return nil, err
+	}
+
+	var funcs struct {
+		Write dnode.Function `json:"write"`
+		Close dnode.Function `json:"close"`
+	}
+
+	if err := result.Unmarshal(&funcs); err != nil {
+		fc.release()
+		return nil, err
+	}
+
+	if !funcs.Write.IsValid() || !funcs.Close.IsValid() {
+		fc.release()
+		return nil, errors.New("invalid response of " + ForwardMethodName)
+	}
+
+	fc.write, fc.close = funcs.Write, funcs.Close
+	fc.remote = c.URL
+
+	return fc, nil
+}
+
+// forwardConn is the local end of a connection forwarded by a remote kite.
+type forwardConn struct {
+	addr   string
+	remote string
+	write  dnode.Function
+	close  dnode.Function
+
+	data chan []byte
+	buf  []byte
+
+	eof     chan struct{} // closed when the remote end is closed
+	eofOnce sync.Once
+	err     error
+
+	done      chan struct{} // closed when the connection is closed locally
+	closeOnce sync.Once
+
+	// The callbacks and the disconnect handler of the connection, released
+	// once it is closed by either end.
+	streams       []*dnode.Stream
+	removeHandler func()
+	releaseOnce   sync.Once
+}
+
+var _ net.Conn = (*forwardConn)(nil)
+
+// closeRemote marks the connection as closed by the remote end. Data which
+// arrived before can still be read.
+func (fc *forwardConn) closeRemote(msg string) {
+	fc.eofOnce.Do(func() {
+		if msg != "" {
+			fc.err = errors.New(msg)
+		}
+		close(fc.eof)
+	})
+
+	fc.release()
+}
+
+// release removes the callbacks and the disconnect handler of the
+// connection. Data sent by the remote end afterwards is dropped.
+func (fc *forwardConn) release() {
+	fc.releaseOnce.Do(func() {
+		fc.removeHandler()
+		for _, s := range fc.streams {
+			s.Close()
+		}
+	})
+}
+
+func (fc *forwardConn) Read(p []byte) (int, error) {
+	if len(fc.buf) == 0 {
+		select {
+		case fc.buf = <-fc.data:
+		case <-fc.done:
+			return 0, io.ErrClosedPipe
+		case <-fc.eof:
+			// Drain what arrived before the connection was closed.
+			select {
+			case fc.buf = <-fc.data:
+			default:
+				if fc.err != nil {
+					return 0, fc.err
+				}
+				return 0, io.EOF
+			}
+		}
+	}
+
+	n := copy(p, fc.buf)
+	fc.buf = fc.buf[n:]
+	return n, nil
+}
+
+func (fc *forwardConn) Write(p []byte) (int, error) {
+	select {
+	case <-fc.done:
+		return 0, io.ErrClosedPipe
+	case <-fc.eof:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+
+	for written := 0; written < len(p); {
+		n := len(p) - written
+		if n > forwardBufSize {
+			n = forwardBufSize
+		}
+
+		if err := fc.write.Call(p[written : written+n]); err != nil {
+			return written, err
+		}
+
+		written += n
+	}
+
+	return len(p), nil
+}
+
+func (fc *forwardConn) Close() error {
+	var err error
+	fc.closeOnce.Do(func() {
+		close(fc.done)
+
+		select {
+		case <-fc.eof:
+		default:
+			err = fc.close.Call()
+		}
+
+		fc.release()
+	})
+	return err
+}
+
+func (fc *forwardConn) LocalAddr() net.Addr  { return forwardAddr(fc.remote) }
+func (fc *forwardConn) RemoteAddr() net.Addr { return forwardAddr(fc.addr) }
+
+func (fc *forwardConn) SetDeadline(time.Time) error      { return errForwardDeadline }
+func (fc *forwardConn) SetReadDeadline(time.Time) error  { return errForwardDeadline }
+func (fc *forwardConn) SetWriteDeadline(time.Time) error { return errForwardDeadline }
+
+// forwardAddr is the address of a forwarded connection.
+type forwardAddr string
+
+func (forwardAddr) Network() string  { return "kite" }
+func (a forwardAddr) String() string { return string(a) }
@@ -0,0 +1,115 @@
+package kite
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestForward(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	k := New("forward", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 3738
+	k.HandleForward(allowLoopback)
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient("http://127.0.0.1:3738/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	handlers := disconnectHandlers(c)
+
+	conn, err := c.DialForward(l.Addr().String())
+	if err != nil {
+		t.Fatalf("DialForward()=%s", err)
+	}
+
+	want := "hello kite"
+	if _, err := conn.Write([]byte(want)); err != nil {
+		t.Fatalf("Write()=%s", err)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("ReadFull()=%s", err)
+	}
+
+	if string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close()=%s", err)
+	}
+
+	if _, err := conn.Write([]byte(want)); err == nil {
+		t.Fatal("expected Write to fail after Close")
+	}
+
+	if _, err := c.DialForward("10.0.0.1:80"); err == nil {
+		t.Fatal("expected forwarding to a non-loopback address to fail")
+	}
+
+	// Closed connections leave no disconnect handlers behind.
+	if n := disconnectHandlers(c); n != handlers {
+		t.Fatalf("got %d disconnect handlers, want %d", n, handlers)
+	}
+}
+
+func TestForwardRejectsAssertedOwner(t *testing.T) {
+	k := New("forward", "0.0.1")
+	k.Config.Username = "owner"
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+	k.HandleForward(nil)
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	// Without authentication the username is only claimed by the caller.
+	ck := New("exp", "0.0.1")
+	ck.Config.Username = "owner"
+
+	c := ck.NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err := c.DialForward("127.0.0.1:80")
+	if err == nil || !strings.Contains(err.Error(), "only authenticated users") {
+		t.Fatalf("DialForward()=%v, want the unauthenticated request rejected", err)
+	}
+}
+
+func disconnectHandlers(c *Client) int {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return len(c.onDisconnectHandlers)
+}
@@ -0,0 +1,25 @@
+// +build go1.18
+
+package kite
+
+import "testing"
+
+func FuzzProcessMessage(f *testing.F) {
+	f.Add([]byte(`{"method":"square","arguments":[{"withArgs":[4],"responseCallback":"[Function]"}],"callbacks":{"0":["0","responseCallback"]}}`))
+	f.Add([]byte(`{"method":"square","callbacks":{"0":["0","responseCallback"]}}`))
+	f.Add([]byte(`{"method":0,"arguments":[null,{"result":16}]}`))
+	f.Add([]byte(`{"method":[],"arguments":{}}`))
+	f.Add([]byte(`{"method":"square","arguments":[`))
+
+	k := New("fuzz", "0.0.1")
+	k.HandleFunc("square", func(r *Request) (interface{}, error) {
+		return nil, nil
+	})
+
+	c := k.NewClient("")
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Must never panic, as it runs on the read loop of the connection.
+		c.processMessage(data)
+	})
+}
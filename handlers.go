@@ -90,6 +90,7 @@ func (k *Kite) addDefaultHandlers() {
 	k.HandleFunc("kite.print", handlePrint)
 	k.HandleFunc("kite.prompt", handlePrompt)
 	k.HandleFunc("kite.getPass", handleGetPass)
+	k.HandleFunc("kite.reloadConfig", k.handleReloadConfig)
 	if runtime.GOOS == "darwin" {
 		k.HandleFunc("kite.notify", handleNotifyDarwin)
 	}
@@ -98,9 +99,13 @@ func (k *Kite) addDefaultHandlers() {
 	}
 }
 
+// systemInfo caches the info returned by kite.systemInfo, so that frequent
+// polls do not read it from the system every time.
+var systemInfo = systeminfo.NewCache(5 * time.Second)
+
 // handleSystemInfo returns info about the system (CPU, memory, disk...).
 func handleSystemInfo(r *Request) (interface{}, error) {
-	return systeminfo.New()
+	return systemInfo.Get()
 }
 
 // handleLog prints a log message to stderr.
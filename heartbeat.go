@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/cenkalti/backoff"
+	"github.com/koding/kite/clock"
 	"github.com/koding/kite/protocol"
 )
 
@@ -52,32 +53,39 @@ func newHeartbeatReq(r *Request) (*heartbeatReq, error) {
 func (k *Kite) processHeartbeats() {
 	var (
 		ping func() error
-		t    = time.NewTicker(time.Second) // dummy initial value
+		t    clock.Ticker
+		tick <-chan time.Time // nil when no heartbeats are sent
 	)
 
-	t.Stop()
+	stop := func() {
+		if t != nil {
+			t.Stop()
+			t, tick = nil, nil
+		}
+	}
 
 	for {
 		select {
-		case <-t.C:
+		case <-tick:
 			switch err := ping(); err {
 			case nil:
 			case errRegisterAgain:
-				t.Stop()
+				stop()
 			default:
 				k.Log.Error("%s", err)
 			}
 		case <-k.closeC:
-			t.Stop()
+			stop()
 			return
 		case req := <-k.heartbeatC:
-			t.Stop()
+			stop()
 
 			if req == nil {
 				continue
 			}
 
-			t = time.NewTicker(req.interval)
+			t = k.Clock.NewTicker(req.interval)
+			tick = t.C()
 			ping = req.ping
 		}
 	}
@@ -109,7 +117,7 @@ func (k *Kite) RegisterHTTPForever(kiteURL *url.URL) {
 	}
 
 	// this will retry register forever
-	err := backoff.Retry(register, httpRegisterBackOff)
+	err := retry(register, httpRegisterBackOff, k.Clock)
 	if err != nil {
 		k.Log.Error("BackOff stopped retrying with Error '%s'", err)
 	}
@@ -144,7 +152,12 @@ func (k *Kite) RegisterHTTP(kiteURL *url.URL) (*registerResult, error) {
 		return nil, err
 	}
 
-	resp, err := k.Config.Client.Post(registerURL, "application/json", bytes.NewReader(data))
+	cfg, err := k.Config.Pinned(k.Config.KontrolTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cfg.Client.Post(registerURL, "application/json", bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
@@ -182,24 +195,34 @@ func (k *Kite) RegisterHTTP(kiteURL *url.URL) (*registerResult, error) {
 
 var errRegisterAgain = errors.New("register again")
 
-func (k *Kite) sendHeartbeats(interval time.Duration, kiteURL *url.URL) {
+// sendHeartbeats starts sending heartbeats to Kontrol with the given
+// interval. Errors are logged as well as returned, as it is run in its own
+// goroutine.
+func (k *Kite) sendHeartbeats(interval time.Duration, kiteURL *url.URL) error {
 	heartbeatURL := k.getKontrolPath("heartbeat")
 
 	k.Log.Debug("Starting to send heartbeat to: %s", heartbeatURL)
 
 	u, err := url.Parse(heartbeatURL)
 	if err != nil {
-		k.Log.Fatal("HeartbeatURL is malformed: %s", err)
+		k.Log.Error("HeartbeatURL is malformed: %s", err)
+		return err
 	}
 
 	q := u.Query()
 	q.Set("id", k.Id)
 	u.RawQuery = q.Encode()
 
+	cfg, err := k.Config.Pinned(k.Config.KontrolTLS)
+	if err != nil {
+		k.Log.Error("Cannot pin certificates of Kontrol: %s", err)
+		return err
+	}
+
 	heartbeatFunc := func() error {
 		k.Log.Debug("Sending heartbeat to %s", u)
 
-		resp, err := k.Config.Client.Get(u.String())
+		resp, err := cfg.Client.Get(u.String())
 		if err != nil {
 			return err
 		}
@@ -240,6 +263,8 @@ func (k *Kite) sendHeartbeats(interval time.Duration, kiteURL *url.URL) {
 		ping:     heartbeatFunc,
 		interval: interval,
 	}
+
+	return nil
 }
 
 // handleHeartbeat pings the callback with the given interval seconds.
@@ -0,0 +1,550 @@
+// Package jobqueue provides a coordinator kite distributing jobs among
+// workers, and the worker library pulling the jobs from it.
+//
+// The coordinator kite exports the methods:
+//
+//	jobqueue.enqueue({queue, payload, maxAttempts, delayNs})   returns the job ID
+//	jobqueue.claim({queue, visibilityNs})       returns a Job, or null if none is ready
+//	jobqueue.extend({id, lease, visibilityNs})  returns the new deadline of a job
+//	jobqueue.ack({id, lease})                   removes a completed job
+//	jobqueue.fail({id, lease, error, retryAfterNs})  retries a job or drops it
+//	jobqueue.stats({queue})                     returns the Stats of a queue
+//
+// A claimed job is invisible to other workers until its deadline, after
+// which it is claimed again, so jobs of workers which died are retried.
+// Each claim is an attempt. A job is dead once it failed or timed out
+// MaxAttempts times, the coordinator drops it and calls OnDead.
+//
+// Workers find the coordinator registered to kontrol with Find:
+//
+//	c, err := jobqueue.Find(k)
+//	w := &jobqueue.Worker{Client: c, Queue: "thumbnails", Handler: resize}
+//	err = w.Run(ctx)
+package jobqueue
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/clock"
+)
+
+// Name is the name the coordinator kite registers with.
+const Name = "jobqueue"
+
+// Prefix is the prefix of the names of the coordinator methods.
+const Prefix = "jobqueue."
+
+// Defaults of the Coordinator.
+const (
+	DefaultVisibilityTimeout = 30 * time.Second
+	DefaultMaxAttempts       = 3
+)
+
+// ErrLeaseLost is returned when a job is acknowledged, failed or extended
+// by a worker whose claim expired, e.g. because the job was claimed again
+// by another worker.
+var ErrLeaseLost = errors.New("jobqueue: lease of the job lost")
+
+// Job is a unit of work of a queue.
+type Job struct {
+	ID          string          `json:"id"`
+	Queue       string          `json:"queue"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	Enqueued    time.Time       `json:"enqueued"`
+
+	// Lease identifies the claim of the job, it is given back to the
+	// coordinator to acknowledge, fail or extend the job.
+	Lease int64 `json:"lease,omitempty"`
+
+	// Deadline is when the job becomes visible to other workers again,
+	// unless it is acknowledged, failed or extended.
+	Deadline time.Time `json:"deadline,omitempty"`
+
+	// Error is the error of the last failed attempt.
+	Error string `json:"error,omitempty"`
+
+	version int64     // changed when the job is claimed, failed or removed
+	visible time.Time // when the job can be claimed
+	removed bool
+}
+
+// Unmarshal decodes the payload of the job into v.
+func (j *Job) Unmarshal(v interface{}) error {
+	if len(j.Payload) == 0 {
+		return errors.New("jobqueue: job has no payload")
+	}
+
+	return json.Unmarshal(j.Payload, v)
+}
+
+// EnqueueArgs are the arguments of jobqueue.enqueue. The job is not
+// claimed before Delay passes. If MaxAttempts is zero, the MaxAttempts of
+// the Coordinator is used.
+type EnqueueArgs struct {
+	Queue       string          `json:"queue"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	MaxAttempts int             `json:"maxAttempts,omitempty"`
+	Delay       time.Duration   `json:"delayNs,omitempty"`
+}
+
+// ClaimArgs are the arguments of jobqueue.claim. If Visibility is zero,
+// the VisibilityTimeout of the Coordinator is used.
+type ClaimArgs struct {
+	Queue      string        `json:"queue"`
+	Visibility time.Duration `json:"visibilityNs,omitempty"`
+}
+
+// LeaseArgs are the arguments of jobqueue.ack, jobqueue.fail and
+// jobqueue.extend. Error and RetryAfter are used by jobqueue.fail only, and
+// Visibility by jobqueue.extend only.
+type LeaseArgs struct {
+	ID         string        `json:"id"`
+	Lease      int64         `json:"lease"`
+	Error      string        `json:"error,omitempty"`
+	RetryAfter time.Duration `json:"retryAfterNs,omitempty"`
+	Visibility time.Duration `json:"visibilityNs,omitempty"`
+}
+
+// Stats are the number of jobs of a queue.
+type Stats struct {
+	Ready   int `json:"ready"`   // waiting to be claimed, including delayed jobs
+	Claimed int `json:"claimed"` // claimed by workers
+	Done    int `json:"done"`    // acknowledged
+	Dead    int `json:"dead"`    // dropped after MaxAttempts
+}
+
+// Coordinator keeps the jobs of the queues in memory and hands them out to
+// workers. Its fields must not be changed after HandleMethods is called.
+type Coordinator struct {
+	// VisibilityTimeout is how long a claimed job stays invisible to other
+	// workers. If zero, DefaultVisibilityTimeout is used.
+	VisibilityTimeout time.Duration
+
+	// MaxAttempts is the number of attempts of the jobs enqueued without
+	// their own. If zero, DefaultMaxAttempts is used.
+	MaxAttempts int
+
+	// OnDead, if not nil, is called with the jobs dropped after their last
+	// attempt.
+	OnDead func(*Job)
+
+	// Clock gives the time to the coordinator. If nil, clock.Real is used.
+	Clock clock.Clock
+
+	mu     sync.Mutex
+	seq    int64
+	jobs   map[string]*Job
+	queues map[string]*queue
+}
+
+// NewKite returns a new coordinator kite of c.
+func NewKite(c *Coordinator) *kite.Kite {
+	k := kite.New(Name, "1.0.0")
+	c.HandleMethods(k)
+	return k
+}
+
+// HandleMethods adds the coordinator methods of c to k.
+func (c *Coordinator) HandleMethods(k *kite.Kite) {
+	k.HandleFunc(Prefix+"enqueue", func(r *kite.Request) (interface{}, error) {
+		var args EnqueueArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		return c.Enqueue(&args)
+	})
+
+	k.HandleFunc(Prefix+"claim", func(r *kite.Request) (interface{}, error) {
+		var args ClaimArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		return c.Claim(args.Queue, args.Visibility)
+	})
+
+	k.HandleFunc(Prefix+"extend", func(r *kite.Request) (interface{}, error) {
+		var args LeaseArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		return c.Extend(args.ID, args.Lease, args.Visibility)
+	})
+
+	k.HandleFunc(Prefix+"ack", func(r *kite.Request) (interface{}, error) {
+		var args LeaseArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		return true, c.Ack(args.ID, args.Lease)
+	})
+
+	k.HandleFunc(Prefix+"fail", func(r *kite.Request) (interface{}, error) {
+		var args LeaseArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		return true, c.Fail(args.ID, args.Lease, args.Error, args.RetryAfter)
+	})
+
+	k.HandleFunc(Prefix+"stats", func(r *kite.Request) (interface{}, error) {
+		var args struct {
+			Queue string `json:"queue"`
+		}
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		return c.Stats(args.Queue), nil
+	})
+}
+
+// Enqueue adds a job to a queue and returns its ID.
+func (c *Coordinator) Enqueue(args *EnqueueArgs) (string, error) {
+	if args.Queue == "" {
+		return "", errors.New("jobqueue: no queue given")
+	}
+
+	if args.MaxAttempts < 0 || args.Delay < 0 {
+		return "", errors.New("jobqueue: maxAttempts or delay out of range")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.init()
+	c.seq++
+
+	now := c.clock().Now()
+
+	job := &Job{
+		ID:          strconv.FormatInt(c.seq, 10),
+		Queue:       args.Queue,
+		Payload:     args.Payload,
+		MaxAttempts: args.MaxAttempts,
+		Enqueued:    now,
+		visible:     now.Add(args.Delay),
+	}
+
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = c.maxAttempts()
+	}
+
+	c.jobs[job.ID] = job
+	c.queue(job.Queue).push(job, c.seq)
+
+	return job.ID, nil
+}
+
+// Claim returns the next job of the queue ready to be processed, or nil if
+// there is none. The job is invisible to other workers for the visibility
+// timeout, or the VisibilityTimeout of c if it is zero.
+func (c *Coordinator) Claim(queue string, visibility time.Duration) (*Job, error) {
+	if visibility < 0 {
+		return nil, errors.New("jobqueue: visibility out of range")
+	}
+
+	if visibility == 0 {
+		visibility = c.visibilityTimeout()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.init()
+
+	q, ok := c.queues[queue]
+	if !ok {
+		return nil, nil
+	}
+
+	now := c.clock().Now()
+
+	for {
+		job := q.pop(now)
+		if job == nil {
+			return nil, nil
+		}
+
+		// The claim of the job expired after its last attempt.
+		if job.Attempts >= job.MaxAttempts {
+			c.dead(job)
+			continue
+		}
+
+		c.seq++
+
+		job.Attempts++
+		job.Lease = c.seq
+		job.Deadline = now.Add(visibility)
+		job.visible = job.Deadline
+		q.claimed++
+		q.push(job, c.seq)
+
+		j := *job
+		return &j, nil
+	}
+}
+
+// Extend extends the deadline of a claimed job by the visibility timeout,
+// or the VisibilityTimeout of c if it is zero, and returns the new one.
+// Workers extend the jobs taking longer than the visibility timeout.
+func (c *Coordinator) Extend(id string, lease int64, visibility time.Duration) (time.Time, error) {
+	if visibility < 0 {
+		return time.Time{}, errors.New("jobqueue: visibility out of range")
+	}
+
+	if visibility == 0 {
+		visibility = c.visibilityTimeout()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job, err := c.leased(id, lease)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	c.seq++
+
+	job.Deadline = c.clock().Now().Add(visibility)
+	job.visible = job.Deadline
+	c.queues[job.Queue].push(job, c.seq)
+
+	return job.Deadline, nil
+}
+
+// Ack removes a job completed by the worker holding its lease.
+func (c *Coordinator) Ack(id string, lease int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job, err := c.leased(id, lease)
+	if err != nil {
+		return err
+	}
+
+	q := c.queues[job.Queue]
+	q.claimed--
+	q.done++
+
+	c.remove(job)
+	return nil
+}
+
+// Fail records the failure of an attempt of a job by the worker holding its
+// lease. The job is retried after retryAfter, or dropped if it was its last
+// attempt.
+func (c *Coordinator) Fail(id string, lease int64, reason string, retryAfter time.Duration) error {
+	if retryAfter < 0 {
+		return errors.New("jobqueue: retryAfter out of range")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job, err := c.leased(id, lease)
+	if err != nil {
+		return err
+	}
+
+	q := c.queues[job.Queue]
+	q.claimed--
+
+	job.Error = reason
+	job.Lease = 0
+	job.Deadline = time.Time{}
+
+	if job.Attempts >= job.MaxAttempts {
+		c.dead(job)
+		return nil
+	}
+
+	c.seq++
+
+	job.visible = c.clock().Now().Add(retryAfter)
+	q.push(job, c.seq)
+
+	return nil
+}
+
+// Stats returns the number of jobs of the queue.
+func (c *Coordinator) Stats(queue string) *Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	q, ok := c.queues[queue]
+	if !ok {
+		return &Stats{}
+	}
+
+	return &Stats{
+		Ready:   q.jobs - q.claimed,
+		Claimed: q.claimed,
+		Done:    q.done,
+		Dead:    q.dead,
+	}
+}
+
+// leased returns the job claimed with the lease. Jobs whose claim expired
+// are still leased until they are claimed again.
+func (c *Coordinator) leased(id string, lease int64) (*Job, error) {
+	job, ok := c.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("jobqueue: job %q not found", id)
+	}
+
+	if job.Lease == 0 || job.Lease != lease {
+		return nil, ErrLeaseLost
+	}
+
+	return job, nil
+}
+
+// dead drops a job after its last attempt.
+func (c *Coordinator) dead(job *Job) {
+	c.queues[job.Queue].dead++
+	c.remove(job)
+
+	if c.OnDead != nil {
+		j := *job
+		go c.OnDead(&j)
+	}
+}
+
+func (c *Coordinator) remove(job *Job) {
+	job.removed = true
+	c.queues[job.Queue].jobs--
+	delete(c.jobs, job.ID)
+}
+
+func (c *Coordinator) init() {
+	if c.jobs == nil {
+		c.jobs = make(map[string]*Job)
+		c.queues = make(map[string]*queue)
+	}
+}
+
+func (c *Coordinator) queue(name string) *queue {
+	q, ok := c.queues[name]
+	if !ok {
+		q = &queue{}
+		c.queues[name] = q
+	}
+
+	q.jobs++
+	return q
+}
+
+func (c *Coordinator) clock() clock.Clock {
+	if c.Clock != nil {
+		return c.Clock
+	}
+
+	return clock.Real
+}
+
+func (c *Coordinator) visibilityTimeout() time.Duration {
+	if c.VisibilityTimeout > 0 {
+		return c.VisibilityTimeout
+	}
+
+	return DefaultVisibilityTimeout
+}
+
+func (c *Coordinator) maxAttempts() int {
+	if c.MaxAttempts > 0 {
+		return c.MaxAttempts
+	}
+
+	return DefaultMaxAttempts
+}
+
+// queue orders the jobs of a queue by the time they become visible, and the
+// order they were pushed in. A job is pushed again each time its visibility
+// changes, the entries of the previous versions are skipped.
+type queue struct {
+	entries entries
+	jobs    int // not removed
+	claimed int
+	done    int
+	dead    int
+}
+
+type entry struct {
+	job     *Job
+	visible time.Time
+	version int64
+}
+
+func (q *queue) push(job *Job, version int64) {
+	job.version = version
+	heap.Push(&q.entries, &entry{job: job, visible: job.visible, version: version})
+}
+
+// pop returns the next job visible at now, or nil.
+func (q *queue) pop(now time.Time) *Job {
+	for len(q.entries) != 0 {
+		e := q.entries[0]
+
+		if e.job.removed || e.version != e.job.version {
+			heap.Pop(&q.entries)
+			continue
+		}
+
+		if e.visible.After(now) {
+			return nil
+		}
+
+		heap.Pop(&q.entries)
+
+		// The claim of the job expired.
+		if e.job.Lease != 0 {
+			e.job.Lease = 0
+			e.job.Deadline = time.Time{}
+			q.claimed--
+		}
+
+		return e.job
+	}
+
+	return nil
+}
+
+type entries []*entry
+
+func (e entries) Len() int      { return len(e) }
+func (e entries) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+
+func (e entries) Less(i, j int) bool {
+	if !e[i].visible.Equal(e[j].visible) {
+		return e[i].visible.Before(e[j].visible)
+	}
+
+	return e[i].version < e[j].version
+}
+
+func (e *entries) Push(x interface{}) { *e = append(*e, x.(*entry)) }
+
+func (e *entries) Pop() interface{} {
+	old := *e
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*e = old[:n-1]
+	return x
+}
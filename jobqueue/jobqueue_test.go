@@ -0,0 +1,180 @@
+package jobqueue_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/clock"
+	"github.com/koding/kite/jobqueue"
+	"github.com/koding/kite/kitetest"
+)
+
+func TestCoordinator(t *testing.T) {
+	mock := clock.NewMock(time.Now())
+
+	dead := make(chan *jobqueue.Job, 1)
+	c := &jobqueue.Coordinator{
+		VisibilityTimeout: time.Minute,
+		MaxAttempts:       2,
+		OnDead:            func(job *jobqueue.Job) { dead <- job },
+		Clock:             mock,
+	}
+
+	first, err := c.Enqueue(&jobqueue.EnqueueArgs{Queue: "q", Payload: json.RawMessage(`1`)})
+	if err != nil {
+		t.Fatalf("Enqueue()=%s", err)
+	}
+
+	if _, err := c.Enqueue(&jobqueue.EnqueueArgs{Queue: "q", Payload: json.RawMessage(`2`), Delay: time.Hour}); err != nil {
+		t.Fatalf("Enqueue()=%s", err)
+	}
+
+	job, err := c.Claim("q", 0)
+	if err != nil || job == nil || job.ID != first || job.Attempts != 1 {
+		t.Fatalf("Claim()=%+v, %v, want the first attempt of job %s", job, err, first)
+	}
+
+	// The other job is delayed and the first one is claimed.
+	if job, err := c.Claim("q", 0); job != nil || err != nil {
+		t.Fatalf("Claim()=%+v, %v, want no job ready", job, err)
+	}
+
+	if s := c.Stats("q"); s.Ready != 1 || s.Claimed != 1 {
+		t.Fatalf("got %+v, want 1 job ready and 1 claimed", s)
+	}
+
+	// The claim expires and the job is claimed again.
+	mock.Add(time.Minute)
+
+	again, err := c.Claim("q", 0)
+	if err != nil || again == nil || again.ID != first || again.Attempts != 2 {
+		t.Fatalf("Claim()=%+v, %v, want the second attempt of job %s", again, err, first)
+	}
+
+	if err := c.Ack(job.ID, job.Lease); err != jobqueue.ErrLeaseLost {
+		t.Fatalf("Ack()=%v with an expired lease, want ErrLeaseLost", err)
+	}
+
+	if err := c.Fail(again.ID, again.Lease, "boom", 0); err != nil {
+		t.Fatalf("Fail()=%s", err)
+	}
+
+	select {
+	case job := <-dead:
+		if job.ID != first || job.Error != "boom" {
+			t.Fatalf("got dead job %+v, want job %s failed with boom", job, first)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnDead was not called for the last attempt")
+	}
+
+	mock.Add(time.Hour)
+
+	job, err = c.Claim("q", time.Second)
+	if err != nil || job == nil || string(job.Payload) != "2" {
+		t.Fatalf("Claim()=%+v, %v, want the delayed job", job, err)
+	}
+
+	if _, err := c.Extend(job.ID, job.Lease, 0); err != nil {
+		t.Fatalf("Extend()=%s", err)
+	}
+
+	// The extended claim does not expire after the first visibility timeout.
+	mock.Add(time.Second)
+
+	if job, err := c.Claim("q", 0); job != nil || err != nil {
+		t.Fatalf("Claim()=%+v, %v, want the extended job invisible", job, err)
+	}
+
+	if err := c.Ack(job.ID, job.Lease); err != nil {
+		t.Fatalf("Ack()=%s", err)
+	}
+
+	if s := c.Stats("q"); *s != (jobqueue.Stats{Done: 1, Dead: 1}) {
+		t.Fatalf("got %+v, want 1 job done and 1 dead", s)
+	}
+}
+
+func TestWorker(t *testing.T) {
+	const jobs = 20
+
+	c := &jobqueue.Coordinator{}
+
+	k := jobqueue.NewKite(c)
+	k.Config.DisableAuthentication = true
+
+	client, err := kitetest.Connect(kite.New("worker", "0.0.1"), k)
+	if err != nil {
+		t.Fatalf("Connect()=%s", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < jobs; i++ {
+		payload, _ := json.Marshal(i)
+		if _, err := jobqueue.Enqueue(client, &jobqueue.EnqueueArgs{Queue: "q", Payload: payload}); err != nil {
+			t.Fatalf("Enqueue()=%s", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	done := make(map[int]int)
+
+	w := &jobqueue.Worker{
+		Client:       client,
+		Queue:        "q",
+		Concurrency:  4,
+		PollInterval: 10 * time.Millisecond,
+		Handler: func(_ context.Context, job *jobqueue.Job) error {
+			var i int
+			if err := job.Unmarshal(&i); err != nil {
+				return err
+			}
+
+			// Odd jobs fail their first attempt.
+			if i%2 == 1 && job.Attempts == 1 {
+				return errors.New("retry")
+			}
+
+			mu.Lock()
+			done[i]++
+			mu.Unlock()
+
+			return nil
+		},
+		OnError: func(err error) { t.Errorf("worker: %s", err) },
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	for i := 0; i < 500 && c.Stats("q").Done != jobs; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("Run()=%v, want %s", err, context.Canceled)
+	}
+
+	if s := c.Stats("q"); *s != (jobqueue.Stats{Done: jobs}) {
+		t.Fatalf("got %+v, want %d jobs done", s, jobs)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i := 0; i < jobs; i++ {
+		if done[i] != 1 {
+			t.Fatalf("job %d was completed %d times, want once", i, done[i])
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// DefaultPollInterval is how long workers wait before claiming a job again
+// when their queue is empty.
+const DefaultPollInterval = time.Second
+
+// Find returns a client of a coordinator kite registered to the kontrol of
+// k by the same user in the same environment, connected to it.
+func Find(k *kite.Kite) (*kite.Client, error) {
+	clients, err := k.GetKites(&protocol.KontrolQuery{
+		Username:    k.Config.Username,
+		Environment: k.Config.Environment,
+		Name:        Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	kite.Close(clients[1:])
+
+	c := clients[0]
+	if err := c.Dial(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Enqueue adds a job to a queue of the coordinator kite c is connected to,
+// and returns its ID.
+func Enqueue(c *kite.Client, args *EnqueueArgs) (string, error) {
+	res, err := c.Tell(Prefix+"enqueue", args)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	if err := res.Unmarshal(&id); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Worker claims the jobs of a queue from a coordinator kite and processes
+// them. The jobs taking longer than the visibility timeout are extended
+// while they are processed.
+type Worker struct {
+	// Client is the client of the coordinator kite, see Find.
+	Client *kite.Client
+
+	// Queue is the name of the queue the jobs are claimed from.
+	Queue string
+
+	// Handler processes a job. The job is acknowledged if it returns nil,
+	// and failed otherwise. The context is canceled when Run returns.
+	Handler func(context.Context, *Job) error
+
+	// Concurrency is the number of jobs processed at once. If zero, jobs
+	// are processed one by one.
+	Concurrency int
+
+	// PollInterval is how long the worker waits before claiming a job
+	// again when the queue is empty. If zero, DefaultPollInterval is used.
+	PollInterval time.Duration
+
+	// Visibility is the visibility timeout of the claimed jobs. If zero,
+	// DefaultVisibilityTimeout is used.
+	Visibility time.Duration
+
+	// RetryAfter is how long failed jobs are delayed before their next
+	// attempt.
+	RetryAfter time.Duration
+
+	// OnError, if not nil, is called with the errors of the calls to the
+	// coordinator, e.g. when it is not reachable.
+	OnError func(error)
+}
+
+// Run processes the jobs of the queue until ctx is canceled. It waits for
+// the jobs being processed to complete and returns ctx.Err().
+func (w *Worker) Run(ctx context.Context) error {
+	if w.Client == nil || w.Handler == nil {
+		return errors.New("jobqueue: worker has no client or handler")
+	}
+
+	n := w.Concurrency
+	if n <= 0 {
+		n = 1
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	poll := w.PollInterval
+	if poll <= 0 {
+		poll = DefaultPollInterval
+	}
+
+	for ctx.Err() == nil {
+		job, err := w.claim()
+		if err != nil {
+			w.error(err)
+		}
+
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(poll):
+			}
+			continue
+		}
+
+		w.process(ctx, job)
+	}
+}
+
+func (w *Worker) claim() (*Job, error) {
+	res, err := w.Client.Tell(Prefix+"claim", &ClaimArgs{
+		Queue:      w.Queue,
+		Visibility: w.visibility(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var job *Job
+	if err := res.Unmarshal(&job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (w *Worker) process(ctx context.Context, job *Job) {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		w.extend(job, stop)
+	}()
+
+	err := w.handle(ctx, job)
+
+	// The lease is not extended after the job is acknowledged or failed.
+	close(stop)
+	<-stopped
+
+	args := &LeaseArgs{ID: job.ID, Lease: job.Lease}
+	method := "ack"
+
+	if err != nil {
+		args.Error = err.Error()
+		args.RetryAfter = w.RetryAfter
+		method = "fail"
+	}
+
+	if _, err := w.Client.Tell(Prefix+method, args); err != nil {
+		w.error(fmt.Errorf("jobqueue: %s of job %s: %s", method, job.ID, err))
+	}
+}
+
+func (w *Worker) handle(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return w.Handler(ctx, job)
+}
+
+// extend extends the lease of the job every half of the visibility
+// timeout, until stop is closed.
+func (w *Worker) extend(job *Job, stop <-chan struct{}) {
+	ticker := time.NewTicker(w.visibility() / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, err := w.Client.Tell(Prefix+"extend", &LeaseArgs{
+				ID:         job.ID,
+				Lease:      job.Lease,
+				Visibility: w.visibility(),
+			})
+			if err != nil {
+				w.error(fmt.Errorf("jobqueue: extend of job %s: %s", job.ID, err))
+			}
+		}
+	}
+}
+
+func (w *Worker) visibility() time.Duration {
+	if w.Visibility > 0 {
+		return w.Visibility
+	}
+
+	return DefaultVisibilityTimeout
+}
+
+func (w *Worker) error(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+	}
+}
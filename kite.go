@@ -5,7 +5,7 @@ package kite
 
 import (
 	"bytes"
-	"crypto/rsa"
+	"crypto"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -24,7 +24,9 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	"github.com/igm/sockjs-go/sockjs"
+	"github.com/juju/ratelimit"
 	"github.com/koding/cache"
+	"github.com/koding/kite/clock"
 	"github.com/koding/kite/sockjsclient"
 	uuid "github.com/satori/go.uuid"
 )
@@ -64,6 +66,32 @@ type Kite struct {
 	// Keys are the authentication types (options.auth.type).
 	Authenticators map[string]func(*Request) error
 
+	// VerifyClaims, if not nil, is called by the default authenticators
+	// with the token or kite key of a request once its signature,
+	// expiration, audience and scope are verified, letting applications
+	// enforce rules of their own, e.g. on the tenant or the address of the
+	// client. The claims of the token are a *kitekey.KiteClaims, see
+	// kitekey.AllClaims for reading other claims. A returned error rejects
+	// the request with an authenticationError.
+	VerifyClaims func(r *Request, token *jwt.Token) error
+
+	// SessionHook, if not nil, is called with every session of the kite,
+	// served or dialed, before it is used; the returned session is used
+	// instead. It lets the frames of the sessions be observed, e.g. by
+	// the recording sessions of the record package.
+	SessionHook func(sockjs.Session) sockjs.Session
+
+	// Capture, if not nil, captures the dnode frames sent and received by
+	// the kite and its clients. It is opened from Config.WireCapture when
+	// the kite is created.
+	Capture *Capture
+
+	// Clock gives the time to the kite, its clients and a kontrol running
+	// on it: token expiration, heartbeats, timeouts, token renewals and
+	// backoffs. It is clock.Real by default. Tests set a *clock.Mock to
+	// advance time deterministically, before the kite is run or dialed.
+	Clock clock.Clock
+
 	// ClientFunc is used as the default value for kite.Client.ClientFunc.
 	// If nil, a default ClientFunc will be used.
 	//
@@ -73,6 +101,11 @@ type Kite struct {
 	// WebRTCHandler handles the webrtc responses coming from a signalling server.
 	WebRTCHandler Handler
 
+	// ReloadFunc returns the configuration applied by Reload. If nil,
+	// Config is read again with its Reload method, which requires it to be
+	// built by config.Load.
+	ReloadFunc func() (*config.Config, error)
+
 	// Handlers added with Kite.HandleFunc().
 	handlers     map[string]*Method // method map for exported methods
 	preHandlers  []Handler          // a list of handlers that are executed before any handler
@@ -91,11 +124,17 @@ type Kite struct {
 	kontrol *kontrolClient
 
 	// kontrolKey stores parsed Config.KontrolKey
-	kontrolKey *rsa.PublicKey
+	kontrolKey crypto.PublicKey
 
-	// configMu protects access to Config.{Kite,Kontrol}Key fields.
+	// configMu protects access to Config.{Kite,Kontrol}Key fields and the
+	// fields changed by Reload.
 	configMu sync.RWMutex
 
+	// reloadMu protects the state built from the settings changed by Reload.
+	reloadMu     sync.Mutex
+	rateLimiters map[string]*ratelimit.Bucket // per method, for Config.RateLimit
+	tlsCert      *tls.Certificate             // served if set by useConfigTLS
+
 	// verifyCache is used as a cache for verify method.
 	//
 	// The field is set by verifyInit method.
@@ -135,6 +174,9 @@ type Kite struct {
 	// registers successfully to Kontrol
 	onRegisterHandlers []func(*protocol.RegisterResult)
 
+	// Handlers to call after every chunk of a message sent or received.
+	onChunkProgressHandlers []func(*Client, *ChunkProgress)
+
 	// handlersMu protects access to on*Handlers fields.
 	handlersMu sync.RWMutex
 
@@ -177,6 +219,9 @@ func NewWithConfig(name, version string, cfg *config.Config) *Kite {
 	kiteID := uuid.Must(uuid.NewV4())
 
 	l, setlevel := newLogger(name)
+	if cfg.LogLevel != "" {
+		setlevel(parseLogLevel(cfg.LogLevel))
+	}
 
 	kClient := &kontrolClient{
 		readyConnected:  make(chan struct{}),
@@ -198,6 +243,11 @@ func NewWithConfig(name, version string, cfg *config.Config) *Kite {
 		closeC:         make(chan bool),
 		heartbeatC:     make(chan *heartbeatReq, 1),
 		muxer:          mux.NewRouter(),
+		Clock:          clock.Real,
+	}
+
+	if err := k.openCapture(); err != nil {
+		k.Log.Error("Cannot open wire capture: %s", err)
 	}
 
 	if cfg != nil && cfg.UseWebRTC {
@@ -249,10 +299,11 @@ func (k *Kite) KiteKey() string {
 	return k.Config.KiteKey
 }
 
-// KontrolKey gives a Kontrol's public key.
+// KontrolKey gives a Kontrol's public key, an *rsa.PublicKey,
+// *ecdsa.PublicKey or ed25519.PublicKey.
 //
 // The value is taken form kite key's kontrolKey claim.
-func (k *Kite) KontrolKey() *rsa.PublicKey {
+func (k *Kite) KontrolKey() crypto.PublicKey {
 	k.configMu.RLock()
 	defer k.configMu.RUnlock()
 
@@ -277,7 +328,15 @@ func (k *Kite) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	k.muxer.ServeHTTP(w, req)
 }
 
+// ServeSession serves the kite over a session opened by a transport other
+// than the SockJS handler of the kite, e.g. an in-memory session of the
+// kitetest package. It returns after the session is closed.
+func (k *Kite) ServeSession(session sockjs.Session) {
+	k.sockjsHandler(session)
+}
+
 func (k *Kite) sockjsHandler(session sockjs.Session) {
+	session = k.hookSession(session)
 	defer session.Close(3000, "Go away!")
 
 	// This Client also handles the connected client.
@@ -299,6 +358,23 @@ func (k *Kite) sockjsHandler(session sockjs.Session) {
 	k.callOnDisconnectHandlers(c)
 }
 
+// hookSession passes the session through SessionHook, if set. Sessions
+// trusted as initiated by the kite stay trusted.
+func (k *Kite) hookSession(session sockjs.Session) sockjs.Session {
+	if k.SessionHook == nil {
+		return session
+	}
+
+	trusted := isDialed(session)
+	session = k.SessionHook(session)
+
+	if trusted {
+		return &dialedSession{Session: session}
+	}
+
+	return session
+}
+
 // OnConnect registers a callbacks which is called when a Kite connects
 // to the k Kite.
 func (k *Kite) OnConnect(handler func(*Client)) {
@@ -387,10 +463,11 @@ func (k *Kite) updateAuth(reg *protocol.RegisterResult) {
 		k.Config.KiteKey = reg.KiteKey
 
 		ex := &kitekey.Extractor{
-			Claims: &kitekey.KiteClaims{},
+			Claims:     &kitekey.KiteClaims{},
+			Algorithms: k.Config.SigningAlgorithms,
 		}
 
-		if _, err := jwt.ParseWithClaims(reg.KiteKey, ex.Claims, ex.Extract); err != nil {
+		if _, err := kitekey.ParseAt(k.Clock.Now(), reg.KiteKey, ex.Claims, ex.Extract); err != nil {
 			k.Log.Error("auth update: unable to extract kontrol key: %s", err)
 
 			break
@@ -406,7 +483,7 @@ func (k *Kite) updateAuth(reg *protocol.RegisterResult) {
 	if reg.PublicKey != "" {
 		k.Config.KontrolKey = reg.PublicKey
 
-		key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(reg.PublicKey))
+		key, err := kitekey.ParsePublicKey([]byte(reg.PublicKey))
 		if err != nil {
 			k.Log.Error("auth update: unable to update kontrol key: %s", err)
 
@@ -428,10 +505,6 @@ func (k *Kite) RSAKey(token *jwt.Token) (interface{}, error) {
 		panic("kontrol key is not set in config")
 	}
 
-	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-		return nil, errors.New("invalid signing method")
-	}
-
 	claims, ok := token.Claims.(*kitekey.KiteClaims)
 	if !ok {
 		return nil, errors.New("token does not have valid claims")
@@ -441,6 +514,10 @@ func (k *Kite) RSAKey(token *jwt.Token) (interface{}, error) {
 		return nil, fmt.Errorf("issuer is not trusted: %s", claims.Issuer)
 	}
 
+	if err := kitekey.CheckSigningMethod(token, kontrolKey, k.signingAlgorithms(claims.Issuer)); err != nil {
+		return nil, err
+	}
+
 	return kontrolKey, nil
 }
 
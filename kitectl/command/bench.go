@@ -0,0 +1,260 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/loadtest"
+	"github.com/mitchellh/cli"
+)
+
+type Bench struct {
+	KiteClient *kite.Kite
+	Ui         cli.Ui
+}
+
+func NewBench() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Bench{
+			KiteClient: DefaultKiteClient,
+			Ui:         DefaultUi,
+		}, nil
+	}
+}
+
+func (c *Bench) Synopsis() string {
+	return "Load tests a method of a kite"
+}
+
+func (c *Bench) Help() string {
+	helpText := `
+Usage: kitectl bench [options] <url|query> <method> [args...]
+
+  Calls the method of a kite from concurrent workers for the given duration
+  or number of requests, then reports throughput, latency percentiles and
+  errors, with a histogram of the latencies. The kite is given by its URL
+  or a query, as for "kitectl ping". Arguments are passed as for
+  "kitectl tell". Interrupting the benchmark reports the requests made so
+  far.
+
+Options:
+
+  -c=10              Number of concurrent workers.
+  -d=10s             Duration of the benchmark.
+  -n=0               Stop after the given number of requests, 0 to run for
+                     the whole duration.
+  -connections=1     Number of connections the workers are spread over.
+  -timeout=4s        Timeout of dialing and of each request.
+  -transport=auto    Transport to connect with, WebSocket, XHRPolling or auto.
+  -args-file=file    Read the arguments as a JSON array from the file, "-"
+                     reads from stdin.
+  -payload=size      Append a string payload to the arguments of each
+                     request, of a size given as 1024, as a range 64-4096,
+                     or as weighted sizes 64:9,64k:1.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// benchResult is the JSON representation of the result of kitectl bench.
+type benchResult struct {
+	URL string `json:"url"`
+	*loadtest.Result
+}
+
+func (c *Bench) Run(args []string) int {
+	var (
+		concurrency, connections int
+		requests                 int64
+		duration, timeout        time.Duration
+		transport, argsFile      string
+		payload                  string
+	)
+
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	flags.IntVar(&concurrency, "c", 10, "")
+	flags.DurationVar(&duration, "d", 10*time.Second, "")
+	flags.Int64Var(&requests, "n", 0, "")
+	flags.IntVar(&connections, "connections", 1, "")
+	flags.DurationVar(&timeout, "timeout", 4*time.Second, "")
+	flags.StringVar(&transport, "transport", config.Transport(config.Auto).String(), "")
+	flags.StringVar(&argsFile, "args-file", "", "")
+	flags.StringVar(&payload, "payload", "", "")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	if concurrency < 1 || connections < 1 {
+		c.Ui.Error("-c and -connections must be at least 1")
+		return 1
+	}
+
+	if connections > concurrency {
+		connections = concurrency
+	}
+
+	t, ok := config.Transports[transport]
+	if !ok {
+		c.Ui.Error(fmt.Sprintf("Unknown transport %q", transport))
+		return 1
+	}
+
+	method := flags.Arg(1)
+	params := parseTellArgs(flags.Args()[2:])
+
+	var dist loadtest.Distribution
+	if payload != "" {
+		var err error
+		if dist, err = loadtest.ParseDistribution(payload); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	if argsFile != "" {
+		if flags.NArg() != 2 {
+			c.Ui.Error("Arguments cannot be given together with -args-file")
+			return 1
+		}
+
+		var err error
+		if params, err = readTellArgs(argsFile); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	first, err := resolveKite(c.KiteClient, flags.Arg(0))
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	clients := []*kite.Client{first}
+	for len(clients) < connections {
+		remote := c.KiteClient.NewClient(first.URL)
+		remote.Auth = first.Auth
+		clients = append(clients, remote)
+	}
+	defer kite.Close(clients)
+
+	for _, remote := range clients {
+		remote.Config = c.KiteClient.Config.Copy()
+		remote.Config.Transport = t
+
+		if err := remote.DialTimeout(timeout); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	if OutputFormat != OutputJSON {
+		c.Ui.Output(fmt.Sprintf("Benchmarking %s on %s with %d workers over %d connections",
+			method, first.URL, concurrency, connections))
+	}
+
+	// Stop on the deadline, after the requested number of requests or when
+	// interrupted, whichever comes first.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	g := &loadtest.Generator{
+		Clients:     clients,
+		Method:      method,
+		Args:        params,
+		Payload:     dist,
+		Concurrency: concurrency,
+		Duration:    duration,
+		Requests:    requests,
+		Timeout:     timeout,
+	}
+
+	res, err := g.Run(ctx)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	result := &benchResult{URL: first.URL, Result: res}
+
+	if OutputFormat == OutputJSON {
+		if code := outputJSON(c.Ui, result); code != 0 {
+			return code
+		}
+	} else {
+		c.printResult(result)
+	}
+
+	if result.Requests == 0 || result.Errors == result.Requests {
+		return 1
+	}
+
+	return 0
+}
+
+func (c *Bench) printResult(r *benchResult) {
+	l := r.Latency
+
+	c.Ui.Output("")
+	c.Ui.Output(fmt.Sprintf("Requests:    %d in %s", r.Requests, round(r.Duration)))
+	c.Ui.Output(fmt.Sprintf("Throughput:  %.2f req/s", r.Throughput))
+	c.Ui.Output(fmt.Sprintf("Errors:      %d (%.2f%%)", r.Errors, 100*r.ErrorRate))
+
+	if r.Succeeded() != 0 {
+		c.Ui.Output("Latency:")
+		c.Ui.Output(fmt.Sprintf("  min %s  mean %s  max %s", round(l.Min), round(l.Mean), round(l.Max)))
+		c.Ui.Output(fmt.Sprintf("  p50 %s  p90 %s  p95 %s  p99 %s", round(l.P50), round(l.P90), round(l.P95), round(l.P99)))
+
+		var buf bytes.Buffer
+		r.WriteHistogram(&buf)
+		c.Ui.Output("Histogram:")
+		c.Ui.Output(strings.TrimRight(buf.String(), "\n"))
+	}
+
+	if len(r.ErrorCounts) == 0 {
+		return
+	}
+
+	msgs := make([]string, 0, len(r.ErrorCounts))
+	for msg := range r.ErrorCounts {
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		return r.ErrorCounts[msgs[i]] > r.ErrorCounts[msgs[j]]
+	})
+
+	c.Ui.Output("Error counts:")
+	for i, msg := range msgs {
+		if i == maxBenchErrors {
+			c.Ui.Output(fmt.Sprintf("  ... and %d more kinds of errors", len(msgs)-i))
+			break
+		}
+		c.Ui.Output(fmt.Sprintf("  %6d  %s", r.ErrorCounts[msg], msg))
+	}
+}
+
+// maxBenchErrors is the number of most frequent errors printed.
+const maxBenchErrors = 10
@@ -0,0 +1,595 @@
+package command
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// defaultEnvFile is the default configuration shipped with a packaged kite.
+// Every variable is commented out so the built-in defaults stay in effect
+// until an operator changes them.
+const defaultEnvFile = `# Configuration of the %[1]s kite, read by its service unit.
+#
+# KITE_KONTROL_URL=https://kontrol.example.com/kite
+# KITE_USERNAME=
+# KITE_ENVIRONMENT=production
+# KITE_REGION=
+# KITE_PORT=
+# KITE_KEY_FILE=/etc/kite/kite.key
+`
+
+type Build struct {
+	Ui cli.Ui
+}
+
+func NewBuild() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Build{
+			Ui: DefaultUi,
+		}, nil
+	}
+}
+
+func (c *Build) Synopsis() string {
+	return "Builds a distributable kite package"
+}
+
+func (c *Build) Help() string {
+	helpText := `
+Usage: kitectl build [options] [dir]
+
+  Compiles the kite in the given directory (default: current directory) and
+  bundles the binary together with a default configuration file and service
+  unit files. The kite name and version are read from the .kite.json
+  manifest if present.
+
+  A tar package can be installed with "kitectl install"; deb and rpm
+  packages install the binary under the prefix, the configuration to
+  /etc/kite/<name>.env and a systemd unit named kite-<name>.
+
+Options:
+
+  -name=name         Name of the kite. Defaults to the directory name.
+  -version=version   Version of the kite. Defaults to the manifest version,
+                     or the version reported by the built binary.
+  -format=tar        Package format: tar, deb or rpm.
+  -os=os             Target operating system. Defaults to the host's.
+  -arch=arch         Target architecture. Defaults to the host's.
+  -prefix=/usr       Installation prefix of deb and rpm packages.
+  -o=dir             Directory to write the package to. Defaults to the
+                     current directory.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// buildSpec holds everything needed to package a single kite binary.
+type buildSpec struct {
+	Name    string
+	Version string
+	OS      string
+	Arch    string
+	Prefix  string
+	Binary  string // path of the compiled binary
+	Dir     string // source directory
+}
+
+func (b *buildSpec) bundleName() string {
+	return b.Name + "-" + b.Version + ".kite"
+}
+
+func (b *buildSpec) service() *serviceConfig {
+	return &serviceConfig{
+		Name:    b.Name,
+		Exec:    filepath.Join(b.Prefix, "bin", b.Name),
+		EnvFile: "/etc/kite/" + b.Name + ".env",
+	}
+}
+
+func (c *Build) Run(args []string) int {
+	var spec buildSpec
+	var format, outDir string
+
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	flags.StringVar(&spec.Name, "name", "", "")
+	flags.StringVar(&spec.Version, "version", "", "")
+	flags.StringVar(&format, "format", "tar", "")
+	flags.StringVar(&spec.OS, "os", runtime.GOOS, "")
+	flags.StringVar(&spec.Arch, "arch", runtime.GOARCH, "")
+	flags.StringVar(&spec.Prefix, "prefix", "/usr", "")
+	flags.StringVar(&outDir, "o", ".", "")
+	flags.Parse(args)
+
+	if flags.NArg() > 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	spec.Dir = "."
+	if flags.NArg() == 1 {
+		spec.Dir = flags.Arg(0)
+	}
+
+	var err error
+	if spec.Dir, err = filepath.Abs(spec.Dir); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	switch format {
+	case "tar", "deb", "rpm":
+	default:
+		c.Ui.Error(fmt.Sprintf("unknown package format: %q", format))
+		return 1
+	}
+
+	manifest, err := readBuildManifest(spec.Dir)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if spec.Name == "" {
+		spec.Name, _ = manifest["name"].(string)
+	}
+	if spec.Name == "" {
+		spec.Name = strings.TrimSuffix(filepath.Base(spec.Dir), ".kite")
+	}
+	if spec.Version == "" && manifest != nil {
+		spec.Version, _ = getVersion(manifest)
+	}
+
+	tempDir, err := ioutil.TempDir("", "kitectl-build-")
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer os.RemoveAll(tempDir)
+
+	spec.Binary = filepath.Join(tempDir, spec.Name)
+
+	c.Ui.Info(fmt.Sprintf("Building %s for %s_%s", spec.Name, spec.OS, spec.Arch))
+
+	env := append(os.Environ(), "GOOS="+spec.OS, "GOARCH="+spec.Arch)
+	if err := runIn(spec.Dir, env, "go", "build", "-o", spec.Binary, "."); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	// The kite reports its own version, prefer the one given explicitly
+	// but tell about a mismatch since the kite registers with the latter.
+	crossCompiled := spec.OS != runtime.GOOS || spec.Arch != runtime.GOARCH
+	if !crossCompiled {
+		kiteVersion, err := binaryVersion(spec.Binary)
+		switch {
+		case err != nil:
+			c.Ui.Warn(fmt.Sprintf("Cannot read version of the kite: %s", err))
+		case spec.Version == "":
+			spec.Version = kiteVersion
+		case spec.Version != kiteVersion:
+			c.Ui.Warn(fmt.Sprintf("Package version %s differs from the kite version %s",
+				spec.Version, kiteVersion))
+		}
+	}
+
+	if spec.Version == "" {
+		c.Ui.Error("cannot determine the kite version, please give it with the -version option")
+		return 1
+	}
+
+	var pkgPath string
+	switch format {
+	case "tar":
+		pkgPath, err = buildTar(&spec, outDir)
+	case "deb":
+		pkgPath, err = buildDeb(&spec, tempDir, outDir)
+	case "rpm":
+		pkgPath, err = buildRpm(&spec, tempDir, outDir)
+	}
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	c.Ui.Info("Written " + pkgPath)
+	return 0
+}
+
+// readBuildManifest reads the .kite.json manifest in dir. A missing manifest
+// is not an error, nil is returned instead.
+func readBuildManifest(dir string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ".kite.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make(map[string]interface{})
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest file: %s", err.Error())
+	}
+
+	return manifest, nil
+}
+
+// binaryVersion returns the version the kite binary was compiled with.
+// Kites print their version and exit when KITE_VERSION is set.
+func binaryVersion(path string) (string, error) {
+	// Don't wait forever for binaries that never reach kite.Run.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = append(os.Environ(), "KITE_VERSION=1")
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	version := strings.TrimSpace(string(out))
+	if version == "" || strings.ContainsAny(version, " \n") {
+		return "", errors.New("binary did not print its version")
+	}
+
+	return version, nil
+}
+
+// packageFile is a single file put into a package.
+type packageFile struct {
+	Path string // path relative to the package root
+	Mode os.FileMode
+	Data []byte // content of the file, ignored if Src is set
+	Src  string // path of the file on disk
+}
+
+// bundleFiles returns the files of a kite bundle, laid out the way
+// "kitectl install" expects.
+func bundleFiles(spec *buildSpec) ([]packageFile, error) {
+	systemd, err := systemdUnit(spec.service())
+	if err != nil {
+		return nil, err
+	}
+
+	launchd, err := launchdPlist(spec.service())
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := json.MarshalIndent(map[string]string{
+		"name":    spec.Name,
+		"version": spec.Version,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	root := spec.bundleName()
+	return []packageFile{
+		{Path: root + "/bin/" + spec.Name, Mode: 0755, Src: spec.Binary},
+		{Path: root + "/etc/" + spec.Name + ".env", Mode: 0644, Data: []byte(fmt.Sprintf(defaultEnvFile, spec.Name))},
+		{Path: root + "/service/" + serviceName(spec.Name) + ".service", Mode: 0644, Data: []byte(systemd)},
+		{Path: root + "/service/" + launchdLabel(spec.Name) + ".plist", Mode: 0644, Data: []byte(launchd)},
+		{Path: root + "/VERSION", Mode: 0644, Data: []byte(spec.Version + "\n")},
+		{Path: root + "/.kite.json", Mode: 0644, Data: append(manifest, '\n')},
+	}, nil
+}
+
+func buildTar(spec *buildSpec, outDir string) (string, error) {
+	files, err := bundleFiles(spec)
+	if err != nil {
+		return "", err
+	}
+
+	pkgPath := filepath.Join(outDir, fmt.Sprintf("%s-%s-%s_%s.kite.tar.gz",
+		spec.Name, spec.Version, spec.OS, spec.Arch))
+
+	f, err := os.Create(pkgPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	// extractTar expects the bundle directory to be the first entry.
+	dirs := map[string]bool{}
+	for _, file := range files {
+		for _, dir := range parentDirs(file.Path) {
+			if dirs[dir] {
+				continue
+			}
+			dirs[dir] = true
+
+			hdr := &tar.Header{Name: dir + "/", Mode: 0755, Typeflag: tar.TypeDir}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return "", err
+			}
+		}
+
+		if err := writeTarFile(tw, file); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	return pkgPath, f.Close()
+}
+
+// parentDirs returns the parent directories of the slash separated path,
+// outermost first.
+func parentDirs(path string) []string {
+	var dirs []string
+	for i, r := range path {
+		if r == '/' {
+			dirs = append(dirs, path[:i])
+		}
+	}
+	return dirs
+}
+
+func writeTarFile(tw *tar.Writer, file packageFile) error {
+	data := file.Data
+	if file.Src != "" {
+		var err error
+		if data, err = ioutil.ReadFile(file.Src); err != nil {
+			return err
+		}
+	}
+
+	hdr := &tar.Header{
+		Name:     file.Path,
+		Mode:     int64(file.Mode),
+		Size:     int64(len(data)),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := tw.Write(data)
+	return err
+}
+
+// stageFiles writes the files under the root directory.
+func stageFiles(root string, files []packageFile) error {
+	for _, file := range files {
+		path := filepath.Join(root, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		if file.Src != "" {
+			if err := copyFile(file.Src, path, file.Mode); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := ioutil.WriteFile(path, file.Data, file.Mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// systemFiles returns the files of a deb or rpm package, relative to the
+// filesystem root.
+func systemFiles(spec *buildSpec) ([]packageFile, error) {
+	systemd, err := systemdUnit(spec.service())
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimPrefix(spec.Prefix, "/")
+	return []packageFile{
+		{Path: prefix + "/bin/" + spec.Name, Mode: 0755, Src: spec.Binary},
+		{Path: "etc/kite/" + spec.Name + ".env", Mode: 0644, Data: []byte(fmt.Sprintf(defaultEnvFile, spec.Name))},
+		{Path: "lib/systemd/system/" + serviceName(spec.Name) + ".service", Mode: 0644, Data: []byte(systemd)},
+	}, nil
+}
+
+// debArch maps GOARCH values to Debian architecture names.
+var debArch = map[string]string{
+	"386":   "i386",
+	"amd64": "amd64",
+	"arm":   "armhf",
+	"arm64": "arm64",
+}
+
+func buildDeb(spec *buildSpec, tempDir, outDir string) (string, error) {
+	if spec.OS != "linux" {
+		return "", fmt.Errorf("deb packages can only be built for linux, not %s", spec.OS)
+	}
+
+	arch, ok := debArch[spec.Arch]
+	if !ok {
+		arch = spec.Arch
+	}
+
+	files, err := systemFiles(spec)
+	if err != nil {
+		return "", err
+	}
+
+	control := fmt.Sprintf(`Package: %s
+Version: %s
+Architecture: %s
+Maintainer: %s
+Section: net
+Priority: optional
+Description: %s kite
+`, spec.Name, spec.Version, arch, packageMaintainer(), spec.Name)
+
+	files = append(files,
+		packageFile{Path: "DEBIAN/control", Mode: 0644, Data: []byte(control)},
+		packageFile{Path: "DEBIAN/conffiles", Mode: 0644, Data: []byte("/etc/kite/" + spec.Name + ".env\n")},
+	)
+
+	root := filepath.Join(tempDir, "deb")
+	if err := stageFiles(root, files); err != nil {
+		return "", err
+	}
+
+	pkgPath, err := filepath.Abs(filepath.Join(outDir,
+		fmt.Sprintf("%s_%s_%s.deb", spec.Name, spec.Version, arch)))
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"dpkg-deb", "--build", root, pkgPath}
+	if _, err := exec.LookPath("fakeroot"); err == nil {
+		args = append([]string{"fakeroot"}, args...)
+	}
+
+	if err := runIn(tempDir, nil, args[0], args[1:]...); err != nil {
+		return "", err
+	}
+
+	return pkgPath, nil
+}
+
+// rpmArch maps GOARCH values to RPM architecture names.
+var rpmArch = map[string]string{
+	"386":   "i386",
+	"amd64": "x86_64",
+	"arm":   "armhfp",
+	"arm64": "aarch64",
+}
+
+func buildRpm(spec *buildSpec, tempDir, outDir string) (string, error) {
+	if spec.OS != "linux" {
+		return "", fmt.Errorf("rpm packages can only be built for linux, not %s", spec.OS)
+	}
+
+	if _, err := exec.LookPath("rpmbuild"); err != nil {
+		return "", errors.New("rpmbuild is required to build rpm packages")
+	}
+
+	arch, ok := rpmArch[spec.Arch]
+	if !ok {
+		arch = spec.Arch
+	}
+
+	files, err := systemFiles(spec)
+	if err != nil {
+		return "", err
+	}
+
+	root := filepath.Join(tempDir, "rpm", "root")
+	if err := stageFiles(root, files); err != nil {
+		return "", err
+	}
+
+	// RPM versions cannot contain dashes.
+	version := strings.Replace(spec.Version, "-", "_", -1)
+
+	var fileList []string
+	for _, file := range files {
+		path := "/" + file.Path
+		if strings.HasPrefix(file.Path, "etc/") {
+			path = "%config(noreplace) " + path
+		}
+		fileList = append(fileList, path)
+	}
+
+	specFile := fmt.Sprintf(`Name: %[1]s
+Version: %[2]s
+Release: 1
+Summary: %[1]s kite
+License: Proprietary
+Packager: %[3]s
+
+%%description
+%[1]s kite
+
+%%install
+cp -a %[4]s/. %%{buildroot}/
+
+%%files
+%[5]s
+`, spec.Name, version, packageMaintainer(), root, strings.Join(fileList, "\n"))
+
+	specPath := filepath.Join(tempDir, "rpm", spec.Name+".spec")
+	if err := ioutil.WriteFile(specPath, []byte(specFile), 0644); err != nil {
+		return "", err
+	}
+
+	rpmDir := filepath.Join(tempDir, "rpm", "out")
+	err = runIn(tempDir, nil, "rpmbuild", "-bb",
+		"--target", arch,
+		"--define", "_topdir "+filepath.Join(tempDir, "rpm", "top"),
+		"--define", "_rpmdir "+rpmDir,
+		"--define", "_build_name_fmt %{NAME}-%{VERSION}-%{RELEASE}.%{ARCH}.rpm",
+		specPath)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%s-%s-1.%s.rpm", spec.Name, version, arch)
+	pkgPath := filepath.Join(outDir, name)
+	if err := copyFile(filepath.Join(rpmDir, name), pkgPath, 0644); err != nil {
+		return "", err
+	}
+
+	return pkgPath, nil
+}
+
+// packageMaintainer returns the maintainer field of deb and rpm packages,
+// taken from the git configuration of the user building the package.
+func packageMaintainer() string {
+	name, _ := outputIn("", "git", "config", "user.name")
+	email, _ := outputIn("", "git", "config", "user.email")
+
+	name, email = strings.TrimSpace(name), strings.TrimSpace(email)
+	switch {
+	case name != "" && email != "":
+		return fmt.Sprintf("%s <%s>", name, email)
+	case name != "":
+		return name
+	default:
+		return "unknown"
+	}
+}
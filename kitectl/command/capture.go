@@ -0,0 +1,141 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/koding/kite"
+	"github.com/mitchellh/cli"
+)
+
+type Capture struct {
+	Ui cli.Ui
+}
+
+func NewCapture() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Capture{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Capture) Synopsis() string {
+	return "Pretty-prints wire captures of kites"
+}
+
+func (c *Capture) Help() string {
+	helpText := `
+Usage: kitectl capture [options] [file...]
+
+  Prints the dnode frames of wire captures written by kites run with
+  KITE_WIRE_CAPTURE set, read from the files or from stdin. Each frame is
+  printed with its time, direction, connection and method, followed by the
+  frame as indented JSON.
+
+Options:
+
+  -conn=ID       Print only the frames of the connection.
+  -method=NAME   Print only the frames calling the method, or the callback
+                 for a number.
+  -compact       Print the frames as they were sent, without indentation.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Capture) Run(args []string) int {
+	var conn, method string
+	var compact bool
+
+	flags := flag.NewFlagSet("capture", flag.ExitOnError)
+	flags.StringVar(&conn, "conn", "", "")
+	flags.StringVar(&method, "method", "", "")
+	flags.BoolVar(&compact, "compact", false, "")
+	flags.Parse(args)
+
+	var frames []kite.CaptureFrame
+
+	read := func(name string, r io.Reader) bool {
+		f, err := kite.ReadCapture(r)
+		frames = append(frames, f...)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("%s: %s", name, err))
+			return false
+		}
+		return true
+	}
+
+	if flags.NArg() == 0 {
+		if !read("stdin", os.Stdin) {
+			return 1
+		}
+	}
+
+	for _, name := range flags.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+
+		ok := read(name, f)
+		f.Close()
+
+		if !ok {
+			return 1
+		}
+	}
+
+	for _, f := range frames {
+		m := frameMethod(f.Data)
+
+		if conn != "" && f.Conn != conn {
+			continue
+		}
+
+		if method != "" && m != method {
+			continue
+		}
+
+		arrow := "->"
+		if f.Dir == kite.CaptureRecv {
+			arrow = "<-"
+		}
+
+		c.Ui.Output(fmt.Sprintf("%s %s %s conn=%s remote=%s method=%s",
+			f.Time.Format("15:04:05.000000"), f.Dir, arrow, f.Conn, f.Remote, m))
+
+		var buf bytes.Buffer
+		if compact || json.Indent(&buf, []byte(f.Data), "  ", "  ") != nil {
+			c.Ui.Output("  " + f.Data)
+		} else {
+			c.Ui.Output("  " + buf.String())
+		}
+	}
+
+	return 0
+}
+
+// frameMethod returns the method of a dnode frame, a method name or the ID
+// of a callback.
+func frameMethod(data string) string {
+	var msg struct {
+		Method interface{} `json:"method"`
+	}
+
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		return "?"
+	}
+
+	switch m := msg.Method.(type) {
+	case string:
+		return m
+	case float64:
+		return fmt.Sprintf("%g", m)
+	default:
+		return "?"
+	}
+}
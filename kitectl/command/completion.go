@@ -0,0 +1,362 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// CompleteCommandName is the hidden command the completion scripts call
+// back into to get the candidates for the word being completed.
+const CompleteCommandName = "__complete"
+
+// helpFlagRegexp matches the flags listed in the Options section of a
+// command's help text.
+var helpFlagRegexp = regexp.MustCompile(`(?m)^\s+(-[a-zA-Z][\w-]*)`)
+
+// globalFlags are the flags accepted before every command name, see
+// ParseGlobalFlags.
+var globalFlags = []string{"-output", "-profile"}
+
+var completionScripts = map[string]string{
+	"bash": `
+_{{name}}() {
+    local line="${COMP_LINE:0:$COMP_POINT}"
+    local -a words
+    read -ra words <<< "$line"
+    [[ "$line" == *" " ]] && words+=("")
+    local cur="${words[${#words[@]}-1]}"
+    local IFS=$'\n'
+    COMPREPLY=($({{name}} {{complete}} "${words[@]:1}" 2>/dev/null))
+    # Bash splits words at "=", only the part after it is replaced.
+    if [[ "$cur" == *=* && "$COMP_WORDBREAKS" == *=* ]]; then
+        COMPREPLY=("${COMPREPLY[@]#"${cur%=*}="}")
+    fi
+}
+complete -F _{{name}} {{name}}
+`,
+	"zsh": `
+#compdef {{name}}
+_{{name}}() {
+    local -a candidates
+    candidates=("${(@f)$({{name}} {{complete}} "${(@)words[2,$CURRENT]}" 2>/dev/null)}")
+    compadd -- "${candidates[@]}"
+}
+compdef _{{name}} {{name}}
+`,
+	"fish": `
+function __{{name}}_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    {{name}} {{complete}} $tokens[2..-1] 2>/dev/null
+end
+complete -c {{name}} -f -a '(__{{name}}_complete)'
+`,
+}
+
+type Completion struct {
+	Ui cli.Ui
+}
+
+func NewCompletion() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Completion{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Completion) Synopsis() string {
+	return "Prints a shell completion script"
+}
+
+func (c *Completion) Help() string {
+	helpText := `
+Usage: kitectl completion bash|zsh|fish
+
+  Prints the completion script for the given shell. It completes commands,
+  flags, installed kites, profiles and the kites found by the last query.
+  To enable it, add the following to your shell's startup file:
+
+    bash:  source <(kitectl completion bash)
+    zsh:   source <(kitectl completion zsh)
+    fish:  kitectl completion fish | source
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Completion) Run(args []string) int {
+	if len(args) != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		c.Ui.Error(fmt.Sprintf("Unsupported shell %q, must be one of bash, zsh or fish", args[0]))
+		return 1
+	}
+
+	script = strings.Replace(script, "{{name}}", AppName, -1)
+	script = strings.Replace(script, "{{complete}}", CompleteCommandName, -1)
+
+	c.Ui.Output(strings.TrimSpace(script))
+	return 0
+}
+
+// Complete is the hidden command the completion scripts call. It is given
+// the words of the command line after the program name, the last one
+// being the word to complete, and prints the candidates one per line.
+type Complete struct {
+	Ui       cli.Ui
+	Commands map[string]cli.CommandFactory
+}
+
+func NewComplete(commands map[string]cli.CommandFactory) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Complete{
+			Ui:       DefaultUi,
+			Commands: commands,
+		}, nil
+	}
+}
+
+func (c *Complete) Synopsis() string {
+	return "Completes a command line"
+}
+
+func (c *Complete) Help() string {
+	helpText := `
+Usage: kitectl __complete [words]
+
+  Prints the completion candidates for the last word. Used by the scripts
+  printed by "kitectl completion".
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Complete) Run(args []string) int {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+
+	cur := args[len(args)-1]
+
+	for _, candidate := range c.candidates(args[:len(args)-1], cur) {
+		if strings.HasPrefix(candidate, cur) {
+			c.Ui.Output(candidate)
+		}
+	}
+
+	return 0
+}
+
+func (c *Complete) candidates(words []string, cur string) []string {
+	var cmd string     // name of the command given so far
+	var positional int // number of arguments given to it
+	var prev string
+
+	for _, w := range words {
+		switch {
+		case strings.HasPrefix(w, "-"):
+			// flags and their values are not counted
+		case strings.HasPrefix(prev, "-") && !strings.Contains(prev, "=") && c.takesValue(cmd, prev):
+		case positional == 0 && c.Commands[strings.TrimSpace(cmd+" "+w)] != nil:
+			cmd = strings.TrimSpace(cmd + " " + w)
+		default:
+			positional++
+		}
+		prev = w
+	}
+
+	// Values of flags, either as -flag=value or -flag value.
+	if i := strings.IndexRune(cur, '='); strings.HasPrefix(cur, "-") && i != -1 {
+		return prefixAll(cur[:i+1], c.flagValues(cur[:i]))
+	}
+	if strings.HasPrefix(prev, "-") && !strings.Contains(prev, "=") && c.takesValue(cmd, prev) {
+		return c.flagValues(prev)
+	}
+
+	if strings.HasPrefix(cur, "-") {
+		if cmd == "" {
+			return globalFlags
+		}
+		return c.flags(cmd)
+	}
+
+	if positional == 0 {
+		if sub := c.subcommands(cmd); len(sub) != 0 {
+			return sub
+		}
+	}
+
+	return c.arguments(cmd, positional)
+}
+
+// subcommands returns the names of the commands nested under cmd, or the
+// top level commands if cmd is empty.
+func (c *Complete) subcommands(cmd string) []string {
+	var names []string
+
+	prefix := ""
+	if cmd != "" {
+		prefix = cmd + " "
+	}
+
+	for name := range c.Commands {
+		if name == CompleteCommandName || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		if rest := strings.TrimPrefix(name, prefix); !strings.Contains(rest, " ") {
+			names = append(names, rest)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// flags returns the flags listed in the help of the command.
+func (c *Complete) flags(cmd string) []string {
+	factory, ok := c.Commands[cmd]
+	if !ok {
+		return nil
+	}
+
+	command, err := factory()
+	if err != nil {
+		return nil
+	}
+
+	var flags []string
+	for _, m := range helpFlagRegexp.FindAllStringSubmatch(command.Help(), -1) {
+		flags = append(flags, m[1])
+	}
+
+	return flags
+}
+
+// takesValue reports whether the flag is given a value, which is the case
+// for global flags before the command name and for flags shown with "=" in
+// the help of cmd.
+func (c *Complete) takesValue(cmd, flag string) bool {
+	flag = "-" + strings.TrimLeft(flag, "-")
+
+	for _, f := range globalFlags {
+		if f == flag && cmd == "" {
+			return true
+		}
+	}
+
+	factory, ok := c.Commands[cmd]
+	if !ok {
+		return false
+	}
+
+	command, err := factory()
+	if err != nil {
+		return false
+	}
+
+	return regexp.MustCompile(`(?m)^\s+` + regexp.QuoteMeta(flag) + `=`).MatchString(command.Help())
+}
+
+func (c *Complete) flagValues(flag string) []string {
+	switch strings.TrimLeft(flag, "-") {
+	case "output":
+		return []string{OutputText, OutputJSON}
+	case "profile":
+		return profileNames()
+	case "name":
+		var names []string
+		for _, k := range cachedKites() {
+			names = append(names, k.Kite.Name)
+		}
+		return names
+	case "to":
+		var urls []string
+		for _, k := range cachedKites() {
+			urls = append(urls, k.URL)
+		}
+		return urls
+	case "id":
+		var ids []string
+		for _, k := range cachedKites() {
+			ids = append(ids, k.Kite.ID)
+		}
+		return ids
+	}
+
+	return nil
+}
+
+func (c *Complete) arguments(cmd string, positional int) []string {
+	if positional > 0 {
+		return nil
+	}
+
+	switch cmd {
+	case "run", "uninstall", "logs", "status":
+		return installedKiteNames()
+	case "env show", "env use", "env remove":
+		return profileNames()
+	case "completion":
+		var shells []string
+		for shell := range completionScripts {
+			shells = append(shells, shell)
+		}
+		sort.Strings(shells)
+		return shells
+	}
+
+	return nil
+}
+
+func prefixAll(prefix string, values []string) []string {
+	prefixed := make([]string, len(values))
+	for i, v := range values {
+		prefixed[i] = prefix + v
+	}
+
+	return prefixed
+}
+
+func installedKiteNames() []string {
+	kites, err := getInstalledKites("")
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, k := range kites {
+		names = append(names, k.Name(), k.String())
+	}
+
+	return names
+}
+
+func profileNames() []string {
+	settings, err := ReadSettings()
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for name := range settings.Profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// cachedKites returns the kites found by the last query.
+func cachedKites() []queryResult {
+	kites, err := readQueryCache()
+	if err != nil {
+		return nil
+	}
+
+	return kites
+}
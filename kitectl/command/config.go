@@ -0,0 +1,301 @@
+package command
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// settingKey is a setting that can be read and written with kitectl config.
+type settingKey struct {
+	Description string
+	Field       func(*Settings) *string
+	Validate    func(string) error
+}
+
+var settingKeys = map[string]settingKey{
+	"kontrol-url": {
+		Description: "Kontrol URL used unless given by KITE_KONTROL_URL or the profile",
+		Field:       func(s *Settings) *string { return &s.KontrolURL },
+		Validate:    validateSettingURL,
+	},
+	"environment": {
+		Description: "Environment used unless given by KITE_ENVIRONMENT or the profile",
+		Field:       func(s *Settings) *string { return &s.Environment },
+		Validate: func(v string) error {
+			if strings.ContainsRune(v, '/') {
+				return fmt.Errorf("environment must not contain '/'")
+			}
+			return nil
+		},
+	},
+	"output": {
+		Description: "Output format used unless given by -output, text or json",
+		Field:       func(s *Settings) *string { return &s.Output },
+		Validate: func(v string) error {
+			if v != OutputText && v != OutputJSON {
+				return fmt.Errorf("invalid output format %q, must be %q or %q", v, OutputText, OutputJSON)
+			}
+			return nil
+		},
+	},
+	"proxy": {
+		Description: "HTTP proxy used unless HTTP_PROXY or HTTPS_PROXY are set",
+		Field:       func(s *Settings) *string { return &s.Proxy },
+		Validate:    validateSettingURL,
+	},
+}
+
+func validateSettingURL(v string) error {
+	u, err := url.Parse(v)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute URL", v)
+	}
+
+	return nil
+}
+
+// lookupSettingKey returns the setting with the given name.
+func lookupSettingKey(name string) (settingKey, error) {
+	key, ok := settingKeys[name]
+	if !ok {
+		return settingKey{}, fmt.Errorf("unknown setting %q, see \"kitectl config\" for the list", name)
+	}
+	return key, nil
+}
+
+func sortedSettingNames() []string {
+	names := make([]string, 0, len(settingKeys))
+	for name := range settingKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type Config struct {
+	Ui cli.Ui
+}
+
+func NewConfig() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Config{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Config) Synopsis() string {
+	return "Reads and writes kitectl settings"
+}
+
+func (c *Config) Help() string {
+	helpText := `
+Usage: kitectl config <subcommand> [args]
+
+  Reads and writes the persistent settings of kitectl, stored together
+  with the profiles in ~/.kite/kitectl.json. The settings are defaults:
+  command line flags, the environment and the active profile take
+  precedence over them.
+
+Settings:
+
+`
+	var lines []string
+	for _, name := range sortedSettingNames() {
+		lines = append(lines, fmt.Sprintf("  %-13s %s", name, settingKeys[name].Description))
+	}
+
+	return strings.TrimSpace(helpText) + "\n\n" + strings.Join(lines, "\n")
+}
+
+func (c *Config) Run(_ []string) int {
+	return cli.RunResultHelp
+}
+
+type ConfigGet struct {
+	Ui cli.Ui
+}
+
+func NewConfigGet() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &ConfigGet{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *ConfigGet) Synopsis() string {
+	return "Shows kitectl settings"
+}
+
+func (c *ConfigGet) Help() string {
+	helpText := `
+Usage: kitectl config get [name]
+
+  Shows the value of the named setting, or all settings which are set if no
+  name is given. Supports the global -output=json flag.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConfigGet) Run(args []string) int {
+	if len(args) > 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	settings, err := ReadSettings()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if len(args) == 1 {
+		key, err := lookupSettingKey(args[0])
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+
+		value := *key.Field(settings)
+
+		if OutputFormat == OutputJSON {
+			return outputJSON(c.Ui, value)
+		}
+
+		if value != "" {
+			c.Ui.Output(value)
+		}
+		return 0
+	}
+
+	values := make(map[string]string)
+	for name, key := range settingKeys {
+		if v := *key.Field(settings); v != "" {
+			values[name] = v
+		}
+	}
+
+	if OutputFormat == OutputJSON {
+		return outputJSON(c.Ui, values)
+	}
+
+	for _, name := range sortedSettingNames() {
+		if v, ok := values[name]; ok {
+			c.Ui.Output(fmt.Sprintf("%s = %s", name, v))
+		}
+	}
+
+	return 0
+}
+
+type ConfigSet struct {
+	Ui cli.Ui
+}
+
+func NewConfigSet() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &ConfigSet{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *ConfigSet) Synopsis() string {
+	return "Changes a kitectl setting"
+}
+
+func (c *ConfigSet) Help() string {
+	helpText := `
+Usage: kitectl config set name value
+
+  Sets the named setting to the given value.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConfigSet) Run(args []string) int {
+	if len(args) != 2 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	key, err := lookupSettingKey(args[0])
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if err := key.Validate(args[1]); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	settings, err := ReadSettings()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	*key.Field(settings) = args[1]
+
+	if err := settings.Write(); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+type ConfigUnset struct {
+	Ui cli.Ui
+}
+
+func NewConfigUnset() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &ConfigUnset{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *ConfigUnset) Synopsis() string {
+	return "Removes a kitectl setting"
+}
+
+func (c *ConfigUnset) Help() string {
+	helpText := `
+Usage: kitectl config unset name
+
+  Removes the named setting, so its built-in default is used again.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConfigUnset) Run(args []string) int {
+	if len(args) != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	key, err := lookupSettingKey(args[0])
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	settings, err := ReadSettings()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	*key.Field(settings) = ""
+
+	if err := settings.Write(); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,340 @@
+package command
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/kitekey"
+	"github.com/mitchellh/cli"
+)
+
+// Statuses of the findings of kitectl doctor.
+const (
+	FindingOK   = "ok"
+	FindingWarn = "warn"
+	FindingFail = "fail"
+)
+
+// tokenLeeway is the clock difference kontrol tolerates before the tokens it
+// issues are rejected by kites, see kontrol.TokenLeeway.
+const tokenLeeway = 5 * time.Minute
+
+// Finding is the result of a single check made by kitectl doctor.
+type Finding struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+type Doctor struct {
+	Ui cli.Ui
+
+	findings []*Finding
+}
+
+func NewDoctor() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Doctor{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Doctor) Synopsis() string {
+	return "Diagnoses common setup problems"
+}
+
+func (c *Doctor) Help() string {
+	helpText := `
+Usage: kitectl doctor [options]
+
+  Checks the kite.key, Kontrol reachability and TLS trust, clock skew
+  against Kontrol, the availability of the kite port and the toolchain
+  needed to install kites from source. It exits with a non-zero status if
+  any check fails.
+
+Options:
+
+  -port=6000         Port the kite listens on, KITE_PORT by default.
+  -timeout=10s       Timeout of the requests made to Kontrol.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Doctor) Run(args []string) int {
+	var port int
+	var timeout time.Duration
+
+	defaultPort, _ := strconv.Atoi(os.Getenv("KITE_PORT"))
+
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags.IntVar(&port, "port", defaultPort, "")
+	flags.DurationVar(&timeout, "timeout", 10*time.Second, "")
+	flags.Parse(args)
+
+	kontrolURL := c.checkKiteKey()
+	c.checkKontrol(kontrolURL, timeout)
+	c.checkPort(port)
+	c.checkToolchain()
+
+	failed := false
+	for _, f := range c.findings {
+		if f.Status == FindingFail {
+			failed = true
+		}
+	}
+
+	if OutputFormat == OutputJSON {
+		if code := outputJSON(c.Ui, c.findings); code != 0 {
+			return code
+		}
+	} else {
+		c.print()
+	}
+
+	if failed {
+		return 1
+	}
+
+	return 0
+}
+
+func (c *Doctor) print() {
+	for _, f := range c.findings {
+		line := fmt.Sprintf("[%-4s] %-10s %s", strings.ToUpper(f.Status), f.Check, f.Message)
+
+		switch f.Status {
+		case FindingOK:
+			c.Ui.Output(line)
+		case FindingWarn:
+			c.Ui.Warn(line)
+		default:
+			c.Ui.Error(line)
+		}
+
+		if f.Hint != "" {
+			c.Ui.Output("                  " + f.Hint)
+		}
+	}
+}
+
+func (c *Doctor) add(check, status, message, hint string) {
+	c.findings = append(c.findings, &Finding{
+		Check:   check,
+		Status:  status,
+		Message: message,
+		Hint:    hint,
+	})
+}
+
+// checkKiteKey checks the kite.key and returns the Kontrol URL to check,
+// taken from the key or the environment.
+func (c *Doctor) checkKiteKey() string {
+	conf := config.New()
+	conf.ReadEnvironmentVariables()
+
+	keyPath, err := kitekey.KiteKeyPath()
+	if err != nil {
+		c.add("kite.key", FindingFail, err.Error(), "")
+		return conf.KontrolURL
+	}
+
+	if store := os.Getenv("KITE_KEY_STORE"); store != "" && store != kitekey.FileStoreName {
+		keyPath = "the " + store + " store"
+	}
+
+	token, err := kitekey.Parse()
+	if os.IsNotExist(err) {
+		c.add("kite.key", FindingFail, "no kite.key at "+keyPath,
+			`Register this machine to Kontrol with "kitectl register".`)
+		return conf.KontrolURL
+	}
+	if err != nil {
+		c.add("kite.key", FindingFail, fmt.Sprintf("%s is invalid: %s", keyPath, err),
+			`Register again with "kitectl register" to get a new key.`)
+		return conf.KontrolURL
+	}
+
+	claims := token.Claims.(*kitekey.KiteClaims)
+
+	if claims.KontrolURL == "" && conf.KontrolURL == "" {
+		c.add("kite.key", FindingWarn, "no Kontrol URL in "+keyPath,
+			"Set KITE_KONTROL_URL or add a profile with kitectl env add.")
+	}
+
+	if claims.ExpiresAt != 0 {
+		expires := time.Unix(claims.ExpiresAt, 0)
+		if left := time.Until(expires); left < 7*24*time.Hour {
+			c.add("kite.key", FindingWarn, fmt.Sprintf("%s expires at %s", keyPath, expires.Format(time.RFC3339)),
+				`Register again with "kitectl register" before it expires.`)
+			return kontrolFromKey(conf, claims)
+		}
+	}
+
+	c.add("kite.key", FindingOK, fmt.Sprintf("%s is valid, issued to %q by %q", keyPath, claims.Subject, claims.Issuer), "")
+	return kontrolFromKey(conf, claims)
+}
+
+func kontrolFromKey(conf *config.Config, claims *kitekey.KiteClaims) string {
+	// Environment variables override the key, as in config.Get.
+	if os.Getenv("KITE_KONTROL_URL") != "" {
+		return conf.KontrolURL
+	}
+
+	return claims.KontrolURL
+}
+
+func (c *Doctor) checkKontrol(kontrolURL string, timeout time.Duration) {
+	if kontrolURL == "" {
+		c.add("kontrol", FindingFail, "no Kontrol URL configured",
+			"Set KITE_KONTROL_URL or register with kitectl register -to=URL.")
+		return
+	}
+
+	u, err := url.Parse(kontrolURL)
+	if err != nil {
+		c.add("kontrol", FindingFail, fmt.Sprintf("invalid Kontrol URL %q: %s", kontrolURL, err), "")
+		return
+	}
+
+	if u.Scheme == "https" {
+		c.checkTLS(u, timeout)
+	}
+
+	client := &http.Client{Timeout: timeout}
+
+	start := time.Now()
+	res, err := client.Get(strings.TrimSuffix(kontrolURL, "/") + "/info")
+	if err != nil {
+		hint := "Check that Kontrol is running and no firewall or proxy blocks " + u.Host + "."
+		c.add("kontrol", FindingFail, fmt.Sprintf("cannot reach %s: %s", kontrolURL, err), hint)
+		return
+	}
+	res.Body.Close()
+	rtt := time.Since(start)
+
+	if res.StatusCode != http.StatusOK {
+		c.add("kontrol", FindingFail, fmt.Sprintf("%s responded with %s", kontrolURL, res.Status),
+			"Check that the URL points to the Kontrol kite, usually ending with /kite.")
+		return
+	}
+
+	c.add("kontrol", FindingOK, fmt.Sprintf("%s is reachable (%s)", kontrolURL, rtt.Truncate(time.Millisecond)), "")
+
+	date, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		c.add("clock", FindingWarn, "Kontrol did not send its time, clock skew is not checked", "")
+		return
+	}
+
+	// The Date header has a second precision and is taken somewhere
+	// during the request.
+	skew := time.Since(date) - rtt/2
+	if skew < 0 {
+		skew = -skew
+	}
+
+	switch {
+	case skew > tokenLeeway:
+		c.add("clock", FindingFail, fmt.Sprintf("clock is %s off from Kontrol", skew.Truncate(time.Second)),
+			"Tokens issued by Kontrol will be rejected, synchronize the clock with NTP.")
+	case skew > 30*time.Second:
+		c.add("clock", FindingWarn, fmt.Sprintf("clock is %s off from Kontrol", skew.Truncate(time.Second)),
+			"Synchronize the clock with NTP.")
+	default:
+		c.add("clock", FindingOK, "clock is in sync with Kontrol", "")
+	}
+}
+
+func (c *Doctor) checkTLS(u *url.URL, timeout time.Duration) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	if err != nil {
+		hint := "Install the CA certificate of Kontrol into the system trust store, or point SSL_CERT_FILE to it."
+		if _, ok := err.(net.Error); ok {
+			hint = ""
+		}
+		c.add("tls", FindingFail, fmt.Sprintf("TLS handshake with %s failed: %s", host, err), hint)
+		return
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		c.add("tls", FindingFail, host+" sent no certificate", "")
+		return
+	}
+
+	if left := time.Until(certs[0].NotAfter); left < 14*24*time.Hour {
+		c.add("tls", FindingWarn, fmt.Sprintf("certificate of %s expires at %s", host, certs[0].NotAfter.Format(time.RFC3339)),
+			"Renew the certificate of Kontrol.")
+		return
+	}
+
+	c.add("tls", FindingOK, fmt.Sprintf("certificate of %s is trusted", host), "")
+}
+
+func (c *Doctor) checkPort(port int) {
+	if port == 0 {
+		return
+	}
+
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		c.add("port", FindingFail, fmt.Sprintf("cannot listen on port %d: %s", port, err),
+			"Stop the process using the port or run the kite with another KITE_PORT.")
+		return
+	}
+	l.Close()
+
+	c.add("port", FindingOK, fmt.Sprintf("port %d is available", port), "")
+}
+
+// checkToolchain checks the tools needed by kitectl install to build kites
+// from git repositories.
+func (c *Doctor) checkToolchain() {
+	const hint = "Needed only to install kites from git repositories."
+
+	for _, tool := range []string{"git", "go"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			c.add("toolchain", FindingWarn, tool+" is not found in PATH", hint)
+			return
+		}
+	}
+
+	out, err := exec.Command("go", "env", "GOPATH").Output()
+	if err != nil {
+		c.add("toolchain", FindingWarn, "cannot run go env: "+err.Error(), hint)
+		return
+	}
+
+	gopath := strings.TrimSpace(string(out))
+	if gopath == "" {
+		c.add("toolchain", FindingWarn, "GOPATH is not set", hint)
+		return
+	}
+
+	first := filepath.SplitList(gopath)[0]
+	if fi, err := os.Stat(first); err != nil || !fi.IsDir() {
+		c.add("toolchain", FindingWarn, fmt.Sprintf("GOPATH directory %s does not exist", first), hint)
+		return
+	}
+
+	version, _ := exec.Command("go", "version").Output()
+	c.add("toolchain", FindingOK, strings.TrimSpace(string(version))+", GOPATH is "+gopath, "")
+}
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/koding/kite/kitekey"
+	"github.com/mitchellh/cli"
+)
+
+type Encryptkey struct {
+	Ui cli.Ui
+}
+
+func NewEncryptkey() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Encryptkey{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Encryptkey) Synopsis() string {
+	return "Encrypts the kite.key file"
+}
+
+func (c *Encryptkey) Help() string {
+	helpText := `
+Usage: kitectl encryptkey [options]
+
+  Encrypts ~/.kite/kite.key in place, so a copy of the disk does not give
+  away the identity of the kite. Kites decrypt the kite.key when they
+  start, with the passphrase given by KITE_KEY_PASSPHRASE or
+  KITE_KEY_PASSPHRASE_FILE, or prompted for on a terminal.
+
+  Instead of a passphrase, the kite.key may be encrypted with a random key
+  kept in an OS secret store, which only the same user on the same machine
+  can read. Set KITE_KEY_ENCRYPTION to the same value to have
+  "kitectl register" write encrypted kite.keys.
+
+Options:
+
+  -with=passphrase   Where the encryption key comes from: passphrase,
+                     keychain, secret-service or credential-manager.
+  -decrypt           Decrypt the kite.key instead.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Encryptkey) Run(args []string) int {
+	var with string
+	var decrypt bool
+
+	flags := flag.NewFlagSet("encryptkey", flag.ExitOnError)
+	flags.StringVar(&with, "with", kitekey.PassphraseKeySource, "")
+	flags.BoolVar(&decrypt, "decrypt", false, "")
+	flags.Parse(args)
+
+	if store := os.Getenv("KITE_KEY_STORE"); store != "" && store != kitekey.FileStoreName {
+		c.Ui.Error("The kite.key is kept in the " + store + " store, not in a file")
+		return 1
+	}
+
+	// Reading decrypts the kite.key if needed.
+	kiteKey, err := (&kitekey.FileStore{}).Read()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	store := &kitekey.FileStore{Encryption: with}
+	if decrypt {
+		os.Unsetenv("KITE_KEY_ENCRYPTION")
+		store.Encryption = ""
+	}
+
+	if err := store.Write(kiteKey); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if decrypt {
+		c.Ui.Output("kite.key is decrypted")
+	} else {
+		c.Ui.Output("kite.key is encrypted with " + with)
+	}
+
+	return 0
+}
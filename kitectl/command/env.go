@@ -0,0 +1,344 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+type Env struct {
+	Ui cli.Ui
+}
+
+func NewEnv() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Env{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Env) Synopsis() string {
+	return "Manages Kontrol profiles"
+}
+
+func (c *Env) Help() string {
+	helpText := `
+Usage: kitectl env <subcommand> [options]
+
+  Manages profiles, named sets of Kontrol URL, kite.key file, environment
+  and username. The active profile is used by every command, another one
+  can be picked for a single command with the global -profile=name flag,
+  given before the command name.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Env) Run(_ []string) int {
+	return cli.RunResultHelp
+}
+
+type EnvList struct {
+	Ui cli.Ui
+}
+
+func NewEnvList() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &EnvList{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *EnvList) Synopsis() string {
+	return "Lists profiles"
+}
+
+func (c *EnvList) Help() string {
+	helpText := `
+Usage: kitectl env list
+
+  Lists profiles, the active one is marked with "*".
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *EnvList) Run(_ []string) int {
+	settings, err := ReadSettings()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	names := make([]string, 0, len(settings.Profiles))
+	for name := range settings.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if OutputFormat == OutputJSON {
+		return outputJSON(c.Ui, settings)
+	}
+
+	for _, name := range names {
+		mark := " "
+		if name == settings.Profile {
+			mark = "*"
+		}
+
+		c.Ui.Output(fmt.Sprintf("%s %s\t%s", mark, name, settings.Profiles[name].KontrolURL))
+	}
+
+	return 0
+}
+
+type EnvShow struct {
+	Ui cli.Ui
+}
+
+func NewEnvShow() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &EnvShow{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *EnvShow) Synopsis() string {
+	return "Shows a profile"
+}
+
+func (c *EnvShow) Help() string {
+	helpText := `
+Usage: kitectl env show [name]
+
+  Shows the named profile, or the active one if no name is given.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *EnvShow) Run(args []string) int {
+	settings, err := ReadSettings()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	name := settings.Profile
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	if name == "" {
+		c.Ui.Error("No profile is active")
+		return 1
+	}
+
+	p, ok := settings.Profiles[name]
+	if !ok {
+		c.Ui.Error(fmt.Sprintf("Profile %q does not exist", name))
+		return 1
+	}
+
+	if OutputFormat == OutputJSON {
+		return outputJSON(c.Ui, p)
+	}
+
+	c.Ui.Output(fmt.Sprintf("%-15s%s", "name", name))
+	c.Ui.Output(fmt.Sprintf("%-15s%s", "kontrolURL", p.KontrolURL))
+	c.Ui.Output(fmt.Sprintf("%-15s%s", "keyFile", p.KeyFile))
+	c.Ui.Output(fmt.Sprintf("%-15s%s", "environment", p.Environment))
+	c.Ui.Output(fmt.Sprintf("%-15s%s", "username", p.Username))
+
+	return 0
+}
+
+type EnvAdd struct {
+	Ui cli.Ui
+}
+
+func NewEnvAdd() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &EnvAdd{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *EnvAdd) Synopsis() string {
+	return "Adds or updates a profile"
+}
+
+func (c *EnvAdd) Help() string {
+	helpText := `
+Usage: kitectl env add [options] name
+
+  Adds a profile, or updates it if one with the same name exists. Fields
+  left empty fall back to the kite.key and the environment variables.
+
+Options:
+
+  -kontrol-url=URL         URL of Kontrol.
+  -key-file=path           kite.key file to use instead of ~/.kite/kite.key.
+  -environment=staging     Environment of the kites.
+  -username=koding         Default username for queries.
+  -use                     Make it the active profile.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *EnvAdd) Run(args []string) int {
+	var p Profile
+	var use bool
+
+	flags := flag.NewFlagSet("env add", flag.ExitOnError)
+	flags.StringVar(&p.KontrolURL, "kontrol-url", "", "")
+	flags.StringVar(&p.KeyFile, "key-file", "", "")
+	flags.StringVar(&p.Environment, "environment", "", "")
+	flags.StringVar(&p.Username, "username", "", "")
+	flags.BoolVar(&use, "use", false, "")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	if p.KeyFile != "" {
+		keyFile, err := filepath.Abs(p.KeyFile)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		p.KeyFile = keyFile
+	}
+
+	settings, err := ReadSettings()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	name := flags.Arg(0)
+
+	if settings.Profiles == nil {
+		settings.Profiles = make(map[string]*Profile)
+	}
+	settings.Profiles[name] = &p
+
+	if use {
+		settings.Profile = name
+	}
+
+	if err := settings.Write(); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+type EnvUse struct {
+	Ui cli.Ui
+}
+
+func NewEnvUse() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &EnvUse{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *EnvUse) Synopsis() string {
+	return "Switches the active profile"
+}
+
+func (c *EnvUse) Help() string {
+	helpText := `
+Usage: kitectl env use name
+
+  Makes the named profile the active one. Use "-" as the name to
+  deactivate profiles.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *EnvUse) Run(args []string) int {
+	if len(args) != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	settings, err := ReadSettings()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	name := args[0]
+	if name == "-" {
+		name = ""
+	} else if _, ok := settings.Profiles[name]; !ok {
+		c.Ui.Error(fmt.Sprintf("Profile %q does not exist", name))
+		return 1
+	}
+
+	settings.Profile = name
+
+	if err := settings.Write(); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+type EnvRemove struct {
+	Ui cli.Ui
+}
+
+func NewEnvRemove() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &EnvRemove{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *EnvRemove) Synopsis() string {
+	return "Removes a profile"
+}
+
+func (c *EnvRemove) Help() string {
+	helpText := `
+Usage: kitectl env remove name
+
+  Removes the named profile. The kite.key file of the profile is kept.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *EnvRemove) Run(args []string) int {
+	if len(args) != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	settings, err := ReadSettings()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	name := args[0]
+	if _, ok := settings.Profiles[name]; !ok {
+		c.Ui.Error(fmt.Sprintf("Profile %q does not exist", name))
+		return 1
+	}
+
+	delete(settings.Profiles, name)
+
+	if settings.Profile == name {
+		settings.Profile = ""
+	}
+
+	if err := settings.Write(); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,305 @@
+package command
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/mitchellh/cli"
+)
+
+type Exec struct {
+	KiteClient *kite.Kite
+	Ui         cli.Ui
+}
+
+func NewExec() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Exec{
+			KiteClient: DefaultKiteClient,
+			Ui:         DefaultUi,
+		}, nil
+	}
+}
+
+func (c *Exec) Synopsis() string {
+	return "Runs a command on remote kites"
+}
+
+func (c *Exec) Help() string {
+	helpText := `
+Usage: kitectl exec [options] <url|query> -- <command> [args...]
+
+  Runs the command on the host of a kite and streams its output while it
+  runs. The kite is given by its URL or a query, as for "kitectl ping", and
+  must handle the kite.exec method (see kite.HandleExec). The exit code of
+  the command is the exit code of kitectl. Interrupting kitectl kills the
+  command.
+
+  With -all the command runs on every kite matching the query at the same
+  time. Every line of output is prefixed with the kite it came from and the
+  highest exit code is returned.
+
+  With the global -output=json flag, given before the command name, the
+  output is collected and printed together with the exit code of every
+  kite once the command is done.
+
+Options:
+
+  -all               Run on all kites matching the query.
+  -dir=path          Working directory of the command on the kite.
+  -env=KEY=VALUE     Set an environment variable for the command, may be
+                     repeated.
+  -timeout=4s        Timeout of dialing.
+  -transport=auto    Transport to connect with, WebSocket, XHRPolling or auto.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// execResult is the JSON representation of running a command on a kite.
+type execResult struct {
+	Kite     string `json:"kite,omitempty"`
+	URL      string `json:"url"`
+	ExitCode int    `json:"exitCode"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (c *Exec) Run(args []string) int {
+	var (
+		all            bool
+		dir, transport string
+		env            = make(envFlag)
+		timeout        time.Duration
+	)
+
+	flags := flag.NewFlagSet("exec", flag.ExitOnError)
+	flags.BoolVar(&all, "all", false, "")
+	flags.StringVar(&dir, "dir", "", "")
+	flags.Var(env, "env", "")
+	flags.DurationVar(&timeout, "timeout", 4*time.Second, "")
+	flags.StringVar(&transport, "transport", config.Transport(config.Auto).String(), "")
+	flags.Parse(args)
+
+	cmd := flags.Args()
+	if len(cmd) > 1 && cmd[1] == "--" {
+		cmd = append(cmd[:1:1], cmd[2:]...)
+	}
+
+	if len(cmd) < 2 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	t, ok := config.Transports[transport]
+	if !ok {
+		c.Ui.Error(fmt.Sprintf("Unknown transport %q", transport))
+		return 1
+	}
+
+	execArgs := kite.ExecArgs{
+		Cmd: cmd[1:],
+		Dir: dir,
+	}
+	for k, v := range env {
+		execArgs.Env = append(execArgs.Env, k+"="+v)
+	}
+	sort.Strings(execArgs.Env)
+
+	var (
+		clients []*kite.Client
+		err     error
+	)
+	if all {
+		clients, err = resolveKites(c.KiteClient, cmd[0])
+	} else {
+		var remote *kite.Client
+		if remote, err = resolveKite(c.KiteClient, cmd[0]); err == nil {
+			clients = []*kite.Client{remote}
+		}
+	}
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer kite.Close(clients)
+
+	// Closing the connections kills the commands.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	go func() {
+		if _, ok := <-sigs; ok {
+			kite.Close(clients)
+		}
+	}()
+
+	labels := execLabels(clients)
+	results := make([]*execResult, len(clients))
+
+	var (
+		mu sync.Mutex // serializes writes to stdout and stderr
+		wg sync.WaitGroup
+	)
+
+	for i, remote := range clients {
+		remote.Config = c.KiteClient.Config.Copy()
+		remote.Config.Transport = t
+
+		results[i] = &execResult{URL: remote.URL}
+		if remote.Kite.ID != "" {
+			results[i].Kite = remote.Kite.String()
+		}
+
+		var stdout, stderr io.Writer
+		var stdoutBuf, stderrBuf bytes.Buffer
+
+		switch {
+		case OutputFormat == OutputJSON:
+			stdout, stderr = &stdoutBuf, &stderrBuf
+		case all:
+			stdout = &prefixWriter{mu: &mu, w: os.Stdout, prefix: labels[i] + " "}
+			stderr = &prefixWriter{mu: &mu, w: os.Stderr, prefix: labels[i] + " "}
+		default:
+			stdout, stderr = os.Stdout, os.Stderr
+		}
+
+		wg.Add(1)
+		go func(remote *kite.Client, res *execResult) {
+			defer wg.Done()
+
+			code, err := execOn(remote, timeout, execArgs, stdout, stderr)
+			res.ExitCode = code
+			if err != nil {
+				res.Error = err.Error()
+			}
+
+			for _, w := range []io.Writer{stdout, stderr} {
+				if pw, ok := w.(*prefixWriter); ok {
+					pw.Flush()
+				}
+			}
+
+			res.Stdout, res.Stderr = stdoutBuf.String(), stderrBuf.String()
+		}(remote, results[i])
+	}
+
+	wg.Wait()
+
+	code := 0
+	for i, res := range results {
+		if res.Error != "" {
+			if OutputFormat != OutputJSON {
+				msg := res.Error
+				if all {
+					msg = labels[i] + " " + msg
+				}
+				c.Ui.Error(msg)
+			}
+			if code == 0 {
+				code = 1
+			}
+		}
+
+		if res.ExitCode > code {
+			code = res.ExitCode
+		}
+	}
+
+	if OutputFormat == OutputJSON {
+		var v interface{} = results
+		if !all {
+			v = results[0]
+		}
+
+		if outputJSON(c.Ui, v) != 0 {
+			return 1
+		}
+	}
+
+	return code
+}
+
+// execOn dials the kite and runs the command on it.
+func execOn(remote *kite.Client, timeout time.Duration, args kite.ExecArgs, stdout, stderr io.Writer) (int, error) {
+	if err := remote.DialTimeout(timeout); err != nil {
+		return 0, err
+	}
+
+	return remote.Exec(args, stdout, stderr)
+}
+
+// execLabels returns the prefixes of the output of the kites, their hostnames
+// unless several kites run on the same host or the kite was given by URL.
+func execLabels(clients []*kite.Client) []string {
+	hosts := make(map[string]int)
+	for _, remote := range clients {
+		hosts[remote.Kite.Hostname]++
+	}
+
+	labels := make([]string, len(clients))
+	for i, remote := range clients {
+		label := remote.Kite.Hostname
+		switch {
+		case label == "":
+			label = remote.URL
+		case hosts[label] > 1:
+			label += "/" + remote.Kite.ID
+		}
+		labels[i] = "[" + label + "]"
+	}
+
+	return labels
+}
+
+// prefixWriter writes every line written to it to w prefixed with a string.
+// Lines are buffered until complete so lines of concurrent writers sharing
+// the mutex are not mixed.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		pw.writeLine(pw.buf[:i+1])
+		pw.buf = pw.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush writes a trailing incomplete line.
+func (pw *prefixWriter) Flush() {
+	if len(pw.buf) != 0 {
+		pw.writeLine(append(pw.buf, '\n'))
+		pw.buf = nil
+	}
+}
+
+func (pw *prefixWriter) writeLine(line []byte) {
+	pw.mu.Lock()
+	io.WriteString(pw.w, pw.prefix)
+	pw.w.Write(line)
+	pw.mu.Unlock()
+}
@@ -0,0 +1,159 @@
+package command
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/koding/kite/config"
+)
+
+// ParseGlobalFlags removes the flags that apply to every command from args
+// and returns the remaining arguments. Global flags are given before the
+// command name, as in "kitectl -output=json list"; the arguments following
+// it are left to the command, even if they look like global flags.
+//
+// The -profile flag selects the profile to run the command with, otherwise
+// the active profile is used. Variables already set in the environment take
+// precedence over the active profile, but not over one chosen by -profile.
+// The defaults of "kitectl config" come last.
+func ParseGlobalFlags(args []string) ([]string, error) {
+	// The command line being completed is left for the command to look at.
+	if len(args) != 0 && args[0] == CompleteCommandName {
+		return args, nil
+	}
+
+	var rest []string
+	var profile string
+	var outputSet bool
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		name, value, ok := globalFlag(arg, "output", "profile")
+		if !ok {
+			rest = append(rest, arg)
+			continue
+		}
+
+		if value == "" {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "output":
+			if err := setOutputFormat(value); err != nil {
+				return nil, err
+			}
+			outputSet = true
+		case "profile":
+			profile = value
+		}
+	}
+
+	settings, err := ReadSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyProfile(settings, profile); err != nil {
+		return nil, err
+	}
+
+	applyDefaults(settings, outputSet)
+
+	return rest, nil
+}
+
+// globalFlag reports whether arg is one of the global flags with the given
+// names, in any of the "-name", "--name", "-name=value" or "--name=value"
+// forms.
+func globalFlag(arg string, names ...string) (name, value string, ok bool) {
+	if !strings.HasPrefix(arg, "-") {
+		return "", "", false
+	}
+
+	s := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	if i := strings.IndexRune(s, '='); i != -1 {
+		s, value = s[:i], s[i+1:]
+		if value == "" {
+			return "", "", false
+		}
+	}
+
+	for _, name := range names {
+		if s == name {
+			return name, value, true
+		}
+	}
+
+	return "", "", false
+}
+
+// applyProfile exports the named profile, or the active one if name is
+// empty, to the environment.
+func applyProfile(settings *Settings, name string) error {
+	override := name != ""
+	if name == "" {
+		name = settings.Profile
+	}
+
+	if name == "" {
+		return nil
+	}
+
+	p, ok := settings.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %q does not exist", name)
+	}
+
+	p.Apply(override)
+	return nil
+}
+
+// applyDefaults applies the defaults of the settings which weren't set by
+// the command line, the environment or the profile.
+func applyDefaults(settings *Settings, outputSet bool) {
+	defaults := &Profile{
+		KontrolURL:  settings.KontrolURL,
+		Environment: settings.Environment,
+	}
+	defaults.Apply(false)
+
+	// An invalid output format is ignored rather than failing every command,
+	// including the one fixing it; "kitectl config set" validates it.
+	if settings.Output != "" && !outputSet {
+		setOutputFormat(settings.Output)
+	}
+
+	if settings.Proxy != "" {
+		setProxy(settings.Proxy)
+	}
+}
+
+// setProxy makes HTTP requests and websocket connections go through the
+// given proxy, unless one is set in the environment already.
+func setProxy(proxy string) {
+	for _, k := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+		if os.Getenv(k) != "" {
+			return
+		}
+	}
+
+	os.Setenv("HTTP_PROXY", proxy)
+	os.Setenv("HTTPS_PROXY", proxy)
+
+	// Websocket dialers don't look at the environment by default.
+	config.DefaultConfig.Websocket.Proxy = http.ProxyFromEnvironment
+	DefaultKiteClient.Config.Websocket.Proxy = http.ProxyFromEnvironment
+}
@@ -5,19 +5,48 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/koding/kite/kitekey"
 	"github.com/mitchellh/cli"
 )
 
+// sourceFileName is the name of the file inside of an installed kite
+// bundle that records where the kite was installed from.
+const sourceFileName = "source.json"
+
+// Source describes the origin of an installed kite.
+type Source struct {
+	URL         string    `json:"url"`
+	Ref         string    `json:"ref,omitempty"`
+	Commit      string    `json:"commit,omitempty"`
+	InstalledAt time.Time `json:"installedAt"`
+}
+
+func (s *Source) String() string {
+	switch {
+	case s.Commit != "" && s.Ref != "":
+		return s.URL + "@" + s.Ref + " (" + s.Commit + ")"
+	case s.Commit != "":
+		return s.URL + " (" + s.Commit + ")"
+	case s.Ref != "":
+		return s.URL + "@" + s.Ref
+	default:
+		return s.URL
+	}
+}
+
 type Install struct {
 	Ui cli.Ui
 }
@@ -34,21 +63,46 @@ func (c *Install) Synopsis() string {
 
 func (c *Install) Help() string {
 	helpText := `
-Usage: kitectl install URL
+Usage: kitectl install [options] URL
 
   Installs a kite from the given URL. Example: github.com/cenkalti/math.kite
+
+  If the URL is a git repository URL (https://, ssh://, git@, file:// or
+  ending with .git), the repository is cloned and the kite is built from
+  source with the go tool. Example:
+
+    kitectl install -ref=v1.0.2 https://github.com/cenkalti/math.kite.git
+
+Options:
+
+  -ref=master  Branch, tag or commit to build (git URLs only).
 `
 
 	return strings.TrimSpace(helpText)
 }
 
 func (c *Install) Run(args []string) int {
-	if len(args) != 1 {
+	var ref string
+
+	flags := flag.NewFlagSet("install", flag.ExitOnError)
+	flags.StringVar(&ref, "ref", "", "branch, tag or commit to build")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
 		c.Ui.Error("You should give a URL. Example: github.com/cenkalti/math.kite")
 		return 1
 	}
 
-	repoName := args[0]
+	if isGitURL(flags.Arg(0)) {
+		return c.installGit(flags.Arg(0), ref)
+	}
+
+	if ref != "" {
+		c.Ui.Error("The -ref option is supported only for git URLs.")
+		return 1
+	}
+
+	repoName := flags.Arg(0)
 
 	// Download manifest
 	c.Ui.Output("Downloading manifest file...")
@@ -109,6 +163,16 @@ func (c *Install) Run(args []string) int {
 		return 1
 	}
 
+	err = writeSource(bundlePath, &Source{
+		URL:         binaryURL,
+		Ref:         version,
+		InstalledAt: time.Now().UTC(),
+	})
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
 	err = installKite(bundlePath, repoName, version)
 	if err != nil {
 		c.Ui.Error(err.Error())
@@ -119,6 +183,248 @@ func (c *Install) Run(args []string) int {
 	return 0
 }
 
+// installGit clones the repository at the given ref, builds the kite
+// and installs it together with its source information.
+func (c *Install) installGit(gitURL, ref string) int {
+	repoName, err := repoNameFromGitURL(gitURL)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	tempPath, err := ioutil.TempDir("", "kite-install-")
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer os.RemoveAll(tempPath)
+
+	// The repository is cloned into a temporary GOPATH, so the kite
+	// can import its own packages by their canonical path.
+	gopath := filepath.Join(tempPath, "gopath")
+	srcPath := filepath.Join(gopath, "src", repoName)
+
+	c.Ui.Output(fmt.Sprintf("Cloning %s...", gitURL))
+	if err := runIn("", nil, "git", "clone", "--quiet", gitURL, srcPath); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if ref != "" {
+		if err := runIn(srcPath, nil, "git", "checkout", "--quiet", ref); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	commit, err := outputIn(srcPath, "git", "rev-parse", "HEAD")
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	version, err := getSourceVersion(srcPath, ref)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	c.Ui.Output(fmt.Sprintf("Found version: %s\n", version))
+
+	installed, err := isInstalled(filepath.Join(repoName, version))
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if installed {
+		c.Ui.Error(fmt.Sprintf("Already installed: %s", filepath.Join(repoName, version)))
+		return 1
+	}
+
+	bundlePath := filepath.Join(tempPath, "bundle")
+	binPath := filepath.Join(bundlePath, "bin", kiteNameFromRepo(repoName))
+
+	if err := os.MkdirAll(filepath.Dir(binPath), 0700); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	env := append(os.Environ(), "GOPATH="+gopathList(gopath))
+
+	c.Ui.Output("Building kite...")
+	if err := runIn(srcPath, env, "go", "get", "-d", "./..."); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if err := runIn(srcPath, env, "go", "build", "-o", binPath, "."); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	err = writeSource(bundlePath, &Source{
+		URL:         gitURL,
+		Ref:         ref,
+		Commit:      commit,
+		InstalledAt: time.Now().UTC(),
+	})
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if err := installKite(bundlePath, repoName, version); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	fmt.Println("Installed successfully:", filepath.Join(repoName, version))
+	return 0
+}
+
+// isGitURL returns true if the given string looks like a git repository URL
+// rather than a kite repository name.
+func isGitURL(s string) bool {
+	for _, prefix := range []string{"https://", "http://", "ssh://", "git://", "file://", "git@"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+
+	return strings.HasSuffix(s, ".git")
+}
+
+// repoNameFromGitURL converts a git URL to the repository name used as
+// the install path, e.g. "git@github.com:koding/fs.kite.git" becomes
+// "github.com/koding/fs.kite".
+func repoNameFromGitURL(gitURL string) (string, error) {
+	s := gitURL
+
+	// scp-like syntax: user@host:path
+	if !strings.Contains(s, "://") {
+		if i := strings.Index(s, "@"); i != -1 {
+			s = s[i+1:]
+		}
+		s = "ssh://" + strings.Replace(s, ":", "/", 1)
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid git URL: %s", err)
+	}
+
+	path := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if u.Host != "" {
+		path = u.Hostname() + "/" + path
+	}
+
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 {
+		return "", fmt.Errorf("invalid git URL: cannot use %q as domain/user/repo", path)
+	}
+
+	// getInstalledKites expects domain/user/repo layout.
+	return strings.Join(parts[len(parts)-3:], "/"), nil
+}
+
+// kiteNameFromRepo returns the binary name of the kite for the given repo.
+func kiteNameFromRepo(repoName string) string {
+	return strings.TrimSuffix(filepath.Base(repoName), ".kite")
+}
+
+// getSourceVersion reads the version from the .kite.json manifest in the
+// repository. If there is no manifest, the ref is used as the version.
+func getSourceVersion(srcPath, ref string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(srcPath, ".kite.json"))
+	if err == nil {
+		manifest := make(map[string]interface{})
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return "", fmt.Errorf("invalid manifest file: %s", err.Error())
+		}
+
+		return getVersion(manifest)
+	}
+
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if ref == "" {
+		return "", errors.New("no .kite.json manifest found, please give a version with the -ref option")
+	}
+
+	return strings.TrimPrefix(ref, "v"), nil
+}
+
+// gopathList prepends the dir to the user's GOPATH.
+func gopathList(dir string) string {
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		return dir + string(os.PathListSeparator) + gopath
+	}
+	return dir
+}
+
+// runIn runs the command in the given directory. The output of the
+// command is passed through to the user.
+func runIn(dir string, env []string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), err)
+	}
+
+	return nil
+}
+
+// outputIn runs the command in the given directory and returns its
+// trimmed standard output.
+func outputIn(dir string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// writeSource records the source of the kite in its bundle directory.
+func writeSource(bundlePath string, source *Source) error {
+	data, err := json.MarshalIndent(source, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(bundlePath, sourceFileName), data, 0600)
+}
+
+// readSource reads the source of the installed kite. It returns nil
+// if the kite was installed without recording its source.
+func readSource(versionPath string) (*Source, error) {
+	data, err := ioutil.ReadFile(filepath.Join(versionPath, sourceFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var source Source
+	if err := json.Unmarshal(data, &source); err != nil {
+		return nil, fmt.Errorf("invalid %s file: %s", sourceFileName, err)
+	}
+
+	return &source, nil
+}
+
 func getManifest(repoName string) (map[string]interface{}, error) {
 	if !strings.HasPrefix(repoName, "github.com/") {
 		return nil, errors.New("Repo other than github.com is not supported for now")
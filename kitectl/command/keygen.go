@@ -0,0 +1,198 @@
+package command
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/koding/kite/kitekey"
+	"github.com/mitchellh/cli"
+)
+
+type Keygen struct {
+	Ui cli.Ui
+}
+
+func NewKeygen() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Keygen{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Keygen) Synopsis() string {
+	return "Generates a key pair for a private kontrol"
+}
+
+func (c *Keygen) Help() string {
+	helpText := `
+Usage: kitectl keygen [options]
+
+  Generates a key pair for signing the tokens of a private kontrol. The
+  private key is written to <dir>/<name>.pem and the public key to
+  <dir>/<name>.pub, both PEM encoded in the format kontrol reads with its
+  -privatekeyfile and -publickeyfile flags.
+
+Options:
+
+  -type=rsa          Key type, rsa, ecdsa or ed25519. Kontrol signs tokens
+                     with RS256, ES256 or EdDSA respectively.
+  -bits=2048         Size of RSA keys.
+  -dir=~/.kite/kontrol
+                     Directory to write the keys to.
+  -name=kontrol      Base name of the key files.
+  -force             Overwrite existing keys.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Keygen) Run(args []string) int {
+	var keyType, dir, name string
+	var bits int
+	var force bool
+
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	flags.StringVar(&keyType, "type", "rsa", "")
+	flags.IntVar(&bits, "bits", 2048, "")
+	flags.StringVar(&dir, "dir", "", "")
+	flags.StringVar(&name, "name", "kontrol", "")
+	flags.BoolVar(&force, "force", false, "")
+	flags.Parse(args)
+
+	if dir == "" {
+		kiteHome, err := kitekey.KiteHome()
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		dir = filepath.Join(kiteHome, "kontrol")
+	}
+
+	privatePath := filepath.Join(dir, name+".pem")
+	publicPath := filepath.Join(dir, name+".pub")
+
+	if !force {
+		for _, path := range []string{privatePath, publicPath} {
+			if _, err := os.Stat(path); err == nil {
+				c.Ui.Error(fmt.Sprintf("%s already exists, use -force to overwrite it", path))
+				return 1
+			}
+		}
+	}
+
+	private, public, err := generateKeyPair(keyType, bits)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	// The previous private key may be read-only.
+	os.Remove(privatePath)
+
+	if err := ioutil.WriteFile(privatePath, private, 0600); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if err := ioutil.WriteFile(publicPath, public, 0644); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	c.Ui.Output("Private key: " + privatePath)
+	c.Ui.Output("Public key:  " + publicPath)
+
+	c.Ui.Output("")
+	c.Ui.Output("Create the first kite.key with:")
+	c.Ui.Output(fmt.Sprintf("    kontrol -initial -username=<username> -kontrolurl=http://<host>:<port>/kite -publickeyfile=%s -privatekeyfile=%s", publicPath, privatePath))
+	c.Ui.Output("Then run kontrol with:")
+	c.Ui.Output(fmt.Sprintf("    kontrol -publickeyfile=%s -privatekeyfile=%s", publicPath, privatePath))
+
+	return 0
+}
+
+// generateKeyPair returns a new PEM encoded private and public key. RSA
+// private keys are in PKCS #1 form, ECDSA ones in SEC 1 and Ed25519 ones in
+// PKCS #8. Public keys are in PKIX form.
+func generateKeyPair(keyType string, bits int) (private, public []byte, err error) {
+	var privateBlock *pem.Block
+	var publicKey interface{}
+
+	switch keyType {
+	case "rsa":
+		if bits < 2048 {
+			return nil, nil, fmt.Errorf("RSA keys must be at least 2048 bits, got %d", bits)
+		}
+
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		privateBlock = &pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		}
+		publicKey = &key.PublicKey
+	case "ecdsa":
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		privateBlock = &pem.Block{
+			Type:  "EC PRIVATE KEY",
+			Bytes: der,
+		}
+		publicKey = &key.PublicKey
+	case "ed25519":
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		privateBlock = &pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: der,
+		}
+		publicKey = pub
+	default:
+		return nil, nil, fmt.Errorf("unknown key type %q, must be rsa, ecdsa or ed25519", keyType)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicBlock := &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: der,
+	}
+
+	return pem.EncodeToMemory(privateBlock), pem.EncodeToMemory(publicBlock), nil
+}
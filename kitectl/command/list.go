@@ -29,7 +29,8 @@ func (c *List) Help() string {
 	helpText := `
 Usage: kitectl list
 
-  Lists installed kites.
+  Lists installed kites. Use "kitectl -output=json list" to print them
+  as JSON.
 `
 	return strings.TrimSpace(helpText)
 }
@@ -41,8 +42,19 @@ func (c *List) Run(_ []string) int {
 		return 1
 	}
 
+	if OutputFormat == OutputJSON {
+		if kites == nil {
+			kites = []*InstalledKite{}
+		}
+		return outputJSON(c.Ui, kites)
+	}
+
 	for _, k := range kites {
-		c.Ui.Output(k.String())
+		if k.Source != nil {
+			c.Ui.Output(k.String() + "\t" + k.Source.String())
+		} else {
+			c.Ui.Output(k.String())
+		}
 	}
 
 	return 0
@@ -101,7 +113,13 @@ func getInstalledKites(kiteName string) ([]*InstalledKite, error) {
 						continue
 					}
 
-					installedKites = append(installedKites, NewInstalledKite(domain.Name(), user.Name(), repo.Name(), version.Name()))
+					ik := NewInstalledKite(domain.Name(), user.Name(), repo.Name(), version.Name())
+
+					if ik.Source, err = readSource(versionPath); err != nil {
+						fmt.Println(err)
+					}
+
+					installedKites = append(installedKites, ik)
 				}
 			}
 		}
@@ -111,10 +129,14 @@ func getInstalledKites(kiteName string) ([]*InstalledKite, error) {
 }
 
 type InstalledKite struct {
-	Domain  string
-	User    string
-	Repo    string
-	Version string
+	Domain  string `json:"domain"`
+	User    string `json:"user"`
+	Repo    string `json:"repo"`
+	Version string `json:"version"`
+
+	// Source is the origin the kite was installed from. It is nil
+	// for kites installed before sources were recorded.
+	Source *Source `json:"source,omitempty"`
 }
 
 func NewInstalledKite(domain, user, repo, version string) *InstalledKite {
@@ -130,7 +152,13 @@ func (k *InstalledKite) String() string {
 	return k.Domain + "/" + k.User + "/" + k.Repo + "/" + k.Version
 }
 
+// Name returns the short name of the kite, the repository name without
+// the ".kite" suffix.
+func (k *InstalledKite) Name() string {
+	return strings.TrimSuffix(k.Repo, ".kite")
+}
+
 // BinPath returns the path of the executable binary file.
 func (k *InstalledKite) BinPath() string {
-	return filepath.Join(k.Domain, k.User, k.Repo, k.Version, "bin", strings.TrimSuffix(k.Repo, ".kite"))
+	return filepath.Join(k.Domain, k.User, k.Repo, k.Version, "bin", k.Name())
 }
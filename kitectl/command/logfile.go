@@ -0,0 +1,121 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// logFile is an io.Writer appending to a file which is rotated once it
+// grows beyond maxSize bytes. Rotated files are renamed to name.1,
+// name.2, ... and at most maxBackups of them are kept.
+type logFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func openLogFile(path string, maxSize int64, maxBackups int) (*logFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	l := &logFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *logFile) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	l.size = fi.Size()
+	return nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		// A file which can not be rotated is appended to until it can,
+		// rather than failing the write and losing the output.
+		if err := l.rotate(); err != nil && l.file == nil {
+			return 0, err
+		}
+	}
+
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file aside and opens a new one. If the file can not be
+// renamed it is opened again, so l.file is nil only if opening failed.
+func (l *logFile) rotate() error {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+
+	if err := l.renameBackups(); err != nil {
+		if e := l.open(); e != nil {
+			return e
+		}
+		return err
+	}
+
+	return l.open()
+}
+
+// renameBackups shifts the rotated files and renames the file to the first
+// of them, or removes it if no backups are kept.
+func (l *logFile) renameBackups() error {
+	for i := l.maxBackups - 1; i > 0; i-- {
+		os.Rename(backupLogPath(l.path, i), backupLogPath(l.path, i+1))
+	}
+
+	if l.maxBackups > 0 {
+		return os.Rename(l.path, backupLogPath(l.path, 1))
+	}
+
+	return os.Remove(l.path)
+}
+
+func (l *logFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Close()
+}
+
+// backupLogPath returns the path of the n'th rotated copy of the log file.
+func backupLogPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
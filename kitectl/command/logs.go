@@ -0,0 +1,323 @@
+package command
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// logTimeLayout is the layout of the timestamp kite loggers put at the
+// beginning of every line.
+const logTimeLayout = "2006-01-02 15:04:05"
+
+// logLevels are the kite log levels from the most verbose to the least.
+var logLevels = []string{"DEBUG", "INFO", "NOTICE", "WARNING", "ERROR", "CRITICAL"}
+
+var (
+	// logLineRegexp matches a line written by a kite logger, e.g.
+	// "2014-05-05 12:00:00 [mykite] INFO     kite started".
+	logLineRegexp = regexp.MustCompile(`^(\d{4}-\d\d-\d\d \d\d:\d\d:\d\d) \[[^\]]*\] ([A-Z]+)`)
+
+	// ansiRegexp matches terminal color sequences of colorized loggers.
+	ansiRegexp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+)
+
+type Logs struct {
+	Ui cli.Ui
+}
+
+func NewLogs() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Logs{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Logs) Synopsis() string {
+	return "Shows the logs of a kite"
+}
+
+func (c *Logs) Help() string {
+	helpText := `
+Usage: kitectl logs [options] kitename
+
+  Shows the logs of a kite started with "kitectl run -supervise". If the
+  kite has no captured logs, they are read from the kite-<kitename> unit
+  of journald where available.
+
+Options:
+
+  -follow          Keep printing new lines as they are written.
+  -since=1h        Only show lines logged in the given duration or after
+                   the given time ("2006-01-02 15:04:05").
+  -level=WARNING   Only show lines of the given level or above.
+  -stdout          Show captured stdout instead of the kite logger output.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Logs) Run(args []string) int {
+	var (
+		follow bool
+		since  string
+		level  string
+		stdout bool
+	)
+
+	flags := flag.NewFlagSet("logs", flag.ExitOnError)
+	flags.BoolVar(&follow, "follow", false, "")
+	flags.BoolVar(&follow, "f", false, "")
+	flags.StringVar(&since, "since", "", "")
+	flags.StringVar(&level, "level", "", "")
+	flags.BoolVar(&stdout, "stdout", false, "")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	name := strings.TrimSuffix(flags.Arg(0), ".kite")
+
+	filter, err := newLogFilter(since, level)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	logDir, err := kiteLogDir(name)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	path := filepath.Join(logDir, stderrLogName)
+	if stdout {
+		path = filepath.Join(logDir, stdoutLogName)
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if runtime.GOOS == "linux" && !stdout {
+			if _, err := exec.LookPath("journalctl"); err == nil {
+				err = c.journald(name, filter, follow)
+				if err != nil {
+					c.Ui.Error(err.Error())
+					return 1
+				}
+				return 0
+			}
+		}
+
+		c.Ui.Error(fmt.Sprintf("No logs found for %s in %s", name, logDir))
+		return 1
+	}
+
+	if err := c.files(path, filter, follow); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// files prints the log file at path, preceded by its rotated copies.
+func (c *Logs) files(path string, filter *logFilter, follow bool) error {
+	var backups []string
+	for i := 1; ; i++ {
+		p := backupLogPath(path, i)
+		if _, err := os.Stat(p); err != nil {
+			break
+		}
+		backups = append([]string{p}, backups...)
+	}
+
+	for _, p := range backups {
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+
+		err = filter.copy(c.Ui, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	if err := filter.copy(c.Ui, f); err != nil {
+		return err
+	}
+
+	if !follow {
+		return nil
+	}
+
+	r := bufio.NewReader(f)
+	var partial string
+
+	for {
+		line, err := r.ReadString('\n')
+		partial += line
+
+		if err == nil {
+			filter.write(c.Ui, strings.TrimSuffix(partial, "\n"))
+			partial = ""
+			continue
+		}
+
+		if err != io.EOF {
+			return err
+		}
+
+		time.Sleep(250 * time.Millisecond)
+
+		// Start over with the new file after it has been rotated.
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		if cur, err := f.Stat(); err == nil && !os.SameFile(fi, cur) {
+			nf, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+
+			// Drain what was written before the rotation.
+			if err := filter.copy(c.Ui, io.MultiReader(strings.NewReader(partial), r)); err != nil {
+				nf.Close()
+				return err
+			}
+
+			f.Close()
+			f, r, partial = nf, bufio.NewReader(nf), ""
+		}
+	}
+}
+
+// journald prints the logs of the kite's systemd unit.
+func (c *Logs) journald(name string, filter *logFilter, follow bool) error {
+	args := []string{"-o", "cat", "-u", serviceName(name)}
+	if isSystemdUserUnit(name) {
+		args = append([]string{"--user"}, args...)
+	}
+	if !filter.since.IsZero() {
+		args = append(args, "--since", filter.since.Format(logTimeLayout))
+	}
+	if follow {
+		args = append(args, "-f")
+	}
+
+	cmd := exec.Command("journalctl", args...)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	if err := filter.copy(c.Ui, out); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	return cmd.Wait()
+}
+
+// logFilter selects the lines of kite logs to be shown. Lines which do
+// not start with a timestamp, e.g. stack traces, belong to the line
+// before them and are shown only if that line is.
+type logFilter struct {
+	since time.Time
+	level int
+
+	show bool
+}
+
+func newLogFilter(since, level string) (*logFilter, error) {
+	f := &logFilter{show: true}
+
+	if since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			f.since = time.Now().Add(-d)
+		} else if t, err := time.ParseInLocation(logTimeLayout, since, time.Local); err == nil {
+			f.since = t
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			f.since = t
+		} else {
+			return nil, fmt.Errorf("invalid -since value %q, must be a duration or a time as %q", since, logTimeLayout)
+		}
+
+		// Untimestamped lines before the first entry are too old as well.
+		f.show = false
+	}
+
+	if level != "" {
+		f.level = logLevelIndex(strings.ToUpper(level))
+		if f.level == -1 {
+			return nil, fmt.Errorf("invalid -level value %q, must be one of %s", level, strings.Join(logLevels, ", "))
+		}
+	}
+
+	return f, nil
+}
+
+func logLevelIndex(level string) int {
+	for i, l := range logLevels {
+		if l == level {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (f *logFilter) copy(ui cli.Ui, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		f.write(ui, scanner.Text())
+	}
+
+	return scanner.Err()
+}
+
+func (f *logFilter) write(ui cli.Ui, line string) {
+	if m := logLineRegexp.FindStringSubmatch(ansiRegexp.ReplaceAllString(line, "")); m != nil {
+		f.show = true
+
+		if !f.since.IsZero() {
+			t, err := time.ParseInLocation(logTimeLayout, m[1], time.Local)
+			if err == nil && t.Before(f.since) {
+				f.show = false
+			}
+		}
+
+		if f.show && f.level > 0 && logLevelIndex(m[2]) < f.level {
+			f.show = false
+		}
+	}
+
+	if f.show {
+		ui.Output(line)
+	}
+}
@@ -0,0 +1,49 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/mitchellh/cli"
+)
+
+// Output formats accepted by the global -output flag.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// OutputFormat is the format commands print their results in. It is set
+// by ParseGlobalFlags and defaults to human readable text.
+var OutputFormat = OutputText
+
+func setOutputFormat(format string) error {
+	switch format {
+	case OutputText:
+	case OutputJSON:
+		// Keep stdout clean for parsers, errors go to stderr uncolored.
+		DefaultUi = &cli.BasicUi{
+			Reader:      os.Stdin,
+			Writer:      os.Stdout,
+			ErrorWriter: os.Stderr,
+		}
+	default:
+		return fmt.Errorf("invalid output format %q, must be %q or %q", format, OutputText, OutputJSON)
+	}
+
+	OutputFormat = format
+	return nil
+}
+
+// outputJSON writes v to the ui as indented JSON.
+func outputJSON(ui cli.Ui, v interface{}) int {
+	p, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	ui.Output(string(p))
+	return 0
+}
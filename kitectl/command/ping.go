@@ -0,0 +1,252 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+	"github.com/mitchellh/cli"
+)
+
+type Ping struct {
+	KiteClient *kite.Kite
+	Ui         cli.Ui
+}
+
+func NewPing() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Ping{
+			KiteClient: DefaultKiteClient,
+			Ui:         DefaultUi,
+		}, nil
+	}
+}
+
+func (c *Ping) Synopsis() string {
+	return "Pings a kite"
+}
+
+func (c *Ping) Help() string {
+	helpText := `
+Usage: kitectl ping [options] <url|query>
+
+  Connects to a kite and calls kite.ping on it, reporting round trip times.
+  The kite is given either by its URL or as a query in the
+  username/environment/name/version/region/hostname/id form, in which case
+  the first kite Kontrol returns is pinged.
+
+Options:
+
+  -count=4             Number of pings.
+  -interval=1s         Time to wait between pings.
+  -timeout=4s          Timeout of dialing and of each ping.
+  -transport=auto      Transport to connect with, WebSocket, XHRPolling or auto.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// pingStats is the JSON representation of the result of kitectl ping.
+type pingStats struct {
+	URL       string          `json:"url"`
+	Kite      *protocol.Kite  `json:"kite,omitempty"`
+	Transport string          `json:"transport"`
+	Remote    string          `json:"remoteAddr,omitempty"`
+	Dial      time.Duration   `json:"dialNs"`
+	Sent      int             `json:"sent"`
+	Received  int             `json:"received"`
+	RTTs      []time.Duration `json:"rttsNs"`
+	Min       time.Duration   `json:"minNs"`
+	Avg       time.Duration   `json:"avgNs"`
+	Max       time.Duration   `json:"maxNs"`
+	StdDev    time.Duration   `json:"stddevNs"`
+}
+
+func (c *Ping) Run(args []string) int {
+	var count int
+	var interval, timeout time.Duration
+	var transport string
+
+	flags := flag.NewFlagSet("ping", flag.ExitOnError)
+	flags.IntVar(&count, "count", 4, "")
+	flags.DurationVar(&interval, "interval", time.Second, "")
+	flags.DurationVar(&timeout, "timeout", 4*time.Second, "")
+	flags.StringVar(&transport, "transport", config.Transport(config.Auto).String(), "")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	t, ok := config.Transports[transport]
+	if !ok {
+		c.Ui.Error(fmt.Sprintf("Unknown transport %q", transport))
+		return 1
+	}
+
+	remote, err := resolveKite(c.KiteClient, flags.Arg(0))
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer remote.Close()
+
+	remote.Config = c.KiteClient.Config.Copy()
+	remote.Config.Transport = t
+
+	stats := &pingStats{URL: remote.URL}
+	if remote.Kite.ID != "" {
+		stats.Kite = &remote.Kite
+	}
+
+	start := time.Now()
+	if err := remote.DialTimeout(timeout); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	stats.Dial = time.Since(start)
+
+	// Only websocket sessions know their remote address.
+	if stats.Remote = remote.RemoteAddr(); stats.Remote != "" {
+		stats.Transport = config.Transport(config.WebSocket).String()
+	} else {
+		stats.Transport = config.Transport(config.XHRPolling).String()
+	}
+
+	if OutputFormat != OutputJSON {
+		c.Ui.Output(fmt.Sprintf("PING %s via %s, connected in %s", remote.URL, stats.Transport, round(stats.Dial)))
+	}
+
+	for i := 0; i < count; i++ {
+		if i != 0 {
+			time.Sleep(interval)
+		}
+
+		stats.Sent++
+		start := time.Now()
+
+		if _, err := remote.TellWithTimeout("kite.ping", timeout); err != nil {
+			if OutputFormat != OutputJSON {
+				c.Ui.Warn(fmt.Sprintf("seq=%d error: %s", i+1, err))
+			}
+			continue
+		}
+
+		rtt := time.Since(start)
+		stats.Received++
+		stats.RTTs = append(stats.RTTs, rtt)
+
+		if OutputFormat != OutputJSON {
+			c.Ui.Output(fmt.Sprintf("seq=%d time=%s", i+1, round(rtt)))
+		}
+	}
+
+	stats.compute()
+
+	if OutputFormat == OutputJSON {
+		if code := outputJSON(c.Ui, stats); code != 0 {
+			return code
+		}
+	} else {
+		loss := 100 * float64(stats.Sent-stats.Received) / float64(stats.Sent)
+		c.Ui.Output(fmt.Sprintf("%d pings sent, %d received, %.0f%% loss", stats.Sent, stats.Received, loss))
+		if stats.Received != 0 {
+			c.Ui.Output(fmt.Sprintf("rtt min/avg/max/stddev = %s/%s/%s/%s",
+				round(stats.Min), round(stats.Avg), round(stats.Max), round(stats.StdDev)))
+		}
+	}
+
+	if stats.Received == 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// resolveKite returns a client for the kite given by a URL or a query. For
+// queries the first kite Kontrol returns is used.
+func resolveKite(k *kite.Kite, arg string) (*kite.Client, error) {
+	clients, err := resolveKites(k, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	kite.Close(clients[1:])
+	return clients[0], nil
+}
+
+// resolveKites returns clients for all kites given by a URL or a query.
+func resolveKites(k *kite.Kite, arg string) ([]*kite.Client, error) {
+	k.Config = config.MustGet()
+
+	if strings.Contains(arg, "://") {
+		key, err := kitekey.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		remote := k.NewClient(arg)
+		remote.Auth = &kite.Auth{
+			Type: "kiteKey",
+			Key:  key,
+		}
+
+		return []*kite.Client{remote}, nil
+	}
+
+	query := parseKiteQuery(arg)
+	if query.Username == "" {
+		query.Username = k.Kite().Username
+	}
+
+	return k.GetKites(query)
+}
+
+func parseKiteQuery(s string) *protocol.KontrolQuery {
+	var q protocol.KontrolQuery
+	fields := []*string{&q.Username, &q.Environment, &q.Name, &q.Version, &q.Region, &q.Hostname, &q.ID}
+
+	for i, v := range strings.SplitN(strings.Trim(s, "/"), "/", len(fields)) {
+		*fields[i] = v
+	}
+
+	return &q
+}
+
+func (s *pingStats) compute() {
+	if len(s.RTTs) == 0 {
+		return
+	}
+
+	var sum float64
+	s.Min, s.Max = s.RTTs[0], s.RTTs[0]
+	for _, rtt := range s.RTTs {
+		if rtt < s.Min {
+			s.Min = rtt
+		}
+		if rtt > s.Max {
+			s.Max = rtt
+		}
+		sum += float64(rtt)
+	}
+
+	avg := sum / float64(len(s.RTTs))
+	s.Avg = time.Duration(avg)
+
+	var variance float64
+	for _, rtt := range s.RTTs {
+		d := float64(rtt) - avg
+		variance += d * d
+	}
+	s.StdDev = time.Duration(math.Sqrt(variance / float64(len(s.RTTs))))
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
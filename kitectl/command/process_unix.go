@@ -0,0 +1,57 @@
+// +build !windows
+
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockSupervisor takes the lock at path held by the supervisor of a kite
+// for as long as it runs, until the returned file is closed. It fails if
+// another supervisor holds the lock.
+func lockSupervisor(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// supervisorLocked reports whether a running supervisor holds the lock at
+// path.
+func supervisorLocked(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return true
+	}
+
+	if err == nil {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}
+
+	return false
+}
+
+// stopSupervisor asks the supervisor of the status to stop its kite and
+// exit.
+func stopSupervisor(s *KiteStatus) error {
+	return syscall.Kill(s.PID, syscall.SIGTERM)
+}
@@ -0,0 +1,71 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const errorSharingViolation = syscall.Errno(32)
+
+// lockSupervisor takes the lock at path held by the supervisor of a kite
+// for as long as it runs, until the returned file is closed. It fails if
+// another supervisor holds the lock.
+//
+// The file is opened without sharing, so it can not be opened again while
+// the supervisor runs.
+func lockSupervisor(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	h, err := openExclusive(path, syscall.OPEN_ALWAYS)
+	if err != nil {
+		return nil, &os.PathError{Op: "lock", Path: path, Err: err}
+	}
+
+	return os.NewFile(uintptr(h), path), nil
+}
+
+// supervisorLocked reports whether a running supervisor holds the lock at
+// path.
+func supervisorLocked(path string) bool {
+	h, err := openExclusive(path, syscall.OPEN_EXISTING)
+	if err != nil {
+		return err == errorSharingViolation
+	}
+
+	syscall.CloseHandle(h)
+	return false
+}
+
+func openExclusive(path string, mode uint32) (syscall.Handle, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return syscall.InvalidHandle, err
+	}
+
+	return syscall.CreateFile(p, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, mode, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+}
+
+// stopSupervisor stops the supervisor of the status and its kite. Windows
+// can not deliver signals to other processes, so both are terminated.
+// The supervisor is terminated first so it does not restart the kite.
+func stopSupervisor(s *KiteStatus) error {
+	p, err := os.FindProcess(s.PID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.Kill(); err != nil {
+		return err
+	}
+
+	if s.ChildPID != 0 {
+		if child, err := os.FindProcess(s.ChildPID); err == nil {
+			child.Kill()
+		}
+	}
+
+	return nil
+}
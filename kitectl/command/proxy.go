@@ -0,0 +1,175 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/mitchellh/cli"
+)
+
+type Proxy struct {
+	KiteClient *kite.Kite
+	Ui         cli.Ui
+}
+
+func NewProxy() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Proxy{
+			KiteClient: DefaultKiteClient,
+			Ui:         DefaultUi,
+		}, nil
+	}
+}
+
+func (c *Proxy) Synopsis() string {
+	return "Forwards a local port to a kite"
+}
+
+func (c *Proxy) Help() string {
+	helpText := `
+Usage: kitectl proxy [options] <url|query>
+
+  Listens on a local TCP port and forwards every connection to it over the
+  kite connection, so services reachable by a remote kite can be used with
+  local tools. The kite is given by its URL or a query, as for "kitectl
+  ping", and must handle the kite.forward method (see kite.HandleForward),
+  which by default only reaches addresses on the kite's own host.
+
+  Works for any protocol on top of TCP, such as HTTP.
+
+Options:
+
+  -local=:8080       Local address to listen on.
+  -remote=addr       Address the kite connects to, defaults to localhost
+                     with the port of -local.
+  -timeout=4s        Timeout of dialing the kite.
+  -transport=auto    Transport to connect with, WebSocket, XHRPolling or auto.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Proxy) Run(args []string) int {
+	var (
+		local, remoteAddr, transport string
+		timeout                      time.Duration
+	)
+
+	flags := flag.NewFlagSet("proxy", flag.ExitOnError)
+	flags.StringVar(&local, "local", ":8080", "")
+	flags.StringVar(&remoteAddr, "remote", "", "")
+	flags.DurationVar(&timeout, "timeout", 4*time.Second, "")
+	flags.StringVar(&transport, "transport", config.Transport(config.Auto).String(), "")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	t, ok := config.Transports[transport]
+	if !ok {
+		c.Ui.Error(fmt.Sprintf("Unknown transport %q", transport))
+		return 1
+	}
+
+	if remoteAddr == "" {
+		_, port, err := net.SplitHostPort(local)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Invalid -local address: %s", err))
+			return 1
+		}
+		remoteAddr = net.JoinHostPort("localhost", port)
+	}
+
+	remote, err := resolveKite(c.KiteClient, flags.Arg(0))
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer remote.Close()
+
+	remote.Config = c.KiteClient.Config.Copy()
+	remote.Config.Transport = t
+
+	disconnected := make(chan struct{})
+	remote.OnDisconnect(func() { close(disconnected) })
+
+	if err := remote.DialTimeout(timeout); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	l, err := net.Listen("tcp", local)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer l.Close()
+
+	c.Ui.Info(fmt.Sprintf("Forwarding %s to %s on %s", l.Addr(), remoteAddr, remote.URL))
+
+	accepted := make(chan net.Conn)
+	acceptErr := make(chan error, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				acceptErr <- err
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	for {
+		select {
+		case conn := <-accepted:
+			go c.forward(remote, conn, remoteAddr)
+		case err := <-acceptErr:
+			c.Ui.Error(err.Error())
+			return 1
+		case <-disconnected:
+			c.Ui.Error("kite disconnected")
+			return 1
+		case <-sigs:
+			return 0
+		}
+	}
+}
+
+// forward copies data between the local connection and a connection to addr
+// forwarded by the remote kite, until either of them is closed.
+func (c *Proxy) forward(remote *kite.Client, conn net.Conn, addr string) {
+	defer conn.Close()
+
+	fc, err := remote.DialForward(addr)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("%s: %s", conn.RemoteAddr(), err))
+		return
+	}
+	defer fc.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(fc, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, fc)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
@@ -1,16 +1,65 @@
 package command
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/koding/kite"
 	"github.com/koding/kite/config"
+	"github.com/koding/kite/kitekey"
 	"github.com/koding/kite/protocol"
 	"github.com/mitchellh/cli"
 )
 
+// queryResult is the JSON representation of a kite found by Query.
+type queryResult struct {
+	Kite protocol.Kite `json:"kite"`
+	URL  string        `json:"url"`
+}
+
+// queryCacheFileName is the file in KiteHome the results of the last
+// query are kept in.
+const queryCacheFileName = "query-cache.json"
+
+func writeQueryCache(kites []queryResult) error {
+	kiteHome, err := kitekey.KiteHome()
+	if err != nil {
+		return err
+	}
+
+	p, err := json.Marshal(kites)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(kiteHome, queryCacheFileName), p, 0600)
+}
+
+func readQueryCache() ([]queryResult, error) {
+	kiteHome, err := kitekey.KiteHome()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := ioutil.ReadFile(filepath.Join(kiteHome, queryCacheFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var kites []queryResult
+	if err := json.Unmarshal(p, &kites); err != nil {
+		return nil, err
+	}
+
+	return kites, nil
+}
+
 type Query struct {
 	KiteClient *kite.Kite
 	Ui         cli.Ui
@@ -33,17 +82,22 @@ func (c *Query) Help() string {
 	helpText := `
 Usage: kitectl query [options]
 
-  Queries Kontrol based on the given criteria.
+  Queries Kontrol based on the given criteria. Use
+  "kitectl -output=json query" to print the matching kites as JSON.
 
 Options:
 
   -username=koding      Username of the kite.
   -environment=staging  Environment of the kite.
   -name=naber           Name of the kite.
-  -version=0.0.1        Version of the kite.
+  -version=0.0.1        Version of the kite, or a constraint like ">= 1.2, < 2".
   -region=Asia          Region of the kite.
   -hostname=caprica     Hostname of the kite.
   -id=<UUID>            Unique ID of the kite.
+  -select=field=glob    Only show kites whose field matches the glob, e.g.
+                        hostname=web-*. Can be given more than once. Kites
+                        carry no labels, selectors match the fields above and
+                        are applied to the results returned by Kontrol.
 `
 	return strings.TrimSpace(helpText)
 }
@@ -53,15 +107,11 @@ func (c *Query) Run(args []string) int {
 	c.KiteClient.Config.Transport = config.XHRPolling
 
 	var query protocol.KontrolQuery
+	var selectors kiteSelectors
 
 	flags := flag.NewFlagSet("query", flag.ExitOnError)
-	flags.StringVar(&query.Username, "username", c.KiteClient.Kite().Username, "")
-	flags.StringVar(&query.Environment, "environment", "", "")
-	flags.StringVar(&query.Name, "name", "", "")
-	flags.StringVar(&query.Version, "version", "", "")
-	flags.StringVar(&query.Region, "region", "", "")
-	flags.StringVar(&query.Hostname, "hostname", "", "")
-	flags.StringVar(&query.ID, "id", "", "")
+	queryFlags(flags, &query, c.KiteClient.Kite().Username)
+	flags.Var(&selectors, "select", "")
 	flags.Parse(args)
 
 	result, err := c.KiteClient.GetKites(&query)
@@ -70,6 +120,20 @@ func (c *Query) Run(args []string) int {
 		return 1
 	}
 
+	result = selectors.filter(result)
+
+	kites := make([]queryResult, len(result))
+	for i, client := range result {
+		kites[i] = queryResult{Kite: client.Kite, URL: client.URL}
+	}
+
+	// Remembered for shell completion, which must not hit Kontrol.
+	writeQueryCache(kites)
+
+	if OutputFormat == OutputJSON {
+		return outputJSON(c.Ui, kites)
+	}
+
 	for i, client := range result {
 		var k *protocol.Kite = &client.Kite
 		c.Ui.Output(fmt.Sprintf(
@@ -88,3 +152,80 @@ func (c *Query) Run(args []string) int {
 
 	return 0
 }
+
+// queryFlags defines the flags for the fields of a kontrol query.
+func queryFlags(flags *flag.FlagSet, query *protocol.KontrolQuery, username string) {
+	flags.StringVar(&query.Username, "username", username, "")
+	flags.StringVar(&query.Environment, "environment", "", "")
+	flags.StringVar(&query.Name, "name", "", "")
+	flags.StringVar(&query.Version, "version", "", "")
+	flags.StringVar(&query.Region, "region", "", "")
+	flags.StringVar(&query.Hostname, "hostname", "", "")
+	flags.StringVar(&query.ID, "id", "", "")
+}
+
+// kiteSelectors is a list of field=glob selectors given with -select.
+type kiteSelectors []kiteSelector
+
+type kiteSelector struct {
+	field   string
+	pattern string
+}
+
+func (s *kiteSelectors) String() string {
+	var parts []string
+	for _, sel := range *s {
+		parts = append(parts, sel.field+"="+sel.pattern)
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (s *kiteSelectors) Set(value string) error {
+	i := strings.IndexRune(value, '=')
+	if i == -1 {
+		return errors.New("selector must be in field=glob form")
+	}
+
+	sel := kiteSelector{field: value[:i], pattern: value[i+1:]}
+
+	if _, ok := (&protocol.Kite{}).Query().Fields()[sel.field]; !ok {
+		return fmt.Errorf("unknown kite field %q", sel.field)
+	}
+
+	if _, err := path.Match(sel.pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %s", sel.pattern, err)
+	}
+
+	*s = append(*s, sel)
+	return nil
+}
+
+// filter returns the clients of kites which match all of the selectors.
+func (s kiteSelectors) filter(clients []*kite.Client) []*kite.Client {
+	if len(s) == 0 {
+		return clients
+	}
+
+	var selected []*kite.Client
+
+	for _, client := range clients {
+		fields := client.Kite.Query().Fields()
+		matched := true
+
+		for _, sel := range s {
+			if ok, _ := path.Match(sel.pattern, fields[sel.field]); !ok {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			selected = append(selected, client)
+		} else {
+			client.Close()
+		}
+	}
+
+	return selected
+}
@@ -37,6 +37,10 @@ Usage: kitectl register [options]
   Registers your host to a kite authority.
   If no server is specified, "https://discovery.koding.io/kite" is the default.
 
+  The kite.key is written to ~/.kite/kite.key, or to the secret store given
+  by KITE_KEY_STORE: keychain, secret-service, credential-manager, or vault
+  for the Vault secret at KITE_VAULT_PATH.
+
 Options:
 
   -to=https://discovery.koding.io/kite  Kontrol URL
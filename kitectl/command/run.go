@@ -1,10 +1,13 @@
 package command
 
 import (
+	"errors"
+	"flag"
 	"os"
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/koding/kite/kitekey"
 	"github.com/mitchellh/cli"
@@ -26,14 +29,43 @@ func (c *Run) Synopsis() string {
 
 func (c *Run) Help() string {
 	helpText := `
-Usage: kitectl run kitename
-
-  Runs the given kite.
+Usage: kitectl run [options] kitename [args]
+
+  Runs the given kite. The kite is given a directory for its data in
+  the KITE_DATA_DIR environment variable, ~/.kite/data/kitename.
+
+Options:
+
+  -supervise              Keep running the kite, restarting it with a backoff
+                          when it crashes. Its output is captured into
+                          ~/.kite/logs/kitename and its state can be seen
+                          with "kitectl status".
+  -max-restarts=5         Give up after this many restarts within the
+                          restart window. Zero means never give up.
+  -restart-window=1m      Window for the restart limit.
+  -log-max-size=10        Rotate captured logs after this many megabytes.
+  -log-backups=3          Number of rotated log files to keep.
 `
 	return strings.TrimSpace(helpText)
 }
 
 func (c *Run) Run(args []string) int {
+	var (
+		supervise     bool
+		maxRestarts   int
+		restartWindow time.Duration
+		logMaxSize    int64
+		logBackups    int
+	)
+
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	flags.BoolVar(&supervise, "supervise", false, "")
+	flags.IntVar(&maxRestarts, "max-restarts", 5, "")
+	flags.DurationVar(&restartWindow, "restart-window", time.Minute, "")
+	flags.Int64Var(&logMaxSize, "log-max-size", 10, "")
+	flags.IntVar(&logBackups, "log-backups", 3, "")
+	flags.Parse(args)
+	args = flags.Args()
 
 	// Parse kite name
 	if len(args) == 0 {
@@ -41,15 +73,74 @@ func (c *Run) Run(args []string) int {
 		return 1
 	}
 
-	// User is allowed to enter kite name in these forms: "fs" or "github.com/koding/fs.kite/1.0.0"
-	suppliedName := args[0]
+	kite, err := findInstalledKite(args[0])
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
 
-	installedKites, err := getInstalledKites(suppliedName)
+	kiteHome, err := kitekey.KiteHome()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	binPath := filepath.Join(kiteHome, "kites", kite.BinPath())
+
+	env, err := kiteRunEnviron(kite.Name())
 	if err != nil {
 		c.Ui.Error(err.Error())
 		return 1
 	}
 
+	if supervise {
+		s := &supervisor{
+			Ui:            c.Ui,
+			Kite:          kite,
+			BinPath:       binPath,
+			Args:          args,
+			Env:           env,
+			MaxRestarts:   maxRestarts,
+			RestartWindow: restartWindow,
+			LogMaxSize:    logMaxSize << 20,
+			LogBackups:    logBackups,
+		}
+		return s.Run()
+	}
+
+	err = syscall.Exec(binPath, args, env)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// kiteRunEnviron returns the environment the named kite is run with, the
+// current one together with the data directory of the kite.
+func kiteRunEnviron(name string) ([]string, error) {
+	dataDir, err := kiteDataDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+
+	return append(os.Environ(), "KITE_DATA_DIR="+dataDir), nil
+}
+
+// findInstalledKite returns the installed kite with the given name. User is
+// allowed to enter kite name in these forms: "fs" or
+// "github.com/koding/fs.kite/1.0.0".
+func findInstalledKite(suppliedName string) (*InstalledKite, error) {
+	installedKites, err := getInstalledKites(suppliedName)
+	if err != nil {
+		return nil, err
+	}
+
 	var matched []*InstalledKite
 
 	for _, ik := range installedKites {
@@ -67,27 +158,12 @@ func (c *Run) Run(args []string) int {
 	}
 
 	if len(matched) == 0 {
-		c.Ui.Error("Kite not found")
-		return 1
+		return nil, errors.New("Kite not found")
 	}
 
 	if len(matched) > 1 {
-		c.Ui.Error("More than one version is installed. Please give a full kite name as: domain/user/repo/version")
-		return 1
+		return nil, errors.New("More than one version is installed. Please give a full kite name as: domain/user/repo/version")
 	}
 
-	kiteHome, err := kitekey.KiteHome()
-	if err != nil {
-		c.Ui.Error(err.Error())
-		return 1
-	}
-
-	binPath := filepath.Join(kiteHome, "kites", matched[0].BinPath())
-	err = syscall.Exec(binPath, args, os.Environ())
-	if err != nil {
-		c.Ui.Error(err.Error())
-		return 1
-	}
-
-	return 0
+	return matched[0], nil
 }
@@ -0,0 +1,1006 @@
+package command
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/koding/kite/kitekey"
+	"github.com/mitchellh/cli"
+)
+
+// serviceName returns the name of the system service running the kite.
+// kitectl logs looks up journald units by the same name.
+func serviceName(kiteName string) string {
+	return "kite-" + kiteName
+}
+
+// launchdLabel returns the launchd label of the service running the kite.
+func launchdLabel(kiteName string) string {
+	return "com.koding.kite." + kiteName
+}
+
+// Restart policies of kite services.
+const (
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+	RestartNever     = "never"
+)
+
+// serviceConfig describes a kite to be run as a system service.
+type serviceConfig struct {
+	Name       string   // name of the kite
+	Exec       string   // absolute path of the binary
+	Args       []string // arguments of the binary
+	EnvFile    string   // file with KITE_* variables, optional
+	Env        map[string]string
+	User       string // user to run the kite as, optional
+	LogDir     string // directory for stdout/stderr logs when not using journald
+	Restart    string // restart policy, defaults to RestartOnFailure
+	RestartSec int    // seconds to wait before restarting, defaults to 1
+}
+
+// SystemdRestart returns the value of the Restart option of systemd units.
+func (s *serviceConfig) SystemdRestart() string {
+	switch s.Restart {
+	case RestartAlways:
+		return "always"
+	case RestartNever:
+		return "no"
+	default:
+		return "on-failure"
+	}
+}
+
+// Delay returns the seconds to wait between restarts.
+func (s *serviceConfig) Delay() int {
+	if s.RestartSec <= 0 {
+		return 1
+	}
+	return s.RestartSec
+}
+
+var systemdTemplate = template.Must(template.New("systemd").Funcs(template.FuncMap{
+	"escape": systemdEscape,
+	"arg":    systemdArg,
+	"env":    systemdEnv,
+}).Parse(`[Unit]
+Description={{escape .Name}} kite
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+ExecStart={{arg .Exec}}{{range .Args}} {{arg .}}{{end}}
+{{- if .EnvFile}}
+EnvironmentFile=-{{escape .EnvFile}}
+{{- end}}
+{{- range $k, $v := .Env}}
+Environment="{{env $k $v}}"
+{{- end}}
+{{- if .User}}
+User={{escape .User}}
+{{- end}}
+Environment=KITE_LOG_NOCOLOR=1
+Restart={{.SystemdRestart}}
+RestartSec={{.Delay}}
+
+[Install]
+WantedBy={{if .UserUnit}}default.target{{else}}multi-user.target{{end}}
+`))
+
+var launchdTemplate = template.Must(template.New("launchd").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{.Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{xml .Exec}}</string>
+{{- range .Args}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+	<key>EnvironmentVariables</key>
+	<dict>
+		<key>KITE_LOG_NOCOLOR</key>
+		<string>1</string>
+{{- range $k, $v := .Env}}
+		<key>{{xml $k}}</key>
+		<string>{{xml $v}}</string>
+{{- end}}
+	</dict>
+{{- if .User}}
+	<key>UserName</key>
+	<string>{{xml .User}}</string>
+{{- end}}
+	<key>RunAtLoad</key>
+	<true/>
+{{- if eq .Restart "always"}}
+	<key>KeepAlive</key>
+	<true/>
+{{- else if ne .Restart "never"}}
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+{{- end}}
+	<key>ThrottleInterval</key>
+	<integer>{{.Delay}}</integer>
+{{- if .LogDir}}
+	<key>StandardOutPath</key>
+	<string>{{xml .LogDir}}/stdout.log</string>
+	<key>StandardErrorPath</key>
+	<string>{{xml .LogDir}}/stderr.log</string>
+{{- end}}
+</dict>
+</plist>
+`))
+
+// systemdEscape escapes a value of a systemd unit, doubling the % of
+// specifiers. Newlines would end the setting, so they are rejected.
+func systemdEscape(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return "", fmt.Errorf("%q can not be written to a systemd unit, it contains a newline", s)
+	}
+
+	return strings.Replace(s, "%", "%%", -1), nil
+}
+
+// systemdArg escapes a word of ExecStart=, which expands $ variables, and
+// quotes it if it is empty or contains spaces, quotes or backslashes.
+func systemdArg(s string) (string, error) {
+	escaped, err := systemdEscape(s)
+	if err != nil {
+		return "", err
+	}
+
+	escaped = strings.Replace(escaped, "$", "$$", -1)
+
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return escaped, nil
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(escaped) + `"`, nil
+}
+
+// systemdEnv escapes the assignment of an environment variable, which the
+// template writes within the quotes of Environment=.
+func systemdEnv(k, v string) (string, error) {
+	escaped, err := systemdEscape(k + "=" + v)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(escaped), nil
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// systemdUnit returns the systemd unit file running the kite.
+func systemdUnit(s *serviceConfig) (string, error) {
+	return renderSystemdUnit(s, false)
+}
+
+func renderSystemdUnit(s *serviceConfig, user bool) (string, error) {
+	var buf bytes.Buffer
+	err := systemdTemplate.Execute(&buf, struct {
+		*serviceConfig
+		UserUnit bool
+	}{s, user})
+	return buf.String(), err
+}
+
+// launchdPlist returns the launchd property list running the kite. launchd
+// has no equivalent of an environment file, variables are given inline.
+func launchdPlist(s *serviceConfig) (string, error) {
+	var buf bytes.Buffer
+	err := launchdTemplate.Execute(&buf, struct {
+		*serviceConfig
+		Label string
+	}{s, launchdLabel(s.Name)})
+	return buf.String(), err
+}
+
+// writeServiceFile writes a service file readable by its owner only, as it
+// holds the environment of the kite, and variables given with -env may be
+// secret. Files of earlier installs are made private too.
+func writeServiceFile(path, content string) error {
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		return err
+	}
+
+	return os.Chmod(path, 0600)
+}
+
+// ServiceStatus is the state of a kite service as reported by the service
+// manager.
+type ServiceStatus struct {
+	Name    string `json:"name"`
+	Service string `json:"service"`
+	Path    string `json:"path"`
+	State   string `json:"state"`
+	PID     int    `json:"pid,omitempty"`
+}
+
+// serviceManager installs and controls kite services with the service
+// manager of the host.
+type serviceManager interface {
+	// Path returns the path of the service file of the kite.
+	Path(name string) (string, error)
+	Install(s *serviceConfig, now bool) error
+	Uninstall(name string) error
+	Start(name string) error
+	Stop(name string) error
+	Status(name string) (*ServiceStatus, error)
+}
+
+// newServiceManager returns the service manager of the host. Services are
+// installed system wide when running as root and for the current user
+// otherwise.
+func newServiceManager() (serviceManager, error) {
+	user := os.Geteuid() != 0
+
+	switch runtime.GOOS {
+	case "linux":
+		if _, err := exec.LookPath("systemctl"); err != nil {
+			return nil, errors.New("systemd is required to install kite services")
+		}
+		return &systemdManager{user: user}, nil
+	case "darwin":
+		return &launchdManager{user: user}, nil
+	case "windows":
+		return nil, errors.New(`kite services are not supported on Windows, run the kite with "kitectl run -supervise" instead`)
+	default:
+		return nil, fmt.Errorf("kite services are not supported on %s", runtime.GOOS)
+	}
+}
+
+type systemdManager struct {
+	user bool
+}
+
+func (m *systemdManager) Path(name string) (string, error) {
+	return systemdUnitPath(name, m.user)
+}
+
+// systemdUnitPath returns the path of the unit file of the kite, installed
+// either system wide or for the current user.
+func systemdUnitPath(name string, user bool) (string, error) {
+	if !user {
+		return filepath.Join("/etc/systemd/system", serviceName(name)+".service"), nil
+	}
+
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, err := homeDir()
+		if err != nil {
+			return "", err
+		}
+		configDir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(configDir, "systemd", "user", serviceName(name)+".service"), nil
+}
+
+// isSystemdUserUnit tells whether the kite is installed as a systemd user
+// service rather than a system one.
+func isSystemdUserUnit(name string) bool {
+	path, err := systemdUnitPath(name, true)
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+func (m *systemdManager) systemctl(args ...string) error {
+	if m.user {
+		args = append([]string{"--user"}, args...)
+	}
+	return runIn("", nil, "systemctl", args...)
+}
+
+func (m *systemdManager) Install(s *serviceConfig, now bool) error {
+	unit, err := renderSystemdUnit(s, m.user)
+	if err != nil {
+		return err
+	}
+
+	path, err := m.Path(s.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if err := writeServiceFile(path, unit); err != nil {
+		return err
+	}
+
+	if err := m.systemctl("daemon-reload"); err != nil {
+		return err
+	}
+
+	args := []string{"enable", serviceName(s.Name)}
+	if now {
+		args = append(args, "--now")
+	}
+
+	return m.systemctl(args...)
+}
+
+func (m *systemdManager) Uninstall(name string) error {
+	path, err := m.Path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := m.systemctl("disable", "--now", serviceName(name)); err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	return m.systemctl("daemon-reload")
+}
+
+func (m *systemdManager) Start(name string) error {
+	return m.systemctl("start", serviceName(name))
+}
+
+func (m *systemdManager) Stop(name string) error {
+	return m.systemctl("stop", serviceName(name))
+}
+
+func (m *systemdManager) Status(name string) (*ServiceStatus, error) {
+	path, err := m.Path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"show", "-p", "ActiveState", "-p", "SubState", "-p", "MainPID", serviceName(name)}
+	if m.user {
+		args = append([]string{"--user"}, args...)
+	}
+
+	out, err := outputIn("", "systemctl", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if i := strings.IndexByte(line, '='); i != -1 {
+			props[line[:i]] = line[i+1:]
+		}
+	}
+
+	status := &ServiceStatus{
+		Name:    name,
+		Service: serviceName(name),
+		Path:    path,
+		State:   props["ActiveState"],
+	}
+
+	if sub := props["SubState"]; sub != "" && sub != status.State {
+		status.State += " (" + sub + ")"
+	}
+
+	status.PID, _ = strconv.Atoi(props["MainPID"])
+	return status, nil
+}
+
+type launchdManager struct {
+	user bool
+}
+
+func (m *launchdManager) Path(name string) (string, error) {
+	if !m.user {
+		return filepath.Join("/Library/LaunchDaemons", launchdLabel(name)+".plist"), nil
+	}
+
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, "Library", "LaunchAgents", launchdLabel(name)+".plist"), nil
+}
+
+func (m *launchdManager) Install(s *serviceConfig, now bool) error {
+	if s.LogDir != "" {
+		if err := os.MkdirAll(s.LogDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	plist, err := launchdPlist(s)
+	if err != nil {
+		return err
+	}
+
+	path, err := m.Path(s.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if err := writeServiceFile(path, plist); err != nil {
+		return err
+	}
+
+	// Property lists in the launchd directories are loaded on boot or
+	// login, loading starts the kite right away.
+	if now {
+		return m.Start(s.Name)
+	}
+
+	return nil
+}
+
+func (m *launchdManager) Uninstall(name string) error {
+	path, err := m.Path(name)
+	if err != nil {
+		return err
+	}
+
+	if status, err := m.Status(name); err == nil && status.State != "not loaded" {
+		if err := m.Stop(name); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(path)
+}
+
+func (m *launchdManager) Start(name string) error {
+	path, err := m.Path(name)
+	if err != nil {
+		return err
+	}
+
+	return runIn("", nil, "launchctl", "load", path)
+}
+
+func (m *launchdManager) Stop(name string) error {
+	path, err := m.Path(name)
+	if err != nil {
+		return err
+	}
+
+	return runIn("", nil, "launchctl", "unload", path)
+}
+
+// launchdPIDRegexp matches the PID line of "launchctl list <label>".
+var launchdPIDRegexp = regexp.MustCompile(`"PID" = (\d+);`)
+
+func (m *launchdManager) Status(name string) (*ServiceStatus, error) {
+	path, err := m.Path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ServiceStatus{
+		Name:    name,
+		Service: launchdLabel(name),
+		Path:    path,
+		State:   "not loaded",
+	}
+
+	cmd := exec.Command("launchctl", "list", launchdLabel(name))
+	out, err := cmd.Output()
+	if err != nil {
+		// launchctl fails for labels that are not loaded.
+		if _, ok := err.(*exec.ExitError); ok {
+			return status, nil
+		}
+		return nil, err
+	}
+
+	status.State = "loaded"
+	if m := launchdPIDRegexp.FindSubmatch(out); m != nil {
+		status.State = "running"
+		status.PID, _ = strconv.Atoi(string(m[1]))
+	}
+
+	return status, nil
+}
+
+// homeDir returns the home directory of the current user.
+func homeDir() (string, error) {
+	if home := os.Getenv("HOME"); home != "" {
+		return home, nil
+	}
+	return "", errors.New("cannot determine the home directory, HOME is not set")
+}
+
+type Service struct {
+	Ui cli.Ui
+}
+
+func NewService() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Service{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Service) Synopsis() string {
+	return "Runs installed kites as system services"
+}
+
+func (c *Service) Help() string {
+	helpText := `
+Usage: kitectl service <subcommand> [options] kitename
+
+  Installs and controls installed kites as systemd units on Linux and
+  launchd services on macOS. Services are installed system wide when run
+  as root, and for the current user otherwise. Windows services are not
+  supported, use "kitectl run -supervise" there.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Service) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+type ServiceInstall struct {
+	Ui cli.Ui
+}
+
+func NewServiceInstall() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &ServiceInstall{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *ServiceInstall) Synopsis() string {
+	return "Installs a service running an installed kite"
+}
+
+func (c *ServiceInstall) Help() string {
+	helpText := `
+Usage: kitectl service install [options] kitename [args...]
+
+  Generates and installs a service running the installed kite with the
+  given arguments, then enables it to start on boot (or login for user
+  services). The KITE_* variables of the current environment, including
+  the ones set by the active profile, are passed to the kite, except for
+  credentials like KITE_KEY and KITE_KEY_PASSPHRASE. The service file is
+  readable by its owner only.
+
+  systemd units log to journald, launchd services log to the kite's log
+  directory. Both are shown by "kitectl logs kitename".
+
+Options:
+
+  -env=KEY=VALUE          Set an environment variable of the kite. May be
+                          given multiple times.
+  -restart=on-failure     Restart policy: on-failure, always or never.
+  -restart-sec=1          Seconds to wait before restarting the kite.
+  -run-as=user            Run the kite as the given user. Only for system
+                          services.
+  -now                    Start the service right away.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ServiceInstall) Run(args []string) int {
+	var (
+		env        = make(envFlag)
+		restart    string
+		restartSec int
+		runAs      string
+		now        bool
+	)
+
+	flags := flag.NewFlagSet("service install", flag.ExitOnError)
+	flags.Var(env, "env", "")
+	flags.StringVar(&restart, "restart", RestartOnFailure, "")
+	flags.IntVar(&restartSec, "restart-sec", 1, "")
+	flags.StringVar(&runAs, "run-as", "", "")
+	flags.BoolVar(&now, "now", false, "")
+	flags.Parse(args)
+	args = flags.Args()
+
+	if len(args) == 0 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	m, err := newServiceManager()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	switch restart {
+	case RestartOnFailure, RestartAlways, RestartNever:
+	default:
+		c.Ui.Error(fmt.Sprintf("unknown restart policy: %q", restart))
+		return 1
+	}
+
+	if runAs != "" && os.Geteuid() != 0 {
+		c.Ui.Error("-run-as is only supported for system services, please run as root")
+		return 1
+	}
+
+	kite, err := findInstalledKite(args[0])
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	kiteHome, err := kitekey.KiteHome()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	logDir, err := kiteLogDir(kite.Name())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	s := &serviceConfig{
+		Name:       kite.Name(),
+		Exec:       filepath.Join(kiteHome, "kites", kite.BinPath()),
+		Args:       args[1:],
+		Env:        kiteEnviron(),
+		User:       runAs,
+		Restart:    restart,
+		RestartSec: restartSec,
+	}
+
+	dataDir, err := kiteDataDir(kite.Name())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	// The service may run as another user, or without the variables of
+	// this shell, so it is pinned to the kite home used here.
+	s.Env["KITE_HOME"] = kiteHome
+	s.Env["KITE_DATA_DIR"] = dataDir
+	for k, v := range env {
+		s.Env[k] = v
+	}
+
+	if _, ok := m.(*launchdManager); ok {
+		s.LogDir = logDir
+	}
+
+	if err := m.Install(s, now); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	path, _ := m.Path(s.Name)
+	c.Ui.Info(fmt.Sprintf("Installed service of %s to %s", kite, path))
+	return 0
+}
+
+// serviceEnvVars are the KITE_* variables passed from the current
+// environment to the services of kites. Credentials, like KITE_KEY and
+// KITE_KEY_PASSPHRASE, are not, as service files are read by their
+// service manager; the kite reads them from its kite.key store instead.
+var serviceEnvVars = []string{
+	"KITE_ALLOWED_USERS",
+	"KITE_CALLBACK_TIMEOUT",
+	"KITE_CHUNK_SIZE",
+	"KITE_DISABLE_AUTHENTICATION",
+	"KITE_DISABLE_CONCURRENCY",
+	"KITE_DISCONNECT_DELAY",
+	"KITE_ENVIRONMENT",
+	"KITE_HANDSHAKE_TIMEOUT",
+	"KITE_HEARTBEAT_DELAY",
+	"KITE_IP",
+	"KITE_KEY_ENCRYPTION",
+	"KITE_KEY_FILE",
+	"KITE_KEY_PASSPHRASE_FILE",
+	"KITE_KEY_STORE",
+	"KITE_KONTROL_CA_FILE",
+	"KITE_KONTROL_KEY",
+	"KITE_KONTROL_PINS",
+	"KITE_KONTROL_URL",
+	"KITE_KONTROL_USER",
+	"KITE_LOG_LEVEL",
+	"KITE_MAX_CHUNKED_SIZE",
+	"KITE_PORT",
+	"KITE_PROXY_CA_FILE",
+	"KITE_PROXY_PINS",
+	"KITE_PROXY_URL",
+	"KITE_RATE_LIMIT",
+	"KITE_RATE_LIMIT_BURST",
+	"KITE_REGION",
+	"KITE_SIGNING_ALGORITHMS",
+	"KITE_STRICT_ARGUMENTS",
+	"KITE_TIMEOUT",
+	"KITE_TLS_CERT_FILE",
+	"KITE_TLS_KEY_FILE",
+	"KITE_TRANSPORT",
+	"KITE_USERNAME",
+	"KITE_USE_WEBRTC",
+	"KITE_VAULT_PATH",
+	"KITE_VERIFY_TTL",
+}
+
+// kiteEnviron returns the variables of the current environment that
+// configure a kite, see serviceEnvVars.
+func kiteEnviron() map[string]string {
+	env := make(map[string]string)
+	for _, k := range serviceEnvVars {
+		if v, ok := os.LookupEnv(k); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// envFlag is a flag.Value collecting KEY=VALUE pairs.
+type envFlag map[string]string
+
+func (e envFlag) String() string {
+	var pairs []string
+	for k, v := range e {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (e envFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("invalid environment variable %q, expected KEY=VALUE", s)
+	}
+
+	e[s[:i]] = s[i+1:]
+	return nil
+}
+
+// serviceTarget returns the service manager and the service name of the
+// kite given on the command line of a service subcommand. Both the bare kite
+// name and the full installed name are accepted, services are named after
+// the former.
+func serviceTarget(name string) (serviceManager, string, error) {
+	m, err := newServiceManager()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if kite, err := findInstalledKite(name); err == nil {
+		name = kite.Name()
+	}
+
+	path, err := m.Path(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("no service is installed for %s", name)
+	}
+
+	return m, name, nil
+}
+
+type ServiceUninstall struct {
+	Ui cli.Ui
+}
+
+func NewServiceUninstall() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &ServiceUninstall{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *ServiceUninstall) Synopsis() string {
+	return "Stops and removes the service of a kite"
+}
+
+func (c *ServiceUninstall) Help() string {
+	helpText := `
+Usage: kitectl service uninstall kitename
+
+  Stops and disables the service of the kite, then removes its service
+  file. The kite itself stays installed.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ServiceUninstall) Run(args []string) int {
+	if len(args) != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	m, name, err := serviceTarget(args[0])
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if err := m.Uninstall(name); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	c.Ui.Info(fmt.Sprintf("Removed service of %s", name))
+	return 0
+}
+
+type ServiceStart struct {
+	Ui cli.Ui
+}
+
+func NewServiceStart() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &ServiceStart{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *ServiceStart) Synopsis() string {
+	return "Starts the service of a kite"
+}
+
+func (c *ServiceStart) Help() string {
+	helpText := `
+Usage: kitectl service start kitename
+
+  Starts the service of the kite installed with "kitectl service install".
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ServiceStart) Run(args []string) int {
+	if len(args) != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	m, name, err := serviceTarget(args[0])
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if err := m.Start(name); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+type ServiceStop struct {
+	Ui cli.Ui
+}
+
+func NewServiceStop() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &ServiceStop{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *ServiceStop) Synopsis() string {
+	return "Stops the service of a kite"
+}
+
+func (c *ServiceStop) Help() string {
+	helpText := `
+Usage: kitectl service stop kitename
+
+  Stops the service of the kite installed with "kitectl service install".
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ServiceStop) Run(args []string) int {
+	if len(args) != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	m, name, err := serviceTarget(args[0])
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if err := m.Stop(name); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+type ServiceStatusCommand struct {
+	Ui cli.Ui
+}
+
+func NewServiceStatus() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &ServiceStatusCommand{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *ServiceStatusCommand) Synopsis() string {
+	return "Shows the state of the service of a kite"
+}
+
+func (c *ServiceStatusCommand) Help() string {
+	helpText := `
+Usage: kitectl service status kitename
+
+  Shows the state of the service of the kite as reported by systemd or
+  launchd. Supports the global -output=json flag.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ServiceStatusCommand) Run(args []string) int {
+	if len(args) != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	m, name, err := serviceTarget(args[0])
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	status, err := m.Status(name)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if OutputFormat == OutputJSON {
+		return outputJSON(c.Ui, status)
+	}
+
+	c.Ui.Output(fmt.Sprintf("Service: %s", status.Service))
+	c.Ui.Output(fmt.Sprintf("Path:    %s", status.Path))
+	c.Ui.Output(fmt.Sprintf("State:   %s", status.State))
+	if status.PID != 0 {
+		c.Ui.Output(fmt.Sprintf("PID:     %d", status.PID))
+	}
+
+	return 0
+}
@@ -0,0 +1,121 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/koding/kite/kitekey"
+)
+
+const settingsFileName = "kitectl.json"
+
+// Settings is the configuration of kitectl, stored in KiteHome.
+type Settings struct {
+	// Profile is the name of the active profile.
+	Profile string `json:"profile,omitempty"`
+
+	Profiles map[string]*Profile `json:"profiles,omitempty"`
+
+	// Defaults used by every command, set with "kitectl config set". The
+	// environment and the active profile take precedence over them.
+	KontrolURL  string `json:"kontrolURL,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	Output      string `json:"output,omitempty"`
+	Proxy       string `json:"proxy,omitempty"`
+}
+
+// Profile describes a Kontrol to work against. Empty fields are left to
+// the defaults taken from the kite.key and the environment.
+type Profile struct {
+	KontrolURL  string `json:"kontrolURL,omitempty"`
+	KeyFile     string `json:"keyFile,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	Username    string `json:"username,omitempty"`
+}
+
+// env returns the environment variables the profile is applied with.
+func (p *Profile) env() map[string]string {
+	return map[string]string{
+		"KITE_KONTROL_URL": p.KontrolURL,
+		"KITE_KEY_FILE":    p.KeyFile,
+		"KITE_ENVIRONMENT": p.Environment,
+		"KITE_USERNAME":    p.Username,
+	}
+}
+
+// Apply exports the profile to the environment, so kite configuration read
+// afterwards uses it. With override false variables which are already set
+// are kept.
+func (p *Profile) Apply(override bool) {
+	for k, v := range p.env() {
+		if v == "" {
+			continue
+		}
+
+		if _, ok := os.LookupEnv(k); ok && !override {
+			continue
+		}
+
+		os.Setenv(k, v)
+	}
+}
+
+func settingsPath() (string, error) {
+	kiteHome, err := kitekey.KiteHome()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(kiteHome, settingsFileName), nil
+}
+
+// ReadSettings reads the kitectl settings. A missing settings file
+// gives empty settings.
+func ReadSettings() (*Settings, error) {
+	path, err := settingsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Settings{}
+
+	p, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(p, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Write saves the settings into KiteHome.
+func (s *Settings) Write() error {
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	p, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(p, '\n'), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
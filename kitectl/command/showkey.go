@@ -53,7 +53,8 @@ func (c *Showkey) Help() string {
 	helpText := `
 Usage: kitectl showkey
 
-  Shows the registration key.
+  Shows the registration key. Use "kitectl -output=json showkey" to print
+  all claims of the key as JSON.
 `
 	return strings.TrimSpace(helpText)
 }
@@ -67,6 +68,10 @@ func (c *Showkey) Run(_ []string) int {
 
 	claims := toObject(token.Claims)
 
+	if OutputFormat == OutputJSON {
+		return outputJSON(c.Ui, claims)
+	}
+
 	for _, v := range tokenKeyOrder {
 		c.Ui.Output(fmt.Sprintf("%-15s%+v", v, claims[v]))
 	}
@@ -0,0 +1,134 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// StateDead is reported for a kite whose supervisor went away without
+// recording a final state.
+const StateDead = "dead"
+
+type Status struct {
+	Ui cli.Ui
+}
+
+func NewStatus() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Status{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Status) Synopsis() string {
+	return "Shows the status of supervised kites"
+}
+
+func (c *Status) Help() string {
+	helpText := `
+Usage: kitectl status [kitename]
+
+  Shows the status of kites started with "kitectl run -supervise".
+  If no kite name is given all supervised kites are shown.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Status) Run(args []string) int {
+	var statuses []*KiteStatus
+
+	if len(args) > 0 {
+		path, err := kiteStatusPath(strings.TrimSuffix(args[0], ".kite"))
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+
+		s, err := readKiteStatus(path)
+		if os.IsNotExist(err) {
+			c.Ui.Error(fmt.Sprintf("%s is not supervised", args[0]))
+			return 1
+		}
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+
+		statuses = append(statuses, s)
+	} else {
+		var err error
+		if statuses, err = readKiteStatuses(); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	for _, s := range statuses {
+		if (s.State == StateRunning || s.State == StateRestarting) && !s.Alive() {
+			s.State = StateDead
+		}
+	}
+
+	if OutputFormat == OutputJSON {
+		if statuses == nil {
+			statuses = []*KiteStatus{}
+		}
+		return outputJSON(c.Ui, statuses)
+	}
+
+	for _, s := range statuses {
+		line := fmt.Sprintf("%s\t%s\t%s", s.Name, s.Kite, s.State)
+
+		switch s.State {
+		case StateRunning:
+			line += fmt.Sprintf("\tpid %d\tup %s", s.ChildPID, time.Since(s.StartedAt).Truncate(time.Second))
+		default:
+			if s.LastExit != "" {
+				line += "\t" + s.LastExit
+			}
+		}
+
+		c.Ui.Output(fmt.Sprintf("%s\trestarts %d", line, s.Restarts))
+	}
+
+	return 0
+}
+
+// readKiteStatuses returns the status of every supervised kite.
+func readKiteStatuses() ([]*KiteStatus, error) {
+	path, err := kiteStatusPath("")
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var statuses []*KiteStatus
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+
+		s, err := readKiteStatus(filepath.Join(filepath.Dir(path), f.Name()))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,333 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/koding/kite/kitekey"
+	"github.com/mitchellh/cli"
+)
+
+// States of a supervised kite as recorded in its status file.
+const (
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateExited     = "exited"
+	StateStopped    = "stopped"
+	StateFailed     = "failed"
+)
+
+// Names of the files the output of a supervised kite is captured into.
+const (
+	stdoutLogName = "stdout.log"
+	stderrLogName = "stderr.log"
+)
+
+// KiteStatus is the state of a supervised kite. The supervisor keeps it
+// up to date in KiteHome/run/<kitename>.json, kitectl status reads it.
+type KiteStatus struct {
+	Name       string     `json:"name"`
+	Kite       string     `json:"kite"`
+	State      string     `json:"state"`
+	PID        int        `json:"pid"`
+	ChildPID   int        `json:"childPid,omitempty"`
+	Restarts   int        `json:"restarts"`
+	StartedAt  time.Time  `json:"startedAt"`
+	LastExit   string     `json:"lastExit,omitempty"`
+	LastExitAt *time.Time `json:"lastExitAt,omitempty"`
+	LogDir     string     `json:"logDir"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// Alive reports whether the supervisor which wrote the status is still
+// running. It checks the lock the supervisor holds rather than its pid,
+// which may have been reused by another process since.
+func (s *KiteStatus) Alive() bool {
+	if s.PID == 0 {
+		return false
+	}
+
+	path, err := kiteLockPath(s.Name)
+	if err != nil {
+		return false
+	}
+
+	return supervisorLocked(path)
+}
+
+// kiteLogDir returns the directory the logs of the named kite are
+// written to.
+func kiteLogDir(name string) (string, error) {
+	kiteHome, err := kitekey.KiteHome()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(kiteHome, "logs", name), nil
+}
+
+// kiteDataDir returns the directory the named kite may keep its data in.
+// It is given to the kite as KITE_DATA_DIR by run and service install.
+func kiteDataDir(name string) (string, error) {
+	kiteHome, err := kitekey.KiteHome()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(kiteHome, "data", name), nil
+}
+
+// kiteStatusPath returns the path of the status file of the named kite.
+func kiteStatusPath(name string) (string, error) {
+	kiteHome, err := kitekey.KiteHome()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(kiteHome, "run", name+".json"), nil
+}
+
+// kiteLockPath returns the path of the file locked by the supervisor of the
+// named kite while it runs.
+func kiteLockPath(name string) (string, error) {
+	kiteHome, err := kitekey.KiteHome()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(kiteHome, "run", name+".lock"), nil
+}
+
+func readKiteStatus(path string) (*KiteStatus, error) {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s KiteStatus
+	if err := json.Unmarshal(p, &s); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return &s, nil
+}
+
+func writeKiteStatus(path string, s *KiteStatus) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	p, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial status.
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, p, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// supervisor runs a kite as a child process and restarts it with an
+// exponential backoff whenever it crashes.
+type supervisor struct {
+	Ui      cli.Ui
+	Kite    *InstalledKite
+	BinPath string
+	Args    []string // passed to the kite, including argv[0]
+	Env     []string // environment of the kite
+
+	// The kite is given up on after it has been restarted MaxRestarts
+	// times within RestartWindow. Zero MaxRestarts means no limit.
+	MaxRestarts   int
+	RestartWindow time.Duration
+
+	// Captured output is rotated after LogMaxSize bytes, keeping
+	// LogBackups old files.
+	LogMaxSize int64
+	LogBackups int
+
+	status     KiteStatus
+	statusPath string
+	restarts   []time.Time
+}
+
+func (s *supervisor) Run() int {
+	name := s.Kite.Name()
+
+	logDir, err := kiteLogDir(name)
+	if err != nil {
+		s.Ui.Error(err.Error())
+		return 1
+	}
+
+	s.statusPath, err = kiteStatusPath(name)
+	if err != nil {
+		s.Ui.Error(err.Error())
+		return 1
+	}
+
+	lockPath, err := kiteLockPath(name)
+	if err != nil {
+		s.Ui.Error(err.Error())
+		return 1
+	}
+
+	lock, err := lockSupervisor(lockPath)
+	if err != nil {
+		if old, e := readKiteStatus(s.statusPath); e == nil && supervisorLocked(lockPath) {
+			s.Ui.Error(fmt.Sprintf("%s is already supervised by pid %d", name, old.PID))
+		} else {
+			s.Ui.Error(fmt.Sprintf("cannot lock %s: %s", lockPath, err))
+		}
+		return 1
+	}
+	defer lock.Close()
+
+	stdout, err := openLogFile(filepath.Join(logDir, stdoutLogName), s.LogMaxSize, s.LogBackups)
+	if err != nil {
+		s.Ui.Error(err.Error())
+		return 1
+	}
+	defer stdout.Close()
+
+	stderr, err := openLogFile(filepath.Join(logDir, stderrLogName), s.LogMaxSize, s.LogBackups)
+	if err != nil {
+		s.Ui.Error(err.Error())
+		return 1
+	}
+	defer stderr.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = 0 // giving up is decided by the restart limit
+
+	s.status = KiteStatus{
+		Name:   name,
+		Kite:   s.Kite.String(),
+		PID:    os.Getpid(),
+		LogDir: logDir,
+	}
+
+	for {
+		cmd := exec.Command(s.BinPath)
+		cmd.Args = s.Args
+		cmd.Env = append(s.Env, "KITE_LOG_NOCOLOR=1") // output goes to files
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+
+		if err := cmd.Start(); err != nil {
+			s.Ui.Error(err.Error())
+			s.setState(StateFailed)
+			return 1
+		}
+
+		started := time.Now()
+		s.status.ChildPID = cmd.Process.Pid
+		s.status.StartedAt = started
+		s.setState(StateRunning)
+		s.Ui.Info(fmt.Sprintf("%s started with pid %d, logs are in %s", name, cmd.Process.Pid, logDir))
+
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+
+		select {
+		case sig := <-signals:
+			cmd.Process.Signal(sig)
+			s.exited(<-done)
+			s.setState(StateStopped)
+			return 0
+		case err = <-done:
+			s.exited(err)
+		}
+
+		if err == nil {
+			s.Ui.Info(fmt.Sprintf("%s exited", name))
+			s.setState(StateExited)
+			return 0
+		}
+
+		// A kite which ran for a while has recovered, do not keep
+		// penalizing it for old crashes.
+		if time.Since(started) > s.RestartWindow {
+			b.Reset()
+		}
+
+		if !s.allowRestart(time.Now()) {
+			s.Ui.Error(fmt.Sprintf("%s crashed %d times within %s, giving up", name, len(s.restarts), s.RestartWindow))
+			s.setState(StateFailed)
+			return 1
+		}
+
+		wait := b.NextBackOff()
+		s.Ui.Warn(fmt.Sprintf("%s %s, restarting in %s", name, s.status.LastExit, wait))
+		s.setState(StateRestarting)
+
+		select {
+		case <-time.After(wait):
+		case <-signals:
+			s.setState(StateStopped)
+			return 0
+		}
+
+		s.status.Restarts++
+	}
+}
+
+// allowRestart records a restart at time t and reports whether it stays
+// within the restart limit.
+func (s *supervisor) allowRestart(t time.Time) bool {
+	if s.MaxRestarts <= 0 {
+		return true
+	}
+
+	recent := s.restarts[:0]
+	for _, r := range s.restarts {
+		if t.Sub(r) < s.RestartWindow {
+			recent = append(recent, r)
+		}
+	}
+	s.restarts = recent
+
+	if len(s.restarts) >= s.MaxRestarts {
+		return false
+	}
+
+	s.restarts = append(s.restarts, t)
+	return true
+}
+
+func (s *supervisor) exited(err error) {
+	now := time.Now()
+	s.status.ChildPID = 0
+	s.status.LastExitAt = &now
+
+	if err != nil {
+		s.status.LastExit = err.Error()
+	} else {
+		s.status.LastExit = "exit status 0"
+	}
+}
+
+func (s *supervisor) setState(state string) {
+	s.status.State = state
+	s.status.UpdatedAt = time.Now()
+
+	if err := writeKiteStatus(s.statusPath, &s.status); err != nil {
+		s.Ui.Warn("cannot write status: " + err.Error())
+	}
+}
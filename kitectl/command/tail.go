@@ -0,0 +1,237 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+	"github.com/mitchellh/cli"
+)
+
+type Tail struct {
+	KiteClient *kite.Kite
+	Ui         cli.Ui
+}
+
+func NewTail() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Tail{
+			KiteClient: DefaultKiteClient,
+			Ui:         DefaultUi,
+		}, nil
+	}
+}
+
+func (c *Tail) Synopsis() string {
+	return "Prints the callback invocations of a method"
+}
+
+func (c *Tail) Help() string {
+	helpText := `
+Usage: kitectl tail [options] <url|query> <method> [args...]
+
+  Calls the method of a kite with a callback and prints every invocation of
+  the callback as it arrives, until interrupted or the kite disconnects.
+  The kite is given by its URL or a query, as for "kitectl ping". Arguments
+  are passed as for "kitectl tell", the callback is appended as the last
+  argument unless -key is given.
+
+  String arguments of the callback are printed as they are, others as JSON.
+  With the global -output=json flag, given before the command name, every
+  invocation is printed as a JSON line holding the time and the arguments.
+
+Options:
+
+  -key=name          Pass the callback as the given field of the last
+                     argument, which must be an object, instead of
+                     appending it. A new object is appended if there are no
+                     arguments.
+  -n=0               Exit after the given number of invocations.
+  -timeout=4s        Timeout of dialing.
+  -transport=auto    Transport to connect with, WebSocket, XHRPolling or auto.
+  -args-file=file    Read the arguments as a JSON array from the file, "-"
+                     reads from stdin.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// tailEvent is the JSON representation of a callback invocation.
+type tailEvent struct {
+	Time time.Time       `json:"time"`
+	Args json.RawMessage `json:"args"`
+}
+
+func (c *Tail) Run(args []string) int {
+	var (
+		key, transport, argsFile string
+		count                    int
+		timeout                  time.Duration
+	)
+
+	flags := flag.NewFlagSet("tail", flag.ExitOnError)
+	flags.StringVar(&key, "key", "", "")
+	flags.IntVar(&count, "n", 0, "")
+	flags.DurationVar(&timeout, "timeout", 4*time.Second, "")
+	flags.StringVar(&transport, "transport", config.Transport(config.Auto).String(), "")
+	flags.StringVar(&argsFile, "args-file", "", "")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	t, ok := config.Transports[transport]
+	if !ok {
+		c.Ui.Error(fmt.Sprintf("Unknown transport %q", transport))
+		return 1
+	}
+
+	method := flags.Arg(1)
+	params := parseTellArgs(flags.Args()[2:])
+	if argsFile != "" {
+		if flags.NArg() != 2 {
+			c.Ui.Error("Arguments cannot be given together with -args-file")
+			return 1
+		}
+
+		var err error
+		if params, err = readTellArgs(argsFile); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	// Invocations are handed over to this goroutine so they are printed in
+	// order and never concurrently.
+	events := make(chan *tailEvent, 64)
+	callback := dnode.Callback(func(p *dnode.Partial) {
+		events <- &tailEvent{Time: time.Now(), Args: p.Raw}
+	})
+
+	params, err := withCallback(params, key, callback)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	remote, err := resolveKite(c.KiteClient, flags.Arg(0))
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer remote.Close()
+
+	remote.Config = c.KiteClient.Config.Copy()
+	remote.Config.Transport = t
+
+	disconnected := make(chan struct{})
+	remote.OnDisconnect(func() { close(disconnected) })
+
+	if err := remote.DialTimeout(timeout); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	// The method may keep calling the callback after returning, or only
+	// return once it is done, so there is no timeout on the call. Only an
+	// error it returns ends the tail.
+	callErr := make(chan error, 1)
+	go func() {
+		_, err := remote.Tell(method, params...)
+		callErr <- err
+	}()
+
+	for n := 0; count == 0 || n < count; {
+		select {
+		case ev := <-events:
+			if err := c.print(ev); err != nil {
+				c.Ui.Error(err.Error())
+				return 1
+			}
+			n++
+		case err := <-callErr:
+			if err != nil {
+				c.Ui.Error(err.Error())
+				return 1
+			}
+			callErr = nil
+		case <-disconnected:
+			c.Ui.Error("kite disconnected")
+			return 1
+		case <-sigs:
+			return 0
+		}
+	}
+
+	return 0
+}
+
+func (c *Tail) print(ev *tailEvent) error {
+	if OutputFormat == OutputJSON {
+		p, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		c.Ui.Output(string(p))
+		return nil
+	}
+
+	var args []json.RawMessage
+	if err := json.Unmarshal(ev.Args, &args); err != nil {
+		// Not an argument list, print what was received.
+		c.Ui.Output(string(ev.Args))
+		return nil
+	}
+
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		var s string
+		if err := json.Unmarshal(arg, &s); err == nil {
+			parts[i] = s
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, arg); err != nil {
+			parts[i] = string(arg)
+		} else {
+			parts[i] = buf.String()
+		}
+	}
+
+	c.Ui.Output(strings.Join(parts, " "))
+	return nil
+}
+
+// withCallback adds the callback to the method arguments, either as a field
+// of the last argument or appended as a new argument.
+func withCallback(params []interface{}, key string, callback dnode.Function) ([]interface{}, error) {
+	if key == "" {
+		return append(params, callback), nil
+	}
+
+	if len(params) == 0 {
+		return []interface{}{map[string]interface{}{key: callback}}, nil
+	}
+
+	obj, ok := params[len(params)-1].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the last argument must be an object to pass the callback as %q", key)
+	}
+
+	obj[key] = callback
+	return params, nil
+}
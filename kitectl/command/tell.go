@@ -1,7 +1,12 @@
 package command
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
+	"io/ioutil"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -31,28 +36,34 @@ func (c *Tell) Synopsis() string {
 
 func (c *Tell) Help() string {
 	helpText := `
-Usage: kitectl tell [options]
+Usage: kitectl tell [options] [args]
 
-  Calls a method on a kite.
+  Calls a method on a kite. Arguments are passed to the method as strings,
+  or as numbers if they look like one. Structured arguments can be given
+  as JSON with -args-file, a JSON array is passed as the list of
+  arguments, any other value as the only argument. The result is printed
+  as indented JSON.
 
 Options:
 
   -to=URL          URL of the remote kite
   -method=divide   Method name to be invoked
   -timeout=4       Timeout in seconds.
+  -args-file=FILE  Read the arguments as JSON from FILE, "-" for stdin.
 `
 	return strings.TrimSpace(helpText)
 }
 
 func (c *Tell) Run(args []string) int {
 
-	var to, method string
+	var to, method, argsFile string
 	var timeout time.Duration
 
 	flags := flag.NewFlagSet("tell", flag.ExitOnError)
 	flags.StringVar(&to, "to", "", "URL of remote kite")
 	flags.StringVar(&method, "method", "", "method to be called")
 	flags.DurationVar(&timeout, "timeout", 4*time.Second, "timeout of tell method")
+	flags.StringVar(&argsFile, "args-file", "", "JSON file to read arguments from")
 	flags.Parse(args)
 
 	if to == "" || method == "" {
@@ -60,6 +71,22 @@ func (c *Tell) Run(args []string) int {
 		return 1
 	}
 
+	var params []interface{}
+	if argsFile != "" {
+		if flags.NArg() != 0 {
+			c.Ui.Error("Arguments cannot be given together with -args-file")
+			return 1
+		}
+
+		var err error
+		if params, err = readTellArgs(argsFile); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	} else {
+		params = parseTellArgs(flags.Args())
+	}
+
 	key, err := kitekey.Read()
 	if err != nil {
 		c.Ui.Error(err.Error())
@@ -77,17 +104,6 @@ func (c *Tell) Run(args []string) int {
 		return 1
 	}
 
-	// Convert args to []interface{} in order to pass it to Tell() method.
-	methodArgs := flags.Args()
-	params := make([]interface{}, len(methodArgs))
-	for i, arg := range methodArgs {
-		if number, err := strconv.Atoi(arg); err != nil {
-			params[i] = arg
-		} else {
-			params[i] = number
-		}
-	}
-
 	result, err := remote.TellWithTimeout(method, timeout, params...)
 	if err != nil {
 		c.Ui.Error(err.Error())
@@ -96,9 +112,66 @@ func (c *Tell) Run(args []string) int {
 
 	if result == nil {
 		c.Ui.Info("nil")
-	} else {
+		return 0
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, result.Raw, "", "  "); err != nil {
 		c.Ui.Info(string(result.Raw))
+	} else {
+		c.Ui.Info(buf.String())
 	}
 
 	return 0
 }
+
+// readTellArgs reads method arguments as JSON from the named file, or from
+// stdin if the name is "-".
+func readTellArgs(name string) ([]interface{}, error) {
+	var p []byte
+	var err error
+
+	if name == "-" {
+		p, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		p, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p = bytes.TrimSpace(p)
+	if len(p) == 0 {
+		return nil, errors.New("no arguments given in " + name)
+	}
+
+	// Numbers are kept as they are written instead of being rounded
+	// to float64.
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, errors.New("invalid JSON arguments: " + err.Error())
+	}
+
+	if args, ok := v.([]interface{}); ok {
+		return args, nil
+	}
+
+	return []interface{}{v}, nil
+}
+
+// parseTellArgs converts command line arguments to method arguments, numbers
+// are passed as numbers and everything else as strings.
+func parseTellArgs(args []string) []interface{} {
+	params := make([]interface{}, len(args))
+	for i, arg := range args {
+		if number, err := strconv.Atoi(arg); err != nil {
+			params[i] = arg
+		} else {
+			params[i] = number
+		}
+	}
+	return params
+}
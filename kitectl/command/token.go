@@ -0,0 +1,335 @@
+package command
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite/kitekey"
+	"github.com/mitchellh/cli"
+)
+
+// timeClaims are the claims holding a Unix time.
+var timeClaims = map[string]bool{"iat": true, "nbf": true, "exp": true}
+
+type Token struct {
+	Ui cli.Ui
+}
+
+func NewToken() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Token{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Token) Synopsis() string {
+	return "Works with kontrol issued tokens"
+}
+
+func (c *Token) Help() string {
+	helpText := `
+Usage: kitectl token <subcommand> [options]
+
+  Works with tokens issued by Kontrol, including kite.key files.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Token) Run(_ []string) int {
+	return cli.RunResultHelp
+}
+
+type TokenInspect struct {
+	Ui cli.Ui
+}
+
+func NewTokenInspect() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &TokenInspect{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *TokenInspect) Synopsis() string {
+	return "Decodes and verifies a token"
+}
+
+func (c *TokenInspect) Help() string {
+	helpText := `
+Usage: kitectl token inspect [options] <token|file|->
+
+  Decodes a JWT issued by Kontrol, given as is, in a file or on stdin, and
+  prints its claims. The signature is verified against the public key of
+  Kontrol, which is taken from the kite.key unless -public-key is given.
+  It exits with a non-zero status if the token is invalid or expired.
+
+Options:
+
+  -public-key=FILE   PEM encoded public key of Kontrol.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// tokenInspection is the JSON representation of an inspected token.
+type tokenInspection struct {
+	Header   map[string]interface{} `json:"header"`
+	Claims   map[string]interface{} `json:"claims"`
+	Valid    bool                   `json:"valid"`
+	Problems []string               `json:"problems,omitempty"`
+}
+
+func (c *TokenInspect) Run(args []string) int {
+	var publicKeyFile string
+
+	flags := flag.NewFlagSet("token inspect", flag.ExitOnError)
+	flags.StringVar(&publicKeyFile, "public-key", "", "")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	raw, err := readToken(flags.Arg(0))
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	claims := jwt.MapClaims{}
+	token, _, err := new(jwt.Parser).ParseUnverified(raw, claims)
+	if err != nil {
+		c.Ui.Error("cannot decode token: " + err.Error())
+		return 1
+	}
+
+	var problems []string
+
+	publicKey, source, err := kontrolPublicKey(publicKeyFile, claims)
+	if err != nil {
+		problems = append(problems, "signature is not verified: "+err.Error())
+	} else if err := verifyToken(raw, publicKey); err != nil {
+		problems = append(problems, "signature is invalid: "+err.Error())
+	} else if source != "" {
+		c.Ui.Info("signature is verified with the public key from " + source)
+	}
+
+	problems = append(problems, tokenTimeProblems(claims, time.Now())...)
+
+	if OutputFormat == OutputJSON {
+		code := outputJSON(c.Ui, &tokenInspection{
+			Header:   token.Header,
+			Claims:   claims,
+			Valid:    len(problems) == 0,
+			Problems: problems,
+		})
+		if code != 0 || len(problems) != 0 {
+			return 1
+		}
+		return 0
+	}
+
+	c.Ui.Output(fmt.Sprintf("%-15s%v", "alg", token.Header["alg"]))
+	if kid, ok := token.Header["kid"]; ok {
+		c.Ui.Output(fmt.Sprintf("%-15s%v", "kid", kid))
+	}
+
+	for _, name := range claimNames(claims) {
+		c.Ui.Output(fmt.Sprintf("%-15s%s", name, formatClaim(name, claims[name])))
+	}
+
+	if aud, ok := claims["aud"].(string); ok {
+		if desc, ok := describeAudience(aud); ok {
+			c.Ui.Output(fmt.Sprintf("%-15s%s", "grants", desc))
+		}
+	}
+
+	if len(problems) != 0 {
+		for _, p := range problems {
+			c.Ui.Error(p)
+		}
+		return 1
+	}
+
+	c.Ui.Info("token is valid")
+	return 0
+}
+
+// readToken returns the token given as an argument. The argument may be the
+// token itself, a file holding it or "-" for stdin.
+func readToken(arg string) (string, error) {
+	var p []byte
+	var err error
+
+	switch {
+	case arg == "-":
+		p, err = ioutil.ReadAll(os.Stdin)
+	case strings.Count(arg, ".") == 2 && !strings.ContainsAny(arg, "/\\"):
+		if _, err := os.Stat(arg); err != nil {
+			return arg, nil
+		}
+		fallthrough
+	default:
+		p, err = ioutil.ReadFile(arg)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(p)), nil
+}
+
+// kontrolPublicKey returns the key to verify tokens with and where it is
+// taken from.
+func kontrolPublicKey(file string, claims jwt.MapClaims) (interface{}, string, error) {
+	if file != "" {
+		p, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, "", err
+		}
+
+		key, err := kitekey.ParsePublicKey(p)
+		return key, file, err
+	}
+
+	if key, err := kitekey.Parse(); err == nil {
+		if kc, ok := key.Claims.(*kitekey.KiteClaims); ok && kc.KontrolKey != "" {
+			pub, err := kitekey.ParsePublicKey([]byte(kc.KontrolKey))
+			return pub, "", err
+		}
+	}
+
+	// A kite.key carries the key of the kontrol which signed it, that only
+	// proves the token is consistent, not who issued it.
+	if k, ok := claims["kontrolKey"].(string); ok && k != "" {
+		pub, err := kitekey.ParsePublicKey([]byte(k))
+		return pub, "the token itself", err
+	}
+
+	return nil, "", errors.New("no kite.key found, give the key with -public-key")
+}
+
+func verifyToken(raw string, publicKey interface{}) error {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if err := kitekey.CheckSigningMethod(token, publicKey, nil); err != nil {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+
+		return publicKey, nil
+	}
+
+	// Times are checked separately with a more helpful message.
+	_, err := new(jwt.Parser).ParseWithClaims(raw, &noTimeClaims{}, keyFunc)
+	return err
+}
+
+// noTimeClaims skips the validation of time claims.
+type noTimeClaims struct {
+	jwt.MapClaims
+}
+
+func (noTimeClaims) Valid() error { return nil }
+
+// tokenTimeProblems reports expired tokens and tokens issued in the
+// future, which mean the clocks of Kontrol and this machine differ.
+func tokenTimeProblems(claims jwt.MapClaims, now time.Time) []string {
+	var problems []string
+
+	if exp, ok := claimTime(claims, "exp"); ok && now.After(exp) {
+		problems = append(problems, fmt.Sprintf("token expired %s ago", now.Sub(exp).Truncate(time.Second)))
+	}
+
+	if nbf, ok := claimTime(claims, "nbf"); ok && now.Before(nbf) {
+		problems = append(problems, fmt.Sprintf("token is not valid for another %s, check the clock", nbf.Sub(now).Truncate(time.Second)))
+	}
+
+	// Kontrol sets iat behind the time of issue to allow for clock skew,
+	// a token issued in the future means the clock is off by more than that.
+	if iat, ok := claimTime(claims, "iat"); ok && now.Before(iat) {
+		problems = append(problems, fmt.Sprintf("token is issued %s in the future, the clock is behind Kontrol's", iat.Sub(now).Truncate(time.Second)))
+	}
+
+	return problems
+}
+
+func claimTime(claims jwt.MapClaims, name string) (time.Time, bool) {
+	v, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(v), 0), true
+}
+
+// claimNames returns the names of the claims with the registered kite
+// claims first.
+func claimNames(claims jwt.MapClaims) []string {
+	order := []string{"sub", "iss", "aud", "scope", "iat", "nbf", "exp", "jti", "kontrolURL", "kontrolKey"}
+
+	var names, rest []string
+	for _, name := range order {
+		if _, ok := claims[name]; ok {
+			names = append(names, name)
+		}
+	}
+
+	for name := range claims {
+		found := false
+		for _, n := range order {
+			if n == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			rest = append(rest, name)
+		}
+	}
+
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+func formatClaim(name string, v interface{}) string {
+	if t, ok := v.(float64); ok && timeClaims[name] {
+		tm := time.Unix(int64(t), 0)
+		d := time.Until(tm).Truncate(time.Second)
+
+		if d < 0 {
+			return fmt.Sprintf("%s (%s ago)", tm.Format(time.RFC3339), -d)
+		}
+		return fmt.Sprintf("%s (in %s)", tm.Format(time.RFC3339), d)
+	}
+
+	if s, ok := v.(string); ok && name == "kontrolKey" {
+		return strings.Replace(strings.TrimSpace(s), "\n", "\n"+strings.Repeat(" ", 15), -1)
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// describeAudience describes an audience of the "/username/environment/name"
+// form kontrol issues tokens for as the kites it grants access to.
+func describeAudience(aud string) (string, bool) {
+	if !strings.HasPrefix(aud, "/") {
+		return "", false
+	}
+
+	fields := strings.Split(strings.TrimPrefix(aud, "/"), "/")
+	names := []string{"username", "environment", "name", "version", "region", "hostname", "id"}
+	if len(fields) > len(names) {
+		return "", false
+	}
+
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = names[i] + "=" + f
+	}
+
+	return "kites with " + strings.Join(parts, " "), true
+}
@@ -1,23 +1,30 @@
 package command
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
 	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
 	"github.com/mitchellh/cli"
 )
 
 type Uninstall struct {
-	Ui cli.Ui
+	KiteClient *kite.Kite
+	Ui         cli.Ui
 }
 
 func NewUninstall() cli.CommandFactory {
 	return func() (cli.Command, error) {
 		return &Uninstall{
-			Ui: DefaultUi,
+			KiteClient: DefaultKiteClient,
+			Ui:         DefaultUi,
 		}, nil
 	}
 }
@@ -28,20 +35,34 @@ func (c *Uninstall) Synopsis() string {
 
 func (c *Uninstall) Help() string {
 	helpText := `
-Usage: kitectl uninstall kitename
+Usage: kitectl uninstall [options] kitename
 
   Uninstall the given kite. Example kitename: github.com/koding/fs.kite/1.0.0
+
+  A supervised kite of this version is stopped and registrations of the kite
+  on this host are removed from Kontrol. Once no other version of the kite
+  is installed, its service, logs, supervisor status and data directory are
+  removed as well.
+
+Options:
+
+  -keep-data    Keep the data directory of the kite.
 `
 	return strings.TrimSpace(helpText)
 }
 
 func (c *Uninstall) Run(args []string) int {
+	var keepData bool
 
-	if len(args) != 1 {
+	flags := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	flags.BoolVar(&keepData, "keep-data", false, "")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
 		c.Ui.Output(c.Help())
 		return 1
 	}
-	fullName := args[0]
+	fullName := flags.Arg(0)
 
 	installed, err := isInstalled(fullName)
 	if err != nil {
@@ -49,8 +70,26 @@ func (c *Uninstall) Run(args []string) int {
 		return 1
 	}
 
+	// Short names given to run are accepted as well.
 	if !installed {
-		c.Ui.Error(fmt.Sprintf("%s is not installed", fullName))
+		ik, err := findInstalledKite(fullName)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("%s is not installed", fullName))
+			return 1
+		}
+		fullName = ik.String()
+	}
+
+	parts := strings.Split(fullName, "/")
+	if len(parts) != 4 {
+		c.Ui.Error(fmt.Sprintf("invalid kite name %q, expected domain/user/repo/version", fullName))
+		return 1
+	}
+	ik := NewInstalledKite(parts[0], parts[1], parts[2], parts[3])
+	name := ik.Name()
+
+	if err := c.stopSupervised(ik); err != nil {
+		c.Ui.Error(err.Error())
 		return 1
 	}
 
@@ -65,10 +104,171 @@ func (c *Uninstall) Run(args []string) int {
 		c.Ui.Error(err.Error())
 		return 1
 	}
+	removeEmptyParents(bundlePath, 3)
+
+	c.Ui.Info(fmt.Sprintf("Removed %s", fullName))
+
+	// Services, logs and data belong to the kite name, keep them while
+	// another version can still use them.
+	if others, err := getInstalledKites(name); err == nil {
+		for _, other := range others {
+			if other.Name() == name {
+				c.Ui.Info(fmt.Sprintf("%s is still installed, keeping its service, logs and data", other))
+				return 0
+			}
+		}
+	}
+
+	if m, err := newServiceManager(); err == nil {
+		if path, err := m.Path(name); err == nil {
+			if ok, _ := exists(path); ok {
+				if err := m.Uninstall(name); err != nil {
+					c.Ui.Error(err.Error())
+					return 1
+				}
+				c.Ui.Info(fmt.Sprintf("Removed service %s", path))
+			}
+		}
+	}
+
+	// The kite is no longer running, so what is left in Kontrol are stale
+	// registrations that would otherwise linger until they expire.
+	if err := c.unregister(name); err != nil {
+		c.Ui.Warn(fmt.Sprintf("Cannot remove registrations from Kontrol: %s", err))
+	}
+
+	logDir, err := kiteLogDir(name)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	statusPath, err := kiteStatusPath(name)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	dataDir, err := kiteDataDir(name)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	lockPath, err := kiteLockPath(name)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	paths := []string{logDir, statusPath, lockPath}
+	if !keepData {
+		paths = append(paths, dataDir)
+	}
+
+	for _, path := range paths {
+		if ok, _ := exists(path); !ok {
+			continue
+		}
+
+		if err := os.RemoveAll(path); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+
+		c.Ui.Info(fmt.Sprintf("Removed %s", path))
+	}
 
 	return 0
 }
 
+// stopSupervised stops the supervisor of the kite if it is running this
+// version of the kite.
+func (c *Uninstall) stopSupervised(ik *InstalledKite) error {
+	statusPath, err := kiteStatusPath(ik.Name())
+	if err != nil {
+		return err
+	}
+
+	// Alive checks the lock of the supervisor, so a stale pid of a status
+	// left behind is not signalled.
+	status, err := readKiteStatus(statusPath)
+	if err != nil || !status.Alive() || status.Kite != ik.String() {
+		return nil
+	}
+
+	c.Ui.Info(fmt.Sprintf("Stopping supervisor of %s (pid %d)", ik, status.PID))
+
+	if err := stopSupervisor(status); err != nil {
+		return err
+	}
+
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+		if !status.Alive() {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return fmt.Errorf("supervisor of %s (pid %d) did not stop", ik, status.PID)
+}
+
+// unregister removes registrations of the named kite of this user on this
+// host from Kontrol.
+func (c *Uninstall) unregister(name string) error {
+	if _, err := kitekey.Read(); err != nil {
+		// Not registered to a Kontrol, nothing to clean up.
+		return nil
+	}
+
+	conf, err := config.Get()
+	if err != nil {
+		return err
+	}
+	c.KiteClient.Config = conf
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	clients, err := c.KiteClient.GetKites(&protocol.KontrolQuery{
+		Username: conf.Username,
+		Name:     name,
+		Hostname: hostname,
+	})
+	if err == kite.ErrNoKitesAvailable {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer kite.Close(clients)
+
+	for _, client := range clients {
+		_, err := c.KiteClient.TellKontrolWithTimeout("unregister", 4*time.Second, map[string]string{
+			"id": client.Kite.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		c.Ui.Info(fmt.Sprintf("Unregistered %s", &client.Kite))
+	}
+
+	return nil
+}
+
+// removeEmptyParents removes up to n empty parent directories of path.
+func removeEmptyParents(path string, n int) {
+	for i := 0; i < n; i++ {
+		path = filepath.Dir(path)
+		if os.Remove(path) != nil {
+			return
+		}
+	}
+}
+
 // getBundlePath returns the bundle path of a given kite.
 // Example: "adsf-1.2.3" -> "~/.kd/kites/asdf-1.2.3.kite"
 func getBundlePath(fullKiteName string) (string, error) {
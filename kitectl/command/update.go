@@ -0,0 +1,348 @@
+package command
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/mitchellh/cli"
+)
+
+// DefaultUpdateURL is the release manifest kitectl update checks. It can be
+// overridden with the KITECTL_UPDATE_URL environment variable.
+var DefaultUpdateURL = "https://kite-cli.s3.amazonaws.com/kitectl/latest.json"
+
+// UpdatePublicKey is the PEM encoded RSA public key releases are signed
+// with. It is meant to be set at build time with the -X linker flag.
+// Release binaries without a valid signature are rejected, so kitectl
+// builds without the key can not update.
+var UpdatePublicKey = ""
+
+// Release is the manifest published for every kitectl release.
+type Release struct {
+	Version string `json:"version"`
+
+	// Binaries are keyed by "GOOS_GOARCH", e.g. "linux_amd64".
+	Binaries map[string]*ReleaseBinary `json:"binaries"`
+}
+
+// ReleaseBinary describes the kitectl binary for a single platform.
+type ReleaseBinary struct {
+	// URL of the binary, relative to the manifest if not absolute.
+	URL string `json:"url"`
+
+	// SHA256 is the hex encoded SHA-256 checksum of the binary.
+	SHA256 string `json:"sha256"`
+
+	// Signature is the base64 encoded RSA PKCS #1 v1.5 signature of the
+	// SHA-256 hash of the release statement of the binary, which names the
+	// version, the platform and the checksum, see releaseStatement. So the
+	// version and the platform of the manifest can not be changed either.
+	Signature string `json:"signature,omitempty"`
+}
+
+type Update struct {
+	Ui cli.Ui
+}
+
+func NewUpdate() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Update{Ui: DefaultUi}, nil
+	}
+}
+
+func (c *Update) Synopsis() string {
+	return "Updates kitectl to the latest release"
+}
+
+func (c *Update) Help() string {
+	helpText := `
+Usage: kitectl update [options]
+
+  Downloads the latest kitectl release for this platform and replaces the
+  running executable with it. The download is verified against the
+  checksum and the signature published in the release manifest, so only
+  kitectl builds with a release key can update.
+
+Options:
+
+  -check        Only report whether an update is available.
+  -force        Install the latest release even if it is not newer.
+  -url=URL      URL of the release manifest.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Update) Run(args []string) int {
+	var check, force bool
+	var manifestURL string
+
+	defaultURL := DefaultUpdateURL
+	if u := os.Getenv("KITECTL_UPDATE_URL"); u != "" {
+		defaultURL = u
+	}
+
+	flags := flag.NewFlagSet("update", flag.ExitOnError)
+	flags.BoolVar(&check, "check", false, "")
+	flags.BoolVar(&force, "force", false, "")
+	flags.StringVar(&manifestURL, "url", defaultURL, "")
+	flags.Parse(args)
+
+	release, err := getRelease(manifestURL)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	newer, err := isNewerVersion(release.Version, AppVersion)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if !newer && !force {
+		c.Ui.Info(fmt.Sprintf("kitectl %s is the latest version", AppVersion))
+		return 0
+	}
+
+	if check {
+		c.Ui.Output(fmt.Sprintf("kitectl %s is available, current version is %s", release.Version, AppVersion))
+		return 0
+	}
+
+	if UpdatePublicKey == "" {
+		c.Ui.Error("kitectl was built without a release key and can not verify updates, install the release manually")
+		return 1
+	}
+
+	platform := runtime.GOOS + "_" + runtime.GOARCH
+	binary, ok := release.Binaries[platform]
+	if !ok {
+		c.Ui.Error(fmt.Sprintf("Release %s has no binary for %s", release.Version, platform))
+		return 1
+	}
+
+	binaryURL, err := resolveURL(manifestURL, binary.URL)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	c.Ui.Output(fmt.Sprintf("Downloading kitectl %s...", release.Version))
+
+	if err := replaceExecutable(exe, binaryURL, release, platform); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	c.Ui.Info(fmt.Sprintf("kitectl is updated to %s", release.Version))
+	return 0
+}
+
+func getRelease(manifestURL string) (*Release, error) {
+	res, err := http.Get(manifestURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("Unexpected response from server: %d", res.StatusCode)
+	}
+
+	var release Release
+	if err := json.NewDecoder(res.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("invalid release manifest: %s", err)
+	}
+
+	if release.Version == "" {
+		return nil, errors.New("invalid release manifest: no version")
+	}
+
+	return &release, nil
+}
+
+func isNewerVersion(latest, current string) (bool, error) {
+	l, err := version.NewVersion(latest)
+	if err != nil {
+		return false, fmt.Errorf("invalid release version %q: %s", latest, err)
+	}
+
+	c, err := version.NewVersion(current)
+	if err != nil {
+		return false, err
+	}
+
+	return l.GreaterThan(c), nil
+}
+
+func resolveURL(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return b.ResolveReference(r).String(), nil
+}
+
+// replaceExecutable downloads the binary next to exe, verifies it and
+// renames it over exe. The rename is atomic, so exe is either the old or
+// the new binary even if the update is interrupted.
+//
+// Windows does not allow replacing a running executable, but it allows
+// renaming it, so there the old binary is moved aside first and removed
+// by the next update.
+func replaceExecutable(exe, binaryURL string, release *Release, platform string) error {
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), ".kitectl-update-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+	defer tmp.Close()
+
+	res, err := http.Get(binaryURL)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("Unexpected response from server: %d", res.StatusCode)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), res.Body); err != nil {
+		return err
+	}
+
+	if err := verifyRelease(h.Sum(nil), release, platform); err != nil {
+		return err
+	}
+
+	if err := tmp.Chmod(fi.Mode()); err != nil {
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if runtime.GOOS != "windows" {
+		return os.Rename(tmp.Name(), exe)
+	}
+
+	old := exe + ".old"
+	os.Remove(old) // left by the previous update
+
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		os.Rename(old, exe)
+		return err
+	}
+
+	return nil
+}
+
+// releaseStatement returns the statement signed for the binary of a
+// release, binding its checksum to the version and the platform, so a
+// tampered manifest can not pass off an older release or the binary of
+// another platform as the one it lists.
+func releaseStatement(version, platform string, sum []byte) []byte {
+	return []byte(fmt.Sprintf("kitectl %s %s sha256:%x\n", version, platform, sum))
+}
+
+// verifyRelease verifies the downloaded binary of the release for the
+// platform, whose checksum is sum, against the manifest and its signature.
+func verifyRelease(sum []byte, release *Release, platform string) error {
+	binary, ok := release.Binaries[platform]
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s", release.Version, platform)
+	}
+
+	want, err := hex.DecodeString(binary.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return errors.New("invalid checksum in release manifest")
+	}
+
+	if !bytes.Equal(sum, want) {
+		return fmt.Errorf("checksum mismatch: got %x, want %x", sum, want)
+	}
+
+	if UpdatePublicKey == "" {
+		return errors.New("no release public key to verify the signature with")
+	}
+
+	if binary.Signature == "" {
+		return errors.New("release binary is not signed")
+	}
+
+	block, _ := pem.Decode([]byte(UpdatePublicKey))
+	if block == nil {
+		return errors.New("invalid release public key")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("release public key is not an RSA key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(binary.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %s", err)
+	}
+
+	statement := sha256.Sum256(releaseStatement(release.Version, platform, sum))
+
+	if err := rsa.VerifyPKCS1v15(rsaPub, crypto.SHA256, statement[:], sig); err != nil {
+		return fmt.Errorf("invalid signature: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package command
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"testing"
+)
+
+// withUpdateKey makes kitectl update verify releases with a new key, until
+// the returned function is called. It returns the function signing the
+// release statement of a binary with the key.
+func withUpdateKey(t *testing.T) (sign func(version, platform string, sum []byte) string, restore func()) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig := UpdatePublicKey
+	UpdatePublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	sign = func(version, platform string, sum []byte) string {
+		statement := sha256.Sum256(releaseStatement(version, platform, sum))
+
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, statement[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+
+	return sign, func() { UpdatePublicKey = orig }
+}
+
+func TestVerifyRelease(t *testing.T) {
+	sign, restore := withUpdateKey(t)
+	defer restore()
+
+	oldSum := sha256.Sum256([]byte("kitectl 0.1.0"))
+	newSum := sha256.Sum256([]byte("kitectl 0.2.0"))
+
+	binary := func(sum [32]byte, sig string) *ReleaseBinary {
+		return &ReleaseBinary{
+			URL:       "kitectl",
+			SHA256:    hex.EncodeToString(sum[:]),
+			Signature: sig,
+		}
+	}
+
+	cases := []struct {
+		name    string
+		release *Release
+		sum     [32]byte
+		ok      bool
+	}{{
+		name: "valid",
+		release: &Release{Version: "0.2.0", Binaries: map[string]*ReleaseBinary{
+			"linux_amd64": binary(newSum, sign("0.2.0", "linux_amd64", newSum[:])),
+		}},
+		sum: newSum,
+		ok:  true,
+	}, {
+		// An older signed binary is passed off as the latest release.
+		name: "downgrade",
+		release: &Release{Version: "0.2.0", Binaries: map[string]*ReleaseBinary{
+			"linux_amd64": binary(oldSum, sign("0.1.0", "linux_amd64", oldSum[:])),
+		}},
+		sum: oldSum,
+	}, {
+		// The binary of another platform is listed for this one.
+		name: "other platform",
+		release: &Release{Version: "0.2.0", Binaries: map[string]*ReleaseBinary{
+			"linux_amd64": binary(newSum, sign("0.2.0", "darwin_amd64", newSum[:])),
+		}},
+		sum: newSum,
+	}, {
+		name: "checksum mismatch",
+		release: &Release{Version: "0.2.0", Binaries: map[string]*ReleaseBinary{
+			"linux_amd64": binary(newSum, sign("0.2.0", "linux_amd64", newSum[:])),
+		}},
+		sum: oldSum,
+	}, {
+		name: "unsigned",
+		release: &Release{Version: "0.2.0", Binaries: map[string]*ReleaseBinary{
+			"linux_amd64": binary(newSum, ""),
+		}},
+		sum: newSum,
+	}, {
+		name: "no binary",
+		release: &Release{Version: "0.2.0", Binaries: map[string]*ReleaseBinary{
+			"darwin_amd64": binary(newSum, sign("0.2.0", "darwin_amd64", newSum[:])),
+		}},
+		sum: newSum,
+	}}
+
+	for _, cas := range cases {
+		t.Run(cas.name, func(t *testing.T) {
+			err := verifyRelease(cas.sum[:], cas.release, "linux_amd64")
+			if cas.ok && err != nil {
+				t.Fatalf("verifyRelease()=%s", err)
+			}
+			if !cas.ok && err == nil {
+				t.Fatal("expected verifyRelease to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/protocol"
+	"github.com/mitchellh/cli"
+)
+
+// Events printed by kitectl watch.
+const (
+	EventRegister   = "REGISTER"
+	EventDeregister = "DEREGISTER"
+	EventUpdate     = "UPDATE"
+)
+
+// WatchEvent is a change in the kites matching a watched query.
+type WatchEvent struct {
+	Time   time.Time     `json:"time"`
+	Action string        `json:"action"`
+	Kite   protocol.Kite `json:"kite"`
+	URL    string        `json:"url"`
+}
+
+type Watch struct {
+	KiteClient *kite.Kite
+	Ui         cli.Ui
+}
+
+func NewWatch() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Watch{
+			KiteClient: DefaultKiteClient,
+			Ui:         DefaultUi,
+		}, nil
+	}
+}
+
+func (c *Watch) Synopsis() string {
+	return "Prints kites registering to and leaving kontrol"
+}
+
+func (c *Watch) Help() string {
+	helpText := `
+Usage: kitectl watch [options]
+
+  Prints an event whenever a kite matching the query registers to Kontrol,
+  goes away or changes its URL. Kontrol has no watch stream, so it is
+  queried every -interval, and events are as timely as that.
+
+Options:
+
+  -username=koding      Username of the kite.
+  -environment=staging  Environment of the kite.
+  -name=naber           Name of the kite.
+  -version=0.0.1        Version of the kite, or a constraint like ">= 1.2, < 2".
+  -region=Asia          Region of the kite.
+  -hostname=caprica     Hostname of the kite.
+  -id=<UUID>            Unique ID of the kite.
+  -interval=5s          Time between queries.
+  -json                 Print events as JSON, one per line.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Watch) Run(args []string) int {
+	c.KiteClient.Config = config.MustGet()
+	c.KiteClient.Config.Transport = config.XHRPolling
+
+	var query protocol.KontrolQuery
+	var interval time.Duration
+	var jsonLines bool
+
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	queryFlags(flags, &query, c.KiteClient.Kite().Username)
+	flags.DurationVar(&interval, "interval", 5*time.Second, "")
+	flags.BoolVar(&jsonLines, "json", OutputFormat == OutputJSON, "")
+	flags.Parse(args)
+
+	var known map[string]queryResult // by kite ID
+
+	for {
+		current, err := c.poll(&query)
+		if err != nil {
+			c.Ui.Warn(err.Error())
+			time.Sleep(interval)
+			continue
+		}
+
+		// Kites which are there when watching starts are reported as
+		// registered, so the output alone tells the whole state.
+		for _, e := range diffKites(known, current, time.Now()) {
+			c.print(e, jsonLines)
+		}
+
+		known = current
+		time.Sleep(interval)
+	}
+}
+
+func (c *Watch) poll(query *protocol.KontrolQuery) (map[string]queryResult, error) {
+	clients, err := c.KiteClient.GetKites(query)
+	if err == kite.ErrNoKitesAvailable {
+		return map[string]queryResult{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer kite.Close(clients)
+
+	kites := make(map[string]queryResult, len(clients))
+	for _, client := range clients {
+		kites[client.Kite.ID] = queryResult{Kite: client.Kite, URL: client.URL}
+	}
+
+	return kites, nil
+}
+
+// diffKites returns the events which turn old into current.
+func diffKites(old, current map[string]queryResult, now time.Time) []*WatchEvent {
+	var events []*WatchEvent
+
+	for id, k := range current {
+		prev, ok := old[id]
+		switch {
+		case !ok:
+			events = append(events, &WatchEvent{Time: now, Action: EventRegister, Kite: k.Kite, URL: k.URL})
+		case prev.URL != k.URL || prev.Kite != k.Kite:
+			events = append(events, &WatchEvent{Time: now, Action: EventUpdate, Kite: k.Kite, URL: k.URL})
+		}
+	}
+
+	for id, k := range old {
+		if _, ok := current[id]; !ok {
+			events = append(events, &WatchEvent{Time: now, Action: EventDeregister, Kite: k.Kite, URL: k.URL})
+		}
+	}
+
+	sort.Sort(watchEvents(events))
+	return events
+}
+
+type watchEvents []*WatchEvent
+
+func (e watchEvents) Len() int           { return len(e) }
+func (e watchEvents) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e watchEvents) Less(i, j int) bool { return e[i].Kite.String() < e[j].Kite.String() }
+
+func (c *Watch) print(e *WatchEvent, jsonLines bool) {
+	if jsonLines {
+		p, err := json.Marshal(e)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return
+		}
+
+		c.Ui.Output(string(p))
+		return
+	}
+
+	c.Ui.Output(fmt.Sprintf("%s\t%-10s\t%s\t%s", e.Time.Format(logTimeLayout), e.Action, e.Kite.String(), e.URL))
+}
@@ -11,22 +11,67 @@ import (
 )
 
 func main() {
+	args, err := command.ParseGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing flags: %s\n", err.Error())
+		os.Exit(1)
+	}
+
 	c := cli.NewCLI(command.AppName, command.AppVersion)
-	c.Args = os.Args[1:]
-	c.Commands = map[string]cli.CommandFactory{
-		"showkey":   command.NewShowkey(),
-		"register":  command.NewRegister(),
-		"query":     command.NewQuery(),
-		"run":       command.NewRun(),
-		"tell":      command.NewTell(),
-		"uninstall": command.NewUninstall(),
-		"list":      command.NewList(),
-		"install":   command.NewInstall(),
+	c.Args = args
+	commands := map[string]cli.CommandFactory{
+		"showkey":           command.NewShowkey(),
+		"encryptkey":        command.NewEncryptkey(),
+		"register":          command.NewRegister(),
+		"query":             command.NewQuery(),
+		"run":               command.NewRun(),
+		"tell":              command.NewTell(),
+		"uninstall":         command.NewUninstall(),
+		"list":              command.NewList(),
+		"install":           command.NewInstall(),
+		"build":             command.NewBuild(),
+		"status":            command.NewStatus(),
+		"logs":              command.NewLogs(),
+		"env":               command.NewEnv(),
+		"env list":          command.NewEnvList(),
+		"env show":          command.NewEnvShow(),
+		"env add":           command.NewEnvAdd(),
+		"env use":           command.NewEnvUse(),
+		"config":            command.NewConfig(),
+		"config get":        command.NewConfigGet(),
+		"config set":        command.NewConfigSet(),
+		"config unset":      command.NewConfigUnset(),
+		"env remove":        command.NewEnvRemove(),
+		"completion":        command.NewCompletion(),
+		"update":            command.NewUpdate(),
+		"doctor":            command.NewDoctor(),
+		"keygen":            command.NewKeygen(),
+		"ping":              command.NewPing(),
+		"bench":             command.NewBench(),
+		"capture":           command.NewCapture(),
+		"tail":              command.NewTail(),
+		"proxy":             command.NewProxy(),
+		"exec":              command.NewExec(),
+		"watch":             command.NewWatch(),
+		"token":             command.NewToken(),
+		"token inspect":     command.NewTokenInspect(),
+		"service":           command.NewService(),
+		"service install":   command.NewServiceInstall(),
+		"service uninstall": command.NewServiceUninstall(),
+		"service start":     command.NewServiceStart(),
+		"service stop":      command.NewServiceStop(),
+		"service status":    command.NewServiceStatus(),
 	}
+	commands[command.CompleteCommandName] = command.NewComplete(commands)
 
-	_, err := c.Run()
+	c.Commands = commands
+	c.HiddenCommands = []string{command.CompleteCommandName}
+
+	exitStatus, err := c.Run()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error executing CLI: %s\n", err.Error())
-		return
+		os.Exit(1)
 	}
+
+	os.Exit(exitStatus)
 }
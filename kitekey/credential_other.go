@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package kitekey
+
+// Read implements the KiteKeyStore interface.
+func (s *CredentialManagerStore) Read() (string, error) {
+	return "", errStoreUnavailable
+}
+
+// Write implements the KiteKeyStore interface.
+func (s *CredentialManagerStore) Write(kiteKey string) error {
+	return errStoreUnavailable
+}
+
+// Delete implements the KiteKeyStore interface.
+func (s *CredentialManagerStore) Delete() error {
+	return errStoreUnavailable
+}
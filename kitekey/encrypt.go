@@ -0,0 +1,288 @@
+package kitekey
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// PassphraseKeySource is the source of the key of kite.keys encrypted with a
+// passphrase. The other sources are the names of the OS secret stores of
+// NewKiteKeyStore, which keep a random key bound to the machine and user.
+const PassphraseKeySource = "passphrase"
+
+const (
+	encryptedBlockType = "ENCRYPTED KITE KEY"
+
+	// encryptionKeyService is the service the keys of encrypted kite.keys
+	// are stored under in the secret stores of the OS.
+	encryptionKeyService = "kite.key-encryption"
+
+	// Parameters of scrypt recommended for interactive logins.
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Passphrase returns the passphrase of an encrypted kite.key. It is called
+// with confirm set when the kite.key is encrypted, so a prompt can ask for
+// the passphrase twice.
+//
+// By default the passphrase is read from the KITE_KEY_PASSPHRASE
+// environment variable, the file given by KITE_KEY_PASSPHRASE_FILE or, if
+// stdin is a terminal, prompted for.
+var Passphrase = func(confirm bool) ([]byte, error) {
+	if p := os.Getenv("KITE_KEY_PASSPHRASE"); p != "" {
+		return []byte(p), nil
+	}
+
+	if file := os.Getenv("KITE_KEY_PASSPHRASE_FILE"); file != "" {
+		p, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimRight(string(p), "\r\n")), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, errors.New("kite.key is encrypted, set KITE_KEY_PASSPHRASE or KITE_KEY_PASSPHRASE_FILE")
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase of kite.key: ")
+	p, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		again, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+
+		if string(again) != string(p) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+
+	if len(p) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+
+	return p, nil
+}
+
+// IsEncrypted reports whether data is an encrypted kite.key.
+func IsEncrypted(data string) bool {
+	return strings.HasPrefix(strings.TrimSpace(data), "-----BEGIN "+encryptedBlockType+"-----")
+}
+
+// Encrypt encrypts the kite.key with AES-256-GCM. The key is derived from
+// Passphrase with scrypt if source is PassphraseKeySource, otherwise it is
+// a random key kept in the OS secret store with the name source, e.g.
+// keychain or credential-manager, so the kite.key can only be decrypted by
+// the same user on the same machine. The key is created on first use and
+// reused afterwards, so kite.keys encrypted earlier, e.g. backups, can
+// still be decrypted.
+//
+// The result is PEM encoded and names the source, so Decrypt needs no
+// other arguments.
+func Encrypt(kiteKey, source string) (string, error) {
+	block := &pem.Block{
+		Type:    encryptedBlockType,
+		Headers: map[string]string{"Key-Source": source},
+	}
+
+	var key []byte
+
+	if source == PassphraseKeySource {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+
+		passphrase, err := Passphrase(true)
+		if err != nil {
+			return "", err
+		}
+
+		if key, err = deriveKey(passphrase, salt); err != nil {
+			return "", err
+		}
+
+		block.Headers["KDF"] = "scrypt"
+		block.Headers["Salt"] = base64.StdEncoding.EncodeToString(salt)
+	} else {
+		var err error
+		if key, err = storedKey(source); err != nil {
+			return "", err
+		}
+
+		block.Headers["Key-ID"] = keyID(key)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	block.Headers["Nonce"] = base64.StdEncoding.EncodeToString(nonce)
+	block.Bytes = gcm.Seal(nil, nonce, []byte(kiteKey), []byte(encryptedBlockType))
+
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// Decrypt decrypts a kite.key encrypted by Encrypt.
+func Decrypt(data string) (string, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(data)))
+	if block == nil || block.Type != encryptedBlockType {
+		return "", errors.New("kite.key is not encrypted")
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(block.Headers["Nonce"])
+	if err != nil {
+		return "", fmt.Errorf("invalid nonce of encrypted kite.key: %s", err)
+	}
+
+	var key []byte
+
+	switch source := block.Headers["Key-Source"]; source {
+	case PassphraseKeySource:
+		if kdf := block.Headers["KDF"]; kdf != "scrypt" {
+			return "", fmt.Errorf("unknown key derivation function %q", kdf)
+		}
+
+		salt, err := base64.StdEncoding.DecodeString(block.Headers["Salt"])
+		if err != nil {
+			return "", fmt.Errorf("invalid salt of encrypted kite.key: %s", err)
+		}
+
+		passphrase, err := Passphrase(false)
+		if err != nil {
+			return "", err
+		}
+
+		if key, err = deriveKey(passphrase, salt); err != nil {
+			return "", err
+		}
+	default:
+		store, err := encryptionKeyStore(source)
+		if err != nil {
+			return "", err
+		}
+
+		encoded, err := store.Read()
+		if err != nil {
+			return "", fmt.Errorf("reading encryption key: %s", err)
+		}
+
+		if key, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return "", fmt.Errorf("invalid encryption key: %s", err)
+		}
+
+		if id := block.Headers["Key-ID"]; id != "" && id != keyID(key) {
+			return "", fmt.Errorf("kite.key was encrypted with another key than the one in %s", source)
+		}
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return "", errors.New("invalid nonce of encrypted kite.key")
+	}
+
+	kiteKey, err := gcm.Open(nil, nonce, block.Bytes, []byte(encryptedBlockType))
+	if err != nil {
+		return "", errors.New("cannot decrypt kite.key: wrong key or corrupted data")
+	}
+
+	return string(kiteKey), nil
+}
+
+func deriveKey(passphrase, salt []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, 32)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(c)
+}
+
+// storedKey returns the key of the source kept in its secret store, creating
+// it if there is none yet.
+func storedKey(source string) ([]byte, error) {
+	store, err := encryptionKeyStore(source)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := store.Read()
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid encryption key in %s", source)
+		}
+		return key, nil
+	}
+
+	// Any other error must not replace a key which may be in use.
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading encryption key: %s", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	if err := store.Write(base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("storing encryption key: %s", err)
+	}
+
+	return key, nil
+}
+
+// keyID identifies a key in the header of encrypted kite.keys without
+// revealing it.
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// encryptionKeyStore returns the OS secret store keeping the keys of
+// kite.keys encrypted with the source. It is a variable for tests.
+var encryptionKeyStore = func(source string) (KiteKeyStore, error) {
+	switch source {
+	case KeychainStoreName, SecretServiceStoreName, CredentialManagerStoreName:
+		return newSecretStore(source, encryptionKeyService)
+	default:
+		return nil, fmt.Errorf("unknown kite.key encryption key source %q", source)
+	}
+}
@@ -0,0 +1,147 @@
+package kitekey
+
+import (
+	"encoding/pem"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testKiteKey = "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.test.signature"
+
+// memoryStore is a KiteKeyStore standing in for the secret stores of the OS.
+type memoryStore struct {
+	key    string
+	writes int
+}
+
+func (s *memoryStore) Read() (string, error) {
+	if s.key == "" {
+		return "", os.ErrNotExist
+	}
+	return s.key, nil
+}
+
+func (s *memoryStore) Write(key string) error {
+	s.key = key
+	s.writes++
+	return nil
+}
+
+func (s *memoryStore) Delete() error {
+	s.key = ""
+	return nil
+}
+
+// withPassphrase makes Passphrase return passphrase, until the returned
+// function is called.
+func withPassphrase(passphrase string) (restore func()) {
+	orig := Passphrase
+	Passphrase = func(bool) ([]byte, error) { return []byte(passphrase), nil }
+	return func() { Passphrase = orig }
+}
+
+// withKeyStore makes encrypted kite.keys keep their keys in store, until the
+// returned function is called.
+func withKeyStore(store KiteKeyStore) (restore func()) {
+	orig := encryptionKeyStore
+	encryptionKeyStore = func(string) (KiteKeyStore, error) { return store, nil }
+	return func() { encryptionKeyStore = orig }
+}
+
+func TestEncryptPassphrase(t *testing.T) {
+	defer withPassphrase("correct horse")()
+
+	data, err := Encrypt(testKiteKey, PassphraseKeySource)
+	if err != nil {
+		t.Fatalf("Encrypt()=%s", err)
+	}
+
+	if !IsEncrypted(data) || strings.Contains(data, testKiteKey) {
+		t.Fatalf("got %q, want an encrypted kite.key", data)
+	}
+
+	kiteKey, err := Decrypt(data)
+	if err != nil {
+		t.Fatalf("Decrypt()=%s", err)
+	}
+
+	if kiteKey != testKiteKey {
+		t.Fatalf("got %q, want %q", kiteKey, testKiteKey)
+	}
+
+	defer withPassphrase("wrong horse")()
+
+	if _, err := Decrypt(data); err == nil {
+		t.Fatal("expected Decrypt() to fail with a wrong passphrase")
+	}
+}
+
+func TestEncryptStoredKey(t *testing.T) {
+	store := &memoryStore{}
+	defer withKeyStore(store)()
+
+	first, err := Encrypt(testKiteKey, KeychainStoreName)
+	if err != nil {
+		t.Fatalf("Encrypt()=%s", err)
+	}
+
+	second, err := Encrypt(testKiteKey+"2", KeychainStoreName)
+	if err != nil {
+		t.Fatalf("Encrypt()=%s", err)
+	}
+
+	if store.writes != 1 {
+		t.Fatalf("got %d writes of the encryption key, want 1", store.writes)
+	}
+
+	// kite.keys encrypted earlier are still decrypted.
+	for data, want := range map[string]string{first: testKiteKey, second: testKiteKey + "2"} {
+		if kiteKey, err := Decrypt(data); err != nil || kiteKey != want {
+			t.Fatalf("Decrypt()=%q, %v, want %q", kiteKey, err, want)
+		}
+	}
+
+	// A replaced key is reported as such.
+	store.Delete()
+	if _, err := Encrypt(testKiteKey, KeychainStoreName); err != nil {
+		t.Fatalf("Encrypt()=%s", err)
+	}
+
+	if _, err := Decrypt(first); err == nil || !strings.Contains(err.Error(), "another key") {
+		t.Fatalf("Decrypt()=%v, want error about another key", err)
+	}
+}
+
+func TestDecryptCorrupted(t *testing.T) {
+	defer withPassphrase("correct horse")()
+
+	data, err := Encrypt(testKiteKey, PassphraseKeySource)
+	if err != nil {
+		t.Fatalf("Encrypt()=%s", err)
+	}
+
+	cases := map[string]func(*pem.Block){
+		"nonce":      func(b *pem.Block) { b.Headers["Nonce"] = "AAAA" },
+		"bad nonce":  func(b *pem.Block) { b.Headers["Nonce"] = "!" },
+		"salt":       func(b *pem.Block) { b.Headers["Salt"] = "AAAAAAAAAAAAAAAAAAAAAA==" },
+		"kdf":        func(b *pem.Block) { b.Headers["KDF"] = "pbkdf2" },
+		"key source": func(b *pem.Block) { b.Headers["Key-Source"] = "unknown" },
+		"ciphertext": func(b *pem.Block) { b.Bytes[0] ^= 0xff },
+	}
+
+	for name, corrupt := range cases {
+		t.Run(name, func(t *testing.T) {
+			block, _ := pem.Decode([]byte(data))
+			corrupt(block)
+
+			if _, err := Decrypt(string(pem.EncodeToMemory(block))); err == nil {
+				t.Fatal("expected Decrypt() to fail")
+			}
+		})
+	}
+
+	if _, err := Decrypt(testKiteKey); err == nil {
+		t.Fatal("expected Decrypt() to fail for a kite.key not encrypted")
+	}
+}
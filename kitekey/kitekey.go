@@ -2,14 +2,14 @@
 package kitekey
 
 import (
-	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -24,6 +24,179 @@ type KiteClaims struct {
 	jwt.StandardClaims
 	KontrolKey string `json:"kontrolKey,omitempty"`
 	KontrolURL string `json:"kontrolURL,omitempty"`
+
+	// Scope, if not empty, lists the methods the token may be used to
+	// call. An entry ending with "*" allows every method starting with
+	// the rest of it, e.g. "metrics.*".
+	Scope []string `json:"scope,omitempty"`
+
+	// Actor, if set, is the kite the token was delegated to, which calls
+	// kites on behalf of Subject with it. It is the "act" claim of
+	// RFC 8693.
+	Actor *Actor `json:"act,omitempty"`
+}
+
+// Actor is a kite acting on behalf of the subject of a delegated token. If
+// the actor got the token it delegated from another actor, its Actor is set
+// again, so the innermost actor made the first hop.
+type Actor struct {
+	Subject string `json:"sub"`            // username of the kite
+	Kite    string `json:"kite,omitempty"` // the kite, as protocol.Kite.String
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+// String returns the kites and usernames of the chain of actors, the last
+// hop first, e.g. "/bob/prod/api/1.0.0/... (bob) via /alice/prod/web/... (alice)".
+func (a *Actor) String() string {
+	var chain []string
+	for ; a != nil; a = a.Actor {
+		chain = append(chain, a.Kite+" ("+a.Subject+")")
+	}
+	return strings.Join(chain, " via ")
+}
+
+// AllowsMethod reports whether the scope of the claims allows calling the
+// method.
+func (c *KiteClaims) AllowsMethod(method string) bool {
+	if len(c.Scope) == 0 {
+		return true
+	}
+
+	for _, s := range c.Scope {
+		if strings.HasSuffix(s, "*") {
+			if strings.HasPrefix(method, strings.TrimSuffix(s, "*")) {
+				return true
+			}
+		} else if s == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidAt validates the time claims at now, as Valid does at the time given
+// by jwt.TimeFunc.
+func (c *KiteClaims) ValidAt(now time.Time) error {
+	vErr := &jwt.ValidationError{}
+	unix := now.Unix()
+
+	if !c.VerifyExpiresAt(unix, false) {
+		delta := time.Unix(unix, 0).Sub(time.Unix(c.ExpiresAt, 0))
+		vErr.Inner = fmt.Errorf("token is expired by %v", delta)
+		vErr.Errors |= jwt.ValidationErrorExpired
+	}
+
+	if !c.VerifyIssuedAt(unix, false) {
+		vErr.Inner = fmt.Errorf("Token used before issued")
+		vErr.Errors |= jwt.ValidationErrorIssuedAt
+	}
+
+	if !c.VerifyNotBefore(unix, false) {
+		vErr.Inner = fmt.Errorf("token is not valid yet")
+		vErr.Errors |= jwt.ValidationErrorNotValidYet
+	}
+
+	if vErr.Errors != 0 {
+		return vErr
+	}
+
+	return nil
+}
+
+// ParseAt parses and verifies the token as jwt.ParseWithClaims does, with
+// its time claims validated at now. Kites and kontrol parse tokens with the
+// time of their clock.
+func ParseAt(now time.Time, tokenString string, claims *KiteClaims, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
+	p := &jwt.Parser{SkipClaimsValidation: true}
+
+	token, err := p.ParseWithClaims(tokenString, claims, keyFunc)
+	if err != nil {
+		return token, err
+	}
+
+	if err := claims.ValidAt(now); err != nil {
+		token.Valid = false
+		return token, err
+	}
+
+	return token, nil
+}
+
+// ValidateScope returns an error if an entry of the scope is empty or has
+// a "*" anywhere but at its end.
+func ValidateScope(scope []string) error {
+	for _, s := range scope {
+		if s == "" || strings.Contains(strings.TrimSuffix(s, "*"), "*") {
+			return fmt.Errorf("invalid scope %q", s)
+		}
+	}
+	return nil
+}
+
+// IntersectScope returns the scope allowing the methods allowed by both
+// scopes. An empty scope allows every method, so the result is empty only
+// if both are, or if they allow no method in common, in which case it is
+// not nil.
+func IntersectScope(a, b []string) []string {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+
+	scope := []string{}
+	seen := make(map[string]bool)
+
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			scope = append(scope, s)
+		}
+	}
+
+	for _, x := range a {
+		px := strings.TrimSuffix(x, "*")
+
+		for _, y := range b {
+			py := strings.TrimSuffix(y, "*")
+
+			switch wx, wy := px != x, py != y; {
+			case !wx && !wy:
+				if x == y {
+					add(x)
+				}
+			case wy && strings.HasPrefix(px, py):
+				add(x) // x is within y
+			case wx && strings.HasPrefix(py, px):
+				add(y) // y is within x
+			}
+		}
+	}
+
+	return scope
+}
+
+// AllClaims returns all claims of the token, including the ones KiteClaims
+// has no field for, such as claims added by applications.
+func AllClaims(token *jwt.Token) (jwt.MapClaims, error) {
+	parts := strings.Split(token.Raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token contains an invalid number of segments")
+	}
+
+	payload, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(jwt.MapClaims)
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
 }
 
 // KiteHome returns the home path of Kite directory.
@@ -40,7 +213,13 @@ func KiteHome() (string, error) {
 	return filepath.Join(usr.HomeDir, kiteDirName), nil
 }
 
-func kiteKeyPath() (string, error) {
+// KiteKeyPath returns the path of the kite.key file, which is in KiteHome.
+// The returned value can be overridden by setting KITE_KEY_FILE environment
+// variable.
+func KiteKeyPath() (string, error) {
+	if keyFile := os.Getenv("KITE_KEY_FILE"); keyFile != "" {
+		return keyFile, nil
+	}
 	kiteHome, err := KiteHome()
 	if err != nil {
 		return "", err
@@ -48,36 +227,24 @@ func kiteKeyPath() (string, error) {
 	return filepath.Join(kiteHome, kiteKeyFileName), nil
 }
 
-// Read the contents of the kite.key file.
+// Read the contents of the kite.key file from the store given by the
+// KITE_KEY_STORE environment variable, see NewKiteKeyStore.
 func Read() (string, error) {
-	keyPath, err := kiteKeyPath()
+	store, err := DefaultKiteKeyStore()
 	if err != nil {
 		return "", err
 	}
-	data, err := ioutil.ReadFile(keyPath)
-	if err != nil {
-		return "", err
-	}
-	return strings.TrimSpace(string(data)), nil
+	return store.Read()
 }
 
-// Write over the kite.key file.
+// Write over the kite.key file in the store given by the KITE_KEY_STORE
+// environment variable, see NewKiteKeyStore.
 func Write(kiteKey string) error {
-	keyPath, err := kiteKeyPath()
-	if err != nil {
-		return err
-	}
-
-	err = os.MkdirAll(filepath.Dir(keyPath), 0700)
+	store, err := DefaultKiteKeyStore()
 	if err != nil {
 		return err
 	}
-
-	// Need to remove the previous key first because we can't write over
-	// when previous file's mode is 0400.
-	os.Remove(keyPath)
-
-	return ioutil.WriteFile(keyPath, []byte(kiteKey), 0400)
+	return store.Write(kiteKey)
 }
 
 // Parse the kite.key file and return it as JWT token.
@@ -90,30 +257,31 @@ func Parse() (*jwt.Token, error) {
 	return jwt.ParseWithClaims(kiteKey, &KiteClaims{}, GetKontrolKey)
 }
 
-// ParseFile reads the given kite key file and parses it as a JWT token.
+// ParseFile reads the given kite key file, decrypting it if it is encrypted,
+// and parses it as a JWT token.
 func ParseFile(file string) (*jwt.Token, error) {
-	kiteKey, err := ioutil.ReadFile(file)
+	kiteKey, err := (&FileStore{Path: file}).Read()
 	if err != nil {
 		return nil, err
 	}
 
-	return jwt.ParseWithClaims(string(bytes.TrimSpace(kiteKey)), &KiteClaims{}, GetKontrolKey)
+	return jwt.ParseWithClaims(kiteKey, &KiteClaims{}, GetKontrolKey)
 }
 
 // Extractor is used to extract kontrol key from JWT token.
 type Extractor struct {
 	Token  *jwt.Token
 	Claims *KiteClaims
+
+	// Algorithms, if set, restricts the signing algorithms accepted from
+	// the issuer of the token, see CheckSigningMethod.
+	Algorithms Algorithms
 }
 
 // Extract is a keyFunc argument for jwt.Parse function.
 func (e *Extractor) Extract(token *jwt.Token) (interface{}, error) {
 	e.Token = token
 
-	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-		return nil, errors.New("invalid signing method")
-	}
-
 	claims, ok := token.Claims.(*KiteClaims)
 	if !ok {
 		return nil, fmt.Errorf("no kontrol key found")
@@ -121,7 +289,16 @@ func (e *Extractor) Extract(token *jwt.Token) (interface{}, error) {
 
 	e.Claims = claims
 
-	return jwt.ParseRSAPublicKeyFromPEM([]byte(claims.KontrolKey))
+	key, err := ParsePublicKey([]byte(claims.KontrolKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckSigningMethod(token, key, e.Algorithms.For(claims.Issuer)); err != nil {
+		return nil, err
+	}
+
+	return key, nil
 }
 
 // GetKontrolKey is used as key getter func for jwt.Parse() function.
@@ -0,0 +1,144 @@
+package kitekey
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/koding/kite/vault"
+)
+
+// KeyProvider gives signers for private keys kept outside of the process,
+// e.g. in an HSM, a TPM or a PKCS #11 token, so the private key is never
+// read. Providers are registered for the scheme of the URIs naming their
+// keys with RegisterKeyProvider.
+type KeyProvider interface {
+	// Signer returns the signer of the key named by the URI.
+	Signer(uri string) (crypto.Signer, error)
+}
+
+// KeyProviderFunc is a function implementing KeyProvider.
+type KeyProviderFunc func(uri string) (crypto.Signer, error)
+
+// Signer implements the KeyProvider interface.
+func (f KeyProviderFunc) Signer(uri string) (crypto.Signer, error) {
+	return f(uri)
+}
+
+var (
+	keyProvidersMu sync.RWMutex
+	keyProviders   = map[string]KeyProvider{
+		"file":  KeyProviderFunc(fileSigner),
+		"vault": KeyProviderFunc(vaultSigner),
+	}
+)
+
+// RegisterKeyProvider registers the provider of the keys named by URIs with
+// the scheme, replacing the provider registered before. Applications link
+// in the providers of their hardware, e.g. one for RFC 7512 URIs like
+// "pkcs11:token=kontrol;object=signing" built on a PKCS #11 library, or one
+// for "tpm:" URIs naming keys of a TPM.
+//
+// The file provider, for URIs like "file:/etc/kontrol/key.pem", reads a PEM
+// encoded key from a file. The vault provider, for URIs like
+// "vault:transit/kontrol", signs with a key of the transit engine of the
+// Vault configured by the VAULT_* environment variables, see
+// vault.Client.TransitSigner.
+func RegisterKeyProvider(scheme string, p KeyProvider) {
+	keyProvidersMu.Lock()
+	defer keyProvidersMu.Unlock()
+
+	keyProviders[scheme] = p
+}
+
+// IsKeyURI reports whether the private key is a URI naming a key of a key
+// provider rather than a PEM encoded key.
+func IsKeyURI(private string) bool {
+	private = strings.TrimSpace(private)
+	if strings.HasPrefix(private, "-----BEGIN ") {
+		return false
+	}
+
+	i := strings.Index(private, ":")
+	return i > 0 && !strings.ContainsAny(private[:i], " \t\r\n/")
+}
+
+// NewSigner returns the signer for the private key, which is either PEM
+// encoded, as accepted by ParsePrivateKey, or a URI whose scheme has a
+// registered KeyProvider.
+func NewSigner(private string) (crypto.Signer, error) {
+	if !IsKeyURI(private) {
+		key, err := ParsePrivateKey([]byte(private))
+		if err != nil {
+			return nil, err
+		}
+
+		return key.(crypto.Signer), nil
+	}
+
+	uri := strings.TrimSpace(private)
+	scheme := uri[:strings.Index(uri, ":")]
+
+	keyProvidersMu.RLock()
+	p, ok := keyProviders[scheme]
+	keyProvidersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no key provider registered for %q keys", scheme)
+	}
+
+	signer, err := p.Signer(uri)
+	if err != nil {
+		return nil, fmt.Errorf("%s key: %s", scheme, err)
+	}
+
+	return signer, nil
+}
+
+// MarshalPublicKey returns the PEM encoded PKIX form of the public key, e.g.
+// of a signer returned by NewSigner, as kite keys and kontrol take it.
+func MarshalPublicKey(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+func fileSigner(uri string) (crypto.Signer, error) {
+	path := strings.TrimPrefix(strings.TrimPrefix(uri, "file:"), "//")
+
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, err := ParsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return priv.(crypto.Signer), nil
+}
+
+func vaultSigner(uri string) (crypto.Signer, error) {
+	name := strings.TrimPrefix(uri, "vault:")
+
+	i := strings.LastIndex(name, "/")
+	if i == -1 {
+		return nil, errors.New(`URI is not of the "vault:<mount>/<key>" form`)
+	}
+
+	client, err := vault.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.TransitSigner(name[:i], name[i+1:])
+}
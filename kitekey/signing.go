@@ -0,0 +1,343 @@
+package kitekey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethodEdDSA signs and verifies tokens with Ed25519 keys, the EdDSA
+// algorithm of RFC 8037.
+var SigningMethodEdDSA jwt.SigningMethod = signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+type signingMethodEdDSA struct{}
+
+func (signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(pub, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+func (signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(priv, []byte(signingString))), nil
+}
+
+// SigningAlgorithms are the names of the algorithms kite keys and tokens may
+// be signed with.
+var SigningAlgorithms = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Algorithms maps issuers of kite keys and tokens to the signing algorithms
+// accepted from them. The algorithms of the empty issuer apply to issuers
+// which are not listed.
+type Algorithms map[string][]string
+
+// For returns the algorithms accepted from the issuer, or nil if any
+// algorithm fitting the key of the issuer is accepted.
+func (a Algorithms) For(issuer string) []string {
+	if algs, ok := a[issuer]; ok {
+		return algs
+	}
+	return a[""]
+}
+
+// Copy returns a deep copy of a.
+func (a Algorithms) Copy() Algorithms {
+	if a == nil {
+		return nil
+	}
+
+	copy := make(Algorithms, len(a))
+	for issuer, algs := range a {
+		copy[issuer] = append([]string(nil), algs...)
+	}
+	return copy
+}
+
+// ParseAlgorithm returns the name of a signing algorithm as used in the
+// header of tokens, e.g. ES256 for es256.
+func ParseAlgorithm(name string) (string, error) {
+	for _, alg := range SigningAlgorithms {
+		if strings.EqualFold(alg, name) {
+			return alg, nil
+		}
+	}
+	return "", fmt.Errorf("unknown signing algorithm %q", name)
+}
+
+// SigningMethod returns the signing method for the private key: RS256 for
+// RSA keys, ES256, ES384 or ES512 for ECDSA keys depending on their curve
+// and EdDSA for Ed25519 keys.
+func SigningMethod(key crypto.PrivateKey) (jwt.SigningMethod, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			return jwt.SigningMethodES256, nil
+		case 384:
+			return jwt.SigningMethodES384, nil
+		case 521:
+			return jwt.SigningMethodES512, nil
+		}
+		return nil, fmt.Errorf("unsupported ECDSA curve %s", key.Curve.Params().Name)
+	case ed25519.PrivateKey:
+		return SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// keyAlgorithms returns the algorithms tokens signed with the private key
+// of pub may use.
+func keyAlgorithms(pub crypto.PublicKey) []string {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return []string{"RS256", "RS384", "RS512"}
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().BitSize {
+		case 256:
+			return []string{"ES256"}
+		case 384:
+			return []string{"ES384"}
+		case 521:
+			return []string{"ES512"}
+		}
+	case ed25519.PublicKey:
+		return []string{"EdDSA"}
+	}
+	return nil
+}
+
+// CheckSigningMethod returns an error unless the token is signed with an
+// algorithm which fits the key it is verified with and which is one of
+// allowed. If allowed is empty, any algorithm fitting the key is accepted.
+//
+// Checking the algorithm against the key prevents tokens from choosing an
+// algorithm the key was not meant for, e.g. HS256 with an RSA public key
+// as secret.
+func CheckSigningMethod(token *jwt.Token, key crypto.PublicKey, allowed []string) error {
+	alg := token.Method.Alg()
+
+	if !containsAlgorithm(keyAlgorithms(key), alg) {
+		return errors.New("invalid signing method")
+	}
+
+	if len(allowed) != 0 && !containsAlgorithm(allowed, alg) {
+		return fmt.Errorf("signing method %s is not allowed", alg)
+	}
+
+	return nil
+}
+
+func containsAlgorithm(algs []string, alg string) bool {
+	for _, a := range algs {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePublicKey parses a PEM encoded RSA, ECDSA or Ed25519 public key in
+// PKIX or PKCS #1 form, or the public key of a PEM encoded certificate.
+func ParsePublicKey(key []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		if rsaPub, e := x509.ParsePKCS1PublicKey(block.Bytes); e == nil {
+			pub, err = rsaPub, nil
+		} else if cert, e := x509.ParseCertificate(block.Bytes); e == nil {
+			pub, err = cert.PublicKey, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if keyAlgorithms(pub) == nil {
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	return pub, nil
+}
+
+// ParsePrivateKey parses a PEM encoded RSA, ECDSA or Ed25519 private key in
+// PKCS #1, SEC 1 or PKCS #8 form.
+func ParsePrivateKey(key []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	if priv, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return priv, nil
+	}
+
+	if priv, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return priv, nil
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("private key is not a PKCS #1, SEC 1 or PKCS #8 key")
+	}
+
+	if _, err := SigningMethod(priv); err != nil {
+		return nil, err
+	}
+
+	return priv, nil
+}
+
+// SignedString signs the claims with the PEM encoded private key, using the
+// signing method of the key. The private key may also be the URI of a key of
+// a KeyProvider, see NewSigner.
+func SignedString(claims jwt.Claims, privateKey string) (string, error) {
+	if IsKeyURI(privateKey) {
+		signer, err := NewSigner(privateKey)
+		if err != nil {
+			return "", err
+		}
+
+		return SignWith(claims, signer)
+	}
+
+	priv, err := ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return "", err
+	}
+
+	method, err := SigningMethod(priv)
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.NewWithClaims(method, claims).SignedString(priv)
+}
+
+// SignWith signs the claims with the signer, using the signing method for
+// its public key. The signer may keep its private key elsewhere, e.g. in
+// Vault.
+func SignWith(claims jwt.Claims, signer crypto.Signer) (string, error) {
+	method, err := SignerMethod(signer)
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.NewWithClaims(method, claims).SignedString(signer)
+}
+
+// SignerMethod returns the signing method for tokens signed by the signer,
+// as SigningMethod does for private keys. The method signs with the
+// crypto.Signer passed to its Sign method.
+func SignerMethod(signer crypto.Signer) (jwt.SigningMethod, error) {
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		return &signerMethod{SigningMethod: jwt.SigningMethodRS256, hash: crypto.SHA256}, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().BitSize {
+		case 256:
+			return &signerMethod{SigningMethod: jwt.SigningMethodES256, hash: crypto.SHA256, size: 32}, nil
+		case 384:
+			return &signerMethod{SigningMethod: jwt.SigningMethodES384, hash: crypto.SHA384, size: 48}, nil
+		case 521:
+			return &signerMethod{SigningMethod: jwt.SigningMethodES512, hash: crypto.SHA512, size: 66}, nil
+		}
+		return nil, fmt.Errorf("unsupported ECDSA curve %s", pub.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return &signerMethod{SigningMethod: SigningMethodEdDSA}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// signerMethod signs with a crypto.Signer and verifies with the embedded
+// method.
+type signerMethod struct {
+	jwt.SigningMethod
+	hash crypto.Hash // zero for Ed25519, which signs the message itself
+	size int         // of the integers of ECDSA signatures
+}
+
+func (m *signerMethod) Sign(signingString string, key interface{}) (string, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	msg := []byte(signingString)
+	if m.hash != 0 {
+		h := m.hash.New()
+		h.Write(msg)
+		msg = h.Sum(nil)
+	}
+
+	sig, err := signer.Sign(rand.Reader, msg, m.hash)
+	if err != nil {
+		return "", err
+	}
+
+	if m.size != 0 {
+		// JWS takes ECDSA signatures as the concatenated integers instead
+		// of their ASN.1 encoding crypto.Signer returns.
+		var esig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &esig); err != nil {
+			return "", err
+		}
+
+		r, s := esig.R.Bytes(), esig.S.Bytes()
+		if len(r) > m.size || len(s) > m.size {
+			return "", errors.New("ECDSA signature is larger than the curve size")
+		}
+
+		// Both integers are left-padded with zeros to the curve size.
+		sig = make([]byte, 2*m.size)
+		copy(sig[m.size-len(r):m.size], r)
+		copy(sig[2*m.size-len(s):], s)
+	}
+
+	return jwt.EncodeSegment(sig), nil
+}
@@ -0,0 +1,439 @@
+package kitekey
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/koding/kite/vault"
+)
+
+// KiteKeyStore stores the kite.key of the user.
+type KiteKeyStore interface {
+	// Read returns the stored kite.key. If there is none, the error
+	// satisfies os.IsNotExist.
+	Read() (string, error)
+
+	// Write replaces the stored kite.key.
+	Write(kiteKey string) error
+
+	// Delete removes the stored kite.key.
+	Delete() error
+}
+
+// Names of the stores accepted by NewKiteKeyStore.
+const (
+	FileStoreName              = "file"
+	KeychainStoreName          = "keychain"
+	SecretServiceStoreName     = "secret-service"
+	CredentialManagerStoreName = "credential-manager"
+	VaultStoreName             = "vault"
+)
+
+// keyStoreService is the service the kite.key is stored under in the
+// secret stores of the OS.
+const keyStoreService = "kite"
+
+// DefaultKiteKeyStore returns the store given by the KITE_KEY_STORE
+// environment variable, the kite.key file if it is not set.
+func DefaultKiteKeyStore() (KiteKeyStore, error) {
+	return NewKiteKeyStore(os.Getenv("KITE_KEY_STORE"))
+}
+
+// NewKiteKeyStore returns the store with the given name:
+//
+//	file                 the kite.key file at KiteKeyPath, the default
+//	keychain             the macOS Keychain
+//	secret-service       the Secret Service of Linux desktops, like GNOME
+//	                     Keyring or KWallet, through secret-tool
+//	credential-manager   the Windows Credential Manager
+//	vault                the secret of HashiCorp Vault at the path given by
+//	                     the KITE_VAULT_PATH environment variable
+//
+// Secret stores keep the kite.key under the "kite" service, with the path of
+// KiteHome as account, so every kite home has its own kite.key.
+func NewKiteKeyStore(name string) (KiteKeyStore, error) {
+	if name == "" || name == FileStoreName {
+		return &FileStore{}, nil
+	}
+
+	if name == VaultStoreName {
+		path := os.Getenv("KITE_VAULT_PATH")
+		if path == "" {
+			return nil, errors.New("KITE_VAULT_PATH is not set")
+		}
+		return &VaultStore{Path: path}, nil
+	}
+
+	return newSecretStore(name, keyStoreService)
+}
+
+// newSecretStore returns the OS secret store with the given name, keeping a
+// secret under the service for the current kite home.
+func newSecretStore(name, service string) (KiteKeyStore, error) {
+	account, err := KiteHome()
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case KeychainStoreName:
+		return &KeychainStore{Service: service, Account: account}, nil
+	case SecretServiceStoreName:
+		return &SecretServiceStore{Service: service, Account: account}, nil
+	case CredentialManagerStoreName:
+		return &CredentialManagerStore{Target: service + ":" + account}, nil
+	default:
+		return nil, fmt.Errorf("unknown kite.key store %q", name)
+	}
+}
+
+// FileStore stores the kite.key in a file readable only by the user.
+//
+// Encrypted kite.keys are decrypted when read, see Decrypt. If Encryption
+// is set, or otherwise the KITE_KEY_ENCRYPTION environment variable, the
+// kite.key is encrypted with the key of that source when written, see
+// Encrypt.
+type FileStore struct {
+	// Path of the file, KiteKeyPath if empty.
+	Path string
+
+	// Encryption is the key source to encrypt the kite.key with, e.g.
+	// passphrase or keychain.
+	Encryption string
+}
+
+var _ KiteKeyStore = (*FileStore)(nil)
+
+func (s *FileStore) path() (string, error) {
+	if s.Path != "" {
+		return s.Path, nil
+	}
+	return KiteKeyPath()
+}
+
+// Read implements the KiteKeyStore interface.
+func (s *FileStore) Read() (string, error) {
+	keyPath, err := s.path()
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return "", err
+	}
+
+	key := string(data)
+	if IsEncrypted(key) {
+		if key, err = Decrypt(key); err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimSpace(key), nil
+}
+
+// Write implements the KiteKeyStore interface.
+func (s *FileStore) Write(kiteKey string) error {
+	keyPath, err := s.path()
+	if err != nil {
+		return err
+	}
+
+	encryption := s.Encryption
+	if encryption == "" {
+		encryption = os.Getenv("KITE_KEY_ENCRYPTION")
+	}
+
+	if encryption != "" {
+		if kiteKey, err = Encrypt(kiteKey, encryption); err != nil {
+			return err
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(keyPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(keyPath, []byte(kiteKey), 0400)
+}
+
+// writeFileAtomic replaces the file with data by renaming a temporary file
+// over it, so the previous file is kept if writing fails.
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+
+		// Read-only files can not be replaced on Windows.
+		if err != nil && os.Chmod(file, 0600) == nil {
+			err = os.Rename(f.Name(), file)
+		}
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+// Delete implements the KiteKeyStore interface.
+func (s *FileStore) Delete() error {
+	keyPath, err := s.path()
+	if err != nil {
+		return err
+	}
+	return os.Remove(keyPath)
+}
+
+// KeychainStore stores the kite.key as a generic password in the macOS
+// Keychain, using the security command.
+type KeychainStore struct {
+	Service string
+	Account string
+}
+
+var _ KiteKeyStore = (*KeychainStore)(nil)
+
+// Read implements the KiteKeyStore interface.
+func (s *KeychainStore) Read() (string, error) {
+	out, err := runStoreCommand(nil, "security", "find-generic-password", "-s", s.Service, "-a", s.Account, "-w")
+	if err != nil {
+		// Exit status 44 is errSecItemNotFound.
+		if exitStatus(err) == 44 {
+			return "", os.ErrNotExist
+		}
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Write implements the KiteKeyStore interface.
+func (s *KeychainStore) Write(kiteKey string) error {
+	// The commands are passed on stdin so the key does not show up in the
+	// process list.
+	cmd := fmt.Sprintf("add-generic-password -U -s %s -a %s -l %s -w %s\n",
+		quoteSecurityArg(s.Service), quoteSecurityArg(s.Account),
+		quoteSecurityArg("kite.key"), quoteSecurityArg(kiteKey))
+
+	_, err := runStoreCommand(strings.NewReader(cmd), "security", "-i")
+	return err
+}
+
+// Delete implements the KiteKeyStore interface.
+func (s *KeychainStore) Delete() error {
+	_, err := runStoreCommand(nil, "security", "delete-generic-password", "-s", s.Service, "-a", s.Account)
+	if exitStatus(err) == 44 {
+		return os.ErrNotExist
+	}
+	return err
+}
+
+// quoteSecurityArg quotes an argument of a command of security -i.
+func quoteSecurityArg(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// SecretServiceStore stores the kite.key in the Secret Service of the
+// desktop session, using the secret-tool command of libsecret.
+type SecretServiceStore struct {
+	Service string
+	Account string
+}
+
+var _ KiteKeyStore = (*SecretServiceStore)(nil)
+
+func (s *SecretServiceStore) attributes() []string {
+	return []string{"service", s.Service, "account", s.Account}
+}
+
+// Read implements the KiteKeyStore interface.
+func (s *SecretServiceStore) Read() (string, error) {
+	out, err := runStoreCommand(nil, "secret-tool", append([]string{"lookup"}, s.attributes()...)...)
+	if err != nil {
+		// secret-tool fails without output if nothing matches.
+		if exitStatus(err) == 1 && out == "" {
+			return "", os.ErrNotExist
+		}
+		return "", err
+	}
+
+	key := strings.TrimSpace(out)
+	if key == "" {
+		return "", os.ErrNotExist
+	}
+	return key, nil
+}
+
+// Write implements the KiteKeyStore interface.
+func (s *SecretServiceStore) Write(kiteKey string) error {
+	args := append([]string{"store", "--label=kite.key"}, s.attributes()...)
+	_, err := runStoreCommand(strings.NewReader(kiteKey), "secret-tool", args...)
+	return err
+}
+
+// Delete implements the KiteKeyStore interface.
+func (s *SecretServiceStore) Delete() error {
+	_, err := runStoreCommand(nil, "secret-tool", append([]string{"clear"}, s.attributes()...)...)
+	return err
+}
+
+// CredentialManagerStore stores the kite.key as a generic credential in the
+// Windows Credential Manager. It is not available on other systems.
+type CredentialManagerStore struct {
+	// Target is the name of the credential.
+	Target string
+}
+
+var _ KiteKeyStore = (*CredentialManagerStore)(nil)
+
+// VaultStore stores the kite.key in a secret of a KV secrets engine of
+// HashiCorp Vault, so it is fetched when the kite starts instead of being
+// kept on disk.
+type VaultStore struct {
+	// Client connects to Vault. If nil, a client configured by the VAULT_*
+	// environment variables is used, see vault.NewClient.
+	Client *vault.Client
+
+	// Path of the secret, e.g. secret/data/kite/<host> for a KV version 2
+	// engine mounted at secret.
+	Path string
+
+	// Field of the secret holding the kite.key, "kite.key" if empty.
+	Field string
+}
+
+var _ KiteKeyStore = (*VaultStore)(nil)
+
+func (s *VaultStore) client() (*vault.Client, error) {
+	if s.Client != nil {
+		return s.Client, nil
+	}
+	return vault.NewClient()
+}
+
+func (s *VaultStore) field() string {
+	if s.Field != "" {
+		return s.Field
+	}
+	return kiteKeyFileName
+}
+
+// Read implements the KiteKeyStore interface.
+func (s *VaultStore) Read() (string, error) {
+	c, err := s.client()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := c.ReadSecret(s.Path, s.field())
+	if err == vault.ErrNotFound {
+		return "", os.ErrNotExist
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(key), nil
+}
+
+// Write implements the KiteKeyStore interface.
+func (s *VaultStore) Write(kiteKey string) error {
+	c, err := s.client()
+	if err != nil {
+		return err
+	}
+	return c.WriteSecret(s.Path, s.field(), kiteKey)
+}
+
+// Delete implements the KiteKeyStore interface.
+func (s *VaultStore) Delete() error {
+	c, err := s.client()
+	if err != nil {
+		return err
+	}
+
+	err = c.DeleteSecret(s.Path)
+	if err == vault.ErrNotFound {
+		return os.ErrNotExist
+	}
+	return err
+}
+
+// errStoreUnavailable is returned by stores which are not supported on the
+// running system.
+var errStoreUnavailable = errors.New("kite.key store is not available on this system")
+
+// runStoreCommand runs the command of a secret store and returns its output.
+// It is a variable so tests can stand in for the commands.
+var runStoreCommand = execStoreCommand
+
+// execStoreCommand runs the command of a secret store and returns its
+// output. Errors include what the command printed to stderr.
+func execStoreCommand(stdin *strings.Reader, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), &storeError{cmd: name, msg: msg, err: err}
+		}
+		return stdout.String(), &storeError{cmd: name, err: err}
+	}
+
+	return stdout.String(), nil
+}
+
+// storeError is an error of a secret store command.
+type storeError struct {
+	cmd string
+	msg string
+	err error
+}
+
+func (e *storeError) Error() string {
+	if e.msg != "" {
+		return fmt.Sprintf("%s: %s", e.cmd, e.msg)
+	}
+	return fmt.Sprintf("%s: %s", e.cmd, e.err)
+}
+
+// exitStatus returns the exit status of a failed store command, or -1.
+func exitStatus(err error) int {
+	e, ok := err.(*storeError)
+	if !ok {
+		return -1
+	}
+
+	// Implemented by *exec.ExitError.
+	if exitErr, ok := e.err.(interface{ ExitCode() int }); ok {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
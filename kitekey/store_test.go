@@ -0,0 +1,325 @@
+package kitekey
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/koding/kite/vault"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kitekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &FileStore{Path: filepath.Join(dir, "home", "kite.key")}
+
+	if _, err := s.Read(); !os.IsNotExist(err) {
+		t.Fatalf("Read()=%v, want not exist error", err)
+	}
+
+	// The kite.key is read-only, writing it again replaces it.
+	for _, kiteKey := range []string{testKiteKey, testKiteKey + "2"} {
+		if err := s.Write(kiteKey); err != nil {
+			t.Fatalf("Write()=%s", err)
+		}
+
+		if got, err := s.Read(); err != nil || got != kiteKey {
+			t.Fatalf("Read()=%q, %v, want %q", got, err, kiteKey)
+		}
+	}
+
+	fi, err := os.Stat(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0400 {
+		t.Fatalf("got mode %s, want -r--------", fi.Mode().Perm())
+	}
+
+	// No temporary files are left behind.
+	if files, err := ioutil.ReadDir(filepath.Dir(s.Path)); err != nil || len(files) != 1 {
+		t.Fatalf("got %d files (%v), want only kite.key", len(files), err)
+	}
+
+	if err := s.Delete(); err != nil {
+		t.Fatalf("Delete()=%s", err)
+	}
+
+	if _, err := s.Read(); !os.IsNotExist(err) {
+		t.Fatalf("Read()=%v, want not exist error", err)
+	}
+}
+
+func TestFileStoreEncrypted(t *testing.T) {
+	defer withPassphrase("correct horse")()
+
+	dir, err := ioutil.TempDir("", "kitekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &FileStore{Path: filepath.Join(dir, "kite.key"), Encryption: PassphraseKeySource}
+
+	if err := s.Write(testKiteKey); err != nil {
+		t.Fatalf("Write()=%s", err)
+	}
+
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsEncrypted(string(data)) {
+		t.Fatalf("got %q, want an encrypted kite.key", data)
+	}
+
+	if got, err := s.Read(); err != nil || got != testKiteKey {
+		t.Fatalf("Read()=%q, %v, want %q", got, err, testKiteKey)
+	}
+}
+
+// exitCode is the error of a store command exiting with the code.
+type exitCode int
+
+func (e exitCode) Error() string { return "exit status" }
+func (e exitCode) ExitCode() int { return int(e) }
+
+// withStoreCommand makes the store commands run by fn instead, until the
+// returned function is called. fn is given the input of the command.
+func withStoreCommand(fn func(stdin, name string, args ...string) (string, error)) (restore func()) {
+	orig := runStoreCommand
+	runStoreCommand = func(stdin *strings.Reader, name string, args ...string) (string, error) {
+		var in string
+		if stdin != nil {
+			p, _ := ioutil.ReadAll(stdin)
+			in = string(p)
+		}
+		return fn(in, name, args...)
+	}
+	return func() { runStoreCommand = orig }
+}
+
+func TestKeychainStore(t *testing.T) {
+	const kiteKey = `key with "quotes" and \`
+
+	var stored string
+
+	defer withStoreCommand(func(stdin, name string, args ...string) (string, error) {
+		if name != "security" {
+			t.Fatalf("got command %q, want security", name)
+		}
+
+		switch strings.Join(args, " ") {
+		case "find-generic-password -s kite -a /home/kite -w":
+			if stored == "" {
+				return "", &storeError{cmd: name, err: exitCode(44)}
+			}
+			return stored + "\n", nil
+		case "-i":
+			want := `add-generic-password -U -s "kite" -a "/home/kite" -l "kite.key" -w "key with \"quotes\" and \\"` + "\n"
+			if stdin != want {
+				t.Fatalf("got input %q, want %q", stdin, want)
+			}
+			stored = kiteKey
+			return "", nil
+		case "delete-generic-password -s kite -a /home/kite":
+			if stored == "" {
+				return "", &storeError{cmd: name, err: exitCode(44)}
+			}
+			stored = ""
+			return "", nil
+		default:
+			t.Fatalf("unexpected arguments %q", args)
+			return "", nil
+		}
+	})()
+
+	s := &KeychainStore{Service: "kite", Account: "/home/kite"}
+
+	if _, err := s.Read(); !os.IsNotExist(err) {
+		t.Fatalf("Read()=%v, want not exist error", err)
+	}
+
+	if err := s.Write(kiteKey); err != nil {
+		t.Fatalf("Write()=%s", err)
+	}
+
+	if got, err := s.Read(); err != nil || got != kiteKey {
+		t.Fatalf("Read()=%q, %v, want %q", got, err, kiteKey)
+	}
+
+	if err := s.Delete(); err != nil {
+		t.Fatalf("Delete()=%s", err)
+	}
+
+	if err := s.Delete(); !os.IsNotExist(err) {
+		t.Fatalf("Delete()=%v, want not exist error", err)
+	}
+}
+
+func TestSecretServiceStore(t *testing.T) {
+	var stored string
+
+	defer withStoreCommand(func(stdin, name string, args ...string) (string, error) {
+		if name != "secret-tool" {
+			t.Fatalf("got command %q, want secret-tool", name)
+		}
+
+		switch strings.Join(args, " ") {
+		case "lookup service kite account /home/kite":
+			if stored == "" {
+				return "", &storeError{cmd: name, err: exitCode(1)}
+			}
+			return stored, nil
+		case "store --label=kite.key service kite account /home/kite":
+			stored = stdin
+			return "", nil
+		case "clear service kite account /home/kite":
+			stored = ""
+			return "", nil
+		default:
+			t.Fatalf("unexpected arguments %q", args)
+			return "", nil
+		}
+	})()
+
+	s := &SecretServiceStore{Service: "kite", Account: "/home/kite"}
+
+	if _, err := s.Read(); !os.IsNotExist(err) {
+		t.Fatalf("Read()=%v, want not exist error", err)
+	}
+
+	if err := s.Write(testKiteKey); err != nil {
+		t.Fatalf("Write()=%s", err)
+	}
+
+	// The kite.key is passed on stdin, not in the arguments.
+	if stored != testKiteKey {
+		t.Fatalf("got %q stored, want %q", stored, testKiteKey)
+	}
+
+	if got, err := s.Read(); err != nil || got != testKiteKey {
+		t.Fatalf("Read()=%q, %v, want %q", got, err, testKiteKey)
+	}
+
+	if err := s.Delete(); err != nil {
+		t.Fatalf("Delete()=%s", err)
+	}
+
+	if _, err := s.Read(); !os.IsNotExist(err) {
+		t.Fatalf("Read()=%v, want not exist error", err)
+	}
+}
+
+func TestStoreCommandError(t *testing.T) {
+	defer withStoreCommand(func(stdin, name string, args ...string) (string, error) {
+		return "", &storeError{cmd: name, msg: "no session bus", err: exitCode(2)}
+	})()
+
+	s := &SecretServiceStore{Service: "kite", Account: "/home/kite"}
+
+	_, err := s.Read()
+	if err == nil || os.IsNotExist(err) || err.Error() != "secret-tool: no session bus" {
+		t.Fatalf("Read()=%v, want the error of secret-tool", err)
+	}
+}
+
+// kvServer serves the secrets of a KV version 2 engine mounted at secret.
+type kvServer struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+}
+
+func (v *kvServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "s.test" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	switch r.Method {
+	case "GET":
+		data, ok := v.secrets[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": data},
+		})
+	case "POST":
+		var body struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		v.secrets[path] = body.Data
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		if _, ok := v.secrets[path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(v.secrets, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestVaultStore(t *testing.T) {
+	kv := &kvServer{secrets: make(map[string]map[string]interface{})}
+
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	s := &VaultStore{
+		Client: &vault.Client{Addr: srv.URL, Token: "s.test"},
+		Path:   "secret/data/kite/host",
+	}
+
+	if _, err := s.Read(); !os.IsNotExist(err) {
+		t.Fatalf("Read()=%v, want not exist error", err)
+	}
+
+	if err := s.Write(testKiteKey); err != nil {
+		t.Fatalf("Write()=%s", err)
+	}
+
+	if got := kv.secrets["secret/data/kite/host"]["kite.key"]; got != testKiteKey {
+		t.Fatalf("got %v stored, want %q", got, testKiteKey)
+	}
+
+	if got, err := s.Read(); err != nil || got != testKiteKey {
+		t.Fatalf("Read()=%q, %v, want %q", got, err, testKiteKey)
+	}
+
+	if err := s.Delete(); err != nil {
+		t.Fatalf("Delete()=%s", err)
+	}
+
+	if err := s.Delete(); !os.IsNotExist(err) {
+		t.Fatalf("Delete()=%v, want not exist error", err)
+	}
+
+	// Errors other than a missing secret are returned as they are.
+	s.Client.Token = "s.wrong"
+
+	if _, err := s.Read(); err == nil || os.IsNotExist(err) {
+		t.Fatalf("Read()=%v, want a permission error", err)
+	}
+}
@@ -0,0 +1,138 @@
+package kitetest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/igm/sockjs-go/sockjs"
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+// Connect returns a client of the local kite connected to the remote kite
+// over an in-memory pipe, without any listener, network or kontrol. Each
+// time the client dials, e.g. when it reconnects, a new pipe is served by
+// the remote kite.
+//
+// Requests of the client are authenticated by the remote kite as usual,
+// see FakeAuth for authenticating them without a kontrol. The client
+// trusts the remote kite, like clients dialing over the network do.
+func Connect(local, remote *kite.Kite) (*kite.Client, error) {
+	c := local.NewClient("memory://" + remote.Kite().ID)
+	c.Kite = *remote.Kite()
+	c.DialSession = func(string, *config.Config) (sockjs.Session, error) {
+		client, server := Pipe()
+		go remote.ServeSession(server)
+		return client, nil
+	}
+
+	if err := c.Dial(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// AuthType is the authentication type of the fake credentials returned by
+// Auth.
+const AuthType = "kitetest"
+
+// FakeAuth makes k accept the fake credentials returned by Auth, which
+// authenticate the user they name without any kite.key or kontrol. The
+// other authentication types keep working.
+//
+// FakeAuth is for tests only, any kite accepting fake credentials can be
+// called by everyone as anyone.
+func FakeAuth(k *kite.Kite) {
+	k.Authenticators[AuthType] = func(r *kite.Request) error {
+		if r.Auth.Key == "" {
+			return errors.New("no username given")
+		}
+
+		r.Username = r.Auth.Key
+		return nil
+	}
+}
+
+// Auth returns the fake credentials of the user, for the Auth field of
+// clients of kites set up with FakeAuth.
+func Auth(username string) *kite.Auth {
+	return &kite.Auth{
+		Type: AuthType,
+		Key:  username,
+	}
+}
+
+// Call is a call of a method recorded by a Recorder.
+type Call struct {
+	Method   string
+	Username string
+	Args     *dnode.Partial
+	Result   interface{}
+	Err      error
+}
+
+// Recorder records the calls of the methods of a kite, for asserting on
+// them in tests.
+type Recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Record returns a recorder of the calls of the methods of k. Calls are
+// recorded after their handlers return, with their result and error, so
+// they are recorded by the time the caller gets the response. Calls failing
+// authentication are not recorded.
+//
+// Record must be called before the first call of a method, as the kite
+// binds its final funcs to a method on its first call.
+func Record(k *kite.Kite) *Recorder {
+	rec := &Recorder{}
+
+	k.FinalFunc(func(r *kite.Request, resp interface{}, err error) (interface{}, error) {
+		rec.mu.Lock()
+		rec.calls = append(rec.calls, Call{
+			Method:   r.Method,
+			Username: r.Username,
+			Args:     r.Args,
+			Result:   resp,
+			Err:      err,
+		})
+		rec.mu.Unlock()
+
+		return resp, err
+	})
+
+	return rec
+}
+
+// Calls returns the recorded calls, in the order their handlers returned.
+func (rec *Recorder) Calls() []Call {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return append([]Call(nil), rec.calls...)
+}
+
+// CallsOf returns the recorded calls of the method.
+func (rec *Recorder) CallsOf(method string) []Call {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	var calls []Call
+	for _, call := range rec.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Reset forgets the recorded calls.
+func (rec *Recorder) Reset() {
+	rec.mu.Lock()
+	rec.calls = nil
+	rec.mu.Unlock()
+}
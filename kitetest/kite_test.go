@@ -0,0 +1,84 @@
+package kitetest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/kitetest"
+)
+
+func TestConnect(t *testing.T) {
+	srv := kite.New("server", "0.0.1")
+	kitetest.FakeAuth(srv)
+	rec := kitetest.Record(srv)
+
+	srv.HandleFunc("square", func(r *kite.Request) (interface{}, error) {
+		n := r.Args.One().MustFloat64()
+		return n * n, nil
+	})
+
+	c, err := kitetest.Connect(kite.New("client", "0.0.1"), srv)
+	if err != nil {
+		t.Fatalf("Connect()=%s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Tell("square", 2); err == nil || !strings.Contains(err.Error(), "No authentication") {
+		t.Fatalf("got %v, want authentication error", err)
+	}
+
+	c.Auth = kitetest.Auth("alice")
+
+	res, err := c.Tell("square", 3)
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if n := res.MustFloat64(); n != 9 {
+		t.Fatalf("got %v, want 9", n)
+	}
+
+	calls := rec.CallsOf("square")
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls, want 1", len(calls))
+	}
+
+	if call := calls[0]; call.Username != "alice" || call.Result != 9.0 || call.Err != nil {
+		t.Fatalf("got %+v, want call of alice returning 9", call)
+	}
+
+	if n := calls[0].Args.One().MustFloat64(); n != 3 {
+		t.Fatalf("got argument %v, want 3", n)
+	}
+}
+
+func TestConnectCallback(t *testing.T) {
+	srv := kite.New("server", "0.0.1")
+	srv.Config.DisableAuthentication = true
+
+	srv.HandleFunc("greet", func(r *kite.Request) (interface{}, error) {
+		args := r.Args.MustSliceOfLength(2)
+		return nil, args[1].MustFunction().Call("hello " + args[0].MustString())
+	})
+
+	c, err := kitetest.Connect(kite.New("client", "0.0.1"), srv)
+	if err != nil {
+		t.Fatalf("Connect()=%s", err)
+	}
+	defer c.Close()
+
+	greeting := make(chan string, 1)
+	callback := dnode.Callback(func(args *dnode.Partial) {
+		greeting <- args.One().MustString()
+	})
+
+	if _, err := c.Tell("greet", "bob", callback); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if got := <-greeting; got != "hello bob" {
+		t.Fatalf("got %q, want %q", got, "hello bob")
+	}
+}
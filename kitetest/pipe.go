@@ -0,0 +1,118 @@
+package kitetest
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/igm/sockjs-go/sockjs"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pipeBuffer is the number of messages each direction of a pipe buffers
+// before Send blocks.
+const pipeBuffer = 64
+
+// errPipeClosed is returned by Send on a closed pipe.
+var errPipeClosed = errors.New("kitetest: pipe is closed")
+
+// Pipe returns a pair of connected in-memory sessions. Messages sent on one
+// session are received on the other, in order. Closing either session
+// closes both.
+//
+// The client session is for Client.DialSession and the server session for
+// Kite.ServeSession, see Connect.
+func Pipe() (client, server sockjs.Session) {
+	id := uuid.Must(uuid.NewV4()).String()
+	p := &pipe{done: make(chan struct{})}
+
+	c2s := make(chan string, pipeBuffer)
+	s2c := make(chan string, pipeBuffer)
+
+	client = &pipeSession{id: id, pipe: p, in: s2c, out: c2s}
+	server = &pipeSession{id: id, pipe: p, in: c2s, out: s2c}
+
+	return client, server
+}
+
+// pipe is the state shared by both ends of a pipe.
+type pipe struct {
+	once sync.Once
+	done chan struct{}
+}
+
+func (p *pipe) close() {
+	p.once.Do(func() { close(p.done) })
+}
+
+// pipeSession is one end of a pipe, implementing sockjs.Session.
+type pipeSession struct {
+	id   string
+	pipe *pipe
+	in   <-chan string
+	out  chan<- string
+}
+
+var _ sockjs.Session = (*pipeSession)(nil)
+
+// ID implements the sockjs.Session interface.
+func (s *pipeSession) ID() string {
+	return s.id
+}
+
+// Request implements the sockjs.Session interface. It returns a request
+// for the "memory" address, as there is no HTTP request behind a pipe.
+func (s *pipeSession) Request() *http.Request {
+	req, _ := http.NewRequest("GET", "memory:///kite", nil)
+	req.RemoteAddr = "memory"
+	return req
+}
+
+// Recv implements the sockjs.Session interface. Messages sent before the
+// pipe was closed are still received.
+func (s *pipeSession) Recv() (string, error) {
+	select {
+	case msg := <-s.in:
+		return msg, nil
+	case <-s.pipe.done:
+	}
+
+	select {
+	case msg := <-s.in:
+		return msg, nil
+	default:
+		return "", sockjs.ErrSessionNotOpen
+	}
+}
+
+// Send implements the sockjs.Session interface.
+func (s *pipeSession) Send(msg string) error {
+	select {
+	case <-s.pipe.done:
+		return errPipeClosed
+	default:
+	}
+
+	select {
+	case s.out <- msg:
+		return nil
+	case <-s.pipe.done:
+		return errPipeClosed
+	}
+}
+
+// Close implements the sockjs.Session interface.
+func (s *pipeSession) Close(uint32, string) error {
+	s.pipe.close()
+	return nil
+}
+
+// GetSessionState implements the sockjs.Session interface.
+func (s *pipeSession) GetSessionState() sockjs.SessionState {
+	select {
+	case <-s.pipe.done:
+		return sockjs.SessionClosed
+	default:
+		return sockjs.SessionActive
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"time"
 
 	etcd "github.com/coreos/etcd/client"
-	"github.com/hashicorp/go-version"
 	"github.com/koding/kite"
 	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
 	"github.com/koding/kite/protocol"
@@ -189,43 +188,27 @@ func (e *Etcd) Update(k *protocol.Kite, v *kontrolprotocol.RegisterValue) error
 }
 
 func (e *Etcd) Get(query *protocol.KontrolQuery) (Kites, error) {
-	// We will make a get request to etcd store with this key. So get a "etcd"
-	// key from the given query so that we can use it to query from Etcd.
-	etcdKey, err := e.etcdKey(query)
+	// If version field contains a constraint, or the query has gaps between
+	// its fields, we make a query up to the first field which can not be
+	// part of the key and filter the results against the rest.
+	versionConstraint, err := parseVersionConstraint(query.Version)
 	if err != nil {
+		// version is a malformed, just return the error
 		return nil, err
 	}
 
-	// If version field contains a constraint we need no make a new query up to
-	// "name" field and filter the results after getting all versions.
-	// NewVersion returns an error if it's a constraint, like: ">= 1.0, < 1.4"
-	// Because NewConstraint doesn't return an error for version's like "0.0.1"
-	// we check it with the NewVersion function.
-	var hasVersionConstraint bool // does query contains a constraint on version?
-	var keyRest string            // query key after the version field
-	var versionConstraint version.Constraints
-	_, err = version.NewVersion(query.Version)
-	if err != nil && query.Version != "" {
-		// now parse our constraint
-		versionConstraint, err = version.NewConstraint(query.Version)
-		if err != nil {
-			// version is a malformed, just return the error
-			return nil, err
-		}
-
-		hasVersionConstraint = true
-		nameQuery := &protocol.KontrolQuery{
-			Username:    query.Username,
-			Environment: query.Environment,
-			Name:        query.Name,
-		}
-		// We will make a get request to all nodes under this name
-		// and filter the result later.
-		etcdKey, _ = GetQueryKey(nameQuery)
+	// We will make a get request to etcd store with this key. So get a "etcd"
+	// key from the given query so that we can use it to query from Etcd.
+	var etcdKey string
+	var filter bool
 
-		// Rest of the key after version field
-		keyRest = "/" + strings.TrimRight(
-			query.Region+"/"+query.Hostname+"/"+query.ID, "/")
+	if onlyIDQuery(query) {
+		etcdKey, err = e.etcdKey(query)
+	} else {
+		etcdKey, filter, err = getQueryKeyPrefix(query, versionConstraint != nil)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	resp, err := e.client.Get(context.TODO(),
@@ -259,11 +242,10 @@ func (e *Etcd) Get(query *protocol.KontrolQuery) (Kites, error) {
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		// Filter kites by version constraint
-		if hasVersionConstraint {
-			kites.Filter(versionConstraint, keyRest)
-		}
+	if filter {
+		kites.FilterQuery(query, versionConstraint)
 	}
 
 	// Shuffle the list
@@ -371,6 +353,41 @@ func GetQueryKey(q *protocol.KontrolQuery) (string, error) {
 	return path, nil
 }
 
+// getQueryKeyPrefix returns the key for the leading fields of the query
+// that are set. Unlike GetQueryKey it accepts queries with gaps between
+// fields, filter is true if the query has fields which are not part of the
+// key and the results must be filtered against the query. A version
+// constraint can not be part of a key and ends it as well.
+func getQueryKeyPrefix(q *protocol.KontrolQuery, versionConstraint bool) (key string, filter bool, err error) {
+	fields := q.Fields()
+
+	if q.Username == "" {
+		return "", false, errors.New("Empty username field")
+	}
+
+	path := "/"
+	end := false
+
+	for _, k := range keyOrder {
+		v := fields[k]
+
+		if v == "" || (k == "version" && versionConstraint) {
+			end = true
+		}
+
+		if end {
+			if v != "" {
+				filter = true
+			}
+			continue
+		}
+
+		path = path + v + "/"
+	}
+
+	return strings.TrimSuffix(path, "/"), filter, nil
+}
+
 func getAudience(q *protocol.KontrolQuery) string {
 	if q.Name != "" {
 		return "/" + q.Username + "/" + q.Environment + "/" + q.Name
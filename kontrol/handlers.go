@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -46,10 +47,11 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 	}
 
 	ex := &kitekey.Extractor{
-		Claims: &kitekey.KiteClaims{},
+		Claims:     &kitekey.KiteClaims{},
+		Algorithms: k.Kite.Config.SigningAlgorithms,
 	}
 
-	t, err := jwt.ParseWithClaims(r.Auth.Key, ex.Claims, ex.Extract)
+	t, err := kitekey.ParseAt(k.Kite.Clock.Now(), r.Auth.Key, ex.Claims, ex.Extract)
 	if err != nil {
 		return nil, err
 	}
@@ -107,7 +109,7 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 						k.log.Error("storage update '%s' error: %s", &kiteCopy, err)
 					}
 				})
-			case <-time.After(HeartbeatInterval + HeartbeatDelay):
+			case <-k.Kite.Clock.After(HeartbeatInterval + HeartbeatDelay):
 				k.log.Debug("Kite didn't sent any heartbeat %s.", &kiteCopy)
 				atomic.StoreInt32(&closed, 1)
 				return
@@ -204,6 +206,46 @@ func (k *Kontrol) HandleGetKites(r *kite.Request) (interface{}, error) {
 	}, nil
 }
 
+// HandleUnregister removes the registration of the kite with the given ID
+// from the storage. Only kites of the requesting user can be removed. A kite
+// which is still running registers itself again with its next heartbeat.
+func (k *Kontrol) HandleUnregister(r *kite.Request) (interface{}, error) {
+	var args struct {
+		ID string `json:"id"`
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.ID == "" {
+		return nil, errors.New("empty id")
+	}
+
+	kites, err := k.storage.Get(&protocol.KontrolQuery{ID: args.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kites) == 0 {
+		return nil, fmt.Errorf("kite %q is not registered", args.ID)
+	}
+
+	kiteProt := &kites[0].Kite
+	if kiteProt.Username != r.Username {
+		return nil, fmt.Errorf("kite %q does not belong to %q", args.ID, r.Username)
+	}
+
+	if err := k.storage.Delete(kiteProt); err != nil {
+		k.log.Error("storage delete '%s' error: %s", kiteProt, err)
+		return nil, errors.New("internal error - unregister")
+	}
+
+	k.log.Info("Kite unregistered: %s", kiteProt)
+
+	return nil, nil
+}
+
 func (k *Kontrol) HandleGetToken(r *kite.Request) (interface{}, error) {
 	var args protocol.GetTokenArgs
 
@@ -211,6 +253,10 @@ func (k *Kontrol) HandleGetToken(r *kite.Request) (interface{}, error) {
 		return nil, fmt.Errorf("invalid query: %s", err)
 	}
 
+	if err := kitekey.ValidateScope(args.Scope); err != nil {
+		return nil, err
+	}
+
 	// check if it's exist
 	kites, err := k.storage.Get(&args.KontrolQuery)
 	if err != nil {
@@ -232,13 +278,263 @@ func (k *Kontrol) HandleGetToken(r *kite.Request) (interface{}, error) {
 		return nil, err
 	}
 
-	return k.generateToken(&token{
+	tok := &token{
 		audience: getAudience(&args.KontrolQuery),
 		username: r.Username,
 		issuer:   k.Kite.Kite().Username,
+		scope:    args.Scope,
 		keyPair:  keyPair,
 		force:    args.Force,
-	})
+	}
+
+	// Tokens issued along with a refresh token are renewed with it, so
+	// they are short-lived.
+	if args.Refresh {
+		tok.ttl = k.refreshedTokenTTL()
+	}
+
+	if args.OnBehalfOf != "" {
+		claims, err := k.verifyDelegation(r, args.OnBehalfOf)
+		if err != nil {
+			return nil, fmt.Errorf("cannot act on behalf of the user: %s", err)
+		}
+
+		// The kite can not widen the scope the user gave it.
+		scope := kitekey.IntersectScope(args.Scope, claims.Scope)
+		if scope != nil && len(scope) == 0 {
+			return nil, fmt.Errorf("cannot act on behalf of the user: scope %v is not within %v", args.Scope, claims.Scope)
+		}
+
+		tok.username = claims.Subject
+		tok.scope = scope
+		tok.notAfter = claims.ExpiresAt
+		tok.actor = &kitekey.Actor{
+			Subject: r.Username,
+			Kite:    r.Client.Kite.String(),
+			Actor:   claims.Actor,
+		}
+	}
+
+	signed, err := k.generateToken(tok)
+	if err != nil || !args.Refresh {
+		return signed, err
+	}
+
+	tok.refresh = true
+
+	refresh, err := k.generateToken(tok)
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.TokenResult{Token: signed, RefreshToken: refresh}, nil
+}
+
+// refreshAudience prefixes the audience of refresh tokens.
+const refreshAudience = "refresh:"
+
+// HandleRefreshToken exchanges a refresh token issued by HandleGetToken for a
+// new token with the same audience, username and scope, and a new refresh
+// token expiring with the one exchanged. The refresh token is the
+// credential, so the request itself needs no authentication. Refresh tokens
+// are exchanged only once, a refresh token used again is rejected. Refresh
+// tokens signed with a deleted key pair are rejected, which makes deleting a
+// key pair revoke them.
+func (k *Kontrol) HandleRefreshToken(r *kite.Request) (interface{}, error) {
+	var args protocol.RefreshTokenArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, fmt.Errorf("invalid query: %s", err)
+	}
+
+	claims, keyPair, err := k.parseRefreshToken(args.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// A stolen refresh token stops working once either the kite or the
+	// thief uses it.
+	unused, err := k.revokeRefreshToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if !unused {
+		return nil, errors.New("invalid refresh token: already used or revoked")
+	}
+
+	tok := &token{
+		audience: strings.TrimPrefix(claims.Audience, refreshAudience),
+		username: claims.Subject,
+		issuer:   claims.Issuer,
+		scope:    claims.Scope,
+		keyPair:  keyPair,
+		ttl:      k.refreshedTokenTTL(),
+		actor:    claims.Actor,
+	}
+
+	if tok.actor != nil {
+		tok.notAfter = claims.ExpiresAt
+	}
+
+	signed, err := k.generateToken(tok)
+	if err != nil {
+		return nil, err
+	}
+
+	tok.refresh = true
+	tok.notAfter = claims.ExpiresAt
+
+	refresh, err := k.generateToken(tok)
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.TokenResult{Token: signed, RefreshToken: refresh}, nil
+}
+
+// HandleRevokeToken revokes a refresh token issued by HandleGetToken or
+// HandleRefreshToken, e.g. when a kite logs out. Like for HandleRefreshToken
+// the refresh token is the credential. Tokens issued with the refresh token
+// are not revoked, they expire after RefreshedTokenTTL.
+func (k *Kontrol) HandleRevokeToken(r *kite.Request) (interface{}, error) {
+	var args protocol.RefreshTokenArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, fmt.Errorf("invalid query: %s", err)
+	}
+
+	claims, _, err := k.parseRefreshToken(args.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := k.revokeRefreshToken(claims); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+// parseRefreshToken verifies a refresh token and returns its claims, and the
+// key pair which signed it.
+func (k *Kontrol) parseRefreshToken(refreshToken string) (*kitekey.KiteClaims, *KeyPair, error) {
+	var keyPair *KeyPair
+
+	claims := &kitekey.KiteClaims{}
+
+	keyFn := func(t *jwt.Token) (interface{}, error) {
+		id, ok := t.Header["kid"].(string)
+		if !ok || id == "" {
+			return nil, errors.New("no key ID found")
+		}
+
+		pair, err := k.keyPair.GetKeyFromID(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := k.keyPair.IsValid(pair.Public); err != nil {
+			return nil, err
+		}
+
+		pub, err := kitekey.ParsePublicKey([]byte(pair.Public))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := kitekey.CheckSigningMethod(t, pub, k.Kite.Config.SigningAlgorithms.For(claims.Issuer)); err != nil {
+			return nil, err
+		}
+
+		keyPair = pair
+		return pub, nil
+	}
+
+	if _, err := kitekey.ParseAt(k.Kite.Clock.Now(), refreshToken, claims, keyFn); err != nil {
+		return nil, nil, fmt.Errorf("invalid refresh token: %s", err)
+	}
+
+	if !strings.HasPrefix(claims.Audience, refreshAudience) {
+		return nil, nil, errors.New("invalid refresh token: not a refresh token")
+	}
+
+	if claims.Issuer != k.Kite.Kite().Username {
+		return nil, nil, fmt.Errorf("invalid refresh token: issuer is not trusted: %s", claims.Issuer)
+	}
+
+	if claims.Id == "" {
+		return nil, nil, errors.New("invalid refresh token: no token ID found")
+	}
+
+	return claims, keyPair, nil
+}
+
+// revokeRefreshToken revokes the refresh token with the given claims. It
+// reports whether the token was not used or revoked before.
+func (k *Kontrol) revokeRefreshToken(claims *kitekey.KiteClaims) (bool, error) {
+	unused, err := k.revocations.Revoke(claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		k.log.Error("revocation storage error for token %q: %s", claims.Id, err)
+		return false, errors.New("internal error - revoke token")
+	}
+
+	return unused, nil
+}
+
+// verifyDelegation verifies the token a user called the requesting kite
+// with, which the kite asks to get a token on behalf of the user with. The
+// token must be issued by kontrol for the requesting kite with a valid key
+// pair, and not expired.
+func (k *Kontrol) verifyDelegation(r *kite.Request, delegated string) (*kitekey.KiteClaims, error) {
+	claims := &kitekey.KiteClaims{}
+
+	// The token is verified with the key pair which signed it, which is
+	// not the one of the acting kite if kontrol rotated its keys since.
+	keyFn := func(t *jwt.Token) (interface{}, error) {
+		id, ok := t.Header["kid"].(string)
+		if !ok || id == "" {
+			return nil, errors.New("no key ID found")
+		}
+
+		keyPair, err := k.keyPair.GetKeyFromID(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := k.keyPair.IsValid(keyPair.Public); err != nil {
+			return nil, err
+		}
+
+		pub, err := kitekey.ParsePublicKey([]byte(keyPair.Public))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := kitekey.CheckSigningMethod(t, pub, k.Kite.Config.SigningAlgorithms.For(claims.Issuer)); err != nil {
+			return nil, err
+		}
+
+		return pub, nil
+	}
+
+	if _, err := kitekey.ParseAt(k.Kite.Clock.Now(), delegated, claims, keyFn); err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != k.Kite.Kite().Username {
+		return nil, fmt.Errorf("issuer is not trusted: %s", claims.Issuer)
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("token has no username")
+	}
+
+	if err := kite.VerifyAudience(&r.Client.Kite, claims.Audience); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
 }
 
 func (k *Kontrol) HandleMachine(r *kite.Request) (interface{}, error) {
@@ -282,10 +578,11 @@ func (k *Kontrol) HandleGetKey(r *kite.Request) (interface{}, error) {
 	}
 
 	ex := &kitekey.Extractor{
-		Claims: &kitekey.KiteClaims{},
+		Claims:     &kitekey.KiteClaims{},
+		Algorithms: k.Kite.Config.SigningAlgorithms,
 	}
 
-	if _, err := jwt.ParseWithClaims(r.Auth.Key, ex.Claims, ex.Extract); err != nil {
+	if _, err := kitekey.ParseAt(k.Kite.Clock.Now(), r.Auth.Key, ex.Claims, ex.Extract); err != nil {
 		return nil, err
 	}
 
@@ -351,14 +648,21 @@ func (k *Kontrol) updateKeyWithKeyPair(t *jwt.Token, keyPair *KeyPair) string {
 		claims.KontrolKey = keyPair.Public
 	}
 
-	rsaPrivate, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(keyPair.Private))
+	signer, err := k.signer(keyPair.Private)
+	if err == nil {
+		// The new key pair may be of another type than the old one.
+		t.Method, err = kitekey.SignerMethod(signer)
+	}
+	if err == nil {
+		t.Header["alg"] = t.Method.Alg()
+	}
 	if err != nil {
 		k.log.Error("key update error for %q: %s", claims.Subject, err)
 
 		return ""
 	}
 
-	kiteKey, err := t.SignedString(rsaPrivate)
+	kiteKey, err := t.SignedString(signer)
 	if err != nil {
 		k.log.Error("key update error for %q: %s", claims.Subject, err)
 
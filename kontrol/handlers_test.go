@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/koding/kite"
 	"github.com/koding/kite/protocol"
@@ -44,3 +45,39 @@ func TestKontrol_HandleWebRTC(t *testing.T) {
 		t.Fatalf("expected hk1 error, got: %+v", err)
 	}
 }
+
+func TestKontrol_HandleUnregister(t *testing.T) {
+	kont, conf := startKontrol(testkeys.PrivateThird, testkeys.PublicThird, 5502)
+	defer kont.Close()
+
+	hk1 := createTestKite("kite1", conf, t)
+	defer hk1.Close()
+
+	hk2 := createTestKite("kite2", conf, t)
+	defer hk2.Close()
+
+	args := map[string]string{"id": hk1.Kite.Id}
+
+	// The kite key of hk2 belongs to another user than hk1.
+	_, err := hk2.Kite.TellKontrolWithTimeout("unregister", 4*time.Second, args)
+	if err == nil || !strings.Contains(err.Error(), "does not belong") {
+		t.Fatalf("expected ownership error, got: %+v", err)
+	}
+
+	owner := kite.New("owner", "1.0.0")
+	owner.Config = conf.Config.Copy()
+	defer owner.Close()
+
+	if _, err := owner.TellKontrolWithTimeout("unregister", 4*time.Second, args); err != nil {
+		t.Fatalf("unregister()=%s", err)
+	}
+
+	if _, err := owner.GetKites(&protocol.KontrolQuery{ID: hk1.Kite.Id}); err == nil {
+		t.Fatal("expected kite1 to be unregistered")
+	}
+
+	_, err = owner.TellKontrolWithTimeout("unregister", 4*time.Second, args)
+	if err == nil {
+		t.Fatal("expected error unregistering kite1 again")
+	}
+}
@@ -63,6 +63,8 @@ func startKontrol(pem, pub string, port int) (*Kontrol, *Config) {
 		p := NewPostgres(nil, kon.Kite.Log)
 		kon.SetStorage(p)
 		kon.SetKeyPairStorage(p)
+	case "memory":
+		kon.SetStorage(NewMemStorage())
 	default:
 		kon.SetStorage(NewEtcd(nil, kon.Kite.Log))
 	}
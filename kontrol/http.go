@@ -7,7 +7,6 @@ import (
 	"net/http"
 	"time"
 
-	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/koding/kite"
 	"github.com/koding/kite/kitekey"
 	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
@@ -85,10 +84,11 @@ func (k *Kontrol) HandleRegisterHTTP(rw http.ResponseWriter, req *http.Request)
 	args.Kite.Username = username
 
 	ex := &kitekey.Extractor{
-		Claims: &kitekey.KiteClaims{},
+		Claims:     &kitekey.KiteClaims{},
+		Algorithms: k.Kite.Config.SigningAlgorithms,
 	}
 
-	t, err := jwt.ParseWithClaims(args.Auth.Key, ex.Claims, ex.Extract)
+	t, err := kitekey.ParseAt(k.Kite.Clock.Now(), args.Auth.Key, ex.Claims, ex.Extract)
 	if err != nil {
 		http.Error(rw, jsonError(err), http.StatusBadRequest)
 		return
@@ -169,7 +169,7 @@ func (k *Kontrol) HandleRegisterHTTP(rw http.ResponseWriter, req *http.Request)
 			updateC: make(chan func() error),
 		}
 
-		updater := time.NewTicker(UpdateInterval)
+		updater := k.Kite.Clock.NewTicker(UpdateInterval)
 
 		go func() {
 			update := func() error {
@@ -180,7 +180,7 @@ func (k *Kontrol) HandleRegisterHTTP(rw http.ResponseWriter, req *http.Request)
 				select {
 				case <-k.closed:
 					return
-				case <-updater.C:
+				case <-updater.C():
 					k.log.Debug("Kite is active (via HTTP), updating the value %s", remoteKite)
 
 					if err := update(); err != nil {
@@ -200,7 +200,7 @@ func (k *Kontrol) HandleRegisterHTTP(rw http.ResponseWriter, req *http.Request)
 		// we are now creating a timer that is going to call the function which
 		// stops the background updater if it's not resetted. The time is being
 		// resetted on a separate HTTP endpoint "/heartbeat"
-		h.timer = time.AfterFunc(HeartbeatInterval+HeartbeatDelay, func() {
+		h.timer = k.Kite.Clock.AfterFunc(HeartbeatInterval+HeartbeatDelay, func() {
 			k.log.Info("Kite didn't sent any heartbeat (via HTTP). Stopping the updater %s", remoteKite)
 
 			// stop the updater so it doesn't update it in the background
@@ -42,6 +42,58 @@ func (k *Kites) Filter(constraint version.Constraints, keyRest string) {
 	*k = filtered
 }
 
+// FilterQuery filters out kites which do not match every field set in the
+// query. The version field of the query is ignored, kites are checked
+// against the given version constraint instead if it is not nil.
+func (k *Kites) FilterQuery(q *protocol.KontrolQuery, constraint version.Constraints) {
+	filtered := make(Kites, 0)
+	for _, kite := range *k {
+		if matchQuery(&kite.Kite, q, constraint) {
+			filtered = append(filtered, kite)
+		}
+	}
+
+	*k = filtered
+}
+
+func matchQuery(k *protocol.Kite, q *protocol.KontrolQuery, c version.Constraints) bool {
+	if c != nil {
+		v, err := version.NewVersion(k.Version)
+		if err != nil || !c.Check(v) {
+			return false
+		}
+	}
+
+	fields := k.Query().Fields()
+	for key, v := range q.Fields() {
+		if key == "version" && c != nil {
+			continue
+		}
+
+		if v != "" && fields[key] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseVersionConstraint returns the constraint given in the version field
+// of a query, or nil if the field is empty or an exact version.
+func parseVersionConstraint(v string) (version.Constraints, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	// NewConstraint doesn't return an error for versions like "0.0.1",
+	// NewVersion does for constraints like ">= 1.0, < 1.4".
+	if _, err := version.NewVersion(v); err == nil {
+		return nil, nil
+	}
+
+	return version.NewConstraint(v)
+}
+
 func isValid(k *protocol.Kite, c version.Constraints, keyRest string) bool {
 	// Check the version constraint.
 	v, _ := version.NewVersion(k.Version)
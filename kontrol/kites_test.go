@@ -64,3 +64,34 @@ func TestKitesFilter(t *testing.T) {
 		t.Fatalf("got %+v, want %+v", kites, want)
 	}
 }
+
+func TestKitesFilterQuery(t *testing.T) {
+	kites := kontrol.Kites{
+		{Kite: protocol.Kite{Environment: "prod", Version: "1.0.0", Region: "eu"}},
+		{Kite: protocol.Kite{Environment: "prod", Version: "1.1.3", Region: "us"}},
+		{Kite: protocol.Kite{Environment: "prod", Version: "1.2.0", Region: "us"}},
+		{Kite: protocol.Kite{Environment: "dev", Version: "1.1.0", Region: "us"}},
+		{Kite: protocol.Kite{Environment: "prod", Version: "invalid", Region: "us"}},
+	}
+
+	want := kontrol.Kites{
+		kites[1],
+	}
+
+	c, err := version.NewConstraint("< 1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &protocol.KontrolQuery{
+		Environment: "prod",
+		Version:     "< 1.2",
+		Region:      "us",
+	}
+
+	kites.FilterQuery(q, c)
+
+	if !reflect.DeepEqual(kites, want) {
+		t.Fatalf("got %+v, want %+v", kites, want)
+	}
+}
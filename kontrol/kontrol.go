@@ -3,6 +3,7 @@
 package kontrol
 
 import (
+	"crypto"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -12,6 +13,7 @@ import (
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/koding/kite"
+	"github.com/koding/kite/clock"
 	"github.com/koding/kite/config"
 	"github.com/koding/kite/kitekey"
 	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
@@ -28,6 +30,17 @@ var (
 	// accepted for processing.
 	TokenTTL = 48 * time.Hour
 
+	// RefreshTokenTTL is the time after which refresh tokens expire. A
+	// refresh token is exchanged once, for a token and a new refresh token
+	// expiring with it, so kites have to ask for a refresh token again
+	// after RefreshTokenTTL.
+	RefreshTokenTTL = 30 * 24 * time.Hour
+
+	// RefreshedTokenTTL is the TTL of the tokens issued along with a
+	// refresh token or exchanged for one. Kites holding the refresh token
+	// get new tokens with it before they expire, so they are short-lived.
+	RefreshedTokenTTL = time.Hour
+
 	// TokenLeeway - implementers MAY provide for some small leeway, usually
 	// no more than a few minutes, to account for clock skew.
 	TokenLeeway = 5 * time.Minute
@@ -75,6 +88,18 @@ type Kontrol struct {
 	// If TokenTTL is 0, default global TokenTTL is used.
 	TokenTTL time.Duration
 
+	// RefreshTokenTTL describes the TTL of refresh tokens issued by the
+	// kontrol.
+	//
+	// If RefreshTokenTTL is 0, default global RefreshTokenTTL is used.
+	RefreshTokenTTL time.Duration
+
+	// RefreshedTokenTTL describes the TTL of tokens issued along with a
+	// refresh token or exchanged for one.
+	//
+	// If RefreshedTokenTTL is 0, default global RefreshedTokenTTL is used.
+	RefreshedTokenTTL time.Duration
+
 	// TokenLeeway describes time difference to gracefully handle clock
 	// skew between client and server.
 	//
@@ -84,6 +109,14 @@ type Kontrol struct {
 	// TokenNoNBF when true does not set nbf field for generated JWT tokens.
 	TokenNoNBF bool
 
+	// PrivateKeySigner, if set, returns the signer for the private key of
+	// a key pair. It lets private keys be kept outside of kontrol, e.g. in
+	// the transit engine of Vault, with the Private field of KeyPair only
+	// naming the key. If nil, kitekey.NewSigner is used, so the Private
+	// field is either a PEM encoded key or the URI of a key of a registered
+	// kitekey.KeyProvider, like a key of an HSM or a PKCS #11 token.
+	PrivateKeySigner func(private string) (crypto.Signer, error)
+
 	clientLocks *IdLock
 
 	heartbeats   map[string]*heartbeat
@@ -92,12 +125,20 @@ type Kontrol struct {
 	tokenCache   map[string]cachedToken
 	tokenCacheMu sync.Mutex
 
+	// signers caches the signers of keys of key providers, which may
+	// have to be looked up remotely
+	signers   map[string]crypto.Signer
+	signersMu sync.Mutex
+
 	// closed notifies goroutines started by kontrol that it got closed
 	closed chan struct{}
 
 	// keyPair defines the storage of keypairs
 	keyPair KeyPairStorage
 
+	// revocations keeps the IDs of the refresh tokens used or revoked
+	revocations RevocationStorage
+
 	// ids, lastPublic and lastPrivate are used to store the last added keys
 	// for convinience
 	lastIDs     []string
@@ -119,7 +160,7 @@ type Kontrol struct {
 
 type heartbeat struct {
 	updateC chan func() error
-	timer   *time.Timer
+	timer   clock.Timer
 }
 
 // New creates a new kontrol instance with the given version and config
@@ -141,9 +182,12 @@ func New(conf *config.Config, version string) *Kontrol {
 	kontrol := NewWithoutHandlers(conf, version)
 
 	kontrol.Kite.HandleFunc("register", kontrol.HandleRegister)
+	kontrol.Kite.HandleFunc("unregister", kontrol.HandleUnregister)
 	kontrol.Kite.HandleFunc("registerMachine", kontrol.HandleMachine).DisableAuthentication()
 	kontrol.Kite.HandleFunc("getKites", kontrol.HandleGetKites)
 	kontrol.Kite.HandleFunc("getToken", kontrol.HandleGetToken)
+	kontrol.Kite.HandleFunc("refreshToken", kontrol.HandleRefreshToken).DisableAuthentication()
+	kontrol.Kite.HandleFunc("revokeToken", kontrol.HandleRevokeToken).DisableAuthentication()
 	kontrol.Kite.HandleFunc("getKey", kontrol.HandleGetKey)
 
 	kontrol.Kite.HandleHTTPFunc("/register", kontrol.HandleRegisterHTTP)
@@ -160,9 +204,12 @@ func New(conf *config.Config, version string) *Kontrol {
 //
 //     kontrol := NewWithoutHandlers(conf, version)
 //     kontrol.Kite.HandleFunc("register", kontrol.HandleRegister)
+//     kontrol.Kite.HandleFunc("unregister", kontrol.HandleUnregister)
 //     kontrol.Kite.HandleFunc("registerMachine", kontrol.HandleMachine).DisableAuthentication()
 //     kontrol.Kite.HandleFunc("getKites", kontrol.HandleGetKites)
 //     kontrol.Kite.HandleFunc("getToken", kontrol.HandleGetToken)
+//     kontrol.Kite.HandleFunc("refreshToken", kontrol.HandleRefreshToken).DisableAuthentication()
+//     kontrol.Kite.HandleFunc("revokeToken", kontrol.HandleRevokeToken).DisableAuthentication()
 //     kontrol.Kite.HandleFunc("getKey", kontrol.HandleGetKey)
 //     kontrol.Kite.HandleHTTPFunc("/heartbeat", kontrol.HandleHeartbeat)
 //     kontrol.Kite.HandleHTTPFunc("/register", kontrol.HandleRegisterHTTP)
@@ -191,6 +238,7 @@ func NewWithoutHandlers(conf *config.Config, version string) *Kontrol {
 
 	k.Kite = kite.NewWithConfig("kontrol", version, conf)
 	k.log = k.Kite.Log
+	k.revocations = NewMemRevocationStorage(k.Kite.Clock)
 
 	return k
 }
@@ -276,6 +324,10 @@ func (k *Kontrol) DeleteKeyPair(id, public string) error {
 // last added key pair is also used to generate tokens for machine
 // registrations via "handleMachine" method. This can be overiden with the
 // kontorl.MachineKeyPicker function.
+//
+// The keys are PEM encoded RSA, ECDSA or Ed25519 keys. Tokens are signed
+// with RS256 by RSA keys, with ES256, ES384 or ES512 by ECDSA keys of the
+// P-256, P-384 or P-521 curve and with EdDSA by Ed25519 keys.
 func (k *Kontrol) AddKeyPair(id, public, private string) error {
 	if k.keyPair == nil {
 		k.log.Warning("Key pair storage is not set. Using in memory cache")
@@ -341,6 +393,13 @@ func (k *Kontrol) SetKeyPairStorage(storage KeyPairStorage) {
 	k.keyPair = storage
 }
 
+// SetRevocationStorage sets the backend storage of the IDs of used and
+// revoked refresh tokens. Kontrols sharing their storage must share it
+// too, by default they keep them in memory.
+func (k *Kontrol) SetRevocationStorage(storage RevocationStorage) {
+	k.revocations = storage
+}
+
 // Close stops kontrol and closes all connections
 func (k *Kontrol) Close() {
 	close(k.closed)
@@ -369,21 +428,26 @@ func (k *Kontrol) registerUser(username, publicKey, privateKey string) (kiteKey
 		StandardClaims: jwt.StandardClaims{
 			Issuer:   k.Kite.Kite().Username,
 			Subject:  username,
-			IssuedAt: time.Now().Add(-k.tokenLeeway()).UTC().Unix(),
+			IssuedAt: k.Kite.Clock.Now().Add(-k.tokenLeeway()).UTC().Unix(),
 			Id:       id.String(),
 		},
 		KontrolURL: k.Kite.Config.KontrolURL,
 		KontrolKey: strings.TrimSpace(publicKey),
 	}
 
-	rsaPrivate, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
+	signer, err := k.signer(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	kiteKey, err = kitekey.SignWith(claims, signer)
 	if err != nil {
 		return "", err
 	}
 
 	k.Kite.Log.Info("Registered machine on user: %s", username)
 
-	return jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims).SignedString(rsaPrivate)
+	return kiteKey, nil
 }
 
 // registerSelf adds Kontrol itself to the storage as a kite.
@@ -441,11 +505,11 @@ func (k *Kontrol) registerSelf() {
 		default:
 			if err := k.storage.Update(k.Kite.Kite(), value); err != nil {
 				k.log.Error("%s", err)
-				time.Sleep(time.Second)
+				k.Kite.Clock.Sleep(time.Second)
 				continue
 			}
 
-			time.Sleep(HeartbeatDelay + HeartbeatInterval)
+			k.Kite.Clock.Sleep(HeartbeatDelay + HeartbeatInterval)
 		}
 	}
 }
@@ -472,14 +536,19 @@ func (k *Kontrol) KeyPair() (pair *KeyPair, err error) {
 		ri := len(k.lastPublic) - i - 1
 
 		keyFn := func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-				return nil, errors.New("invalid signing method")
+			key, err := kitekey.ParsePublicKey([]byte(k.lastPublic[ri]))
+			if err != nil {
+				return nil, err
+			}
+
+			if err := kitekey.CheckSigningMethod(token, key, nil); err != nil {
+				return nil, err
 			}
 
-			return jwt.ParseRSAPublicKeyFromPEM([]byte(k.lastPublic[ri]))
+			return key, nil
 		}
 
-		if _, err := jwt.ParseWithClaims(kiteKey, &kitekey.KiteClaims{}, keyFn); err != nil {
+		if _, err := kitekey.ParseAt(k.Kite.Clock.Now(), kiteKey, &kitekey.KiteClaims{}, keyFn); err != nil {
 			me.err = append(me.err, err)
 			continue
 		}
@@ -509,6 +578,22 @@ func (k *Kontrol) tokenTTL() time.Duration {
 	return TokenTTL
 }
 
+func (k *Kontrol) refreshTokenTTL() time.Duration {
+	if k.RefreshTokenTTL != 0 {
+		return k.RefreshTokenTTL
+	}
+
+	return RefreshTokenTTL
+}
+
+func (k *Kontrol) refreshedTokenTTL() time.Duration {
+	if k.RefreshedTokenTTL != 0 {
+		return k.RefreshedTokenTTL
+	}
+
+	return RefreshedTokenTTL
+}
+
 func (k *Kontrol) tokenLeeway() time.Duration {
 	if k.TokenLeeway != 0 {
 		return k.TokenLeeway
@@ -521,33 +606,39 @@ type token struct {
 	audience string
 	username string
 	issuer   string
+	scope    []string
 	keyPair  *KeyPair
 	force    bool
+	refresh  bool          // a refresh token for tokens of the audience
+	ttl      time.Duration // replaces the TokenTTL of kontrol if not zero
+	actor    *kitekey.Actor
+	notAfter int64 // caps the expiration of the token if not zero
 }
 
 type cachedToken struct {
 	signed string
-	timer  *time.Timer
+	timer  clock.Timer
 }
 
 func (t *token) String() string {
-	return t.audience + t.username + t.issuer + t.keyPair.ID
+	return t.audience + t.username + t.issuer + strings.Join(t.scope, ",") + t.keyPair.ID + t.actor.String() + t.ttl.String()
 }
 
 // cacheToken cached the signed token under the given key.
 //
-// It also ensures the token is invalidated after its expiration time.
+// It also ensures the token is invalidated after its expiration time,
+// given by its ttl.
 //
 // If the token was already exists in the cache, it will be
 // overwritten with a new value.
-func (k *Kontrol) cacheToken(key, signed string) {
+func (k *Kontrol) cacheToken(key, signed string, ttl time.Duration) {
 	if ct, ok := k.tokenCache[key]; ok {
 		ct.timer.Stop()
 	}
 
 	k.tokenCache[key] = cachedToken{
 		signed: signed,
-		timer: time.AfterFunc(k.tokenTTL()-k.tokenLeeway(), func() {
+		timer: k.Kite.Clock.AfterFunc(ttl-k.tokenLeeway(), func() {
 			k.tokenCacheMu.Lock()
 			delete(k.tokenCache, key)
 			k.tokenCacheMu.Unlock()
@@ -563,13 +654,22 @@ func (k *Kontrol) generateToken(tok *token) (string, error) {
 	k.tokenCacheMu.Lock()
 	defer k.tokenCacheMu.Unlock()
 
-	if !tok.force {
+	// Delegated tokens are not cached, as their expiration depends on
+	// the token they are delegated with.
+	cache := !tok.refresh && tok.actor == nil
+
+	if !tok.force && cache {
 		if ct, ok := k.tokenCache[uniqKey]; ok {
 			return ct.signed, nil
 		}
 	}
 
-	rsaPrivate, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(tok.keyPair.Private))
+	signer, err := k.signer(tok.keyPair.Private)
+	if err != nil {
+		return "", err
+	}
+
+	method, err := kitekey.SignerMethod(signer)
 	if err != nil {
 		return "", err
 	}
@@ -579,33 +679,88 @@ func (k *Kontrol) generateToken(tok *token) (string, error) {
 		return "", err
 	}
 
-	now := time.Now().UTC()
+	ttl := k.tokenTTL()
+	if tok.ttl != 0 {
+		ttl = tok.ttl
+	}
+
+	now := k.Kite.Clock.Now().UTC()
 
 	claims := &kitekey.KiteClaims{
 		StandardClaims: jwt.StandardClaims{
 			Issuer:    tok.issuer,
 			Subject:   tok.username,
 			Audience:  tok.audience,
-			ExpiresAt: now.Add(k.tokenTTL()).Add(k.tokenLeeway()).UTC().Unix(),
+			ExpiresAt: now.Add(ttl).Add(k.tokenLeeway()).UTC().Unix(),
 			IssuedAt:  now.Add(-k.tokenLeeway()).UTC().Unix(),
 			Id:        id.String(),
 		},
+		Scope: tok.scope,
+		Actor: tok.actor,
 	}
 
 	if !k.TokenNoNBF {
 		claims.NotBefore = now.Add(-k.tokenLeeway()).Unix()
 	}
 
-	signed, err := jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims).SignedString(rsaPrivate)
+	t := jwt.NewWithClaims(method, claims)
+
+	if tok.refresh {
+		// Refresh tokens name the key pair they are signed with, which
+		// signs the tokens they are exchanged for. Their audience is not
+		// a kite and they carry no kontrol key, so kites reject them both
+		// as tokens and as kite keys.
+		claims.Audience = refreshAudience + tok.audience
+		claims.ExpiresAt = now.Add(k.refreshTokenTTL()).UTC().Unix()
+		t.Header["kid"] = tok.keyPair.ID
+	}
+
+	if tok.notAfter != 0 && claims.ExpiresAt > tok.notAfter {
+		claims.ExpiresAt = tok.notAfter
+	}
+
+	signed, err := t.SignedString(signer)
 	if err != nil {
 		return "", errors.New("Server error: Cannot generate a token")
 	}
 
-	k.cacheToken(uniqKey, signed)
+	if cache {
+		k.cacheToken(uniqKey, signed, ttl)
+	}
 
 	return signed, nil
 }
 
+// signer returns the signer for the private key of a key pair.
+func (k *Kontrol) signer(private string) (crypto.Signer, error) {
+	if k.PrivateKeySigner != nil {
+		return k.PrivateKeySigner(private)
+	}
+
+	if !kitekey.IsKeyURI(private) {
+		return kitekey.NewSigner(private)
+	}
+
+	k.signersMu.Lock()
+	defer k.signersMu.Unlock()
+
+	if signer, ok := k.signers[private]; ok {
+		return signer, nil
+	}
+
+	signer, err := kitekey.NewSigner(private)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.signers == nil {
+		k.signers = make(map[string]crypto.Signer)
+	}
+	k.signers[private] = signer
+
+	return signer, nil
+}
+
 func nonil(err ...error) error {
 	for _, e := range err {
 		if e != nil {
@@ -7,10 +7,13 @@ import (
 	"log"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/koding/kite"
 	"github.com/koding/kite/config"
+	"github.com/koding/kite/kitekey"
 	"github.com/koding/kite/kontrol"
+	"github.com/koding/kite/vault"
 	"github.com/koding/multiconfig"
 )
 
@@ -28,6 +31,33 @@ type Kontrol struct {
 	PublicKeyFile  string
 	PrivateKeyFile string
 
+	// PrivateKeyURI names a key of a key provider, e.g. of an HSM, a TPM
+	// or a PKCS #11 token, which signs the tokens instead of the private
+	// key file, see kitekey.RegisterKeyProvider. The public key is read
+	// from the provider.
+	PrivateKeyURI string
+
+	// Vault holds the key pair instead of the key files if KeyPath or
+	// TransitKey is set. KeyPath is a KV secret with the PEM encoded keys
+	// in its public and private fields. TransitKey is a key of the transit
+	// engine mounted at TransitMount, which signs the tokens so the private
+	// key never leaves Vault. Vault is configured by the VAULT_ADDR and
+	// VAULT_TOKEN environment variables.
+	Vault struct {
+		KeyPath      string
+		TransitMount string `default:"transit"`
+		TransitKey   string
+	}
+
+	// TokenTTL and RefreshTokenTTL are the lifetimes of the tokens and of
+	// the refresh tokens issued by kontrol, and RefreshedTokenTTL the one
+	// of the tokens issued along with or for refresh tokens. If zero,
+	// kontrol.TokenTTL, kontrol.RefreshTokenTTL and
+	// kontrol.RefreshedTokenTTL are used.
+	TokenTTL          time.Duration
+	RefreshTokenTTL   time.Duration
+	RefreshedTokenTTL time.Duration
+
 	Machines []string
 	Version  string `default:"0.0.1"`
 
@@ -46,15 +76,7 @@ func main() {
 
 	multiconfig.New().MustLoad(conf)
 
-	publicKey, err := ioutil.ReadFile(conf.PublicKeyFile)
-	if err != nil {
-		log.Fatalf("cannot read public key file: %s", err.Error())
-	}
-
-	privateKey, err := ioutil.ReadFile(conf.PrivateKeyFile)
-	if err != nil {
-		log.Fatalf("cannot read private key file: %s", err.Error())
-	}
+	publicKey, privateKey := readKeyPair(conf)
 
 	if conf.Initial {
 		initialKey(conf, publicKey, privateKey)
@@ -66,6 +88,9 @@ func main() {
 	kiteConf.Port = conf.Port
 
 	k := kontrol.New(kiteConf, conf.Version)
+	k.TokenTTL = conf.TokenTTL
+	k.RefreshTokenTTL = conf.RefreshTokenTTL
+	k.RefreshedTokenTTL = conf.RefreshedTokenTTL
 
 	if conf.TLSCertFile != "" || conf.TLSKeyFile != "" {
 		cert, err := tls.LoadX509KeyPair(conf.TLSCertFile, conf.TLSKeyFile)
@@ -90,7 +115,7 @@ func main() {
 			DBName:   conf.Postgres.DBName,
 		}
 
-		p := kontrol.NewPostgres(postgresConf, k.Kite.Log)
+		p := kontrol.NewPostgresWithClock(postgresConf, k.Kite.Log, k.Kite.Clock)
 		k.SetStorage(p)
 		k.SetKeyPairStorage(p)
 	case "etcd":
@@ -104,6 +129,60 @@ func main() {
 	k.Run()
 }
 
+// readKeyPair reads the key pair of kontrol from the key files or Vault. For
+// keys of key providers, like transit keys of Vault, the private key is the
+// URI of the key, which kontrol signs with through kitekey.NewSigner.
+func readKeyPair(conf *Kontrol) (publicKey, privateKey []byte) {
+	if conf.Vault.TransitKey != "" && conf.Vault.KeyPath == "" {
+		conf.PrivateKeyURI = "vault:" + conf.Vault.TransitMount + "/" + conf.Vault.TransitKey
+	}
+
+	if conf.PrivateKeyURI != "" {
+		signer, err := kitekey.NewSigner(conf.PrivateKeyURI)
+		if err != nil {
+			log.Fatalf("cannot open private key: %s", err.Error())
+		}
+
+		public, err := kitekey.MarshalPublicKey(signer.Public())
+		if err != nil {
+			log.Fatalf("cannot encode public key: %s", err.Error())
+		}
+
+		return []byte(public), []byte(conf.PrivateKeyURI)
+	}
+
+	if conf.Vault.KeyPath == "" {
+		publicKey, err := ioutil.ReadFile(conf.PublicKeyFile)
+		if err != nil {
+			log.Fatalf("cannot read public key file: %s", err.Error())
+		}
+
+		privateKey, err := ioutil.ReadFile(conf.PrivateKeyFile)
+		if err != nil {
+			log.Fatalf("cannot read private key file: %s", err.Error())
+		}
+
+		return publicKey, privateKey
+	}
+
+	client, err := vault.NewClient()
+	if err != nil {
+		log.Fatalf("cannot connect to vault: %s", err.Error())
+	}
+
+	public, err := client.ReadSecret(conf.Vault.KeyPath, "public")
+	if err != nil {
+		log.Fatalf("cannot read public key from vault: %s", err.Error())
+	}
+
+	private, err := client.ReadSecret(conf.Vault.KeyPath, "private")
+	if err != nil {
+		log.Fatalf("cannot read private key from vault: %s", err.Error())
+	}
+
+	return []byte(public), []byte(private)
+}
+
 func initialKey(kontrolConf *Kontrol, publicKey, privateKey []byte) {
 	conf := config.New()
 
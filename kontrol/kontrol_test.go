@@ -106,8 +106,9 @@ func TestUpdateKeys(t *testing.T) {
 		hk2: hk1,
 	}
 
-	if err := Call(calls); err == nil || !strings.Contains(err.Error(), "token is expired") {
-		t.Fatalf("got nil or unexpected error: %v", err)
+	// Calls made with the expired token are retried with a renewed one.
+	if err := Call(calls); err != nil {
+		t.Fatal(err)
 	}
 
 	if err := hk2.WaitTokenExpired(10 * time.Second); err != nil {
@@ -519,6 +520,202 @@ func TestGetToken(t *testing.T) {
 	}
 }
 
+func TestRefreshToken(t *testing.T) {
+	m := kite.New("mathworker6", "1.1.1")
+	m.Config = conf.Config.Copy()
+	m.Config.Port = 6667
+	defer m.Close()
+
+	kiteURL := &url.URL{Scheme: "http", Host: "localhost:6667", Path: "/kite"}
+	if _, err := m.Register(kiteURL); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := m.GetRefreshToken(m.Kite())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Token == "" || res.RefreshToken == "" {
+		t.Fatalf("got %+v, want token and refresh token", res)
+	}
+
+	// Refresh tokens are accepted neither as tokens nor as kite keys.
+	for _, auth := range []*kite.Auth{
+		{Type: "token", Key: res.RefreshToken},
+		{Type: "kiteKey", Key: res.RefreshToken},
+	} {
+		r := &kite.Request{Method: "kite.ping", LocalKite: m, Auth: auth}
+		if err := m.Authenticators[auth.Type](r); err == nil {
+			t.Errorf("%s: refresh token accepted", auth.Type)
+		}
+	}
+
+	c := kite.New("refresher", "0.0.1")
+	c.Config = conf.Config.Copy()
+	c.Config.KiteKey = ""
+	defer c.Close()
+
+	refreshed, err := c.RefreshToken(res.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &kite.Request{Method: "kite.ping", LocalKite: m, Auth: &kite.Auth{Type: "token", Key: refreshed.Token}}
+	if err := m.AuthenticateFromToken(r); err != nil {
+		t.Fatalf("refreshed token: %s", err)
+	}
+
+	// Tokens issued for refresh tokens are short-lived.
+	claims := &kitekey.KiteClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(refreshed.Token, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := time.Until(time.Unix(claims.ExpiresAt, 0)); ttl > RefreshedTokenTTL+TokenLeeway {
+		t.Fatalf("got token expiring in %s, want at most %s", ttl, RefreshedTokenTTL+TokenLeeway)
+	}
+
+	if _, err := c.RefreshToken(refreshed.Token); err == nil {
+		t.Fatal("token accepted as refresh token")
+	}
+
+	// Refresh tokens are rotated, the one used is rejected.
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == res.RefreshToken {
+		t.Fatalf("got refresh token %q, want a new one", refreshed.RefreshToken)
+	}
+
+	if _, err := c.RefreshToken(res.RefreshToken); err == nil {
+		t.Fatal("used refresh token accepted")
+	}
+
+	if _, err := c.RefreshToken(refreshed.RefreshToken); err != nil {
+		t.Fatalf("rotated refresh token: %s", err)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	m := kite.New("mathworker7", "1.1.1")
+	m.Config = conf.Config.Copy()
+	m.Config.Port = 6670
+	defer m.Close()
+
+	kiteURL := &url.URL{Scheme: "http", Host: "localhost:6670", Path: "/kite"}
+	if _, err := m.Register(kiteURL); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := m.GetRefreshToken(m.Kite())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := kite.New("revoker", "0.0.1")
+	c.Config = conf.Config.Copy()
+	c.Config.KiteKey = ""
+	defer c.Close()
+
+	if err := c.RevokeRefreshToken(res.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.RefreshToken(res.RefreshToken); err == nil {
+		t.Fatal("revoked refresh token accepted")
+	}
+
+	if err := c.RevokeRefreshToken(res.Token); err == nil {
+		t.Fatal("token revoked as refresh token")
+	}
+}
+
+func TestDelegatedToken(t *testing.T) {
+	register := func(name string, port int) *kite.Kite {
+		k := kite.New(name, "1.1.1")
+		k.Config = conf.Config.Copy()
+		k.Config.Port = port
+
+		kiteURL := &url.URL{Scheme: "http", Host: "localhost:" + strconv.Itoa(port), Path: "/kite"}
+		if _, err := k.Register(kiteURL); err != nil {
+			t.Fatal(err)
+		}
+
+		return k
+	}
+
+	front := register("frontend", 6668)
+	defer front.Close()
+
+	back := register("backend", 6669)
+	defer back.Close()
+
+	user := kite.New("browser", "0.0.1")
+	user.Config = conf.Config.Copy()
+	user.Config.KiteKey = testutil.NewToken("alice", conf.Private, conf.Public).Raw
+	defer user.Close()
+
+	userToken, err := user.GetToken(front.Kite())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &kite.Request{Auth: &kite.Auth{Type: "token", Key: userToken}}
+
+	token, err := front.GetDelegatedToken(back.Kite(), req, "square")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &kite.Request{Method: "square", LocalKite: back, Auth: &kite.Auth{Type: "token", Key: token}}
+	if err := back.AuthenticateFromToken(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Username != "alice" {
+		t.Errorf("got username %q, want alice", r.Username)
+	}
+
+	if r.Actor == nil || r.Actor.Subject != front.Kite().Username || r.Actor.Kite != front.Kite().String() {
+		t.Errorf("got actor %v, want %s", r.Actor, front.Kite())
+	}
+
+	r = &kite.Request{Method: "cube", LocalKite: back, Auth: &kite.Auth{Type: "token", Key: token}}
+	if err := back.AuthenticateFromToken(r); err == nil {
+		t.Error("delegated token allows calling a method out of its scope")
+	}
+
+	// The scope of the token of the user can not be widened.
+	userToken, err = user.GetScopedToken(front.Kite(), "square")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req = &kite.Request{Auth: &kite.Auth{Type: "token", Key: userToken}}
+	if _, err := front.GetDelegatedToken(back.Kite(), req, "cube"); err == nil {
+		t.Error("delegated token widens the scope of the user")
+	}
+
+	token, err = front.GetDelegatedToken(back.Kite(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r = &kite.Request{Method: "cube", LocalKite: back, Auth: &kite.Auth{Type: "token", Key: token}}
+	if err := back.AuthenticateFromToken(r); err == nil {
+		t.Error("delegated token allows calling a method out of the scope of the user")
+	}
+
+	// A token of the user for another kite cannot be delegated.
+	userToken, err = user.GetToken(back.Kite())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req = &kite.Request{Auth: &kite.Auth{Type: "token", Key: userToken}}
+	if _, err := front.GetDelegatedToken(back.Kite(), req); err == nil {
+		t.Error("token of another kite delegated")
+	}
+}
+
 func TestRegisterKite(t *testing.T) {
 	kiteURL := &url.URL{Scheme: "http", Host: "localhost:4444", Path: "/kite"}
 	m := kite.New("mathworker3", "1.1.1")
@@ -659,6 +856,38 @@ func TestGetQueryKey(t *testing.T) {
 	}
 }
 
+func TestGetQueryKeyPrefix(t *testing.T) {
+	cases := []struct {
+		query      protocol.KontrolQuery
+		constraint bool
+		key        string
+		filter     bool
+	}{
+		{protocol.KontrolQuery{Username: "cenk", Environment: "production"}, false, "/cenk/production", false},
+		{protocol.KontrolQuery{Username: "cenk", Name: "fs"}, false, "/cenk", true},
+		{protocol.KontrolQuery{Username: "cenk", Environment: "production", Name: "fs", Version: "< 1.2"}, true, "/cenk/production/fs", true},
+		{protocol.KontrolQuery{Username: "cenk", Environment: "production", Hostname: "caprica"}, false, "/cenk/production", true},
+	}
+
+	for i, c := range cases {
+		key, filter, err := getQueryKeyPrefix(&c.query, c.constraint)
+		if err != nil {
+			t.Errorf("%d: %s", i, err)
+			continue
+		}
+		if key != c.key {
+			t.Errorf("%d: got key %q, want %q", i, key, c.key)
+		}
+		if filter != c.filter {
+			t.Errorf("%d: got filter %t, want %t", i, filter, c.filter)
+		}
+	}
+
+	if _, _, err := getQueryKeyPrefix(&protocol.KontrolQuery{Environment: "production"}, false); err == nil {
+		t.Errorf("Error is expected")
+	}
+}
+
 func TestKontrolMultiKey(t *testing.T) {
 	if storage := os.Getenv("KONTROL_STORAGE"); storage != "postgres" {
 		t.Skipf("%q storage does not currently implement soft key pair deletes", storage)
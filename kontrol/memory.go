@@ -0,0 +1,132 @@
+package kontrol
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+
+	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
+	"github.com/koding/kite/protocol"
+)
+
+// MemStorage is a Storage keeping the kites in memory. It is meant for tests
+// and for single kontrols which can afford to lose the registrations on
+// restart, as kites register again once they reconnect.
+type MemStorage struct {
+	mu    sync.RWMutex
+	kites map[string]*protocol.KiteWithToken // by kite ID
+}
+
+var _ Storage = (*MemStorage)(nil)
+
+// NewMemStorage returns a new, empty in-memory storage.
+func NewMemStorage() *MemStorage {
+	return &MemStorage{
+		kites: make(map[string]*protocol.KiteWithToken),
+	}
+}
+
+// Get implements the Storage interface. The fields of the query are matched
+// like Etcd and Postgres do, including version constraints.
+func (m *MemStorage) Get(query *protocol.KontrolQuery) (Kites, error) {
+	versionConstraint, err := parseVersionConstraint(query.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	kites := make(Kites, 0)
+
+	for _, kite := range m.kites {
+		if matchQuery(&kite.Kite, query, versionConstraint) {
+			kiteCopy := *kite
+			kites = append(kites, &kiteCopy)
+		}
+	}
+
+	// randomize the result so the kites get the load evenly, like for
+	// the other storages
+	kites.Shuffle()
+
+	return kites, nil
+}
+
+// Add implements the Storage interface. It fails if a kite with the same ID
+// is already stored.
+func (m *MemStorage) Add(kite *protocol.Kite, value *kontrolprotocol.RegisterValue) error {
+	if err := validateValue(value); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.kites[kite.ID]; ok {
+		return fmt.Errorf("kite %q is already stored", kite.ID)
+	}
+
+	m.kites[kite.ID] = newKiteWithToken(kite, value)
+	return nil
+}
+
+// Update implements the Storage interface. Kites which are not stored are
+// ignored.
+func (m *MemStorage) Update(kite *protocol.Kite, value *kontrolprotocol.RegisterValue) error {
+	if _, err := url.Parse(value.URL); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored, ok := m.kites[kite.ID]; ok {
+		stored.URL = value.URL
+	}
+
+	return nil
+}
+
+// Delete implements the Storage interface.
+func (m *MemStorage) Delete(kite *protocol.Kite) error {
+	m.mu.Lock()
+	delete(m.kites, kite.ID)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Upsert implements the Storage interface.
+func (m *MemStorage) Upsert(kite *protocol.Kite, value *kontrolprotocol.RegisterValue) error {
+	if err := validateValue(value); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.kites[kite.ID] = newKiteWithToken(kite, value)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func validateValue(value *kontrolprotocol.RegisterValue) error {
+	if _, err := url.Parse(value.URL); err != nil {
+		return err
+	}
+
+	if value.KeyID == "" {
+		return errors.New("memory: keyId is empty")
+	}
+
+	return nil
+}
+
+func newKiteWithToken(kite *protocol.Kite, value *kontrolprotocol.RegisterValue) *protocol.KiteWithToken {
+	return &protocol.KiteWithToken{
+		Kite:  *kite,
+		URL:   value.URL,
+		KeyID: value.KeyID,
+	}
+}
@@ -0,0 +1,115 @@
+package kontrol_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/clock"
+	"github.com/koding/kite/kontrol"
+	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
+	"github.com/koding/kite/protocol"
+)
+
+func TestMemStorage(t *testing.T) {
+	m := kontrol.NewMemStorage()
+
+	kites := []*protocol.Kite{
+		{Username: "alice", Environment: "test", Name: "math", Version: "1.0.0", Region: "eu", Hostname: "h1", ID: "1"},
+		{Username: "alice", Environment: "test", Name: "math", Version: "1.2.0", Region: "us", Hostname: "h2", ID: "2"},
+		{Username: "alice", Environment: "test", Name: "echo", Version: "1.0.0", Region: "eu", Hostname: "h1", ID: "3"},
+		{Username: "bob", Environment: "test", Name: "math", Version: "2.0.0", Region: "eu", Hostname: "h3", ID: "4"},
+	}
+
+	for _, k := range kites {
+		value := &kontrolprotocol.RegisterValue{URL: "http://" + k.Hostname + "/kite", KeyID: "key"}
+		if err := m.Add(k, value); err != nil {
+			t.Fatalf("Add(%s)=%s", k, err)
+		}
+	}
+
+	if err := m.Add(kites[0], &kontrolprotocol.RegisterValue{URL: "http://h1/kite", KeyID: "key"}); err == nil {
+		t.Fatal("want error adding a stored kite")
+	}
+
+	if err := m.Upsert(kites[1], &kontrolprotocol.RegisterValue{URL: "http://h2:8080/kite"}); err == nil {
+		t.Fatal("want error for empty key ID")
+	}
+
+	if err := m.Update(kites[1], &kontrolprotocol.RegisterValue{URL: "http://h2:8080/kite"}); err != nil {
+		t.Fatalf("Update()=%s", err)
+	}
+
+	if err := m.Delete(kites[2]); err != nil {
+		t.Fatalf("Delete()=%s", err)
+	}
+
+	cases := []struct {
+		query *protocol.KontrolQuery
+		ids   []string
+	}{
+		{&protocol.KontrolQuery{Username: "alice"}, []string{"1", "2"}},
+		{&protocol.KontrolQuery{Name: "math"}, []string{"1", "2", "4"}},
+		{&protocol.KontrolQuery{Name: "math", Region: "eu"}, []string{"1", "4"}},
+		{&protocol.KontrolQuery{Name: "math", Version: "1.2.0"}, []string{"2"}},
+		{&protocol.KontrolQuery{Name: "math", Version: ">= 1.1, < 3"}, []string{"2", "4"}},
+		{&protocol.KontrolQuery{ID: "4"}, []string{"4"}},
+		{&protocol.KontrolQuery{Name: "echo"}, nil},
+	}
+
+	for _, cas := range cases {
+		got, err := m.Get(cas.query)
+		if err != nil {
+			t.Fatalf("Get(%+v)=%s", cas.query, err)
+		}
+
+		var ids []string
+		for _, k := range got {
+			ids = append(ids, k.Kite.ID)
+
+			if k.Kite.ID == "2" && k.URL != "http://h2:8080/kite" {
+				t.Errorf("got URL %q, want the updated one", k.URL)
+			}
+		}
+
+		sort.Strings(ids)
+
+		if len(ids) != len(cas.ids) {
+			t.Errorf("Get(%+v): got %v, want %v", cas.query, ids, cas.ids)
+			continue
+		}
+
+		for i := range ids {
+			if ids[i] != cas.ids[i] {
+				t.Errorf("Get(%+v): got %v, want %v", cas.query, ids, cas.ids)
+				break
+			}
+		}
+	}
+
+	if _, err := m.Get(&protocol.KontrolQuery{Version: "not a version"}); err == nil {
+		t.Fatal("want error for an invalid version constraint")
+	}
+}
+
+func TestMemRevocationStorage(t *testing.T) {
+	c := clock.NewMock(time.Unix(1000, 0))
+	m := kontrol.NewMemRevocationStorage(c)
+
+	expires := c.Now().Add(time.Hour)
+
+	if unused, err := m.Revoke("id", expires); err != nil || !unused {
+		t.Fatalf("Revoke()=%t, %v, want true", unused, err)
+	}
+
+	if unused, err := m.Revoke("id", expires); err != nil || unused {
+		t.Fatalf("Revoke()=%t, %v, want false for a revoked token", unused, err)
+	}
+
+	// IDs are dropped once the tokens expire, as they are rejected anyway.
+	c.Add(2 * time.Hour)
+
+	if unused, err := m.Revoke("id", expires); err != nil || !unused {
+		t.Fatalf("Revoke()=%t, %v, want true for an expired token", unused, err)
+	}
+}
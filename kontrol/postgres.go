@@ -5,14 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"strings"
 	"time"
 
-	"github.com/hashicorp/go-version"
 	sq "github.com/lann/squirrel"
 	"github.com/lib/pq"
 
 	"github.com/koding/kite"
+	"github.com/koding/kite/clock"
 	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
 	"github.com/koding/kite/protocol"
 	"github.com/koding/multiconfig"
@@ -36,6 +35,9 @@ type PostgresConfig struct {
 type Postgres struct {
 	DB  *sql.DB
 	Log kite.Logger
+
+	// Clock ticks the cleaner of expired rows, clock.Real if nil.
+	Clock clock.Clock
 }
 
 var (
@@ -44,6 +46,12 @@ var (
 )
 
 func NewPostgres(conf *PostgresConfig, log kite.Logger) *Postgres {
+	return NewPostgresWithClock(conf, log, clock.Real)
+}
+
+// NewPostgresWithClock is like NewPostgres, with the cleaner of expired rows
+// ticking by c, e.g. the Clock of the kontrol kite.
+func NewPostgresWithClock(conf *PostgresConfig, log kite.Logger, c clock.Clock) *Postgres {
 	if conf == nil {
 		conf = new(PostgresConfig)
 
@@ -77,8 +85,9 @@ func NewPostgres(conf *PostgresConfig, log kite.Logger) *Postgres {
 	}
 
 	p := &Postgres{
-		DB:  db,
-		Log: log,
+		DB:    db,
+		Log:   log,
+		Clock: c,
 	}
 
 	cleanInterval := 120 * time.Second // clean every 120 second
@@ -100,7 +109,15 @@ func (p *Postgres) RunCleaner(interval, expire time.Duration) {
 		}
 	}
 
-	for range time.Tick(interval) {
+	c := p.Clock
+	if c == nil {
+		c = clock.Real
+	}
+
+	ticker := c.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C() {
 		cleanFunc()
 	}
 }
@@ -132,36 +149,23 @@ func (p *Postgres) Get(query *protocol.KontrolQuery) (Kites, error) {
 		return nil, err
 	}
 
-	var hasVersionConstraint bool // does query contains a constraint on version?
-	var keyRest string            // query key after the version field
-	var versionConstraint version.Constraints
-	// NewVersion returns an error if it's a constraint, like: ">= 1.0, < 1.4"
-	_, err = version.NewVersion(query.Version)
-	if err != nil && query.Version != "" {
-		// now parse our constraint
-		versionConstraint, err = version.NewConstraint(query.Version)
-		if err != nil {
-			// version is a malformed, just return the error
-			return nil, err
-		}
+	// does query contains a constraint on version?
+	versionConstraint, err := parseVersionConstraint(query.Version)
+	if err != nil {
+		// version is a malformed, just return the error
+		return nil, err
+	}
 
-		hasVersionConstraint = true
-		nameQuery := &protocol.KontrolQuery{
-			Username:    query.Username,
-			Environment: query.Environment,
-			Name:        query.Name,
-		}
+	if versionConstraint != nil {
+		versionQuery := *query
+		versionQuery.Version = ""
 
-		// We will make a get request to all nodes under this name
-		// and filter the result later.
-		sqlQuery, args, err = selectQuery(nameQuery)
+		// We will make a get request to all versions matching the other
+		// fields and filter the result later.
+		sqlQuery, args, err = selectQuery(&versionQuery)
 		if err != nil {
 			return nil, err
 		}
-
-		// Rest of the key after version field
-		keyRest = "/" + strings.TrimRight(
-			query.Region+"/"+query.Hostname+"/"+query.ID, "/")
 	}
 
 	rows, err := p.DB.Query(sqlQuery, args...)
@@ -230,8 +234,8 @@ func (p *Postgres) Get(query *protocol.KontrolQuery) (Kites, error) {
 	}
 
 	// Filter kites by version constraint
-	if hasVersionConstraint {
-		kites.Filter(versionConstraint, keyRest)
+	if versionConstraint != nil {
+		kites.FilterQuery(query, versionConstraint)
 	}
 
 	// randomize the result
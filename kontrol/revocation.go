@@ -0,0 +1,61 @@
+package kontrol
+
+import (
+	"sync"
+	"time"
+
+	"github.com/koding/kite/clock"
+)
+
+// RevocationStorage keeps the IDs of the refresh tokens which were used or
+// revoked, until they expire.
+type RevocationStorage interface {
+	// Revoke revokes the token with the given ID, which expires at the
+	// given time. It reports whether the token was not revoked before, so
+	// a refresh token is exchanged only once even if it is used
+	// concurrently.
+	Revoke(id string, expires time.Time) (bool, error)
+}
+
+// MemRevocationStorage is a RevocationStorage keeping the IDs in memory. It
+// is meant for single kontrols, a restart of kontrol makes the refresh
+// tokens used before valid again.
+type MemRevocationStorage struct {
+	clock clock.Clock
+
+	mu  sync.Mutex
+	ids map[string]time.Time // expiration by token ID
+}
+
+var _ RevocationStorage = (*MemRevocationStorage)(nil)
+
+// NewMemRevocationStorage returns a new, empty in-memory storage, which
+// drops the IDs of tokens expired according to c.
+func NewMemRevocationStorage(c clock.Clock) *MemRevocationStorage {
+	return &MemRevocationStorage{
+		clock: c,
+		ids:   make(map[string]time.Time),
+	}
+}
+
+// Revoke implements the RevocationStorage interface.
+func (m *MemRevocationStorage) Revoke(id string, expires time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+
+	for id, exp := range m.ids {
+		if now.After(exp) {
+			delete(m.ids, id)
+		}
+	}
+
+	if _, ok := m.ids[id]; ok {
+		return false, nil
+	}
+
+	m.ids[id] = expires
+
+	return true, nil
+}
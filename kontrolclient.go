@@ -66,6 +66,14 @@ func (k *Kite) SetupKontrolClient() error {
 		Key:  k.KiteKey(),
 	}
 
+	if k.Config.KontrolTLS != nil {
+		cfg, err := k.Config.Pinned(k.Config.KontrolTLS)
+		if err != nil {
+			return err
+		}
+		client.Config = cfg
+	}
+
 	k.kontrol.Lock()
 	k.kontrol.Client = client
 	k.kontrol.Unlock()
@@ -175,6 +183,7 @@ func (k *Kite) getKites(args protocol.GetKitesArgs) ([]*Client, error) {
 
 		token.RenewWhenExpires()
 		c.closeRenewer = token.disconnect
+		c.renewer = token
 	}
 
 	return clients, nil
@@ -205,6 +214,124 @@ func (k *Kite) GetToken(kite *protocol.Kite) (string, error) {
 	return tkn, nil
 }
 
+// GetRefreshToken is used to obtain a token for the given kite along with a
+// refresh token, which gets new tokens with RefreshToken once the token
+// expires. Clients authenticating with the token renew it with the refresh
+// token if it is set in their Auth, so Kontrol issues short-lived tokens
+// along with refresh tokens. Like with GetScopedToken, the tokens may only be used to call the
+// methods of scope, if not empty.
+func (k *Kite) GetRefreshToken(kite *protocol.Kite, scope ...string) (*protocol.TokenResult, error) {
+	if err := k.SetupKontrolClient(); err != nil {
+		return nil, err
+	}
+
+	<-k.kontrol.readyConnected
+
+	args := &protocol.GetTokenArgs{
+		KontrolQuery: *kite.Query(),
+		Scope:        scope,
+		Refresh:      true,
+	}
+
+	result, err := k.kontrol.TellWithTimeout("getToken", k.Config.Timeout, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var res protocol.TokenResult
+	err = result.Unmarshal(&res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// GetDelegatedToken is used to obtain a token for the given kite on behalf
+// of the user who made the request, which must be authenticated with a
+// token. The token authenticates calls as the user, with the local kite
+// recorded as the actor, see Request.Actor, so kites called in the name of
+// the user can authorize the user instead of the local kite. Like with
+// GetScopedToken, the token may only be used to call the methods of scope,
+// if not empty. It expires with the token of the request.
+func (k *Kite) GetDelegatedToken(kite *protocol.Kite, r *Request, scope ...string) (string, error) {
+	if r.Auth == nil || r.Auth.Type != "token" {
+		return "", errors.New("request is not authenticated with a token")
+	}
+
+	if err := k.SetupKontrolClient(); err != nil {
+		return "", err
+	}
+
+	<-k.kontrol.readyConnected
+
+	args := &protocol.GetTokenArgs{
+		KontrolQuery: *kite.Query(),
+		Scope:        scope,
+		OnBehalfOf:   r.Auth.Key,
+	}
+
+	result, err := k.kontrol.TellWithTimeout("getToken", k.Config.Timeout, args)
+	if err != nil {
+		return "", err
+	}
+
+	var tkn string
+	err = result.Unmarshal(&tkn)
+	if err != nil {
+		return "", err
+	}
+
+	return tkn, nil
+}
+
+// RefreshToken is used to obtain a new token with a refresh token given by
+// GetRefreshToken. The kite does not need a kite key for it, the refresh
+// token is the credential. Refresh tokens are used once, the result holds
+// a new refresh token for getting the next token.
+func (k *Kite) RefreshToken(refreshToken string) (*protocol.TokenResult, error) {
+	if err := k.SetupKontrolClient(); err != nil {
+		return nil, err
+	}
+
+	<-k.kontrol.readyConnected
+
+	args := &protocol.RefreshTokenArgs{
+		RefreshToken: refreshToken,
+	}
+
+	result, err := k.kontrol.TellWithTimeout("refreshToken", k.Config.Timeout, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var res protocol.TokenResult
+	err = result.Unmarshal(&res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// RevokeRefreshToken revokes a refresh token given by GetRefreshToken or
+// RefreshToken, so it gets no new tokens anymore. Tokens got with it are
+// valid until they expire.
+func (k *Kite) RevokeRefreshToken(refreshToken string) error {
+	if err := k.SetupKontrolClient(); err != nil {
+		return err
+	}
+
+	<-k.kontrol.readyConnected
+
+	args := &protocol.RefreshTokenArgs{
+		RefreshToken: refreshToken,
+	}
+
+	_, err := k.kontrol.TellWithTimeout("revokeToken", k.Config.Timeout, args)
+	return err
+}
+
 // SendWebRTCRequest sends requests to kontrol for signalling purposes.
 func (k *Kite) SendWebRTCRequest(req *protocol.WebRTCSignalMessage) error {
 	if err := k.SetupKontrolClient(); err != nil {
@@ -247,6 +374,36 @@ func (k *Kite) GetTokenForce(kite *protocol.Kite) (string, error) {
 	return tkn, nil
 }
 
+// GetScopedToken is used to obtain a token for the given kite which may only
+// be used to call the methods of scope. Entries of scope ending with "*"
+// allow every method starting with the rest of the entry, e.g. "metrics.*".
+// The kite rejects calls of other methods made with the token.
+func (k *Kite) GetScopedToken(kite *protocol.Kite, scope ...string) (string, error) {
+	if err := k.SetupKontrolClient(); err != nil {
+		return "", err
+	}
+
+	<-k.kontrol.readyConnected
+
+	args := &protocol.GetTokenArgs{
+		KontrolQuery: *kite.Query(),
+		Scope:        scope,
+	}
+
+	result, err := k.kontrol.TellWithTimeout("getToken", k.Config.Timeout, args)
+	if err != nil {
+		return "", err
+	}
+
+	var tkn string
+	err = result.Unmarshal(&tkn)
+	if err != nil {
+		return "", err
+	}
+
+	return tkn, nil
+}
+
 // GetKey is used to get a new public key from kontrol if the current one is
 // invalidated. The key is also replaced in memory and every request is going
 // to use it. This means even if kite.key contains the old key, the kite itself
@@ -278,8 +435,8 @@ func (k *Kite) GetKey() (string, error) {
 
 // NewKeyRenewer renews the internal key every given interval
 func (k *Kite) NewKeyRenewer(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	for range ticker.C {
+	ticker := k.Clock.NewTicker(interval)
+	for range ticker.C() {
 		_, err := k.GetKey()
 		if err != nil {
 			k.Log.Warning("Key renew failed: %s", err)
@@ -324,7 +481,7 @@ func (k *Kite) RegisterForever(kiteURL *url.URL) error {
 			k.Log.Error("Cannot register to Kontrol: %s Will retry after %d seconds",
 				err, kontrolRetryDuration/time.Second)
 
-			time.AfterFunc(kontrolRetryDuration, func() {
+			k.Clock.AfterFunc(kontrolRetryDuration, func() {
 				select {
 				case k.kontrol.registerChan <- u:
 				default:
@@ -412,6 +569,13 @@ func (k *Kite) RegisterToTunnel() {
 func (k *Kite) RegisterToProxy(registerURL *url.URL, query *protocol.KontrolQuery) {
 	go k.RegisterForever(nil)
 
+	// Proxy kites are dialed with the certificates pinned by ProxyTLS.
+	proxyConfig, err := k.Config.Pinned(k.Config.ProxyTLS)
+	if err != nil {
+		k.Log.Error("Cannot pin certificates of Proxy kites: %s", err)
+		return
+	}
+
 	for {
 		var proxyKite *Client
 
@@ -431,7 +595,7 @@ func (k *Kite) RegisterToProxy(registerURL *url.URL, query *protocol.KontrolQuer
 			kites, err := k.GetKites(query)
 			if err != nil {
 				k.Log.Error("Cannot get Proxy kites from Kontrol: %s", err.Error())
-				time.Sleep(proxyRetryDuration)
+				k.Clock.Sleep(proxyRetryDuration)
 				continue
 			}
 
@@ -440,6 +604,10 @@ func (k *Kite) RegisterToProxy(registerURL *url.URL, query *protocol.KontrolQuer
 			proxyKite = kites[rand.Int()%len(kites)]
 		}
 
+		if k.Config.ProxyTLS != nil {
+			proxyKite.Config = proxyConfig
+		}
+
 		// Notify us on disconnect
 		disconnect := make(chan bool, 1)
 		proxyKite.OnDisconnect(func() {
@@ -451,7 +619,7 @@ func (k *Kite) RegisterToProxy(registerURL *url.URL, query *protocol.KontrolQuer
 
 		proxyURL, err := k.registerToProxyKite(proxyKite, registerURL)
 		if err != nil {
-			time.Sleep(proxyRetryDuration)
+			k.Clock.Sleep(proxyRetryDuration)
 			continue
 		}
 
@@ -516,7 +684,7 @@ func (k *Kite) TellKontrolWithTimeout(method string, timeout time.Duration, args
 
 	// Wait for readyConnect, or timeout
 	select {
-	case <-time.After(k.Config.Timeout):
+	case <-k.Clock.After(k.Config.Timeout):
 		return nil, &Error{
 			Type: "timeout",
 			Message: fmt.Sprintf(
@@ -0,0 +1,161 @@
+package loadtest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Distribution gives the sizes of the payloads sent by the load generator.
+type Distribution interface {
+	// Size returns the size of the next payload, in bytes.
+	Size(r *rand.Rand) int
+}
+
+// Fixed is a distribution of payloads that are all of the same size.
+type Fixed int
+
+// Size implements the Distribution interface.
+func (f Fixed) Size(*rand.Rand) int { return int(f) }
+
+func (f Fixed) String() string { return strconv.Itoa(int(f)) }
+
+// Uniform is a distribution of payload sizes spread evenly between Min and
+// Max, both included.
+type Uniform struct {
+	Min, Max int
+}
+
+// Size implements the Distribution interface.
+func (u Uniform) Size(r *rand.Rand) int {
+	if u.Max <= u.Min {
+		return u.Min
+	}
+	return u.Min + r.Intn(u.Max-u.Min+1)
+}
+
+func (u Uniform) String() string { return fmt.Sprintf("%d-%d", u.Min, u.Max) }
+
+// WeightedSize is a payload size of a Weighted distribution.
+type WeightedSize struct {
+	Size   int
+	Weight float64
+}
+
+// Weighted is a distribution of a set of payload sizes, each of them given
+// with a probability proportional to its weight.
+type Weighted []WeightedSize
+
+// Size implements the Distribution interface.
+func (w Weighted) Size(r *rand.Rand) int {
+	if len(w) == 0 {
+		return 0
+	}
+
+	var total float64
+	for _, s := range w {
+		total += s.Weight
+	}
+
+	x := r.Float64() * total
+	for _, s := range w {
+		if x < s.Weight {
+			return s.Size
+		}
+		x -= s.Weight
+	}
+
+	return w[len(w)-1].Size
+}
+
+func (w Weighted) String() string {
+	sizes := make([]string, len(w))
+	for i, s := range w {
+		sizes[i] = fmt.Sprintf("%d:%g", s.Size, s.Weight)
+	}
+	return strings.Join(sizes, ",")
+}
+
+// ParseDistribution parses a payload size distribution, which is one of:
+//
+//	1024              a Fixed size
+//	64-4096           a Uniform size between 64 and 4096
+//	64:9,65536:1      a Weighted distribution, here of 64 byte payloads
+//	                  nine times out of ten and of 64KiB ones otherwise
+//
+// Sizes may be given with a k or m suffix, for KiB and MiB.
+func ParseDistribution(s string) (Distribution, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case strings.Contains(s, ":"):
+		var w Weighted
+		for _, field := range strings.Split(s, ",") {
+			i := strings.IndexByte(field, ':')
+			if i == -1 {
+				return nil, fmt.Errorf("invalid weighted size %q", field)
+			}
+
+			size, err := parseSize(field[:i])
+			if err != nil {
+				return nil, err
+			}
+
+			weight, err := strconv.ParseFloat(strings.TrimSpace(field[i+1:]), 64)
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight %q", field[i+1:])
+			}
+
+			w = append(w, WeightedSize{Size: size, Weight: weight})
+		}
+		return w, nil
+	case strings.Contains(s, "-"):
+		i := strings.IndexByte(s, '-')
+
+		min, err := parseSize(s[:i])
+		if err != nil {
+			return nil, err
+		}
+
+		max, err := parseSize(s[i+1:])
+		if err != nil {
+			return nil, err
+		}
+
+		if max < min {
+			return nil, fmt.Errorf("invalid size range %q", s)
+		}
+
+		return Uniform{Min: min, Max: max}, nil
+	default:
+		size, err := parseSize(s)
+		if err != nil {
+			return nil, err
+		}
+		return Fixed(size), nil
+	}
+}
+
+func parseSize(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, errors.New("empty payload size")
+	}
+
+	unit := 1
+	switch s[len(s)-1] {
+	case 'k':
+		unit, s = 1<<10, s[:len(s)-1]
+	case 'm':
+		unit, s = 1<<20, s[:len(s)-1]
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid payload size %q", s)
+	}
+
+	return n * unit, nil
+}
@@ -0,0 +1,206 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/koding/kite"
+)
+
+// Generator calls a method of a kite from concurrent workers, for a duration
+// or a number of requests, and collects the latencies and errors of the
+// calls.
+type Generator struct {
+	// Clients are the dialed connections to the kite, the workers are
+	// spread over them.
+	Clients []*kite.Client
+
+	// Method is the name of the called method.
+	Method string
+
+	// Args are the arguments of each call.
+	Args []interface{}
+
+	// Payload, if not nil, gives the size of a string appended to the
+	// arguments of each call.
+	Payload Distribution
+
+	// Concurrency is the number of workers, 1 by default.
+	Concurrency int
+
+	// Duration of the load test. If zero, the load test runs until Requests
+	// requests are made or the context is done.
+	Duration time.Duration
+
+	// Requests, if not zero, stops the load test after the number of
+	// requests.
+	Requests int64
+
+	// Timeout of each request, 4s by default.
+	Timeout time.Duration
+
+	// Buckets is the number of buckets of the latency histogram, 10 by
+	// default.
+	Buckets int
+}
+
+// Run runs the load test until its duration passed, its requests are made
+// or ctx is done, whichever comes first, and returns its result.
+func (g *Generator) Run(ctx context.Context) (*Result, error) {
+	if len(g.Clients) == 0 {
+		return nil, errors.New("loadtest: no clients given")
+	}
+
+	if g.Duration <= 0 && g.Requests <= 0 && ctx.Done() == nil {
+		return nil, errors.New("loadtest: no duration or number of requests given")
+	}
+
+	concurrency := g.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	connections := len(g.Clients)
+	if connections > concurrency {
+		connections = concurrency
+	}
+
+	if g.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.Duration)
+		defer cancel()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		issued int64
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+
+	result := &Result{
+		Method:      g.Method,
+		Concurrency: concurrency,
+		Connections: connections,
+		ErrorCounts: make(map[string]int),
+	}
+
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			w := &worker{
+				g:      g,
+				client: g.Clients[i%connections],
+				rand:   rand.New(rand.NewSource(time.Now().UnixNano() + int64(i))),
+				errs:   make(map[string]int),
+			}
+
+			for ctx.Err() == nil {
+				if g.Requests > 0 && atomic.AddInt64(&issued, 1) > g.Requests {
+					cancel()
+					break
+				}
+
+				w.call()
+			}
+
+			mu.Lock()
+			result.latencies = append(result.latencies, w.latencies...)
+			for msg, n := range w.errs {
+				result.ErrorCounts[msg] += n
+				result.Errors += n
+			}
+			mu.Unlock()
+		}(i)
+	}
+
+	wg.Wait()
+	result.Duration = time.Since(start)
+	result.compute(g.buckets())
+
+	return result, nil
+}
+
+func (g *Generator) timeout() time.Duration {
+	if g.Timeout > 0 {
+		return g.Timeout
+	}
+	return 4 * time.Second
+}
+
+func (g *Generator) buckets() int {
+	if g.Buckets > 0 {
+		return g.Buckets
+	}
+	return 10
+}
+
+// worker makes the calls of a single worker of a load test.
+type worker struct {
+	g         *Generator
+	client    *kite.Client
+	rand      *rand.Rand
+	pad       string
+	latencies []time.Duration
+	errs      map[string]int
+}
+
+func (w *worker) call() {
+	args := w.g.Args
+	if w.g.Payload != nil {
+		args = append(args[:len(args):len(args)], w.payload(w.g.Payload.Size(w.rand)))
+	}
+
+	start := time.Now()
+	if _, err := w.client.TellWithTimeout(w.g.Method, w.g.timeout(), args...); err != nil {
+		w.errs[ErrorMessage(err)]++
+	} else {
+		w.latencies = append(w.latencies, time.Since(start))
+	}
+}
+
+// payload returns a string of n random letters. The letters are generated
+// once per worker and shared by its payloads.
+func (w *worker) payload(n int) string {
+	if n <= 0 {
+		return ""
+	}
+
+	if len(w.pad) < n {
+		const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+		p := make([]byte, n)
+		for i := range p {
+			p[i] = letters[w.rand.Intn(len(letters))]
+		}
+		w.pad = string(p)
+	}
+
+	return w.pad[:n]
+}
+
+// ErrorMessage returns the message errors are grouped by in the result of a
+// load test. Errors returned by the kite carry the ID of the failed request,
+// which is left out.
+func ErrorMessage(err error) string {
+	switch e := err.(type) {
+	case *kite.Error:
+		e2 := *e
+		e2.RequestID = ""
+		return e2.Error()
+	case kite.Error:
+		e.RequestID = ""
+		return e.Error()
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,80 @@
+// Package loadtest provides a kite for load testing and a load generator
+// calling the methods of a kite from concurrent workers.
+//
+// The load testing kite exports the methods:
+//
+//	loadtest.echo(args...)   returns its first argument, or null
+//	loadtest.sleep(ms)       returns ms after sleeping for ms milliseconds
+//	loadtest.size(n)         returns a string of n bytes
+//
+// A benchmark of the kite started with "loadtest -port 4568" is run with:
+//
+//	kitectl bench -payload=64-4096 http://127.0.0.1:4568/kite loadtest.echo
+package loadtest
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/koding/kite"
+)
+
+// Prefix is the prefix of the names of the load testing methods.
+const Prefix = "loadtest."
+
+// maxSize limits the strings returned by loadtest.size.
+const maxSize = 64 << 20
+
+// maxSleep limits how long loadtest.sleep sleeps.
+const maxSleep = time.Minute
+
+// NewKite returns a new load testing kite. Authentication is disabled, the
+// kite must not be reachable from untrusted networks.
+func NewKite() *kite.Kite {
+	k := kite.New("loadtest", "1.0.0")
+	k.Config.DisableAuthentication = true
+	HandleMethods(k)
+	return k
+}
+
+// HandleMethods adds the load testing methods to k.
+func HandleMethods(k *kite.Kite) {
+	k.HandleFunc(Prefix+"echo", echo)
+	k.HandleFunc(Prefix+"sleep", sleep)
+	k.HandleFunc(Prefix+"size", size)
+}
+
+func echo(r *kite.Request) (interface{}, error) {
+	if r.Args == nil {
+		return nil, nil
+	}
+
+	args := r.Args.MustSlice()
+	if len(args) == 0 || args[0] == nil {
+		return nil, nil
+	}
+
+	// The argument is returned as it was received, without being decoded.
+	return args[0], nil
+}
+
+func sleep(r *kite.Request) (interface{}, error) {
+	ms := r.Args.One().MustFloat64()
+
+	d := time.Duration(ms * float64(time.Millisecond))
+	if d < 0 || d > maxSleep {
+		return nil, errors.New("sleep out of range")
+	}
+
+	time.Sleep(d)
+	return ms, nil
+}
+
+func size(r *kite.Request) (interface{}, error) {
+	n := int(r.Args.One().MustFloat64())
+	if n < 0 || n > maxSize {
+		return nil, errors.New("size out of range")
+	}
+	return strings.Repeat("x", n), nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/koding/kite/loadtest"
+)
+
+var (
+	flagIP   = flag.String("ip", "0.0.0.0", "Listening IP")
+	flagPort = flag.Int("port", 4568, "Server port to bind")
+)
+
+func main() {
+	flag.Parse()
+
+	k := loadtest.NewKite()
+	k.Config.IP = *flagIP
+	k.Config.Port = *flagPort
+	k.Run()
+}
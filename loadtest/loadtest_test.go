@@ -0,0 +1,129 @@
+package loadtest_test
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/kitetest"
+	"github.com/koding/kite/loadtest"
+)
+
+func TestParseDistribution(t *testing.T) {
+	cases := map[string]loadtest.Distribution{
+		"1024":         loadtest.Fixed(1024),
+		"2k":           loadtest.Fixed(2048),
+		"64-4096":      loadtest.Uniform{Min: 64, Max: 4096},
+		"64:9,1m:1":    loadtest.Weighted{{Size: 64, Weight: 9}, {Size: 1 << 20, Weight: 1}},
+		" 0 - 1 ":      loadtest.Uniform{Min: 0, Max: 1},
+		"10:1, 20:0.5": loadtest.Weighted{{Size: 10, Weight: 1}, {Size: 20, Weight: 0.5}},
+	}
+
+	for s, want := range cases {
+		got, err := loadtest.ParseDistribution(s)
+		if err != nil {
+			t.Errorf("ParseDistribution(%q)=%s", s, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseDistribution(%q)=%#v, want %#v", s, got, want)
+		}
+	}
+
+	for _, s := range []string{"", "x", "-1", "10-5", "10:", "10:-1", "1g"} {
+		if _, err := loadtest.ParseDistribution(s); err == nil {
+			t.Errorf("ParseDistribution(%q) did not fail", s)
+		}
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	u := loadtest.Uniform{Min: 10, Max: 20}
+	w := loadtest.Weighted{{Size: 1, Weight: 1}, {Size: 2, Weight: 0}}
+
+	for i := 0; i < 1000; i++ {
+		if n := u.Size(r); n < 10 || n > 20 {
+			t.Fatalf("Uniform.Size()=%d, want between 10 and 20", n)
+		}
+
+		if n := w.Size(r); n != 1 {
+			t.Fatalf("Weighted.Size()=%d, want 1", n)
+		}
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	srv := loadtest.NewKite()
+
+	c, err := kitetest.Connect(kite.New("client", "0.0.1"), srv)
+	if err != nil {
+		t.Fatalf("Connect()=%s", err)
+	}
+	defer c.Close()
+
+	g := &loadtest.Generator{
+		Clients:     []*kite.Client{c},
+		Method:      loadtest.Prefix + "echo",
+		Payload:     loadtest.Uniform{Min: 1, Max: 1024},
+		Concurrency: 4,
+		Requests:    200,
+	}
+
+	res, err := g.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run()=%s", err)
+	}
+
+	if res.Requests != 200 || res.Errors != 0 {
+		t.Fatalf("got %d requests and %d errors, want 200 and 0: %v", res.Requests, res.Errors, res.ErrorCounts)
+	}
+
+	var n int
+	for _, b := range res.Histogram {
+		n += b.Count
+	}
+
+	if n != res.Requests {
+		t.Fatalf("got %d requests in the histogram, want %d", n, res.Requests)
+	}
+
+	if l := res.Latency; l.Min > l.P50 || l.P50 > l.P99 || l.P99 > l.Max {
+		t.Fatalf("got unordered latencies %+v", l)
+	}
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	srv := loadtest.NewKite()
+
+	c, err := kitetest.Connect(kite.New("client", "0.0.1"), srv)
+	if err != nil {
+		t.Fatalf("Connect()=%s", err)
+	}
+	defer c.Close()
+
+	g := &loadtest.Generator{
+		Clients:  []*kite.Client{c},
+		Method:   loadtest.Prefix + "sleep",
+		Args:     []interface{}{-1},
+		Duration: 100 * time.Millisecond,
+	}
+
+	res, err := g.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run()=%s", err)
+	}
+
+	if res.Requests == 0 || res.Errors != res.Requests {
+		t.Fatalf("got %d errors of %d requests, want all requests to fail", res.Errors, res.Requests)
+	}
+
+	if len(res.ErrorCounts) != 1 {
+		t.Fatalf("got errors %v, want a single kind of error", res.ErrorCounts)
+	}
+}
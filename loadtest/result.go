@@ -0,0 +1,168 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Latency is the latency distribution of the successful requests of a load
+// test.
+type Latency struct {
+	Min  time.Duration `json:"minNs"`
+	Mean time.Duration `json:"meanNs"`
+	P50  time.Duration `json:"p50Ns"`
+	P90  time.Duration `json:"p90Ns"`
+	P95  time.Duration `json:"p95Ns"`
+	P99  time.Duration `json:"p99Ns"`
+	Max  time.Duration `json:"maxNs"`
+}
+
+// Bucket is a bucket of the latency histogram of a load test, counting the
+// requests with a latency from From, included, to To, excluded. The last
+// bucket includes To.
+type Bucket struct {
+	From  time.Duration `json:"fromNs"`
+	To    time.Duration `json:"toNs"`
+	Count int           `json:"count"`
+}
+
+// Result is the result of a load test.
+type Result struct {
+	Method      string         `json:"method"`
+	Concurrency int            `json:"concurrency"`
+	Connections int            `json:"connections"`
+	Duration    time.Duration  `json:"durationNs"`
+	Requests    int            `json:"requests"`
+	Errors      int            `json:"errors"`
+	ErrorRate   float64        `json:"errorRate"`
+	Throughput  float64        `json:"throughput"`
+	Latency     Latency        `json:"latency"`
+	Histogram   []Bucket       `json:"histogram,omitempty"`
+	ErrorCounts map[string]int `json:"errorCounts,omitempty"`
+
+	latencies []time.Duration
+}
+
+// Succeeded returns the number of successful requests.
+func (r *Result) Succeeded() int {
+	return r.Requests - r.Errors
+}
+
+// WriteHistogram writes the latency histogram to w, a line per bucket with
+// a bar of a length proportional to its count.
+func (r *Result) WriteHistogram(w io.Writer) error {
+	const width = 40
+
+	var max int
+	for _, b := range r.Histogram {
+		if b.Count > max {
+			max = b.Count
+		}
+	}
+
+	for _, b := range r.Histogram {
+		bar := 0
+		if max != 0 {
+			bar = (b.Count*width + max - 1) / max
+		}
+
+		_, err := fmt.Fprintf(w, "  %10s - %-10s %8d  %s\n", round(b.From), round(b.To), b.Count, strings.Repeat("#", bar))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Result) compute(buckets int) {
+	r.Requests = len(r.latencies) + r.Errors
+
+	if r.Requests != 0 {
+		r.ErrorRate = float64(r.Errors) / float64(r.Requests)
+	}
+
+	if r.Duration > 0 {
+		r.Throughput = float64(r.Requests) / r.Duration.Seconds()
+	}
+
+	if len(r.latencies) == 0 {
+		return
+	}
+
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+
+	var sum time.Duration
+	for _, d := range r.latencies {
+		sum += d
+	}
+
+	r.Latency = Latency{
+		Min:  r.latencies[0],
+		Mean: sum / time.Duration(len(r.latencies)),
+		P50:  percentile(r.latencies, 50),
+		P90:  percentile(r.latencies, 90),
+		P95:  percentile(r.latencies, 95),
+		P99:  percentile(r.latencies, 99),
+		Max:  r.latencies[len(r.latencies)-1],
+	}
+
+	r.Histogram = histogram(r.latencies, buckets)
+}
+
+// histogram returns the histogram of the sorted durations, over buckets of
+// exponentially growing widths between the smallest and the largest
+// duration.
+func histogram(sorted []time.Duration, buckets int) []Bucket {
+	min, max := sorted[0], sorted[len(sorted)-1]
+	if min <= 0 {
+		min = 1
+	}
+
+	if max <= min || buckets < 2 {
+		return []Bucket{{From: sorted[0], To: max, Count: len(sorted)}}
+	}
+
+	ratio := math.Pow(float64(max)/float64(min), 1/float64(buckets))
+
+	h := make([]Bucket, buckets)
+	from := sorted[0]
+	for i := range h {
+		to := time.Duration(float64(min) * math.Pow(ratio, float64(i+1)))
+		if i == len(h)-1 || to > max {
+			to = max
+		}
+		h[i] = Bucket{From: from, To: to}
+		from = to
+	}
+
+	i := 0
+	for _, d := range sorted {
+		for i < len(h)-1 && d >= h[i].To {
+			i++
+		}
+		h[i].Count++
+	}
+
+	return h
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
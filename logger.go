@@ -44,7 +44,13 @@ type Logger interface {
 // environment. It returns Info by default if no environment variable
 // is set.
 func getLogLevel() Level {
-	switch strings.ToUpper(os.Getenv("KITE_LOG_LEVEL")) {
+	return parseLogLevel(os.Getenv("KITE_LOG_LEVEL"))
+}
+
+// parseLogLevel returns the logging level with the given name, or Info if
+// the name is unknown.
+func parseLogLevel(name string) Level {
+	switch strings.ToUpper(name) {
 	case "DEBUG":
 		return DEBUG
 	case "WARNING":
@@ -10,15 +10,23 @@ import (
 
 // SetupSignalHandler listens to signals and toggles the log level to DEBUG
 // mode when it received a SIGUSR2 signal. Another SIGUSR2 toggles the log
-// level back to the old level.
+// level back to the old level. A SIGHUP reloads the configuration with
+// Reload.
 func (k *Kite) SetupSignalHandler() {
 	c := make(chan os.Signal, 1)
 
-	signal.Notify(c, syscall.SIGUSR2)
+	signal.Notify(c, syscall.SIGUSR2, syscall.SIGHUP)
 	go func() {
 		for s := range c {
 			k.Log.Info("Got signal: %s", s)
 
+			if s == syscall.SIGHUP {
+				if err := k.Reload(); err != nil {
+					k.Log.Error("Cannot reload configuration: %s", err)
+				}
+				continue
+			}
+
 			if debugMode {
 				// toogle back to old settings.
 				k.Log.Info("Disabling debug mode")
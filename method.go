@@ -61,6 +61,10 @@ type Method struct {
 	// the given auth type in the request.
 	authenticate bool
 
+	// strict defines if the arguments of the request are decoded strictly,
+	// see dnode.Partial.Strict.
+	strict bool
+
 	// handling defines how to handle chaining of kite.Handler middlewares.
 	handling MethodHandling
 
@@ -85,6 +89,7 @@ func (k *Kite) addHandle(method string, handler Handler) *Method {
 		name:         method,
 		handler:      handler,
 		authenticate: authenticate,
+		strict:       k.Config.StrictArguments,
 		handling:     k.MethodHandling,
 	}
 
@@ -98,6 +103,15 @@ func (m *Method) DisableAuthentication() *Method {
 	return m
 }
 
+// Strict makes the arguments of the method decoded strictly: unmarshaling
+// them into a struct fails with an argumentError if they have fields the
+// struct does not have or values of the wrong type, instead of silently
+// decoding what fits. See dnode.Partial.Strict.
+func (m *Method) Strict() *Method {
+	m.strict = true
+	return m
+}
+
 // Throttle throttles the method for each incoming request. The throttle
 // algorithm is based on token bucket implementation:
 // http://en.wikipedia.org/wiki/Token_bucket. Rate determines the number of
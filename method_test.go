@@ -3,6 +3,7 @@ package kite
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -246,3 +247,45 @@ func TestMethod_Base(t *testing.T) {
 	}
 
 }
+
+func TestMethod_Strict(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	type args struct {
+		Name string `json:"name"`
+	}
+
+	handler := func(r *Request) (interface{}, error) {
+		var a args
+		if err := r.Args.One().Unmarshal(&a); err != nil {
+			return nil, err
+		}
+		return a.Name, nil
+	}
+
+	k.HandleFunc("lax", handler)
+	k.HandleFunc("strict", handler).Strict()
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	arg := map[string]interface{}{"name": "kite", "nmae": "kite"}
+
+	if _, err := c.Tell("lax", arg); err != nil {
+		t.Fatalf("lax: %s", err)
+	}
+
+	_, err := c.Tell("strict", arg)
+	if e, ok := err.(*Error); !ok || e.Type != "argumentError" || !strings.Contains(e.Message, `"nmae"`) {
+		t.Fatalf("strict: got %v, want argumentError naming the unknown field", err)
+	}
+}
@@ -154,6 +154,37 @@ type GetTokenArgs struct {
 	KontrolQuery // kite to generate a token for
 
 	Force bool `json:"force"` // force creation of a new token
+
+	// Scope, if not empty, restricts the methods the token may call, see
+	// kitekey.KiteClaims.Scope.
+	Scope []string `json:"scope,omitempty"`
+
+	// Refresh requests a refresh token along with the token. If set the
+	// result is a TokenResult instead of the token.
+	Refresh bool `json:"refresh,omitempty"`
+
+	// OnBehalfOf, if set, is the token a user called the requesting kite
+	// with. The token is issued for the user instead, with the requesting
+	// kite as its actor, see kitekey.KiteClaims.Actor.
+	OnBehalfOf string `json:"onBehalfOf,omitempty"`
+}
+
+// TokenResult is the result of the "getToken" kontrol method when a
+// refresh token is requested, and of the "refreshToken" kontrol method.
+type TokenResult struct {
+	Token string `json:"token"`
+
+	// RefreshToken is a long-lived credential for getting new tokens
+	// with the "refreshToken" method, so they may be short-lived. It is
+	// used once, the "refreshToken" method gives a new one along with the
+	// token.
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+// RefreshTokenArgs is a request value for the "refreshToken" and
+// "revokeToken" kontrol methods.
+type RefreshTokenArgs struct {
+	RefreshToken string `json:"refreshToken"`
 }
 
 type WhoResult struct {
@@ -0,0 +1,209 @@
+// Package record records the frames of kite sessions to files and replays
+// them, for regression tests against real traffic and offline debugging of
+// protocol issues.
+//
+// A kite records all of its sessions with:
+//
+//	k.SessionHook = record.Hook("/var/log/kite/sessions")
+//
+// A recording is replayed to a kite, as if its client sent the frames
+// again, with:
+//
+//	frames, err := record.ReadFile(path)
+//	...
+//	replay := record.NewReplay(frames)
+//	go k.ServeSession(replay)
+//	sent, err := replay.Wait(time.Minute)
+//
+// or to a client, as if its remote kite answered again, by returning the
+// replay from Client.DialSession.
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+// Direction tells whether a frame is received or sent by the recorded side
+// of a session.
+type Direction string
+
+const (
+	Recv Direction = "recv"
+	Send Direction = "send"
+)
+
+// Frame is a frame of a recorded session, one JSON object per line in
+// recordings.
+type Frame struct {
+	// Time is the time since the beginning of the session.
+	Time time.Duration `json:"time"`
+
+	Dir  Direction `json:"dir"`
+	Data string    `json:"data"`
+}
+
+// Session is a sockjs.Session recording the frames of another one.
+type Session struct {
+	sockjs.Session
+
+	start time.Time
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error // first error writing the recording
+
+	closer io.Closer
+	once   sync.Once
+}
+
+var _ sockjs.Session = (*Session)(nil)
+
+// NewSession returns a session recording the frames of session to w.
+func NewSession(session sockjs.Session, w io.Writer) *Session {
+	return &Session{
+		Session: session,
+		start:   time.Now(),
+		enc:     json.NewEncoder(w),
+	}
+}
+
+// Recv implements the sockjs.Session interface. Once the session fails to
+// receive, it is over and the recording is closed, see Hook.
+func (s *Session) Recv() (string, error) {
+	msg, err := s.Session.Recv()
+	if err != nil {
+		s.closeRecording()
+		return msg, err
+	}
+
+	s.record(Recv, msg)
+	return msg, nil
+}
+
+// Send implements the sockjs.Session interface.
+func (s *Session) Send(msg string) error {
+	if err := s.Session.Send(msg); err != nil {
+		return err
+	}
+
+	s.record(Send, msg)
+	return nil
+}
+
+// Close implements the sockjs.Session interface.
+func (s *Session) Close(status uint32, reason string) error {
+	err := s.Session.Close(status, reason)
+	s.closeRecording()
+	return err
+}
+
+// RemoteAddr gives the remote address of the recorded session, if it has
+// one.
+func (s *Session) RemoteAddr() string {
+	if r, ok := s.Session.(interface {
+		RemoteAddr() string
+	}); ok {
+		return r.RemoteAddr()
+	}
+
+	return ""
+}
+
+// Err returns the first error writing the recording, if any. Writing stops
+// after an error, the session itself keeps working.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *Session) record(dir Direction, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil || s.enc == nil {
+		return
+	}
+
+	s.err = s.enc.Encode(&Frame{
+		Time: time.Since(s.start),
+		Dir:  dir,
+		Data: msg,
+	})
+}
+
+func (s *Session) closeRecording() {
+	s.once.Do(func() {
+		if s.closer == nil {
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if err := s.closer.Close(); err != nil && s.err == nil {
+			s.err = err
+		}
+
+		s.enc = nil // frames after the end of the session are dropped
+	})
+}
+
+// Hook returns a Kite.SessionHook recording every session to a file of its
+// own in dir, named after the start time and the ID of the session. If the
+// file cannot be created, the session is not recorded.
+func Hook(dir string) func(sockjs.Session) sockjs.Session {
+	return func(session sockjs.Session) sockjs.Session {
+		name := fmt.Sprintf("%s-%s.jsonl", time.Now().UTC().Format("20060102T150405.000000000"), session.ID())
+
+		f, err := os.OpenFile(filepath.Join(dir, filepath.Base(name)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return session
+		}
+
+		// Frames are written unbuffered, so the recording survives a
+		// crash of the kite.
+		s := NewSession(session, f)
+		s.closer = f
+
+		return s
+	}
+}
+
+// ReadFrames reads the frames of a recording.
+func ReadFrames(r io.Reader) ([]Frame, error) {
+	var frames []Frame
+
+	dec := json.NewDecoder(r)
+	for {
+		var f Frame
+		switch err := dec.Decode(&f); err {
+		case nil:
+			frames = append(frames, f)
+		case io.EOF:
+			return frames, nil
+		default:
+			return nil, fmt.Errorf("frame %d: %s", len(frames)+1, err)
+		}
+	}
+}
+
+// ReadFile reads the frames of the recording in the file.
+func ReadFile(path string) ([]Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadFrames(f)
+}
@@ -0,0 +1,121 @@
+package record_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/igm/sockjs-go/sockjs"
+	"github.com/koding/kite"
+	"github.com/koding/kite/kitetest"
+	"github.com/koding/kite/record"
+)
+
+func newServer() *kite.Kite {
+	k := kite.New("server", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.HandleFunc("square", func(r *kite.Request) (interface{}, error) {
+		n := r.Args.One().MustFloat64()
+		return n * n, nil
+	})
+	return k
+}
+
+// call calls square on the server over a new in-memory connection and
+// waits until the server ends the session.
+func call(t *testing.T, srv *kite.Kite, n float64) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	srv.OnDisconnect(func(*kite.Client) { wg.Done() })
+
+	c, err := kitetest.Connect(kite.New("client", "0.0.1"), srv)
+	if err != nil {
+		t.Fatalf("Connect()=%s", err)
+	}
+
+	if _, err := c.Tell("square", n); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	c.Close()
+	wg.Wait()
+}
+
+func TestRecordReplay(t *testing.T) {
+	var buf bytes.Buffer
+	var rec *record.Session
+
+	srv := newServer()
+	srv.SessionHook = func(s sockjs.Session) sockjs.Session {
+		rec = record.NewSession(s, &buf)
+		return rec
+	}
+
+	call(t, srv, 3)
+
+	if err := rec.Err(); err != nil {
+		t.Fatalf("Err()=%s", err)
+	}
+
+	frames, err := record.ReadFrames(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrames()=%s", err)
+	}
+
+	if len(frames) != 2 || frames[0].Dir != record.Recv || frames[1].Dir != record.Send {
+		t.Fatalf("got %+v, want a received and a sent frame", frames)
+	}
+
+	replay := record.NewReplay(frames)
+	defer replay.Close(0, "")
+
+	go newServer().ServeSession(replay)
+
+	sent, err := replay.Wait(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Wait()=%s", err)
+	}
+
+	if want := replay.Recorded(); !reflect.DeepEqual(sent, want) {
+		t.Fatalf("got %q, want %q", sent, want)
+	}
+}
+
+func TestHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newServer()
+	srv.SessionHook = record.Hook(dir)
+
+	call(t, srv, 2)
+	call(t, srv, 4)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("got %d recordings, want 2", len(files))
+	}
+
+	for _, file := range files {
+		frames, err := record.ReadFile(file)
+		if err != nil {
+			t.Fatalf("ReadFile()=%s", err)
+		}
+
+		if len(frames) != 2 {
+			t.Fatalf("got %d frames in %s, want 2", len(frames), file)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+// errReplayClosed is returned by Send on a closed replay.
+var errReplayClosed = errors.New("record: replay is closed")
+
+// Replay is a sockjs.Session playing back a recording. Recv returns the
+// frames the recorded side received, in order, and Send collects the frames
+// sent in reply, for comparing them with the recorded ones.
+//
+// Once all frames are received Recv blocks until the replay is closed, so
+// the replies can still be sent.
+type Replay struct {
+	// Speed, if positive, delays the frames to their recorded times divided
+	// by Speed, e.g. 1 keeps the original timing and 2 replays twice as
+	// fast. By default frames are returned as fast as they are read.
+	Speed float64
+
+	recv     []Frame
+	recorded []string
+
+	mu      sync.Mutex
+	start   time.Time
+	next    int
+	sent    []string
+	changed chan struct{} // closed and replaced on each Send
+
+	once sync.Once
+	done chan struct{}
+}
+
+var _ sockjs.Session = (*Replay)(nil)
+
+// NewReplay returns a replay of the frames of a recording.
+func NewReplay(frames []Frame) *Replay {
+	r := &Replay{
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	for _, f := range frames {
+		switch f.Dir {
+		case Recv:
+			r.recv = append(r.recv, f)
+		case Send:
+			r.recorded = append(r.recorded, f.Data)
+		}
+	}
+
+	return r
+}
+
+// ID implements the sockjs.Session interface.
+func (r *Replay) ID() string {
+	return "replay"
+}
+
+// Request implements the sockjs.Session interface. It returns a request
+// for the "replay" address, as there is no HTTP request behind a replay.
+func (r *Replay) Request() *http.Request {
+	req, _ := http.NewRequest("GET", "replay:///kite", nil)
+	req.RemoteAddr = "replay"
+	return req
+}
+
+// Recv implements the sockjs.Session interface.
+func (r *Replay) Recv() (string, error) {
+	r.mu.Lock()
+	if r.next == len(r.recv) {
+		r.mu.Unlock()
+		<-r.done
+		return "", sockjs.ErrSessionNotOpen
+	}
+
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+
+	f := r.recv[r.next]
+	r.next++
+	start := r.start
+	r.mu.Unlock()
+
+	if r.Speed > 0 {
+		at := start.Add(time.Duration(float64(f.Time) / r.Speed))
+
+		select {
+		case <-time.After(time.Until(at)):
+		case <-r.done:
+			return "", sockjs.ErrSessionNotOpen
+		}
+	}
+
+	return f.Data, nil
+}
+
+// Send implements the sockjs.Session interface.
+func (r *Replay) Send(msg string) error {
+	select {
+	case <-r.done:
+		return errReplayClosed
+	default:
+	}
+
+	r.mu.Lock()
+	r.sent = append(r.sent, msg)
+	close(r.changed)
+	r.changed = make(chan struct{})
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Close implements the sockjs.Session interface.
+func (r *Replay) Close(uint32, string) error {
+	r.once.Do(func() { close(r.done) })
+	return nil
+}
+
+// GetSessionState implements the sockjs.Session interface.
+func (r *Replay) GetSessionState() sockjs.SessionState {
+	select {
+	case <-r.done:
+		return sockjs.SessionClosed
+	default:
+		return sockjs.SessionActive
+	}
+}
+
+// Recorded returns the frames the recorded side sent.
+func (r *Replay) Recorded() []string {
+	return append([]string(nil), r.recorded...)
+}
+
+// Sent returns the frames sent to the replay so far.
+func (r *Replay) Sent() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.sent...)
+}
+
+// Wait waits until as many frames are sent to the replay as the recorded
+// side sent and returns them. After the timeout it returns the frames sent
+// so far with an error.
+func (r *Replay) Wait(timeout time.Duration) ([]string, error) {
+	deadline := time.After(timeout)
+
+	for {
+		r.mu.Lock()
+		sent := append([]string(nil), r.sent...)
+		changed := r.changed
+		r.mu.Unlock()
+
+		if len(sent) >= len(r.recorded) {
+			return sent, nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return sent, fmt.Errorf("got %d frames after %s, want %d", len(sent), timeout, len(r.recorded))
+		case <-r.done:
+			return sent, fmt.Errorf("replay closed after %d frames, want %d", len(sent), len(r.recorded))
+		}
+	}
+}
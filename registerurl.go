@@ -36,7 +36,7 @@ func (k *Kite) RegisterURL(local bool) *url.URL {
 	}
 
 	scheme := "http"
-	if k.TLSConfig != nil {
+	if k.TLSConfig != nil || k.Config.TLSCertFile != "" {
 		scheme = "https"
 	}
 
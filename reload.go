@@ -0,0 +1,174 @@
+package kite
+
+import (
+	"crypto/tls"
+	"math"
+
+	"github.com/juju/ratelimit"
+)
+
+// Reload reads the configuration with ReloadFunc and applies the settings
+// which can be changed while the kite is running: LogLevel, AllowedUsers,
+// RateLimit, RateLimitBurst and, if the kite serves TLS with the
+// certificate of TLSCertFile and TLSKeyFile, the certificate files. Other
+// settings are left as they are, and so are the ones above which the
+// reloaded configuration does not set, see config.Config.IsSet. Existing
+// connections are kept.
+//
+// Nothing is applied if reading the configuration or the certificate fails.
+func (k *Kite) Reload() error {
+	read := k.ReloadFunc
+	if read == nil {
+		k.configMu.RLock()
+		read = k.Config.Reload
+		k.configMu.RUnlock()
+	}
+
+	cfg, err := read()
+	if err != nil {
+		return err
+	}
+
+	k.reloadMu.Lock()
+	configTLS := k.tlsCert != nil
+	k.reloadMu.Unlock()
+
+	var cert *tls.Certificate
+	if configTLS && cfg.TLSCertFile != "" {
+		c, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		cert = &c
+	}
+
+	// Settings made in code are kept unless the configuration sets them.
+	set := func(name string, nonZero bool) bool {
+		return nonZero || cfg.IsSet(name)
+	}
+
+	setLogLevel := set("KITE_LOG_LEVEL", cfg.LogLevel != "")
+
+	k.configMu.Lock()
+	if setLogLevel {
+		k.Config.LogLevel = cfg.LogLevel
+	}
+	if set("KITE_ALLOWED_USERS", len(cfg.AllowedUsers) != 0) {
+		k.Config.AllowedUsers = cfg.AllowedUsers
+	}
+	if set("KITE_RATE_LIMIT", cfg.RateLimit != 0) {
+		k.Config.RateLimit = cfg.RateLimit
+	}
+	if set("KITE_RATE_LIMIT_BURST", cfg.RateLimitBurst != 0) {
+		k.Config.RateLimitBurst = cfg.RateLimitBurst
+	}
+	if cert != nil {
+		k.Config.TLSCertFile = cfg.TLSCertFile
+		k.Config.TLSKeyFile = cfg.TLSKeyFile
+	}
+	k.configMu.Unlock()
+
+	k.reloadMu.Lock()
+	k.rateLimiters = nil
+	if cert != nil {
+		k.tlsCert = cert
+	}
+	k.reloadMu.Unlock()
+
+	if k.SetLogLevel != nil && setLogLevel {
+		if cfg.LogLevel != "" {
+			k.SetLogLevel(parseLogLevel(cfg.LogLevel))
+		} else {
+			k.SetLogLevel(getLogLevel())
+		}
+	}
+
+	k.Log.Info("Configuration is reloaded")
+	return nil
+}
+
+// handleReloadConfig reloads the configuration of the kite. Only the user the
+// kite runs as may do so, with an authenticated request.
+func (k *Kite) handleReloadConfig(r *Request) (interface{}, error) {
+	if err := k.allowOwner(r, "reload the configuration"); err != nil {
+		return nil, err
+	}
+
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+// useConfigTLS makes the server use the certificate of Config.TLSCertFile and
+// Config.TLSKeyFile, which is replaced by Reload.
+func (k *Kite) useConfigTLS() error {
+	cert, err := tls.LoadX509KeyPair(k.Config.TLSCertFile, k.Config.TLSKeyFile)
+	if err != nil {
+		return err
+	}
+
+	k.reloadMu.Lock()
+	k.tlsCert = &cert
+	k.reloadMu.Unlock()
+
+	k.TLSConfig = &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			k.reloadMu.Lock()
+			defer k.reloadMu.Unlock()
+			return k.tlsCert, nil
+		},
+	}
+
+	return nil
+}
+
+// userAllowed reports whether Config.AllowedUsers permits the user.
+func (k *Kite) userAllowed(username string) bool {
+	k.configMu.RLock()
+	defer k.configMu.RUnlock()
+
+	if len(k.Config.AllowedUsers) == 0 {
+		return true
+	}
+
+	for _, u := range k.Config.AllowedUsers {
+		if u == username {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rateLimiter returns the bucket limiting the method to Config.RateLimit, or
+// nil if there is no limit.
+func (k *Kite) rateLimiter(method string) *ratelimit.Bucket {
+	k.configMu.RLock()
+	rate, burst := k.Config.RateLimit, k.Config.RateLimitBurst
+	k.configMu.RUnlock()
+
+	if rate <= 0 {
+		return nil
+	}
+
+	if burst <= 0 {
+		burst = int64(math.Ceil(rate))
+	}
+
+	k.reloadMu.Lock()
+	defer k.reloadMu.Unlock()
+
+	if b, ok := k.rateLimiters[method]; ok {
+		return b
+	}
+
+	if k.rateLimiters == nil {
+		k.rateLimiters = make(map[string]*ratelimit.Bucket)
+	}
+
+	b := ratelimit.NewBucketWithRate(rate, burst)
+	k.rateLimiters[method] = b
+	return b
+}
@@ -0,0 +1,126 @@
+package kite
+
+import (
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+func TestReload(t *testing.T) {
+	k := New("reload", "0.0.1")
+	k.Config.Username = "owner"
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 3740
+	k.HandleFunc("hello", func(*Request) (interface{}, error) { return "hello", nil })
+
+	cfg := config.New()
+	cfg.RateLimit = 0.001
+	cfg.RateLimitBurst = 1
+	cfg.AllowedUsers = []string{"john"}
+	k.ReloadFunc = func() (*config.Config, error) { return cfg, nil }
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	ck := New("exp", "0.0.1")
+	ck.Config.Username = "owner"
+
+	c := ck.NewClient("http://127.0.0.1:3740/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Tell("hello"); err != nil {
+			t.Fatalf("%d: Tell()=%s", i, err)
+		}
+	}
+
+	if _, err := k.handleReloadConfig(&Request{Username: "john", authenticated: true}); err == nil {
+		t.Fatal("expected kite.reloadConfig to fail for another user")
+	}
+
+	// With authentication disabled the username is asserted by the caller.
+	if _, err := c.Tell("kite.reloadConfig"); err == nil {
+		t.Fatal("expected kite.reloadConfig to fail for an unauthenticated owner")
+	}
+
+	if _, err := k.handleReloadConfig(&Request{Username: k.Config.Username, authenticated: true}); err != nil {
+		t.Fatalf("kite.reloadConfig: %s", err)
+	}
+
+	if _, err := c.Tell("hello"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	_, err := c.Tell("hello")
+	if e, ok := err.(*Error); !ok || e.Type != "requestLimitError" {
+		t.Fatalf("got %v, want requestLimitError", err)
+	}
+
+	if !k.userAllowed("john") || k.userAllowed("jane") {
+		t.Fatalf("got allowed users %v, want [john]", k.Config.AllowedUsers)
+	}
+
+	// Settings the configuration does not set are kept.
+	cfg = config.New()
+	if err := k.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !k.userAllowed("john") || k.userAllowed("jane") || k.Config.RateLimit != 0.001 {
+		t.Fatalf("got allowed users %v and rate limit %v, want them kept",
+			k.Config.AllowedUsers, k.Config.RateLimit)
+	}
+
+	// Settings set to their zero value are applied.
+	cfg, err = config.Load("", []string{"-rate-limit=0", "-allowed-users="})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Tell("hello"); err != nil {
+		t.Fatalf("Tell()=%s after removing the rate limit", err)
+	}
+
+	if !k.userAllowed("jane") {
+		t.Fatal("want all users allowed")
+	}
+}
+
+func TestReloadSource(t *testing.T) {
+	k := New("reload", "0.0.1")
+	k.Config.AllowedUsers = []string{"john"}
+
+	// A configuration not built by config.Load has nothing to be reloaded
+	// from, and is left as it is.
+	if err := k.Reload(); err == nil {
+		t.Fatal("expected Reload() to fail")
+	}
+
+	if !k.userAllowed("john") || k.userAllowed("jane") {
+		t.Fatalf("got allowed users %v, want [john]", k.Config.AllowedUsers)
+	}
+
+	cfg, err := config.Load("", []string{"-rate-limit=5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AllowedUsers = []string{"john"}
+	k.Config = cfg
+
+	if err := k.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if k.Config.RateLimit != 5 || !k.userAllowed("john") || k.userAllowed("jane") {
+		t.Fatalf("got rate limit %v and allowed users %v, want 5 and [john]",
+			k.Config.RateLimit, k.Config.AllowedUsers)
+	}
+}
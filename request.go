@@ -41,6 +41,14 @@ type Request struct {
 	// the type of authentication. This is not used when authentication is disabled.
 	Auth *Auth
 
+	// Actor is the kite which made the request on behalf of Username, if
+	// the request is authenticated with a delegated token.
+	Actor *kitekey.Actor
+
+	// authenticated is true if the request was authenticated by one of the
+	// Authenticators, as opposed to a username asserted by the remote kite.
+	authenticated bool
+
 	// Context holds a context that used by the current ServeKite handler. Any
 	// items added to the Context can be fetched from other handlers in the
 	// chain. This is useful with PreHandle and PostHandle handlers to pass
@@ -78,6 +86,10 @@ func (c *Client) runMethod(method *Method, args *dnode.Partial) {
 
 	// The request that will be constructed from incoming dnode message.
 	request, callFunc = c.newRequest(method.name, args)
+	if request.Args != nil {
+		request.Args.Strict = method.strict
+	}
+
 	if method.authenticate {
 		if err := request.authenticate(); err != nil {
 			callFunc(nil, createError(request, err))
@@ -103,7 +115,12 @@ func (c *Client) runMethod(method *Method, args *dnode.Partial) {
 	// is going to take one token from the bucket. If many requests come in (in
 	// span time larger than the bucket's frequency), there will be no token's
 	// available more so it will return a zero.
-	if method.bucket != nil && method.bucket.TakeAvailable(1) == 0 {
+	bucket := method.bucket
+	if bucket == nil {
+		bucket = c.LocalKite.rateLimiter(method.name)
+	}
+
+	if bucket != nil && bucket.TakeAvailable(1) == 0 {
 		callFunc(nil, &Error{
 			Type:      "requestLimitError",
 			Message:   "The maximum request rate is exceeded.",
@@ -138,7 +155,9 @@ func (c *Client) newRequest(method string, args *dnode.Partial) (*Request, func(
 	args.One().MustUnmarshal(&options)
 
 	// Notify the handlers registered with Kite.OnFirstRequest().
-	if _, ok := c.session.(*sockjsclient.WebsocketSession); !ok {
+	switch c.session.(type) {
+	case *sockjsclient.WebsocketSession, *dialedSession:
+	default:
 		c.firstRequestHandlersNotified.Do(func() {
 			c.m.Lock()
 			c.Kite = options.Kite
@@ -180,13 +199,8 @@ func (c *Client) newRequest(method string, args *dnode.Partial) (*Request, func(
 // authenticate tries to authenticate the user by selecting appropriate
 // authenticator function.
 func (r *Request) authenticate() *Error {
-	// Trust the Kite if we have initiated the connection.  Following casts
-	// means, session is opened by the client.
-	if _, ok := r.Client.session.(*sockjsclient.WebsocketSession); ok {
-		return nil
-	}
-
-	if _, ok := r.Client.session.(*sockjsclient.XHRSession); ok {
+	// Trust the Kite if we have initiated the connection.
+	if isDialed(r.Client.session) {
 		return nil
 	}
 
@@ -215,9 +229,17 @@ func (r *Request) authenticate() *Error {
 		}
 	}
 
+	if !r.LocalKite.userAllowed(r.Username) {
+		return &Error{
+			Type:    "authenticationError",
+			Message: fmt.Sprintf("User %q is not allowed", r.Username),
+		}
+	}
+
 	// Replace username of the remote Kite with the username that client send
 	// us. This prevents a Kite to impersonate someone else's Kite.
 	r.Client.SetUsername(r.Username)
+	r.authenticated = true
 	return nil
 }
 
@@ -225,7 +247,7 @@ func (r *Request) authenticate() *Error {
 func (k *Kite) AuthenticateFromToken(r *Request) error {
 	k.verifyOnce.Do(k.verifyInit)
 
-	token, err := jwt.ParseWithClaims(r.Auth.Key, &kitekey.KiteClaims{}, r.LocalKite.RSAKey)
+	token, err := kitekey.ParseAt(k.Clock.Now(), r.Auth.Key, &kitekey.KiteClaims{}, r.LocalKite.RSAKey)
 
 	if e, ok := err.(*jwt.ValidationError); ok {
 		// Translate public key mismatch errors to token-is-expired one.
@@ -262,11 +284,22 @@ func (k *Kite) AuthenticateFromToken(r *Request) error {
 		return err
 	}
 
-	// We don't check for exp and nbf claims here because jwt-go package
+	if !claims.AllowsMethod(r.Method) {
+		return fmt.Errorf("token does not allow calling %q", r.Method)
+	}
+
+	// We don't check for exp and nbf claims here because kitekey.ParseAt
 	// already checks them.
 
+	if k.VerifyClaims != nil {
+		if err := k.VerifyClaims(r, token); err != nil {
+			return err
+		}
+	}
+
 	// replace the requester username so we reflect the validated
 	r.Username = claims.Subject
+	r.Actor = claims.Actor
 
 	return nil
 }
@@ -275,7 +308,7 @@ func (k *Kite) AuthenticateFromToken(r *Request) error {
 func (k *Kite) AuthenticateFromKiteKey(r *Request) error {
 	claims := &kitekey.KiteClaims{}
 
-	token, err := jwt.ParseWithClaims(r.Auth.Key, claims, k.verify)
+	token, err := kitekey.ParseAt(k.Clock.Now(), r.Auth.Key, claims, k.verify)
 	if err != nil {
 		return err
 	}
@@ -288,6 +321,16 @@ func (k *Kite) AuthenticateFromKiteKey(r *Request) error {
 		return errors.New("token has no username")
 	}
 
+	if !claims.AllowsMethod(r.Method) {
+		return fmt.Errorf("kite key does not allow calling %q", r.Method)
+	}
+
+	if k.VerifyClaims != nil {
+		if err := k.VerifyClaims(r, token); err != nil {
+			return err
+		}
+	}
+
 	r.Username = claims.Subject
 
 	return nil
@@ -299,7 +342,7 @@ func (k *Kite) AuthenticateFromKiteKey(r *Request) error {
 func (k *Kite) AuthenticateSimpleKiteKey(key string) (string, error) {
 	claims := &kitekey.KiteClaims{}
 
-	token, err := jwt.ParseWithClaims(key, claims, k.verify)
+	token, err := kitekey.ParseAt(k.Clock.Now(), key, claims, k.verify)
 	if err != nil {
 		return "", err
 	}
@@ -328,7 +371,7 @@ func (k *Kite) verifyInit() {
 	k.verifyAudienceFunc = k.Config.VerifyAudienceFunc
 
 	if k.verifyAudienceFunc == nil {
-		k.verifyAudienceFunc = k.verifyAudience
+		k.verifyAudienceFunc = VerifyAudience
 	}
 
 	ttl := k.Config.VerifyTTL
@@ -345,7 +388,7 @@ func (k *Kite) verifyInit() {
 		k.verifyCache.StartGC(ttl / 2)
 	}
 
-	key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(k.Config.KontrolKey))
+	key, err := kitekey.ParsePublicKey([]byte(k.Config.KontrolKey))
 	if err != nil {
 		k.Log.Error("unable to init kontrol key: %s", err)
 
@@ -370,16 +413,22 @@ func (k *Kite) selfVerify(pub string) error {
 func (k *Kite) verify(token *jwt.Token) (interface{}, error) {
 	k.verifyOnce.Do(k.verifyInit)
 
-	key := token.Claims.(*kitekey.KiteClaims).KontrolKey
+	claims := token.Claims.(*kitekey.KiteClaims)
+
+	key := claims.KontrolKey
 	if key == "" {
 		return nil, errors.New("no kontrol key found")
 	}
 
-	rsaKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(key))
+	pubKey, err := kitekey.ParsePublicKey([]byte(key))
 	if err != nil {
 		return nil, err
 	}
 
+	if err := kitekey.CheckSigningMethod(token, pubKey, k.signingAlgorithms(claims.Issuer)); err != nil {
+		return nil, err
+	}
+
 	switch {
 	case k.verifyCache != nil:
 		v, err := k.verifyCache.Get(key)
@@ -391,7 +440,7 @@ func (k *Kite) verify(token *jwt.Token) (interface{}, error) {
 			return nil, errors.New("invalid kontrol key found")
 		}
 
-		return rsaKey, nil
+		return pubKey, nil
 	}
 
 	if err := k.verifyFunc(key); err != nil {
@@ -406,10 +455,22 @@ func (k *Kite) verify(token *jwt.Token) (interface{}, error) {
 
 	k.verifyCache.Set(key, true)
 
-	return rsaKey, nil
+	return pubKey, nil
 }
 
-func (k *Kite) verifyAudience(kite *protocol.Kite, audience string) error {
+// signingAlgorithms returns the algorithms accepted from the issuer of a
+// token, see Config.SigningAlgorithms.
+func (k *Kite) signingAlgorithms(issuer string) []string {
+	k.configMu.RLock()
+	defer k.configMu.RUnlock()
+
+	return k.Config.SigningAlgorithms.For(issuer)
+}
+
+// VerifyAudience is the default Config.VerifyAudienceFunc. It accepts the
+// root audience "/" and audiences of the form "/username/environment/name"
+// matching the kite, where empty environment and name match any.
+func VerifyAudience(kite *protocol.Kite, audience string) error {
 	switch audience {
 	case "/":
 		// The root audience is like superuser - it has access to everything.
@@ -440,3 +501,17 @@ func (k *Kite) verifyAudience(kite *protocol.Kite, audience string) error {
 
 	return nil
 }
+
+// allowOwner returns an error unless the request was authenticated as the
+// user the kite runs as. The action names what the request is denied.
+func (k *Kite) allowOwner(r *Request, action string) error {
+	if !r.authenticated {
+		return fmt.Errorf("only authenticated users are allowed to %s", action)
+	}
+
+	if owner := k.Config.Username; owner == "" || owner == "unknown" || r.Username != owner {
+		return fmt.Errorf("user %q is not allowed to %s", r.Username, action)
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package kite
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite/clock"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/testkeys"
+)
+
+func TestScopedToken(t *testing.T) {
+	k := New("scoped", "0.0.1")
+	defer k.Close()
+
+	k.Config.KontrolUser = "testuser"
+	k.Config.KontrolKey = testkeys.Public
+
+	token, err := kitekey.SignedString(&kitekey.KiteClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    "testuser",
+			Subject:   "monitoring",
+			Audience:  "/",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Scope: []string{"metrics.*", "kite.ping"},
+	}, testkeys.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"metrics.cpu":   true,
+		"metrics.":      true,
+		"kite.ping":     true,
+		"kite.pingpong": false,
+		"admin.restart": false,
+		"metrics":       false,
+	}
+
+	for method, allowed := range cases {
+		r := &Request{Method: method, LocalKite: k, Auth: &Auth{Type: "token", Key: token}}
+
+		err := k.AuthenticateFromToken(r)
+		if allowed && err != nil {
+			t.Errorf("%s: %s", method, err)
+		}
+		if !allowed && (err == nil || !strings.Contains(err.Error(), "does not allow")) {
+			t.Errorf("%s: got %v, want scope error", method, err)
+		}
+	}
+
+	if err := kitekey.ValidateScope([]string{"metrics.*", "a*b"}); err == nil {
+		t.Error("expected error for a * inside a scope entry")
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	k := New("claims", "0.0.1")
+	defer k.Close()
+
+	k.Config.KontrolUser = "testuser"
+	k.Config.KontrolKey = testkeys.Public
+
+	k.VerifyClaims = func(r *Request, token *jwt.Token) error {
+		claims, err := kitekey.AllClaims(token)
+		if err != nil {
+			return err
+		}
+
+		if claims["tenant"] != "acme" {
+			return fmt.Errorf("tenant %v is not allowed", claims["tenant"])
+		}
+
+		return nil
+	}
+
+	for tenant, allowed := range map[string]bool{"acme": true, "evil": false} {
+		token, err := kitekey.SignedString(jwt.MapClaims{
+			"iss":    "testuser",
+			"sub":    "john",
+			"aud":    "/",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"tenant": tenant,
+		}, testkeys.Private)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := &Request{Method: "kite.ping", LocalKite: k, Auth: &Auth{Type: "token", Key: token}}
+
+		err = k.AuthenticateFromToken(r)
+		if allowed && err != nil {
+			t.Errorf("%s: %s", tenant, err)
+		}
+		if !allowed && (err == nil || !strings.Contains(err.Error(), "is not allowed")) {
+			t.Errorf("%s: got %v, want tenant error", tenant, err)
+		}
+		if !allowed && r.Username != "" {
+			t.Errorf("%s: username set for a rejected request", tenant)
+		}
+	}
+}
+
+func TestClockTokenExpiry(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock := clock.NewMock(now)
+
+	k := New("clock", "0.0.1")
+	defer k.Close()
+
+	k.Clock = mock
+	k.Config.KontrolUser = "testuser"
+	k.Config.KontrolKey = testkeys.Public
+
+	token, err := kitekey.SignedString(&kitekey.KiteClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    "testuser",
+			Subject:   "alice",
+			Audience:  "/",
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Add(time.Minute).Unix(),
+			ExpiresAt: now.Add(time.Hour).Unix(),
+		},
+	}, testkeys.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticate := func() error {
+		return k.AuthenticateFromToken(&Request{
+			LocalKite: k,
+			Auth:      &Auth{Type: "token", Key: token},
+		})
+	}
+
+	if err := authenticate(); err == nil || !strings.Contains(err.Error(), "not valid yet") {
+		t.Fatalf("got %v, want the token not to be valid yet", err)
+	}
+
+	mock.Add(time.Minute)
+
+	if err := authenticate(); err != nil {
+		t.Fatalf("AuthenticateFromToken()=%s", err)
+	}
+
+	mock.Add(time.Hour)
+
+	if err := authenticate(); err == nil || !strings.Contains(err.Error(), "token is expired") {
+		t.Fatalf("got %v, want the token to be expired", err)
+	}
+}
@@ -68,6 +68,12 @@ func (k *Kite) Addr() string {
 // listenAndServe listens on the TCP network address k.URL.Host and then
 // calls Serve to handle requests on incoming connectionk.
 func (k *Kite) listenAndServe() error {
+	if k.TLSConfig == nil && k.Config.TLSCertFile != "" {
+		if err := k.useConfigTLS(); err != nil {
+			return err
+		}
+	}
+
 	// create a new one if there doesn't exist
 	l, err := net.Listen("tcp4", k.Addr())
 	if err != nil {
@@ -0,0 +1,201 @@
+package kite
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/testkeys"
+)
+
+func TestSigningAlgorithms(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecPrivate, ecPublic := pemKeyPair(t, ecKey, ecKey.Public())
+	edPrivate, edPublic := pemKeyPair(t, edKey, edKey.Public())
+
+	cases := []struct {
+		name       string
+		private    string
+		kontrolKey string
+		algorithms kitekey.Algorithms
+		err        string
+	}{{
+		name:       "ES256",
+		private:    ecPrivate,
+		kontrolKey: ecPublic,
+	}, {
+		name:       "EdDSA",
+		private:    edPrivate,
+		kontrolKey: edPublic,
+	}, {
+		name:       "RS256 allowed",
+		private:    testkeys.Private,
+		kontrolKey: testkeys.Public,
+		algorithms: kitekey.Algorithms{"testuser": {"RS256"}},
+	}, {
+		name:       "ES256 not allowed",
+		private:    ecPrivate,
+		kontrolKey: ecPublic,
+		algorithms: kitekey.Algorithms{"testuser": {"EdDSA"}, "": {"ES256"}},
+		err:        "signing method ES256 is not allowed",
+	}, {
+		name:       "ES256 for RSA key",
+		private:    ecPrivate,
+		kontrolKey: testkeys.Public,
+		err:        "invalid signing method",
+	}}
+
+	for _, cas := range cases {
+		t.Run(cas.name, func(t *testing.T) {
+			k := New("signing", "0.0.1")
+			defer k.Close()
+
+			k.Config.KontrolUser = "testuser"
+			k.Config.KontrolKey = cas.kontrolKey
+			k.Config.SigningAlgorithms = cas.algorithms
+
+			kiteKey, err := kitekey.SignedString(&kitekey.KiteClaims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:  "testuser",
+					Subject: "alice",
+				},
+				KontrolKey: cas.kontrolKey,
+			}, cas.private)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := kitekey.SignedString(&kitekey.KiteClaims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "testuser",
+					Subject:   "alice",
+					Audience:  "/",
+					ExpiresAt: time.Now().Add(time.Hour).Unix(),
+				},
+			}, cas.private)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, auth := range []*Auth{{Type: "kiteKey", Key: kiteKey}, {Type: "token", Key: token}} {
+				r := &Request{LocalKite: k, Auth: auth}
+
+				if auth.Type == "token" {
+					err = k.AuthenticateFromToken(r)
+				} else {
+					err = k.AuthenticateFromKiteKey(r)
+				}
+
+				switch {
+				case cas.err == "" && err != nil:
+					t.Fatalf("%s: %s", auth.Type, err)
+				case cas.err != "" && (err == nil || !strings.Contains(err.Error(), cas.err)):
+					t.Fatalf("%s: got %v, want %q", auth.Type, err, cas.err)
+				case err == nil && r.Username != "alice":
+					t.Fatalf("%s: got username %q, want alice", auth.Type, r.Username)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyProvider(t *testing.T) {
+	hsmKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kitekey.RegisterKeyProvider("testhsm", kitekey.KeyProviderFunc(func(uri string) (crypto.Signer, error) {
+		if uri != "testhsm:slot=1;object=kontrol" {
+			return nil, fmt.Errorf("no key %q", uri)
+		}
+		return hsmKey, nil
+	}))
+
+	filePrivate, filePublic := pemKeyPair(t, hsmKey, hsmKey.Public())
+
+	f, err := ioutil.TempFile("", "kite-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(filePrivate); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	public, err := kitekey.MarshalPublicKey(hsmKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public != filePublic {
+		t.Fatalf("got public key %q, want %q", public, filePublic)
+	}
+
+	k := New("hsm", "0.0.1")
+	defer k.Close()
+
+	k.Config.KontrolUser = "testuser"
+	k.Config.KontrolKey = public
+
+	for _, private := range []string{"testhsm:slot=1;object=kontrol", "file://" + f.Name(), filePrivate} {
+		token, err := kitekey.SignedString(&kitekey.KiteClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    "testuser",
+				Subject:   "alice",
+				Audience:  "/",
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			},
+		}, private)
+		if err != nil {
+			t.Fatalf("%.20s: %s", private, err)
+		}
+
+		if err := k.AuthenticateFromToken(&Request{LocalKite: k, Auth: &Auth{Type: "token", Key: token}}); err != nil {
+			t.Fatalf("%.20s: %s", private, err)
+		}
+	}
+
+	for _, private := range []string{"testhsm:slot=2;object=other", "pkcs11:object=missing"} {
+		if _, err := kitekey.NewSigner(private); err == nil {
+			t.Errorf("%s: want error", private)
+		}
+	}
+}
+
+func pemKeyPair(t *testing.T, private crypto.PrivateKey, public crypto.PublicKey) (string, string) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+}
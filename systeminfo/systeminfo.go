@@ -1,10 +1,17 @@
 // Package systeminfo provides a way of getting memory usage, disk usage and
 // various information about the host.
+//
+// Besides the totals of the host, the load averages, the usage of every
+// mounted disk, the counters of the network interfaces, the open file
+// descriptors of the process and the limits of its control group are given
+// on Linux.
 package systeminfo
 
 import (
 	"os/user"
 	"runtime"
+	"sync"
+	"time"
 )
 
 type status struct{}
@@ -17,6 +24,53 @@ type info struct {
 	MemoryTotal uint64 `json:"totalMemoryLimit"`
 	HomeDir     string `json:"homeDir"`
 	Uname       string `json:"uname"`
+
+	// The following are not available on every platform.
+	Load       []float64   `json:"load,omitempty"` // over 1, 5 and 15 minutes
+	Mounts     []Mount     `json:"mounts,omitempty"`
+	Interfaces []Interface `json:"interfaces,omitempty"`
+	OpenFiles  *OpenFiles  `json:"openFiles,omitempty"`
+	Cgroup     *Cgroup     `json:"cgroup,omitempty"`
+}
+
+// Mount is the disk usage of a mounted filesystem, in kiB like the disk
+// usage of the host.
+type Mount struct {
+	Path   string `json:"path"`
+	Device string `json:"device"`
+	Type   string `json:"type"`
+	Usage  uint64 `json:"usage"`
+	Total  uint64 `json:"total"`
+}
+
+// Interface holds the counters of a network interface since it was brought
+// up.
+type Interface struct {
+	Name      string `json:"name"`
+	RxBytes   uint64 `json:"rxBytes"`
+	RxPackets uint64 `json:"rxPackets"`
+	RxErrors  uint64 `json:"rxErrors"`
+	RxDropped uint64 `json:"rxDropped"`
+	TxBytes   uint64 `json:"txBytes"`
+	TxPackets uint64 `json:"txPackets"`
+	TxErrors  uint64 `json:"txErrors"`
+	TxDropped uint64 `json:"txDropped"`
+}
+
+// OpenFiles is the number of file descriptors open by the process and the
+// limit of their number.
+type OpenFiles struct {
+	Count int    `json:"count"`
+	Limit uint64 `json:"limit"`
+}
+
+// Cgroup holds the limits of the control group of the process, e.g. of the
+// container it runs in. Zero limits are unlimited.
+type Cgroup struct {
+	Version     int     `json:"version"`     // 1 or 2
+	MemoryLimit uint64  `json:"memoryLimit"` // in bytes
+	MemoryUsage uint64  `json:"memoryUsage"` // in bytes
+	CPULimit    float64 `json:"cpuLimit"`    // in CPUs
 }
 
 type memory struct {
@@ -49,7 +103,7 @@ func New() (*info, error) {
 		return nil, err
 	}
 
-	return &info{
+	i := &info{
 		State:       "RUNNING", // needed for client side compatibility
 		DiskUsage:   disk.Usage,
 		DiskTotal:   disk.Total,
@@ -57,5 +111,49 @@ func New() (*info, error) {
 		MemoryTotal: mem.Total,
 		HomeDir:     homeDir(),
 		Uname:       runtime.GOOS,
-	}, nil
+	}
+
+	// The extended metrics are best effort, missing ones are left out.
+	i.Load, _ = loadAverages()
+	i.Mounts, _ = mounts()
+	i.Interfaces, _ = interfaces()
+	i.OpenFiles, _ = openFiles()
+	i.Cgroup, _ = cgroup()
+
+	return i, nil
+}
+
+// Cache caches the info given by New for an interval, so frequent polls
+// do not read it from the system every time.
+type Cache struct {
+	// Interval is how long the info is cached for.
+	Interval time.Duration
+
+	mu      sync.Mutex
+	info    *info
+	updated time.Time
+}
+
+// NewCache returns a cache keeping the info for interval.
+func NewCache(interval time.Duration) *Cache {
+	return &Cache{Interval: interval}
+}
+
+// Get returns the cached info, reading it again with New if it is older
+// than the interval. The returned info is shared and must not be modified.
+func (c *Cache) Get() (*info, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.info != nil && time.Since(c.updated) < c.Interval {
+		return c.info, nil
+	}
+
+	i, err := New()
+	if err != nil {
+		return nil, err
+	}
+
+	c.info, c.updated = i, time.Now()
+	return i, nil
 }
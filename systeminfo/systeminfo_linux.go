@@ -3,10 +3,15 @@ package systeminfo
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 type procMem struct {
@@ -93,3 +98,282 @@ func readFile(file string, handler func(string) bool) error {
 func strtoull(val string) (uint64, error) {
 	return strconv.ParseUint(val, 10, 64)
 }
+
+func loadAverages() ([]float64, error) {
+	data, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLoadavg(string(data))
+}
+
+func parseLoadavg(s string) ([]float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("malformed loadavg: %q", s)
+	}
+
+	load := make([]float64, 3)
+	for i := range load {
+		f, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, err
+		}
+		load[i] = f
+	}
+
+	return load, nil
+}
+
+// skipFSTypes are the types of the filesystems left out of the mounts: the
+// pseudo filesystems, and the network ones, so that a server which does not
+// respond does not block reading the info.
+var skipFSTypes = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true,
+	"cgroup2": true, "configfs": true, "debugfs": true, "devpts": true,
+	"fusectl": true, "hugetlbfs": true, "mqueue": true, "nsfs": true,
+	"proc": true, "pstore": true, "rpc_pipefs": true, "securityfs": true,
+	"sysfs": true, "tracefs": true,
+	"cifs": true, "nfs": true, "nfs4": true, "smb3": true, "fuse.sshfs": true,
+}
+
+func mounts() ([]Mount, error) {
+	var list []Mount
+	seen := make(map[string]int)
+
+	err := readFile("/proc/self/mounts", func(line string) bool {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || skipFSTypes[fields[2]] {
+			return true
+		}
+
+		m := Mount{
+			Device: fields[0],
+			Path:   unescapeMountPath(fields[1]),
+			Type:   fields[2],
+		}
+
+		stat := new(syscall.Statfs_t)
+		if err := syscall.Statfs(m.Path, stat); err != nil || stat.Blocks == 0 {
+			return true
+		}
+
+		m.Total = uint64(stat.Blocks) * uint64(stat.Bsize) / 1024
+		m.Usage = m.Total - uint64(stat.Bfree)*uint64(stat.Bsize)/1024
+
+		// A path mounted over is given by the last mount.
+		if i, ok := seen[m.Path]; ok {
+			list[i] = m
+		} else {
+			seen[m.Path] = len(list)
+			list = append(list, m)
+		}
+
+		return true
+	})
+
+	return list, err
+}
+
+// unescapeMountPath decodes the octal escapes of the spaces, tabs, newlines
+// and backslashes of the paths in /proc/self/mounts.
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				buf.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		buf.WriteByte(path[i])
+	}
+
+	return buf.String()
+}
+
+func interfaces() ([]Interface, error) {
+	data, err := ioutil.ReadFile("/proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNetDev(string(data))
+}
+
+func parseNetDev(s string) ([]Interface, error) {
+	var list []Interface
+
+	for _, line := range strings.Split(s, "\n") {
+		i := strings.Index(line, ":")
+		if i == -1 {
+			continue // headers
+		}
+
+		fields := strings.Fields(line[i+1:])
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("malformed interface counters: %q", line)
+		}
+
+		var counters [16]uint64
+		for j := range counters {
+			n, err := strtoull(fields[j])
+			if err != nil {
+				return nil, err
+			}
+			counters[j] = n
+		}
+
+		list = append(list, Interface{
+			Name:      strings.TrimSpace(line[:i]),
+			RxBytes:   counters[0],
+			RxPackets: counters[1],
+			RxErrors:  counters[2],
+			RxDropped: counters[3],
+			TxBytes:   counters[8],
+			TxPackets: counters[9],
+			TxErrors:  counters[10],
+			TxDropped: counters[11],
+		})
+	}
+
+	return list, nil
+}
+
+func openFiles() (*OpenFiles, error) {
+	dir, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return nil, err
+	}
+
+	return &OpenFiles{
+		Count: len(names) - 1, // without the descriptor reading the directory
+		Limit: uint64(limit.Cur),
+	}, nil
+}
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+func cgroup() (*Cgroup, error) {
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+
+	paths := parseProcCgroup(string(data))
+
+	// Version 2, with a single hierarchy.
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+		dir := cgroupDir(cgroupRoot, paths[""], "memory.current")
+
+		cg := &Cgroup{Version: 2}
+		cg.MemoryLimit = readCgroupLimit(filepath.Join(dir, "memory.max"))
+		cg.MemoryUsage = readCgroupLimit(filepath.Join(dir, "memory.current"))
+
+		if data, err := ioutil.ReadFile(filepath.Join(dir, "cpu.max")); err == nil {
+			cg.CPULimit = parseCPUMax(string(data))
+		}
+
+		return cg, nil
+	}
+
+	// Version 1, with a hierarchy per controller.
+	memory := cgroupDir(filepath.Join(cgroupRoot, "memory"), paths["memory"], "memory.usage_in_bytes")
+	if _, err := os.Stat(memory); err != nil {
+		return nil, errors.New("no cgroup memory controller")
+	}
+
+	cg := &Cgroup{Version: 1}
+	cg.MemoryLimit = readCgroupLimit(filepath.Join(memory, "memory.limit_in_bytes"))
+	cg.MemoryUsage = readCgroupLimit(filepath.Join(memory, "memory.usage_in_bytes"))
+
+	cpu := cgroupDir(filepath.Join(cgroupRoot, "cpu"), paths["cpu"], "cpu.cfs_quota_us")
+	quota, err1 := ioutil.ReadFile(filepath.Join(cpu, "cpu.cfs_quota_us"))
+	period, err2 := ioutil.ReadFile(filepath.Join(cpu, "cpu.cfs_period_us"))
+	if err1 == nil && err2 == nil {
+		cg.CPULimit = parseCPUMax(strings.TrimSpace(string(quota)) + " " + string(period))
+	}
+
+	return cg, nil
+}
+
+// parseProcCgroup gives the paths of the cgroups of the process by
+// controller, "" for the hierarchy of version 2.
+func parseProcCgroup(s string) map[string]string {
+	paths := make(map[string]string)
+
+	for _, line := range strings.Split(s, "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		for _, controller := range strings.Split(fields[1], ",") {
+			paths[controller] = fields[2]
+		}
+	}
+
+	return paths
+}
+
+// cgroupDir gives the directory of the cgroup of the process under root, or
+// root if the cgroup is not visible there, as in containers whose cgroup is
+// mounted as the root.
+func cgroupDir(root, path, file string) string {
+	dir := filepath.Join(root, path)
+	if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+		return dir
+	}
+	return root
+}
+
+// readCgroupLimit reads a number of bytes from a cgroup file. Unlimited
+// values, "max" or the near maximum values of version 1, are zero.
+func readCgroupLimit(file string) uint64 {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0
+	}
+
+	n, err := strtoull(strings.TrimSpace(string(data)))
+	if err != nil || n >= 1<<62 {
+		return 0
+	}
+
+	return n
+}
+
+// parseCPUMax parses the quota and period of the cpu.max file, or of the
+// cpu.cfs_quota_us and cpu.cfs_period_us files joined by a space, into the
+// number of CPUs the cgroup may use, zero if unlimited.
+func parseCPUMax(s string) float64 {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0
+	}
+
+	quota, err1 := strconv.ParseFloat(fields[0], 64)
+	period, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil || quota <= 0 || period <= 0 {
+		return 0 // "max" or -1
+	}
+
+	return quota / period
+}
@@ -0,0 +1,52 @@
+package systeminfo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNetDev(t *testing.T) {
+	const netDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 12728668    2081    0    0    0     0          0         0 12728668    2081    0    0    0     0       0          0
+  eth0:     1000      10    1    2    0     0          0         0     2000      20    3    4    0     0       0          0
+`
+
+	got, err := parseNetDev(netDev)
+	if err != nil {
+		t.Fatalf("parseNetDev()=%s", err)
+	}
+
+	want := []Interface{
+		{Name: "lo", RxBytes: 12728668, RxPackets: 2081, TxBytes: 12728668, TxPackets: 2081},
+		{Name: "eth0", RxBytes: 1000, RxPackets: 10, RxErrors: 1, RxDropped: 2, TxBytes: 2000, TxPackets: 20, TxErrors: 3, TxDropped: 4},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseCgroup(t *testing.T) {
+	paths := parseProcCgroup("4:memory:/docker/abc\n2:cpu,cpuacct:/docker/abc\n0::/\n")
+
+	want := map[string]string{"memory": "/docker/abc", "cpu": "/docker/abc", "cpuacct": "/docker/abc", "": "/"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got %v, want %v", paths, want)
+	}
+
+	for s, want := range map[string]float64{
+		"max 100000":      0,
+		"50000 100000":    0.5,
+		"200000 100000\n": 2,
+		"-1 100000":       0,
+	} {
+		if got := parseCPUMax(s); got != want {
+			t.Errorf("parseCPUMax(%q)=%v, want %v", s, got, want)
+		}
+	}
+
+	if got := unescapeMountPath(`/mnt/my\040disk`); got != "/mnt/my disk" {
+		t.Errorf("got %q, want the escaped space decoded", got)
+	}
+}
@@ -0,0 +1,13 @@
+// +build !linux
+
+package systeminfo
+
+import "errors"
+
+var errNotSupported = errors.New("not supported on this platform")
+
+func loadAverages() ([]float64, error) { return nil, errNotSupported }
+func mounts() ([]Mount, error)         { return nil, errNotSupported }
+func interfaces() ([]Interface, error) { return nil, errNotSupported }
+func openFiles() (*OpenFiles, error)   { return nil, errNotSupported }
+func cgroup() (*Cgroup, error)         { return nil, errNotSupported }
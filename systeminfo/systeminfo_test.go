@@ -1,6 +1,9 @@
 package systeminfo
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestInfo(t *testing.T) {
 	i, err := New()
@@ -23,3 +26,22 @@ func TestInfo(t *testing.T) {
 		t.Errorf("unexpected memory usage %d", i.MemoryUsage)
 	}
 }
+
+func TestCache(t *testing.T) {
+	c := NewCache(time.Minute)
+
+	i, err := c.Get()
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if j, err := c.Get(); err != nil || j != i {
+		t.Fatalf("got %p, %v, want the cached info %p", j, err, i)
+	}
+
+	c.Interval = 0
+
+	if j, err := c.Get(); err != nil || j == i {
+		t.Fatalf("got %p, %v, want the info read again", j, err)
+	}
+}
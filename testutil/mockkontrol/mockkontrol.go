@@ -0,0 +1,159 @@
+// Package mockkontrol provides a kontrol running in-process for tests of
+// registration and token flows, with an in-memory storage and the test keys
+// of the testkeys package, so no etcd or Postgres is needed.
+package mockkontrol
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/kitetest"
+	"github.com/koding/kite/kontrol"
+	"github.com/koding/kite/protocol"
+	"github.com/koding/kite/testkeys"
+	"github.com/koding/kite/testutil"
+)
+
+// KeyID is the ID of the key pair of the kontrol, made of testkeys.Public
+// and testkeys.Private.
+const KeyID = "mockkontrol"
+
+// Username is the user running the kontrol, which is the issuer of the kite
+// keys and tokens.
+const Username = "testuser"
+
+// Kontrol is a kontrol served by an HTTP server on the loopback interface.
+// It handles the methods of kontrol.New, e.g. register, getKites and
+// getToken, except for registering itself in its storage.
+type Kontrol struct {
+	*kontrol.Kontrol
+
+	// Storage keeps the kites registered to the kontrol.
+	Storage *kontrol.MemStorage
+
+	// Calls records the calls of the methods of the kontrol.
+	Calls *kitetest.Recorder
+
+	// URL is the kite URL of the kontrol, e.g. "http://127.0.0.1:34567/kite".
+	URL string
+
+	srv *httptest.Server
+}
+
+// Start starts a new kontrol. It must be closed with Close.
+func Start() *Kontrol {
+	srv := httptest.NewUnstartedServer(nil)
+	url := "http://" + srv.Listener.Addr().String() + "/kite"
+
+	conf := config.New()
+	conf.Username = Username
+	conf.KontrolURL = url
+	conf.KontrolKey = testkeys.Public
+	conf.KontrolUser = Username
+	conf.KiteKey = testutil.NewToken(Username, testkeys.Private, testkeys.Public).Raw
+
+	k := &Kontrol{
+		Kontrol: kontrol.New(conf, "0.0.1"),
+		Storage: kontrol.NewMemStorage(),
+		URL:     url,
+		srv:     srv,
+	}
+
+	k.Calls = kitetest.Record(k.Kite)
+	k.SetStorage(k.Storage)
+	k.SetKeyPairStorage(kontrol.NewMemKeyPairStorage())
+
+	if err := k.AddKeyPair(KeyID, testkeys.Public, testkeys.Private); err != nil {
+		panic(err)
+	}
+
+	srv.Config.Handler = k.Kite
+	srv.Start()
+
+	return k
+}
+
+// Close stops the kontrol.
+func (k *Kontrol) Close() {
+	k.Kontrol.Close()
+	k.srv.Close()
+}
+
+// Config returns a config for kites of the user, with a kite key issued by
+// the kontrol.
+func (k *Kontrol) Config(username string) *config.Config {
+	conf := config.New()
+	conf.Username = username
+	conf.KontrolURL = k.URL
+	conf.KontrolKey = testkeys.Public
+	conf.KontrolUser = Username
+	conf.KiteKey = testutil.NewToken(username, testkeys.Private, testkeys.Public).Raw
+	return conf
+}
+
+// NewKite returns a new kite of the user using the kontrol.
+func (k *Kontrol) NewKite(name, version, username string) *kite.Kite {
+	return kite.NewWithConfig(name, version, k.Config(username))
+}
+
+// Kites returns the kites matching the query which are registered to the
+// kontrol.
+func (k *Kontrol) Kites(query *protocol.KontrolQuery) kontrol.Kites {
+	kites, err := k.Storage.Get(query)
+	if err != nil {
+		panic(err)
+	}
+	return kites
+}
+
+// Registered waits until a kite matching the query is registered to the
+// kontrol and returns it, or fails the test after the timeout.
+func (k *Kontrol) Registered(t testing.TB, query *protocol.KontrolQuery, timeout time.Duration) *protocol.KiteWithToken {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if kites := k.Kites(query); len(kites) != 0 {
+			return kites[0]
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("no kite matching %+v registered after %s", query, timeout)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// NotRegistered fails the test if a kite matching the query is registered
+// to the kontrol.
+func (k *Kontrol) NotRegistered(t testing.TB, query *protocol.KontrolQuery) {
+	t.Helper()
+
+	if kites := k.Kites(query); len(kites) != 0 {
+		t.Fatalf("got %d kites matching %+v registered, want none", len(kites), query)
+	}
+}
+
+// Called fails the test unless the method of the kontrol was called n times
+// successfully, and returns the calls.
+func (k *Kontrol) Called(t testing.TB, method string, n int) []kitetest.Call {
+	t.Helper()
+
+	var calls []kitetest.Call
+	for _, call := range k.Calls.CallsOf(method) {
+		if call.Err == nil {
+			calls = append(calls, call)
+		}
+	}
+
+	if len(calls) != n {
+		t.Fatalf("got %d successful calls of %q, want %d", len(calls), method, n)
+	}
+
+	return calls
+}
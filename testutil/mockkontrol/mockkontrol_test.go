@@ -0,0 +1,52 @@
+package mockkontrol_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/protocol"
+	"github.com/koding/kite/testutil/mockkontrol"
+)
+
+func TestKontrol(t *testing.T) {
+	kon := mockkontrol.Start()
+	defer kon.Close()
+
+	math := kon.NewKite("math", "1.0.0", "alice")
+	defer math.Close()
+
+	u := &url.URL{Scheme: "http", Host: "127.0.0.1:1", Path: "/kite"}
+	if _, err := math.Register(u); err != nil {
+		t.Fatalf("Register()=%s", err)
+	}
+
+	query := &protocol.KontrolQuery{Username: "alice", Name: "math"}
+	kon.Registered(t, query, 5*time.Second)
+	kon.NotRegistered(t, &protocol.KontrolQuery{Username: "alice", Name: "echo"})
+	kon.Called(t, "register", 1)
+
+	client := kon.NewKite("client", "1.0.0", "alice")
+	defer client.Close()
+
+	kites, err := client.GetKites(query)
+	if err != nil {
+		t.Fatalf("GetKites()=%s", err)
+	}
+
+	if len(kites) != 1 || kites[0].URL != u.String() {
+		t.Fatalf("got %+v, want the math kite", kites)
+	}
+	defer kites[0].Close()
+
+	if kites[0].Auth == nil || kites[0].Auth.Type != "token" || kites[0].Auth.Key == "" {
+		t.Fatalf("got %+v, want token authentication", kites[0].Auth)
+	}
+
+	if _, err := client.GetToken(math.Kite()); err != nil {
+		t.Fatalf("GetToken()=%s", err)
+	}
+
+	kon.Called(t, "getKites", 1)
+	kon.Called(t, "getToken", 1)
+}
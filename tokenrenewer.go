@@ -21,10 +21,13 @@ type TokenRenewer struct {
 	client           *Client
 	localKite        *Kite
 	validUntil       time.Time
+	scope            []string // of the token, kept when renewing it
+	delegated        bool     // the token has an actor, see kitekey.Actor
 	signalRenewToken chan struct{}
 	disconnect       chan struct{}
 	once             sync.Once // for c.installHandlers
 	renewLoopWG      sync.WaitGroup
+	renewMu          sync.Mutex // serializes renewals, protects validUntil
 }
 
 func NewTokenRenewer(r *Client, k *Kite) (*TokenRenewer, error) {
@@ -41,7 +44,7 @@ func NewTokenRenewer(r *Client, k *Kite) (*TokenRenewer, error) {
 func (t *TokenRenewer) parse(tokenString string) error {
 	claims := &kitekey.KiteClaims{}
 
-	_, err := jwt.ParseWithClaims(tokenString, claims, t.localKite.RSAKey)
+	_, err := kitekey.ParseAt(t.localKite.Clock.Now(), tokenString, claims, t.localKite.RSAKey)
 	if err != nil {
 		valErr, ok := err.(*jwt.ValidationError)
 		if !ok {
@@ -57,6 +60,8 @@ func (t *TokenRenewer) parse(tokenString string) error {
 	}
 
 	t.validUntil = time.Unix(claims.ExpiresAt, 0).UTC()
+	t.scope = claims.Scope
+	t.delegated = claims.Actor != nil
 	return nil
 }
 
@@ -76,7 +81,7 @@ func (t *TokenRenewer) renewLoop() {
 	defer t.renewLoopWG.Done()
 
 	// renews token before it expires (sends the first signal to the goroutine below)
-	go time.AfterFunc(t.renewDuration(), t.sendRenewTokenSignal)
+	go t.localKite.Clock.AfterFunc(t.renewDuration(), t.sendRenewTokenSignal)
 
 	// renew token on signal util remote kite disconnects.
 	for {
@@ -84,7 +89,7 @@ func (t *TokenRenewer) renewLoop() {
 		case <-t.signalRenewToken:
 			switch err := t.renewToken(); {
 			case err == nil:
-				go time.AfterFunc(t.renewDuration(), t.sendRenewTokenSignal)
+				go t.localKite.Clock.AfterFunc(t.renewDuration(), t.sendRenewTokenSignal)
 			case err == ErrNoKitesAvailable || strings.Contains(err.Error(), "no kites found"):
 				// If kite went down we're not going to renew the token,
 				// as we need to dial either way.
@@ -97,8 +102,8 @@ func (t *TokenRenewer) renewLoop() {
 				// Need to sleep here litle bit because a signal is sent
 				// when an expired token is detected on incoming request.
 				// This sleep prevents the signal from coming too fast.
-				time.Sleep(1 * time.Second)
-				go time.AfterFunc(retryInterval, t.sendRenewTokenSignal)
+				t.localKite.Clock.Sleep(1 * time.Second)
+				go t.localKite.Clock.AfterFunc(retryInterval, t.sendRenewTokenSignal)
 			}
 		case <-t.disconnect:
 			return
@@ -109,7 +114,10 @@ func (t *TokenRenewer) renewLoop() {
 // The duration from now to the time token needs to be renewed.
 // Needs to be calculated after renewing the token.
 func (t *TokenRenewer) renewDuration() time.Duration {
-	return t.validUntil.Add(-renewBefore).Sub(time.Now().UTC())
+	t.renewMu.Lock()
+	defer t.renewMu.Unlock()
+
+	return t.validUntil.Add(-renewBefore).Sub(t.localKite.Clock.Now().UTC())
 }
 
 func (t *TokenRenewer) startRenewLoop() {
@@ -142,11 +150,35 @@ func (t *TokenRenewer) sendDisconnectSignal() {
 
 // renewToken gets a new token from a kontrolClient, parses it and sets it as the token.
 func (t *TokenRenewer) renewToken() error {
+	t.renewMu.Lock()
+	defer t.renewMu.Unlock()
+
+	return t.renew()
+}
+
+// renew is renewToken without locking renewMu.
+func (t *TokenRenewer) renew() error {
 	renew := &protocol.Kite{
 		ID: t.client.Kite.ID,
 	}
 
-	token, err := t.localKite.GetToken(renew)
+	t.client.authMu.Lock()
+	refreshToken := t.client.Auth.RefreshToken
+	t.client.authMu.Unlock()
+
+	var token string
+	var err error
+	switch {
+	case refreshToken != "":
+		var res *protocol.TokenResult
+		if res, err = t.localKite.RefreshToken(refreshToken); err == nil {
+			token, refreshToken = res.Token, res.RefreshToken
+		}
+	case len(t.scope) != 0:
+		token, err = t.localKite.GetScopedToken(renew, t.scope...)
+	default:
+		token, err = t.localKite.GetToken(renew)
+	}
 	if err != nil {
 		return err
 	}
@@ -157,9 +189,103 @@ func (t *TokenRenewer) renewToken() error {
 
 	t.client.authMu.Lock()
 	t.client.Auth.Key = token
+	if refreshToken != "" {
+		// Refresh tokens are used once, the next token is got with the
+		// one given along with this token.
+		t.client.Auth.RefreshToken = refreshToken
+	}
 	t.client.authMu.Unlock()
 
 	t.client.callOnTokenRenewHandlers(token)
 
 	return nil
 }
+
+// setupTokenRenewer starts renewing the token of the client before it
+// expires, if the client authenticates with a token of a kite known to
+// Kontrol or with a refresh token, and its token is not renewed already.
+func (c *Client) setupTokenRenewer() {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	if c.renewer != nil || c.Auth == nil || c.Auth.Type != "token" || c.Auth.Key == "" {
+		return
+	}
+
+	// Without a refresh token the token is renewed by asking Kontrol for
+	// a token of the kite with the ID.
+	if (c.Kite.ID == "" && c.Auth.RefreshToken == "") || c.LocalKite.Config.KontrolURL == "" {
+		return
+	}
+
+	// The token is parsed with the key of Kontrol, which is not known
+	// when the Kontrol URL is given without a kite.key.
+	c.LocalKite.verifyOnce.Do(c.LocalKite.verifyInit)
+	if c.LocalKite.KontrolKey() == nil {
+		return
+	}
+
+	t, err := NewTokenRenewer(c, c.LocalKite)
+	if err != nil {
+		c.LocalKite.Log.Debug("Token of %s will not be renewed: %s", c.URL, err)
+		return
+	}
+
+	// Asking Kontrol for a token of the kite would replace a delegated
+	// token with one of the local kite.
+	if t.delegated && c.Auth.RefreshToken == "" {
+		c.LocalKite.Log.Debug("Delegated token of %s will not be renewed", c.URL)
+		return
+	}
+
+	t.RenewWhenExpires()
+	c.closeRenewer = t.disconnect
+	c.renewer = t
+}
+
+// renewExpiredToken renews the token of the client after a request made with
+// the given key failed because the token was expired. It reports whether
+// the request should be made again, which is when the token was renewed,
+// possibly by another request in the meantime.
+func (c *Client) renewExpiredToken(used string) bool {
+	c.authMu.Lock()
+	t := c.renewer
+	c.authMu.Unlock()
+
+	if t == nil {
+		return false
+	}
+
+	t.renewMu.Lock()
+	defer t.renewMu.Unlock()
+
+	if key := c.authKey(); key != used {
+		return key != ""
+	}
+
+	if err := t.renew(); err != nil {
+		c.LocalKite.Log.Error("token renewer: Cannot renew expired token for Kite %s: %s", c.ID, err)
+		return false
+	}
+
+	return true
+}
+
+// authKey returns the key the client authenticates with.
+func (c *Client) authKey() string {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	if c.Auth == nil {
+		return ""
+	}
+
+	return c.Auth.Key
+}
+
+// isTokenExpired reports whether err is the error a kite responds with to
+// requests made with an expired token.
+func isTokenExpired(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Type == "authenticationError" && strings.Contains(e.Message, "token is expired")
+}
@@ -0,0 +1,58 @@
+package kite
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/testkeys"
+)
+
+func TestDialTokenWithoutKontrolKey(t *testing.T) {
+	k := New("server", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	token, err := kitekey.SignedString(&kitekey.KiteClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    "testuser",
+			Subject:   "client",
+			Audience:  "/",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}, testkeys.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The Kontrol URL is given, e.g. by KITE_KONTROL_URL, but there is no
+	// kite.key with the key of Kontrol.
+	ck := New("client", "0.0.1")
+	ck.Config.KontrolURL = "http://127.0.0.1:1/kite"
+	ck.Config.KontrolKey = ""
+
+	c := ck.NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	c.Auth = &Auth{Type: "token", Key: token, RefreshToken: "refresh"}
+
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Tell("kite.ping"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	c.authMu.Lock()
+	renewer := c.renewer
+	c.authMu.Unlock()
+
+	if renewer != nil {
+		t.Fatal("token is renewed without the key of Kontrol")
+	}
+}
@@ -0,0 +1,159 @@
+package vault
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// TransitSigner is a crypto.Signer signing with an asymmetric key of the
+// transit secrets engine, so the private key never leaves Vault. It signs
+// with the version of the key which was the latest one when the signer was
+// created, the version Public belongs to.
+type TransitSigner struct {
+	client  *Client
+	mount   string
+	name    string
+	version int
+	public  crypto.PublicKey
+}
+
+var _ crypto.Signer = (*TransitSigner)(nil)
+
+// TransitSigner returns the signer of the key with the given name of the
+// transit engine mounted at mount, "transit" if empty. The key must be of
+// the rsa-*, ecdsa-* or ed25519 type.
+func (c *Client) TransitSigner(mount, name string) (*TransitSigner, error) {
+	if mount == "" {
+		mount = "transit"
+	}
+
+	var resp struct {
+		Data struct {
+			Type          string `json:"type"`
+			LatestVersion int    `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+
+	if err := c.do("GET", path.Join(mount, "keys", name), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	key, ok := resp.Data.Keys[strconv.Itoa(resp.Data.LatestVersion)]
+	if !ok || key.PublicKey == "" {
+		return nil, fmt.Errorf("vault: transit key %q of type %q has no public key", name, resp.Data.Type)
+	}
+
+	public, err := parseTransitPublicKey(resp.Data.Type, key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("vault: transit key %q: %s", name, err)
+	}
+
+	return &TransitSigner{
+		client:  c,
+		mount:   mount,
+		name:    name,
+		version: resp.Data.LatestVersion,
+		public:  public,
+	}, nil
+}
+
+func parseTransitPublicKey(keyType, public string) (crypto.PublicKey, error) {
+	if keyType == "ed25519" {
+		p, err := base64.StdEncoding.DecodeString(public)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 public key")
+		}
+		return ed25519.PublicKey(p), nil
+	}
+
+	block, _ := pem.Decode([]byte(public))
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
+
+// Public implements the crypto.Signer interface.
+func (s *TransitSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+var transitHashes = map[crypto.Hash]string{
+	crypto.SHA224: "sha2-224",
+	crypto.SHA256: "sha2-256",
+	crypto.SHA384: "sha2-384",
+	crypto.SHA512: "sha2-512",
+}
+
+// Sign implements the crypto.Signer interface. Like the signers of the
+// crypto packages, it signs a digest with RSA and ECDSA keys, returning
+// ASN.1 encoded ECDSA signatures, and the message itself with Ed25519 keys.
+func (s *TransitSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	body := map[string]interface{}{
+		"input":       base64.StdEncoding.EncodeToString(digest),
+		"key_version": s.version,
+	}
+
+	if _, ok := s.public.(ed25519.PublicKey); !ok {
+		hash, ok := transitHashes[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("vault: unsupported hash function %v", opts.HashFunc())
+		}
+
+		body["prehashed"] = true
+		body["hash_algorithm"] = hash
+	}
+
+	if _, ok := s.public.(*rsa.PublicKey); ok {
+		body["signature_algorithm"] = "pkcs1v15"
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			body["signature_algorithm"] = "pss"
+		}
+	}
+
+	var resp struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+
+	if err := s.client.do("POST", path.Join(s.mount, "sign", s.name), body, &resp); err != nil {
+		return nil, err
+	}
+
+	// Signatures are of the vault:v<version>:<base64> form.
+	i := strings.LastIndex(resp.Data.Signature, ":")
+	if i == -1 {
+		return nil, errors.New("vault: invalid signature")
+	}
+
+	return base64.StdEncoding.DecodeString(resp.Data.Signature[i+1:])
+}
@@ -0,0 +1,195 @@
+// Package vault provides a minimal client of the HTTP API of HashiCorp Vault,
+// for keeping kite keys in its KV secrets engines and signing tokens with
+// keys which never leave its transit engine.
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a secret or key does not exist.
+var ErrNotFound = errors.New("vault: not found")
+
+// Error is an error response of Vault.
+type Error struct {
+	StatusCode int
+	Errors     []string
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("vault: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("vault: %s", strings.Join(e.Errors, "; "))
+}
+
+// Client is a client of a Vault server.
+type Client struct {
+	// Addr is the address of the server, e.g. https://vault:8200.
+	Addr string
+
+	// Token authenticates the requests.
+	Token string
+
+	// Namespace of the requests, Vault Enterprise only.
+	Namespace string
+
+	// HTTPClient is used to make the requests, a client with a timeout of
+	// 10 seconds if nil.
+	HTTPClient *http.Client
+}
+
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// NewClient returns a client configured as the vault command is, by the
+// VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE environment variables. The
+// token defaults to the one in ~/.vault-token written by "vault login".
+func NewClient() (*Client, error) {
+	c := &Client{
+		Addr:      os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+
+	if c.Addr == "" {
+		c.Addr = "https://127.0.0.1:8200"
+	}
+
+	if c.Token == "" {
+		if usr, err := user.Current(); err == nil {
+			if p, err := ioutil.ReadFile(filepath.Join(usr.HomeDir, ".vault-token")); err == nil {
+				c.Token = strings.TrimSpace(string(p))
+			}
+		}
+	}
+
+	if c.Token == "" {
+		return nil, errors.New("vault: no token given, set VAULT_TOKEN or run vault login")
+	}
+
+	return c, nil
+}
+
+// do makes a request to the API at path, e.g. secret/data/kite, and decodes
+// the response into v unless it is nil.
+func (c *Client) do(method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		p, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(p)
+	}
+
+	u := strings.TrimSuffix(c.Addr, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("X-Vault-Token", c.Token)
+	req.Header.Set("X-Vault-Request", "true")
+	if c.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = defaultHTTPClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if resp.StatusCode >= 400 {
+		e := &Error{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(e)
+		return e
+	}
+
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// isKV2 reports whether the path is a path of the data of a secret in a
+// KV version 2 engine, e.g. secret/data/kite.
+func isKV2(path string) bool {
+	return strings.Contains(strings.Trim(path, "/"), "/data/")
+}
+
+// ReadSecret returns a field of the secret at path. For secrets of a KV
+// version 2 engine the path includes the data segment, as in the API, e.g.
+// secret/data/kite for the secret kite of the engine mounted at secret.
+func (c *Client) ReadSecret(path, field string) (string, error) {
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if err := c.do("GET", path, nil, &resp); err != nil {
+		return "", err
+	}
+
+	data := resp.Data
+	if isKV2(path) {
+		// Deleted versions are returned with null data.
+		nested, ok := data["data"].(map[string]interface{})
+		if !ok {
+			return "", ErrNotFound
+		}
+		data = nested
+	}
+
+	v, ok := data[field]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("vault: field %q of %s is not a string", field, path)
+	}
+
+	return s, nil
+}
+
+// WriteSecret replaces the secret at path with one holding the field.
+func (c *Client) WriteSecret(path, field, value string) error {
+	var body interface{} = map[string]string{field: value}
+	if isKV2(path) {
+		body = map[string]interface{}{"data": body}
+	}
+
+	return c.do("POST", path, body, nil)
+}
+
+// DeleteSecret deletes the secret at path. Secrets of a KV version 2
+// engine are deleted softly and may be undeleted.
+func (c *Client) DeleteSecret(path string) error {
+	return c.do("DELETE", path, nil, nil)
+}
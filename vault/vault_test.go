@@ -0,0 +1,263 @@
+package vault_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/vault"
+)
+
+const testToken = "s.test"
+
+// fakeVault implements the parts of the Vault API the package uses, with a
+// KV version 2 engine mounted at secret and a transit engine at transit.
+type fakeVault struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+	keys    map[string]crypto.Signer
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != testToken {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	switch {
+	case strings.HasPrefix(path, "secret/data/"):
+		v.serveSecret(w, r, path)
+	case strings.HasPrefix(path, "transit/keys/"):
+		v.serveKey(w, strings.TrimPrefix(path, "transit/keys/"))
+	case strings.HasPrefix(path, "transit/sign/"):
+		v.serveSign(w, r, strings.TrimPrefix(path, "transit/sign/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (v *fakeVault) serveSecret(w http.ResponseWriter, r *http.Request, path string) {
+	switch r.Method {
+	case "GET":
+		data, ok := v.secrets[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": data, "metadata": map[string]int{"version": 1}},
+		})
+	case "POST":
+		var body struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		v.secrets[path] = body.Data
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		delete(v.secrets, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (v *fakeVault) serveKey(w http.ResponseWriter, name string) {
+	key, ok := v.keys[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	keyType, public := "ed25519", ""
+	if pub, ok := key.Public().(ed25519.PublicKey); ok {
+		public = base64.StdEncoding.EncodeToString(pub)
+	} else {
+		keyType = "ecdsa-p256"
+		if _, ok := key.Public().(*rsa.PublicKey); ok {
+			keyType = "rsa-2048"
+		}
+		der, _ := x509.MarshalPKIXPublicKey(key.Public())
+		public = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":           keyType,
+			"latest_version": 1,
+			"keys":           map[string]interface{}{"1": map[string]string{"public_key": public}},
+		},
+	})
+}
+
+func (v *fakeVault) serveSign(w http.ResponseWriter, r *http.Request, name string) {
+	var body struct {
+		Input     string `json:"input"`
+		Prehashed bool   `json:"prehashed"`
+		Hash      string `json:"hash_algorithm"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	input, _ := base64.StdEncoding.DecodeString(body.Input)
+
+	var opts crypto.SignerOpts = crypto.Hash(0)
+	if body.Prehashed && body.Hash == "sha2-256" {
+		opts = crypto.SHA256
+	}
+
+	sig, err := v.keys[name].Sign(rand.Reader, input, opts)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {err.Error()}})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": map[string]string{"signature": "vault:v1:" + base64.StdEncoding.EncodeToString(sig)},
+	})
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *vault.Client, func()) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &fakeVault{
+		secrets: make(map[string]map[string]interface{}),
+		keys: map[string]crypto.Signer{
+			"ecdsa":   ecKey,
+			"rsa":     rsaKey,
+			"ed25519": edKey,
+		},
+	}
+
+	srv := httptest.NewServer(v)
+
+	return v, &vault.Client{Addr: srv.URL, Token: testToken}, srv.Close
+}
+
+func TestSecrets(t *testing.T) {
+	_, c, done := newFakeVault(t)
+	defer done()
+
+	const path = "secret/data/kite/host"
+
+	if _, err := c.ReadSecret(path, "kite.key"); err != vault.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	if err := c.WriteSecret(path, "kite.key", "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.ReadSecret(path, "kite.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "key" {
+		t.Fatalf("got %q, want %q", got, "key")
+	}
+
+	if _, err := c.ReadSecret(path, "other"); err != vault.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound for a missing field", err)
+	}
+
+	if err := c.DeleteSecret(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ReadSecret(path, "kite.key"); err != vault.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound after delete", err)
+	}
+
+	store := &kitekey.VaultStore{Client: c, Path: path}
+	if err := store.Write("kite.key value"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Read(); err != nil || got != "kite.key value" {
+		t.Fatalf("got %q, %v from kite.key store", got, err)
+	}
+
+	c.Token = "invalid"
+	_, err = c.ReadSecret(path, "kite.key")
+	if e, ok := err.(*vault.Error); !ok || e.StatusCode != http.StatusForbidden {
+		t.Fatalf("got %v, want permission denied", err)
+	}
+}
+
+func TestTransitSigner(t *testing.T) {
+	v, c, done := newFakeVault(t)
+	defer done()
+
+	for name, want := range map[string]string{"ecdsa": "ES256", "rsa": "RS256", "ed25519": "EdDSA"} {
+		signer, err := c.TransitSigner("", name)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		token, err := kitekey.SignWith(&jwt.StandardClaims{Subject: "kontrol"}, signer)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		parsed, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+			return v.keys[name].Public(), nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if alg := parsed.Method.Alg(); alg != want {
+			t.Fatalf("%s: got %s, want %s", name, alg, want)
+		}
+	}
+
+	if _, err := c.TransitSigner("", "missing"); err != vault.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	// Transit keys are also named by vault: URIs of kitekey.NewSigner.
+	os.Setenv("VAULT_ADDR", c.Addr)
+	os.Setenv("VAULT_TOKEN", c.Token)
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	signer, err := kitekey.NewSigner("vault:transit/ecdsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := kitekey.SignWith(&jwt.StandardClaims{Subject: "kontrol"}, signer); err != nil {
+		t.Fatal(err)
+	}
+}